@@ -0,0 +1,249 @@
+// Package acl restricts who may read and edit parts of the wiki. Rules are attached to document
+// paths, either in acl.yaml in the data directory or in the "access" frontmatter of a directory's
+// document.md, and apply to the whole subtree below them.
+package acl
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"wiki-go/internal/auth"
+	"wiki-go/internal/config"
+	"wiki-go/internal/frontmatter"
+	"wiki-go/internal/roles"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule restricts a document path and everything below it
+type Rule struct {
+	Path               string `yaml:"path"`
+	frontmatter.Access `yaml:",inline"`
+}
+
+// File is the layout of acl.yaml
+type File struct {
+	Groups map[string][]string `yaml:"groups"` // Group name to usernames, on top of the wiki's groups
+	Rules  []Rule              `yaml:"rules"`
+}
+
+// cachedFile is a parsed file, kept until the file changes
+type cachedFile struct {
+	modTime time.Time
+	size    int64
+	file    File
+	access  *frontmatter.Access
+}
+
+var (
+	aclConfig *config.Config
+	mu        sync.Mutex
+
+	rulesFile cachedFile
+	rulesPath string
+	rules     map[string]frontmatter.Access // acl.yaml rules by cleaned path
+
+	// Frontmatter of the document.md files consulted so far, by file path
+	docAccess = make(map[string]cachedFile)
+)
+
+// Init makes the package read rules for the wiki configured in cfg
+func Init(cfg *config.Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	aclConfig = cfg
+	rulesPath = filepath.Join(cfg.Wiki.RootDir, "acl.yaml")
+	rulesFile = cachedFile{}
+	rules = nil
+	docAccess = make(map[string]cachedFile)
+}
+
+// Clean turns a URL or file path of a document into the form rules are matched against:
+// slash separated, relative to the documents directory, without leading or trailing slashes.
+// The homepage and the documents root are "".
+func Clean(p string) string {
+	p = strings.ReplaceAll(p, "\\", "/")
+	p = path.Clean("/" + p)
+	return strings.Trim(p, "/")
+}
+
+// loadRules rereads acl.yaml if it changed. The caller holds mu.
+func loadRules() {
+	info, err := os.Stat(rulesPath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to read %s: %v", rulesPath, err)
+		}
+		rulesFile = cachedFile{}
+		rules = nil
+		return
+	}
+	if rules != nil && info.ModTime().Equal(rulesFile.modTime) && info.Size() == rulesFile.size {
+		return
+	}
+
+	rulesFile = cachedFile{modTime: info.ModTime(), size: info.Size()}
+	rules = make(map[string]frontmatter.Access)
+
+	data, err := os.ReadFile(rulesPath)
+	if err == nil {
+		err = yaml.Unmarshal(data, &rulesFile.file)
+	}
+	if err != nil {
+		// Deny rather than silently open everything up when the rules can't be read
+		log.Printf("Failed to parse %s, denying access to everything but admins: %v", rulesPath, err)
+		rules[""] = frontmatter.Access{Read: []string{}, Write: []string{}}
+		return
+	}
+	for _, rule := range rulesFile.file.Rules {
+		rules[Clean(rule.Path)] = rule.Access
+	}
+}
+
+// directoryAccess returns the access frontmatter of the document.md of a directory. The caller holds mu.
+func directoryAccess(docPath string) *frontmatter.Access {
+	// The homepage lives outside the documents tree, so its frontmatter restricts nothing else;
+	// rules for the whole wiki go in acl.yaml
+	if docPath == "" {
+		return nil
+	}
+	file := filepath.Join(aclConfig.Wiki.RootDir, aclConfig.Wiki.DocumentsDir, filepath.FromSlash(docPath), "document.md")
+
+	info, err := os.Stat(file)
+	if err != nil {
+		delete(docAccess, file)
+		return nil
+	}
+	if cached, ok := docAccess[file]; ok && info.ModTime().Equal(cached.modTime) && info.Size() == cached.size {
+		return cached.access
+	}
+
+	cached := cachedFile{modTime: info.ModTime(), size: info.Size()}
+	if content, err := os.ReadFile(file); err == nil {
+		access, err := frontmatter.ParseAccess(string(content))
+		if err != nil {
+			// Like a broken acl.yaml, rules that can't be read deny rather than open the directory up
+			log.Printf("Failed to parse the access rules of %s, denying access to everything but admins: %v", file, err)
+			access = &frontmatter.Access{Read: []string{}, Write: []string{}}
+		}
+		cached.access = access
+	}
+	docAccess[file] = cached
+	return cached.access
+}
+
+// Effective returns the access lists that apply to a document, found by walking from the root
+// down to it. A nil list means the path is not restricted.
+func Effective(docPath string) frontmatter.Access {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var effective frontmatter.Access
+	if aclConfig == nil {
+		return effective
+	}
+	loadRules()
+
+	apply := func(access *frontmatter.Access) {
+		if access == nil {
+			return
+		}
+		if access.Read != nil {
+			effective.Read = access.Read
+		}
+		if access.Write != nil {
+			effective.Write = access.Write
+		}
+	}
+
+	docPath = Clean(docPath)
+	level := ""
+	parts := strings.Split(docPath, "/")
+	for i := 0; ; i++ {
+		if rule, ok := rules[level]; ok {
+			apply(&rule)
+		}
+		apply(directoryAccess(level))
+		if i == len(parts) || docPath == "" {
+			break
+		}
+		level = path.Join(level, parts[i])
+	}
+	return effective
+}
+
+// matches reports whether the user is one of the entries of list
+func matches(list []string, session *auth.Session) bool {
+	for _, entry := range list {
+		entry = strings.TrimSpace(entry)
+		if entry == "*" {
+			return true
+		}
+		if session == nil {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(entry, "role:"):
+			if strings.TrimPrefix(entry, "role:") == session.Role {
+				return true
+			}
+		case strings.HasPrefix(entry, "group:"):
+			if InGroup(session.Username, strings.TrimPrefix(entry, "group:")) {
+				return true
+			}
+		case entry == session.Username:
+			return true
+		}
+	}
+	return false
+}
+
+// InGroup reports whether a user is a member of a group of the wiki or of one defined in acl.yaml
+func InGroup(username, group string) bool {
+	if auth.InGroup(username, group) {
+		return true
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if aclConfig == nil {
+		return false
+	}
+	loadRules()
+	for _, member := range rulesFile.file.Groups[group] {
+		if member == username {
+			return true
+		}
+	}
+	return false
+}
+
+// CanRead reports whether the session may see a document. A nil session is an anonymous
+// visitor; whether the wiki lets those in at all is checked separately.
+func CanRead(session *auth.Session, docPath string) bool {
+	if auth.Can(session, roles.PermAccessBypass) {
+		return true
+	}
+	access := Effective(docPath)
+	return access.Read == nil || matches(access.Read, session)
+}
+
+// CanWrite reports whether the session may change a document, on top of the role allowing edits
+func CanWrite(session *auth.Session, docPath string) bool {
+	if session == nil {
+		return false
+	}
+	if auth.Can(session, roles.PermAccessBypass) {
+		return true
+	}
+	access := Effective(docPath)
+	if access.Read != nil && !matches(access.Read, session) {
+		return false
+	}
+	return access.Write == nil || matches(access.Write, session)
+}
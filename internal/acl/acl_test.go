@@ -0,0 +1,154 @@
+package acl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"wiki-go/internal/auth"
+	"wiki-go/internal/config"
+)
+
+// setupTestTree writes acl.yaml and the given document.md files into a temporary wiki
+func setupTestTree(t *testing.T, rules string, documents map[string]string) {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Wiki.RootDir = t.TempDir()
+	cfg.Wiki.DocumentsDir = "documents"
+
+	if rules != "" {
+		if err := os.WriteFile(filepath.Join(cfg.Wiki.RootDir, "acl.yaml"), []byte(rules), 0644); err != nil {
+			t.Fatalf("Failed to write acl.yaml: %v", err)
+		}
+	}
+	for docPath, content := range documents {
+		dir := filepath.Join(cfg.Wiki.RootDir, "documents", filepath.FromSlash(docPath))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", docPath, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "document.md"), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", docPath, err)
+		}
+	}
+	Init(cfg)
+}
+
+var (
+	jane  = &auth.Session{Username: "jane", Role: "editor"} // In the staff group
+	amy   = &auth.Session{Username: "amy", Role: "editor"}  // In the staff group
+	bob   = &auth.Session{Username: "bob", Role: "editor"}
+	vic   = &auth.Session{Username: "vic", Role: "viewer"}
+	admin = &auth.Session{Username: "root", Role: "admin"} // Has access.bypass
+)
+
+func TestAccess(t *testing.T) {
+	setupTestTree(t, `
+groups:
+  staff: [jane, amy]
+rules:
+  - path: /hr/
+    read: ["group:staff"]
+    write: ["group:staff"]
+  - path: public
+    write: ["role:editor"]
+`, map[string]string{
+		"open":       "# Open\n",
+		"hr/reviews": "---\naccess:\n  read: [jane]\n---\n# Reviews\n",
+		"team":       "---\naccess:\n  read: [\"*\"]\n  write: []\n---\n# Team\n",
+		"team/notes": "# Notes\n",
+		"broken":     "---\naccess:\n  read: [jane\n---\n# Broken\n",
+	})
+
+	tests := []struct {
+		name      string
+		session   *auth.Session
+		docPath   string
+		wantRead  bool
+		wantWrite bool
+	}{
+		{name: "Unrestricted for visitors", session: nil, docPath: "open", wantRead: true, wantWrite: false},
+		{name: "Unrestricted for users", session: vic, docPath: "open", wantRead: true, wantWrite: true},
+		{name: "Homepage", session: bob, docPath: "", wantRead: true, wantWrite: true},
+		{name: "Group member", session: amy, docPath: "hr", wantRead: true, wantWrite: true},
+		{name: "Outside the group", session: bob, docPath: "hr", wantRead: false, wantWrite: false},
+		{name: "Inherited by a subdirectory without a document", session: bob, docPath: "hr/policies/leave", wantRead: false, wantWrite: false},
+		{name: "Inherited group access", session: amy, docPath: "hr/policies", wantRead: true, wantWrite: true},
+		{name: "Narrowed by frontmatter", session: amy, docPath: "hr/reviews", wantRead: false, wantWrite: false},
+		{name: "User listed in frontmatter", session: jane, docPath: "hr/reviews/2024", wantRead: true, wantWrite: true},
+		{name: "Role entry", session: bob, docPath: "public/news", wantRead: true, wantWrite: true},
+		{name: "Other role", session: vic, docPath: "public/news", wantRead: true, wantWrite: false},
+		{name: "Wildcard", session: nil, docPath: "team", wantRead: true, wantWrite: false},
+		{name: "Empty write list", session: jane, docPath: "team", wantRead: true, wantWrite: false},
+		{name: "Empty write list inherited", session: jane, docPath: "team/notes", wantRead: true, wantWrite: false},
+		{name: "Broken frontmatter", session: jane, docPath: "broken", wantRead: false, wantWrite: false},
+		{name: "Below broken frontmatter", session: jane, docPath: "broken/child", wantRead: false, wantWrite: false},
+		{name: "Bypass", session: admin, docPath: "hr/reviews", wantRead: true, wantWrite: true},
+		{name: "Bypass of an empty list", session: admin, docPath: "team", wantRead: true, wantWrite: true},
+		{name: "Bypass of broken frontmatter", session: admin, docPath: "broken", wantRead: true, wantWrite: true},
+		{name: "Path spelled as a URL", session: bob, docPath: "/hr/policies/", wantRead: false, wantWrite: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := CanRead(tt.session, tt.docPath); result != tt.wantRead {
+				t.Errorf("Expected read: %t, got: %t", tt.wantRead, result)
+			}
+			if result := CanWrite(tt.session, tt.docPath); result != tt.wantWrite {
+				t.Errorf("Expected write: %t, got: %t", tt.wantWrite, result)
+			}
+		})
+	}
+}
+
+func TestEffectiveEmptyAndMissingLists(t *testing.T) {
+	setupTestTree(t, "", map[string]string{
+		"locked": "---\naccess:\n  read: []\n---\n",
+	})
+
+	if access := Effective("open"); access.Read != nil || access.Write != nil {
+		t.Errorf("Expected no lists for an unrestricted path, got: %+v", access)
+	}
+	access := Effective("locked/child")
+	if access.Read == nil || len(access.Read) != 0 {
+		t.Errorf("Expected an inherited empty read list, got: %#v", access.Read)
+	}
+	if access.Write != nil {
+		t.Errorf("Expected the missing write list to stay missing, got: %#v", access.Write)
+	}
+	if CanRead(jane, "locked/child") {
+		t.Error("Expected an empty read list to lock everyone out")
+	}
+}
+
+func TestBrokenRulesFile(t *testing.T) {
+	setupTestTree(t, "rules: [path: hr\n", nil)
+
+	if CanRead(nil, "open") || CanRead(jane, "open") || CanWrite(jane, "open") {
+		t.Error("Expected an unreadable acl.yaml to deny everyone")
+	}
+	if !CanRead(admin, "open") || !CanWrite(admin, "open") {
+		t.Error("Expected access.bypass to get through an unreadable acl.yaml")
+	}
+}
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "", expected: ""},
+		{input: "/", expected: ""},
+		{input: ".", expected: ""},
+		{input: "/docs/guide/", expected: "docs/guide"},
+		{input: `docs\guide`, expected: "docs/guide"},
+		{input: "docs/../hr", expected: "hr"},
+		{input: "../../hr", expected: "hr"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if result := Clean(tt.input); result != tt.expected {
+				t.Errorf("Expected: %q, got: %q", tt.expected, result)
+			}
+		})
+	}
+}
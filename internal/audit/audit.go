@@ -0,0 +1,198 @@
+// Package audit keeps an append-only record of who did what: logins, changes to users, roles,
+// access tokens, sessions and settings, and changes to documents, attachments and comments.
+// Entries are written as JSON lines to audit.jsonl in the wiki's root directory and are never
+// rewritten.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"wiki-go/internal/config"
+)
+
+// Outcomes of an audited action
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure" // Refused, e.g. wrong password, or failed with an error
+)
+
+// Actions. They are grouped by their prefix, which the query can filter on.
+const (
+	ActionLogin            = "auth.login"
+	ActionLoginUnban       = "auth.unban"
+	ActionUserCreate       = "user.create"
+	ActionUserUpdate       = "user.update"
+	ActionUserDelete       = "user.delete"
+	ActionUserApprove      = "user.approve"
+	ActionUser2FAReset     = "user.2fa_reset" // A user manager reset a user's second factor
+	ActionRoleSave         = "role.save"
+	ActionRoleDelete       = "role.delete"
+	ActionGroupSave        = "group.save"
+	ActionGroupDelete      = "group.delete"
+	ActionInviteCreate     = "invitation.create"
+	ActionInviteRevoke     = "invitation.revoke"
+	ActionPasswordLink     = "password.link"  // A user manager created a reset link
+	ActionPasswordEmail    = "password.email" // A reset link was requested by email
+	ActionPasswordReset    = "password.reset" // A reset link was used
+	ActionTokenCreate      = "token.create"
+	ActionTokenRevoke      = "token.revoke"
+	ActionSessionRevoke    = "session.revoke"
+	ActionSettingsWiki     = "settings.wiki"
+	ActionSettingsSecurity = "settings.security"
+	ActionDocumentCreate   = "document.create"
+	ActionDocumentSave     = "document.save"
+	ActionDocumentMove     = "document.move"
+	ActionDocumentDelete   = "document.delete"
+	ActionDocumentRestore  = "document.restore"
+	ActionFileUpload       = "file.upload"
+	ActionFileDelete       = "file.delete"
+	ActionImport           = "content.import"
+	ActionCommentDelete    = "comment.delete"
+)
+
+// Entry is a single audited action
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Actor   string    `json:"actor,omitempty"` // Username, empty for anonymous requests
+	IP      string    `json:"ip,omitempty"`
+	Action  string    `json:"action"`
+	Target  string    `json:"target,omitempty"` // Document path, file, username or setting the action applies to
+	Outcome string    `json:"outcome"`
+	Details string    `json:"details,omitempty"`
+}
+
+// Filter selects entries for Query. Empty fields match everything.
+type Filter struct {
+	Actor   string
+	IP      string
+	Action  string // Exact action, or a group such as "user" for all user actions
+	Target  string // Prefix of the target
+	Outcome string
+	Since   time.Time
+	Until   time.Time
+	Limit   int // Maximum number of entries returned, newest first; 0 means no limit
+}
+
+var (
+	mu   sync.Mutex
+	file *os.File
+	path string
+)
+
+// Init opens cfg.Wiki.RootDir/audit.jsonl for appending
+func Init(cfg *config.Config) error {
+	p := filepath.Join(cfg.Wiki.RootDir, "audit.jsonl")
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if file != nil {
+		file.Close()
+	}
+	file, path = f, p
+	return nil
+}
+
+// Record appends an entry to the log. Failing to write it doesn't fail the action; it is logged
+// instead.
+func Record(entry Entry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	if entry.Outcome == "" {
+		entry.Outcome = OutcomeSuccess
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Warning: failed to encode audit entry: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	mu.Lock()
+	defer mu.Unlock()
+	if file == nil {
+		return
+	}
+	// A single write per entry keeps lines whole even if the process dies halfway through
+	if _, err := file.Write(line); err != nil {
+		log.Printf("Warning: failed to write audit entry %s on %s: %v", entry.Action, entry.Target, err)
+	}
+}
+
+// Query returns the entries that match the filter, newest first
+func Query(filter Filter) ([]Entry, error) {
+	mu.Lock()
+	p := path
+	mu.Unlock()
+	if p == "" {
+		return nil, errors.New("audit log is not initialized")
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue // A line cut short by a crash
+		}
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// The file is in chronological order
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[:filter.Limit]
+	}
+	return entries, nil
+}
+
+func (f Filter) matches(entry Entry) bool {
+	if f.Actor != "" && !strings.EqualFold(f.Actor, entry.Actor) {
+		return false
+	}
+	if f.IP != "" && f.IP != entry.IP {
+		return false
+	}
+	if f.Action != "" && f.Action != entry.Action && !strings.HasPrefix(entry.Action, f.Action+".") {
+		return false
+	}
+	if f.Target != "" && !strings.HasPrefix(entry.Target, f.Target) {
+		return false
+	}
+	if f.Outcome != "" && f.Outcome != entry.Outcome {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && entry.Time.After(f.Until) {
+		return false
+	}
+	return true
+}
@@ -2,26 +2,227 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 	"wiki-go/internal/config"
 	"wiki-go/internal/crypto"
+	"wiki-go/internal/users"
 )
 
 // Session represents a user session
 type Session struct {
-	Username  string
-	Role      string  // User role: "admin", "editor", or "viewer"
-	CreatedAt time.Time
+	Username     string    `json:"username"`
+	Role         string    `json:"role"` // User role: "admin", "editor", or "viewer"
+	CreatedAt    time.Time `json:"createdAt"`
+	LastSeen     time.Time `json:"lastSeen"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	KeepLoggedIn bool      `json:"keepLoggedIn"`
+	IP           string    `json:"ip"`        // Address the session was last used from
+	UserAgent    string    `json:"userAgent"` // Browser the session was created in
+	TokenID      string    `json:"-"`         // Personal access token the request was made with, if any
+	TokenPath    string    `json:"-"`         // Document path the token is limited to
+	ViaProxy     bool      `json:"-"`         // Authenticated by the headers of a trusted reverse proxy
+	ReadOnly     bool      `json:"-"`         // Made with a read token, which doesn't get group permissions
 }
 
+// SessionInfo describes a session for listing, without its token
+type SessionInfo struct {
+	ID string `json:"id"`
+	Session
+}
+
+// lastSeenResolution is how stale LastSeen may get before it is updated and written to disk,
+// so that a busy session doesn't rewrite the sessions file on every request
+const lastSeenResolution = time.Minute
+
+// sessionGCInterval is how often expired sessions are removed
+const sessionGCInterval = 10 * time.Minute
+
 var (
+	// Sessions are keyed by the SHA-256 hash of their token, so the tokens themselves never touch the disk
 	sessions = make(map[string]Session)
 	mu       sync.RWMutex
+
+	sessionsFile string
+	persistMu    sync.Mutex
+	gcOnce       sync.Once
+
+	absoluteTimeout   = 24 * time.Hour
+	persistentTimeout = 30 * 24 * time.Hour
+	idleTimeout       = 7 * 24 * time.Hour
 )
 
+// InitSessions loads the sessions saved in cfg.Wiki.RootDir/sessions.json, applies the timeouts
+// from the config and starts removing expired sessions in the background
+func InitSessions(cfg *config.Config) error {
+	if cfg.Security.Sessions.AbsoluteTimeoutHours > 0 {
+		absoluteTimeout = time.Duration(cfg.Security.Sessions.AbsoluteTimeoutHours) * time.Hour
+	}
+	if cfg.Security.Sessions.PersistentTimeoutDays > 0 {
+		persistentTimeout = time.Duration(cfg.Security.Sessions.PersistentTimeoutDays) * 24 * time.Hour
+	}
+	idleTimeout = time.Duration(cfg.Security.Sessions.IdleTimeoutHours) * time.Hour
+
+	path := filepath.Join(cfg.Wiki.RootDir, "sessions.json")
+
+	loaded := make(map[string]Session)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+
+	mu.Lock()
+	sessionsFile = path
+	sessions = loaded
+	mu.Unlock()
+
+	removeExpiredSessions()
+
+	gcOnce.Do(func() {
+		go func() {
+			for range time.Tick(sessionGCInterval) {
+				removeExpiredSessions()
+			}
+		}()
+	})
+
+	return nil
+}
+
+// hashToken returns the key a session token is stored under
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// expired reports whether the session has passed its absolute or idle timeout
+func (s Session) expired(now time.Time) bool {
+	if now.After(s.ExpiresAt) {
+		return true
+	}
+	return idleTimeout > 0 && now.Sub(s.LastSeen) > idleTimeout
+}
+
+// removeExpiredSessions deletes expired sessions and saves the result when anything changed
+func removeExpiredSessions() {
+	now := time.Now()
+	removed := false
+
+	mu.Lock()
+	for key, session := range sessions {
+		if session.expired(now) {
+			delete(sessions, key)
+			removed = true
+		}
+	}
+	mu.Unlock()
+
+	if removed {
+		saveSessions()
+	}
+}
+
+// saveSessions writes the sessions to disk
+func saveSessions() {
+	persistMu.Lock()
+	defer persistMu.Unlock()
+
+	// Take the snapshot while holding persistMu, so that the last write always has the latest state
+	mu.RLock()
+	path := sessionsFile
+	data, err := json.Marshal(sessions)
+	mu.RUnlock()
+
+	if path == "" {
+		return // Sessions are kept in memory only until InitSessions is called
+	}
+	if err != nil {
+		log.Printf("Warning: failed to encode sessions: %v", err)
+		return
+	}
+
+	if err := writeFileAtomic(path, data); err != nil {
+		log.Printf("Warning: failed to save sessions: %v", err)
+	}
+}
+
+// writeFileAtomic replaces a file readable only by its owner, through a temporary file that is
+// renamed over it, so that a crash while writing never leaves a truncated file behind
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0600)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	return err
+}
+
+// ClientIP extracts the real client IP address. Forwarding headers are only believed from the
+// configured trusted proxies, so clients can't pick their own address to dodge the login ban.
+func ClientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if !isTrustedProxy(ip) {
+		// Forwarding headers from anyone else are made up by the client
+		return ip
+	}
+
+	// X-Forwarded-For lists every hop; walk it back from the proxy that connected to us and
+	// take the first address that isn't one of our own proxies
+	if header := r.Header.Get("X-Forwarded-For"); header != "" {
+		hops := strings.Split(header, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			ip = hop
+			if !isTrustedProxy(hop) {
+				return hop
+			}
+		}
+		return ip
+	}
+	if real := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(real) != nil {
+		return real
+	}
+	return ip
+}
+
 // GenerateSessionToken generates a random session token
 func GenerateSessionToken() (string, error) {
 	b := make([]byte, 32)
@@ -33,26 +234,39 @@ func GenerateSessionToken() (string, error) {
 }
 
 // CreateSession creates a new session for the user
-func CreateSession(w http.ResponseWriter, username string, role string, keepLoggedIn bool, cfg *config.Config) error {
+func CreateSession(w http.ResponseWriter, r *http.Request, username string, role string, keepLoggedIn bool, cfg *config.Config) error {
 	token, err := GenerateSessionToken()
 	if err != nil {
 		return err
 	}
 
+	// Sessions expire on the server at the same time as their cookie
+	lifetime := absoluteTimeout
+	if keepLoggedIn {
+		lifetime = persistentTimeout
+	}
+
+	now := time.Now()
 	mu.Lock()
-	sessions[token] = Session{
-		Username:  username,
-		Role:      role,
-		CreatedAt: time.Now(),
+	sessions[hashToken(token)] = Session{
+		Username:     username,
+		Role:         role,
+		CreatedAt:    now,
+		LastSeen:     now,
+		ExpiresAt:    now.Add(lifetime),
+		KeepLoggedIn: keepLoggedIn,
+		IP:           ClientIP(r),
+		UserAgent:    r.UserAgent(),
 	}
 	mu.Unlock()
+	saveSessions()
 
-	// Set cookie expiration time based on keepLoggedIn flag
-	maxAge := 3600 * 24 // 24 hours by default
-	if keepLoggedIn {
-		maxAge = 3600 * 24 * 30 // 30 days for persistent login
+	if err := users.RecordLogin(username); err != nil {
+		log.Printf("Warning: failed to record login of %s: %v", username, err)
 	}
 
+	maxAge := int(lifetime.Seconds())
+
 	// Set the secure HTTP-only session token cookie
 	http.SetCookie(w, &http.Cookie{
 		Name:     "session_token",
@@ -78,23 +292,50 @@ func CreateSession(w http.ResponseWriter, username string, role string, keepLogg
 	return nil
 }
 
-// GetSession retrieves the session for the current request
+// GetSession retrieves the session for the current request. Requests with an
+// Authorization: Bearer header are authenticated by that personal access token alone.
 func GetSession(r *http.Request) *Session {
+	if raw, ok := bearerToken(r); ok {
+		return tokenSession(r, raw)
+	}
+	if session := proxySession(r); session != nil {
+		return session
+	}
+
 	c, err := r.Cookie("session_token")
 	if err != nil {
 		return nil
 	}
+	key := hashToken(c.Value)
 
 	mu.RLock()
-	session, exists := sessions[c.Value]
+	session, exists := sessions[key]
 	mu.RUnlock()
 
 	if !exists {
 		return nil
 	}
 
-	// Session expiration is now handled by cookie expiration time
-	// which is set in CreateSession based on the keepLoggedIn parameter
+	// Expiry is enforced here as well as by the cookie, a copied cookie must not outlive the session
+	now := time.Now()
+	if session.expired(now) {
+		mu.Lock()
+		delete(sessions, key)
+		mu.Unlock()
+		saveSessions()
+		return nil
+	}
+
+	if now.Sub(session.LastSeen) > lastSeenResolution {
+		session.LastSeen = now
+		session.IP = ClientIP(r)
+		mu.Lock()
+		if _, exists := sessions[key]; exists {
+			sessions[key] = session
+		}
+		mu.Unlock()
+		saveSessions()
+	}
 
 	return &session
 }
@@ -107,8 +348,9 @@ func ClearSession(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
 	}
 
 	mu.Lock()
-	delete(sessions, c.Value)
+	delete(sessions, hashToken(c.Value))
 	mu.Unlock()
+	saveSessions()
 
 	// Clear the session token cookie
 	http.SetCookie(w, &http.Cookie{
@@ -131,16 +373,78 @@ func ClearSession(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
 	})
 }
 
-// ValidateCredentials validates user credentials against the config
-func ValidateCredentials(username, password string, cfg *config.Config) (bool, string) {
-	for _, user := range cfg.Users {
-		if user.Username == username && crypto.CheckPasswordHash(password, user.Password) {
-			// Use the user's role
-			role := user.Role
-			return true, role
+// SessionID returns the ID of the request's session, or "" if it has none
+func SessionID(r *http.Request) string {
+	c, err := r.Cookie("session_token")
+	if err != nil {
+		return ""
+	}
+	return hashToken(c.Value)
+}
+
+// ListSessions returns the active sessions of a user, most recently used first
+func ListSessions(username string) []SessionInfo {
+	now := time.Now()
+	list := []SessionInfo{}
+
+	mu.RLock()
+	for id, session := range sessions {
+		if session.Username == username && !session.expired(now) {
+			list = append(list, SessionInfo{ID: id, Session: session})
+		}
+	}
+	mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LastSeen.After(list[j].LastSeen)
+	})
+	return list
+}
+
+// RevokeSession ends a session of the user. It returns false if the user has no session with that ID.
+func RevokeSession(username, id string) bool {
+	mu.Lock()
+	session, exists := sessions[id]
+	if exists && session.Username == username {
+		delete(sessions, id)
+	}
+	mu.Unlock()
+
+	if !exists || session.Username != username {
+		return false
+	}
+	saveSessions()
+	return true
+}
+
+// RevokeUserSessions ends all sessions of the user except the one with the given ID, which may be ""
+// to end all of them, and returns how many sessions were ended
+func RevokeUserSessions(username, except string) int {
+	count := 0
+
+	mu.Lock()
+	for id, session := range sessions {
+		if session.Username == username && id != except {
+			delete(sessions, id)
+			count++
 		}
 	}
-	return false, ""
+	mu.Unlock()
+
+	if count > 0 {
+		saveSessions()
+	}
+	return count
+}
+
+// ValidateCredentials validates user credentials against the user store. Disabled users and
+// users waiting for approval are refused.
+func ValidateCredentials(username, password string) (bool, string) {
+	user, found := users.Get(username)
+	if !found || user.Disabled || user.Pending || !crypto.CheckPasswordHash(password, user.Password) {
+		return false, ""
+	}
+	return true, user.Role
 }
 
 // CheckAuth verifies if the user is authenticated and returns their session
@@ -161,22 +465,3 @@ func RequireAuth(r *http.Request, cfg *config.Config) bool {
 	return session != nil
 }
 
-// RequireRole checks if user has required role or higher
-func RequireRole(r *http.Request, requiredRole string) bool {
-	session := GetSession(r)
-	if session == nil {
-		return false
-	}
-
-	// Role hierarchy: admin > editor > viewer
-	switch requiredRole {
-	case "admin":
-		return session.Role == "admin"
-	case "editor":
-		return session.Role == "admin" || session.Role == "editor"
-	case "viewer":
-		return session.Role == "admin" || session.Role == "editor" || session.Role == "viewer"
-	default:
-		return false
-	}
-}
@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"wiki-go/internal/config"
+	"wiki-go/internal/users"
+)
+
+// setupSessionStore loads the sessions of a temporary wiki with the given idle timeout and
+// returns its config. The timeouts are put back when the test ends.
+func setupSessionStore(t *testing.T, idleHours int) *config.Config {
+	t.Helper()
+	absolute, persistent, idle := absoluteTimeout, persistentTimeout, idleTimeout
+	t.Cleanup(func() {
+		absoluteTimeout, persistentTimeout, idleTimeout = absolute, persistent, idle
+	})
+
+	cfg := &config.Config{}
+	cfg.Wiki.RootDir = t.TempDir()
+	cfg.Server.AllowInsecureCookies = true
+	cfg.Security.Sessions.AbsoluteTimeoutHours = 2
+	cfg.Security.Sessions.PersistentTimeoutDays = 3
+	cfg.Security.Sessions.IdleTimeoutHours = idleHours
+	if err := users.Init(filepath.Join(cfg.Wiki.RootDir, "users.json")); err != nil {
+		t.Fatalf("Failed to open the user store: %v", err)
+	}
+	if err := InitSessions(cfg); err != nil {
+		t.Fatalf("Failed to load sessions: %v", err)
+	}
+	return cfg
+}
+
+// login creates a session and returns its raw token
+func login(t *testing.T, cfg *config.Config, username string, keepLoggedIn bool) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+	if err := CreateSession(rec, r, username, "editor", keepLoggedIn, cfg); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "session_token" {
+			return c.Value
+		}
+	}
+	t.Fatal("Expected a session_token cookie")
+	return ""
+}
+
+// requestWithToken returns a request that carries a session cookie
+func requestWithToken(token string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/docs/page", nil)
+	r.AddCookie(&http.Cookie{Name: "session_token", Value: token})
+	return r
+}
+
+// readSessionsFile returns the sessions saved on disk
+func readSessionsFile(t *testing.T, cfg *config.Config) (map[string]Session, string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(cfg.Wiki.RootDir, "sessions.json"))
+	if err != nil {
+		t.Fatalf("Failed to read sessions file: %v", err)
+	}
+	saved := make(map[string]Session)
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("Failed to parse sessions file: %v", err)
+	}
+	return saved, string(data)
+}
+
+// setSession changes a stored session, as if time had passed since it was last used
+func setSession(token string, change func(*Session)) {
+	mu.Lock()
+	session := sessions[hashToken(token)]
+	change(&session)
+	sessions[hashToken(token)] = session
+	mu.Unlock()
+}
+
+func TestSessionStoredByHash(t *testing.T) {
+	cfg := setupSessionStore(t, 0)
+	token := login(t, cfg, "jane", false)
+
+	saved, raw := readSessionsFile(t, cfg)
+	if strings.Contains(raw, token) {
+		t.Error("Expected the session token not to be written to disk")
+	}
+	session, found := saved[hashToken(token)]
+	if !found || session.Username != "jane" {
+		t.Fatalf("Expected the session under the hash of its token, got: %v", saved)
+	}
+	if id := SessionID(requestWithToken(token)); id != hashToken(token) {
+		t.Errorf("Expected the session ID to be the hash of the token, got: %s", id)
+	}
+
+	info, err := os.Stat(filepath.Join(cfg.Wiki.RootDir, "sessions.json"))
+	if err != nil {
+		t.Fatalf("Expected the sessions file to exist: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("Expected mode 0600, got: %o", mode)
+	}
+
+	// A request made with the stored key instead of the token finds nothing
+	if session := GetSession(requestWithToken(hashToken(token))); session != nil {
+		t.Error("Expected the hash not to work as a token")
+	}
+}
+
+func TestSessionLifetime(t *testing.T) {
+	cfg := setupSessionStore(t, 0)
+
+	tests := []struct {
+		name         string
+		keepLoggedIn bool
+		expected     time.Duration
+	}{
+		{name: "Browser session", keepLoggedIn: false, expected: 2 * time.Hour},
+		{name: "Keep me logged in", keepLoggedIn: true, expected: 3 * 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := login(t, cfg, "jane", tt.keepLoggedIn)
+			mu.RLock()
+			session := sessions[hashToken(token)]
+			mu.RUnlock()
+			if lifetime := session.ExpiresAt.Sub(session.CreatedAt); lifetime != tt.expected {
+				t.Errorf("Expected lifetime %s, got: %s", tt.expected, lifetime)
+			}
+		})
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	cfg := setupSessionStore(t, 1)
+
+	tests := []struct {
+		name     string
+		change   func(*Session)
+		expected bool // Whether the session is still valid
+	}{
+		{name: "Fresh", change: func(*Session) {}, expected: true},
+		{name: "Past its absolute timeout", change: func(s *Session) {
+			s.ExpiresAt = time.Now().Add(-time.Second)
+		}, expected: false},
+		{name: "Idle too long", change: func(s *Session) {
+			s.LastSeen = time.Now().Add(-2 * time.Hour)
+		}, expected: false},
+		{name: "Idle, but not for long", change: func(s *Session) {
+			s.LastSeen = time.Now().Add(-30 * time.Minute)
+		}, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := login(t, cfg, "jane", false)
+			setSession(token, tt.change)
+
+			session := GetSession(requestWithToken(token))
+			if (session != nil) != tt.expected {
+				t.Fatalf("Expected valid: %t, got session: %+v", tt.expected, session)
+			}
+			saved, _ := readSessionsFile(t, cfg)
+			if _, found := saved[hashToken(token)]; found != tt.expected {
+				t.Errorf("Expected the session on disk: %t, got: %t", tt.expected, found)
+			}
+		})
+	}
+}
+
+func TestSessionIdleTimeoutOff(t *testing.T) {
+	cfg := setupSessionStore(t, 0)
+	token := login(t, cfg, "jane", true)
+	setSession(token, func(s *Session) {
+		s.LastSeen = time.Now().Add(-48 * time.Hour)
+	})
+
+	if session := GetSession(requestWithToken(token)); session == nil {
+		t.Error("Expected no idle timeout when it is set to 0")
+	}
+}
+
+func TestLastSeenUpdated(t *testing.T) {
+	cfg := setupSessionStore(t, 1)
+	token := login(t, cfg, "jane", false)
+	stale := time.Now().Add(-10 * time.Minute)
+	setSession(token, func(s *Session) { s.LastSeen = stale })
+
+	if session := GetSession(requestWithToken(token)); session == nil || !session.LastSeen.After(stale) {
+		t.Fatalf("Expected LastSeen to be moved forward, got: %+v", session)
+	}
+	saved, _ := readSessionsFile(t, cfg)
+	if !saved[hashToken(token)].LastSeen.After(stale) {
+		t.Error("Expected the new LastSeen to be saved")
+	}
+}
+
+func TestRemoveExpiredSessions(t *testing.T) {
+	cfg := setupSessionStore(t, 1)
+	active := login(t, cfg, "jane", false)
+	expired := login(t, cfg, "jane", false)
+	idle := login(t, cfg, "bob", true)
+	setSession(expired, func(s *Session) { s.ExpiresAt = time.Now().Add(-time.Minute) })
+	setSession(idle, func(s *Session) { s.LastSeen = time.Now().Add(-3 * time.Hour) })
+
+	removeExpiredSessions()
+
+	saved, _ := readSessionsFile(t, cfg)
+	if len(saved) != 1 {
+		t.Fatalf("Expected 1 session left on disk, got: %d", len(saved))
+	}
+	if _, found := saved[hashToken(active)]; !found {
+		t.Error("Expected the active session to be kept")
+	}
+	if list := ListSessions("bob"); len(list) != 0 {
+		t.Errorf("Expected bob's idle session to be gone, got: %v", list)
+	}
+}
+
+func TestSessionsReload(t *testing.T) {
+	cfg := setupSessionStore(t, 1)
+	token := login(t, cfg, "jane", true)
+	expired := login(t, cfg, "bob", false)
+	setSession(expired, func(s *Session) { s.ExpiresAt = time.Now().Add(-time.Minute) })
+	saveSessions()
+
+	// A restart loads the saved sessions, leaving out the expired ones
+	mu.Lock()
+	sessions = make(map[string]Session)
+	mu.Unlock()
+	if err := InitSessions(cfg); err != nil {
+		t.Fatalf("Failed to reload sessions: %v", err)
+	}
+
+	session := GetSession(requestWithToken(token))
+	if session == nil {
+		t.Fatal("Expected the session to survive a restart")
+	}
+	if session.Username != "jane" || session.Role != "editor" || !session.KeepLoggedIn {
+		t.Errorf("Expected the session to round trip, got: %+v", session)
+	}
+	if list := ListSessions("bob"); len(list) != 0 {
+		t.Errorf("Expected the expired session to be dropped, got: %v", list)
+	}
+	saved, _ := readSessionsFile(t, cfg)
+	if _, found := saved[hashToken(expired)]; found {
+		t.Error("Expected the expired session to be removed from disk on load")
+	}
+}
+
+func TestSessionsBrokenFile(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Wiki.RootDir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(cfg.Wiki.RootDir, "sessions.json"), []byte("{broken"), 0600); err != nil {
+		t.Fatalf("Failed to write sessions file: %v", err)
+	}
+	absolute, persistent, idle := absoluteTimeout, persistentTimeout, idleTimeout
+	defer func() { absoluteTimeout, persistentTimeout, idleTimeout = absolute, persistent, idle }()
+
+	if err := InitSessions(cfg); err == nil {
+		t.Error("Expected an error for a sessions file that doesn't parse")
+	}
+}
@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"wiki-go/internal/config"
+)
+
+// Invitation lets a new user create their own account with a preset role. It can be used once;
+// only a SHA-256 hash of its secret is stored.
+type Invitation struct {
+	ID        string    `json:"id"`
+	Hash      string    `json:"hash,omitempty"`
+	Role      string    `json:"role"`
+	Note      string    `json:"note,omitempty"` // Who the invitation is for, as a reminder for admins
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// ErrInvalidInvitation is returned for invitations that don't exist, were used or expired
+var ErrInvalidInvitation = errors.New("the invitation is invalid or has expired")
+
+var (
+	invitations   = make(map[string]*Invitation)
+	invitationsMu sync.Mutex
+
+	invitationsFile string
+)
+
+// InitInvitations loads the open invitations saved in cfg.Wiki.RootDir/invitations.json
+func InitInvitations(cfg *config.Config) error {
+	path := filepath.Join(cfg.Wiki.RootDir, "invitations.json")
+
+	loaded := make(map[string]*Invitation)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+
+	invitationsMu.Lock()
+	invitationsFile = path
+	invitations = loaded
+	invitationsMu.Unlock()
+
+	return nil
+}
+
+// saveInvitationsLocked writes the invitations to disk, dropping expired ones. invitationsMu
+// must be held.
+func saveInvitationsLocked() {
+	now := time.Now()
+	for id, invitation := range invitations {
+		if now.After(invitation.ExpiresAt) {
+			delete(invitations, id)
+		}
+	}
+
+	if invitationsFile == "" {
+		return
+	}
+	data, err := json.Marshal(invitations)
+	if err != nil {
+		log.Printf("Warning: failed to encode invitations: %v", err)
+		return
+	}
+	if err := writeFileAtomic(invitationsFile, data); err != nil {
+		log.Printf("Warning: failed to save invitations: %v", err)
+	}
+}
+
+// newOneTimeSecret returns a short ID to refer to a one-time link, such as an invitation or a
+// password reset, and the secret that goes into the link
+func newOneTimeSecret() (string, string, error) {
+	idBytes := make([]byte, 6)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", "", err
+	}
+	secret, err := GenerateSessionToken()
+	if err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(idBytes), secret, nil
+}
+
+// CreateInvitation creates an invitation for the given role. The returned secret is the only
+// copy, it goes into the invitation link and can't be recovered later.
+func CreateInvitation(createdBy, role, note string, ttl time.Duration) (string, *Invitation, error) {
+	if !RoleExists(role) {
+		return "", nil, fmt.Errorf("%w %q", ErrUnknownRole, role)
+	}
+
+	id, secret, err := newOneTimeSecret()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	invitation := &Invitation{
+		ID:        id,
+		Hash:      hashToken(secret),
+		Role:      role,
+		Note:      note,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	invitationsMu.Lock()
+	invitations[invitation.ID] = invitation
+	saveInvitationsLocked()
+	invitationsMu.Unlock()
+
+	info := *invitation
+	info.Hash = ""
+	return secret, &info, nil
+}
+
+// ListInvitations returns the open invitations, newest first, without their hashes
+func ListInvitations() []Invitation {
+	now := time.Now()
+	list := []Invitation{}
+
+	invitationsMu.Lock()
+	for _, invitation := range invitations {
+		if now.After(invitation.ExpiresAt) {
+			continue
+		}
+		info := *invitation
+		info.Hash = ""
+		list = append(list, info)
+	}
+	invitationsMu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+// RevokeInvitation deletes an invitation. It returns false if there is none with that ID.
+func RevokeInvitation(id string) bool {
+	invitationsMu.Lock()
+	defer invitationsMu.Unlock()
+
+	if _, exists := invitations[id]; !exists {
+		return false
+	}
+	delete(invitations, id)
+	saveInvitationsLocked()
+	return true
+}
+
+// findInvitationLocked returns the open invitation with the given secret. invitationsMu must
+// be held.
+func findInvitationLocked(secret string) *Invitation {
+	hash := hashToken(secret)
+	for _, invitation := range invitations {
+		if invitation.Hash == hash && time.Now().Before(invitation.ExpiresAt) {
+			return invitation
+		}
+	}
+	return nil
+}
+
+// LookupInvitation returns the open invitation with the given secret without using it
+func LookupInvitation(secret string) (Invitation, error) {
+	invitationsMu.Lock()
+	defer invitationsMu.Unlock()
+
+	invitation := findInvitationLocked(secret)
+	if secret == "" || invitation == nil {
+		return Invitation{}, ErrInvalidInvitation
+	}
+	info := *invitation
+	info.Hash = ""
+	return info, nil
+}
+
+// UseInvitation checks an invitation and calls create with it. The invitation is deleted when
+// create succeeds, so that it can only be used once; concurrent uses wait for each other.
+func UseInvitation(secret string, create func(Invitation) error) error {
+	invitationsMu.Lock()
+	defer invitationsMu.Unlock()
+
+	invitation := findInvitationLocked(secret)
+	if secret == "" || invitation == nil {
+		return ErrInvalidInvitation
+	}
+	if err := create(*invitation); err != nil {
+		return err
+	}
+	delete(invitations, invitation.ID)
+	saveInvitationsLocked()
+	return nil
+}
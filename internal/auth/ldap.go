@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"wiki-go/internal/config"
+	"wiki-go/internal/ldap"
+)
+
+// ldapTimeout bounds every step of a directory login
+const ldapTimeout = 10 * time.Second
+
+// ErrLDAPNoRole is returned when a directory user is in none of the configured groups and
+// there is no default role
+var ErrLDAPNoRole = errors.New("user has no role in the wiki")
+
+// LDAPEnabled reports whether users can log in with their directory password
+func LDAPEnabled(cfg *config.Config) bool {
+	l := cfg.Security.LDAP
+	return l.Enabled && l.URL != "" && (l.UserDNTemplate != "" || l.BaseDN != "")
+}
+
+// AuthenticateLDAP checks a username and password against the directory and returns the role
+// the user's groups map to. Wrong passwords and unknown users return ldap.ErrInvalidCredentials.
+func AuthenticateLDAP(cfg *config.Config, username, password string) (string, error) {
+	l := cfg.Security.LDAP
+	if username == "" || password == "" {
+		return "", ldap.ErrInvalidCredentials
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: l.InsecureSkipVerify}
+	conn, err := ldap.Dial(l.URL, tlsConfig, ldapTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if l.StartTLS && strings.HasPrefix(strings.ToLower(l.URL), "ldap://") {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			return "", err
+		}
+	}
+
+	groupAttribute := l.GroupAttribute
+	if groupAttribute == "" {
+		groupAttribute = "memberOf"
+	}
+
+	var entry ldap.Entry
+	if l.UserDNTemplate != "" {
+		// Bind as the user, then read their groups from their own entry
+		userDN := strings.ReplaceAll(l.UserDNTemplate, "%s", ldap.EscapeDN(username))
+		if err := conn.Bind(userDN, password); err != nil {
+			return "", err
+		}
+		entries, err := conn.Search(userDN, ldap.ScopeBaseObject, "(objectClass=*)", []string{groupAttribute}, 1)
+		if err != nil {
+			return "", err
+		}
+		if len(entries) == 1 {
+			entry = entries[0]
+		}
+	} else {
+		// Find the user with the service account, then check their password
+		if l.BindDN != "" {
+			if err := conn.Bind(l.BindDN, l.BindPassword); err != nil {
+				return "", fmt.Errorf("service account bind failed: %w", err)
+			}
+		}
+		filter := l.UserFilter
+		if filter == "" {
+			filter = "(uid=%s)"
+		}
+		filter = strings.ReplaceAll(filter, "%s", ldap.EscapeFilter(username))
+
+		entries, err := conn.Search(l.BaseDN, ldap.ScopeWholeSubtree, filter, []string{groupAttribute}, 2)
+		if err != nil {
+			return "", err
+		}
+		if len(entries) != 1 {
+			return "", ldap.ErrInvalidCredentials
+		}
+		entry = entries[0]
+
+		if err := conn.Bind(entry.DN, password); err != nil {
+			return "", err
+		}
+	}
+
+	role := ldapRole(cfg, entry.Get(groupAttribute))
+	if role == "" {
+		return "", ErrLDAPNoRole
+	}
+	return role, nil
+}
+
+// ldapRole maps the groups of a directory user to a wiki role. Groups are configured by their
+// full DN or by their name, the value of the first component of the DN, separated by semicolons
+// as DNs contain commas.
+func ldapRole(cfg *config.Config, groups []string) string {
+	l := cfg.Security.LDAP
+
+	inGroup := func(list string) bool {
+		for _, want := range strings.Split(list, ";") {
+			want = strings.TrimSpace(want)
+			if want == "" {
+				continue
+			}
+			for _, group := range groups {
+				if strings.EqualFold(group, want) || strings.EqualFold(groupName(group), want) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	switch {
+	case inGroup(l.AdminGroups):
+		return config.RoleAdmin
+	case inGroup(l.EditorGroups):
+		return config.RoleEditor
+	}
+
+	if l.DefaultRole != "" && RoleExists(l.DefaultRole) {
+		return l.DefaultRole
+	}
+	return ""
+}
+
+// groupName returns the value of the first component of a DN, so cn=editors,ou=groups,dc=example
+// becomes editors
+func groupName(dn string) string {
+	first := dn
+	if i := strings.IndexByte(dn, ','); i >= 0 {
+		first = dn[:i]
+	}
+	if _, value, ok := strings.Cut(first, "="); ok {
+		return strings.TrimSpace(value)
+	}
+	return first
+}
@@ -0,0 +1,512 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"wiki-go/internal/config"
+)
+
+// oidcFlowTimeout is how long a user has to complete the login at the provider
+const oidcFlowTimeout = 10 * time.Minute
+
+// oidcClockSkew is the tolerance when checking the time claims of an ID token
+const oidcClockSkew = 2 * time.Minute
+
+// oidcHTTPClient talks to the provider's discovery, JWKS and token endpoints
+var oidcHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// oidcProvider holds the endpoints of the provider, read from its discovery document
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcFlow is a login that was sent to the provider and hasn't come back yet
+type oidcFlow struct {
+	Nonce        string
+	CodeVerifier string
+	Next         string
+	ExpiresAt    time.Time
+}
+
+var (
+	oidcMu       sync.Mutex
+	oidcIssuer   string // Issuer the cached provider and keys belong to
+	oidcMeta     *oidcProvider
+	oidcKeys     map[string]crypto.PublicKey
+	oidcKeysTime time.Time
+	oidcFlows    = make(map[string]oidcFlow)
+)
+
+// OIDCEnabled reports whether single sign-on is configured
+func OIDCEnabled(cfg *config.Config) bool {
+	oidc := cfg.Security.OIDC
+	return oidc.Enabled && oidc.Issuer != "" && oidc.ClientID != "" && oidc.RedirectURL != ""
+}
+
+// randomURLString returns n random bytes encoded for use in URLs
+func randomURLString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// oidcDiscover returns the provider's endpoints, fetching the discovery document on first use
+func oidcDiscover(ctx context.Context, cfg *config.Config) (*oidcProvider, error) {
+	issuer := strings.TrimSuffix(cfg.Security.OIDC.Issuer, "/")
+
+	oidcMu.Lock()
+	if oidcMeta != nil && oidcIssuer == issuer {
+		meta := oidcMeta
+		oidcMu.Unlock()
+		return meta, nil
+	}
+	oidcMu.Unlock()
+
+	var meta oidcProvider
+	if err := oidcGetJSON(ctx, issuer+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, fmt.Errorf("provider discovery failed: %w", err)
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("provider reports issuer %q, expected %q", meta.Issuer, issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("provider discovery document is missing endpoints")
+	}
+
+	oidcMu.Lock()
+	oidcIssuer = issuer
+	oidcMeta = &meta
+	oidcKeys = nil
+	oidcKeysTime = time.Time{} // The keys of another issuer don't hold back fetching these
+	oidcMu.Unlock()
+
+	return &meta, nil
+}
+
+// oidcGetJSON fetches and decodes a JSON document
+func oidcGetJSON(ctx context.Context, rawURL string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", rawURL, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// StartOIDCLogin begins a login at the provider. It returns the URL to send the browser to and
+// the state that identifies the login when the provider redirects back.
+func StartOIDCLogin(ctx context.Context, cfg *config.Config, next string) (string, string, error) {
+	meta, err := oidcDiscover(ctx, cfg)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomURLString(24)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomURLString(24)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomURLString(32)
+	if err != nil {
+		return "", "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	now := time.Now()
+	oidcMu.Lock()
+	for key, flow := range oidcFlows {
+		if now.After(flow.ExpiresAt) {
+			delete(oidcFlows, key)
+		}
+	}
+	oidcFlows[state] = oidcFlow{
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		Next:         next,
+		ExpiresAt:    now.Add(oidcFlowTimeout),
+	}
+	oidcMu.Unlock()
+
+	scopes := cfg.Security.OIDC.Scopes
+	if !strings.Contains(" "+scopes+" ", " openid ") {
+		scopes = strings.TrimSpace("openid " + scopes)
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", cfg.Security.OIDC.ClientID)
+	params.Set("redirect_uri", cfg.Security.OIDC.RedirectURL)
+	params.Set("scope", scopes)
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	params.Set("code_challenge_method", "S256")
+
+	authURL := meta.AuthorizationEndpoint
+	if strings.Contains(authURL, "?") {
+		authURL += "&" + params.Encode()
+	} else {
+		authURL += "?" + params.Encode()
+	}
+	return authURL, state, nil
+}
+
+// OIDCIdentity is the user the provider vouched for
+type OIDCIdentity struct {
+	Username string
+	Subject  string // The sub claim, which unlike the username can't be changed at the provider
+	Claims   map[string]interface{}
+	Next     string // Where to send the user after logging in
+}
+
+// FinishOIDCLogin completes the login identified by state: it redeems the authorization code
+// and verifies the ID token that comes back.
+func FinishOIDCLogin(ctx context.Context, cfg *config.Config, state, code string) (*OIDCIdentity, error) {
+	oidcMu.Lock()
+	flow, exists := oidcFlows[state]
+	delete(oidcFlows, state)
+	oidcMu.Unlock()
+
+	if !exists || time.Now().After(flow.ExpiresAt) {
+		return nil, errors.New("login request expired or unknown")
+	}
+
+	meta, err := oidcDiscover(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, err := oidcExchangeCode(ctx, cfg, meta, code, flow.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := oidcVerifyIDToken(ctx, cfg, meta, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	if nonce, _ := claims["nonce"].(string); nonce != flow.Nonce {
+		return nil, errors.New("ID token nonce mismatch")
+	}
+
+	usernameClaim := cfg.Security.OIDC.UsernameClaim
+	if usernameClaim == "" {
+		usernameClaim = "preferred_username"
+	}
+	username, _ := claims[usernameClaim].(string)
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, fmt.Errorf("ID token has no %q claim", usernameClaim)
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, errors.New("ID token has no sub claim")
+	}
+
+	return &OIDCIdentity{Username: username, Subject: subject, Claims: claims, Next: flow.Next}, nil
+}
+
+// oidcExchangeCode redeems an authorization code at the token endpoint and returns the ID token
+func oidcExchangeCode(ctx context.Context, cfg *config.Config, meta *oidcProvider, code, verifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", cfg.Security.OIDC.RedirectURL)
+	form.Set("code_verifier", verifier)
+
+	// Confidential clients authenticate with HTTP basic auth, public clients send their ID
+	secret := cfg.Security.OIDC.ClientSecret
+	if secret == "" {
+		form.Set("client_id", cfg.Security.OIDC.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if secret != "" {
+		req.SetBasicAuth(url.QueryEscape(cfg.Security.OIDC.ClientID), url.QueryEscape(secret))
+	}
+
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return "", fmt.Errorf("token endpoint returned %s: %s %s", resp.Status, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", errors.New("token endpoint returned no ID token")
+	}
+	return body.IDToken, nil
+}
+
+// oidcVerifyIDToken checks the signature, issuer, audience and lifetime of an ID token and
+// returns its claims
+func oidcVerifyIDToken(ctx context.Context, cfg *config.Config, meta *oidcProvider, raw string) (map[string]interface{}, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed ID token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed ID token header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed ID token signature: %w", err)
+	}
+
+	key, err := oidcKey(ctx, meta, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	switch header.Alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature) != nil {
+			return nil, errors.New("invalid ID token signature")
+		}
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return nil, errors.New("invalid ID token signature")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return nil, errors.New("invalid ID token signature")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported ID token algorithm %q", header.Alg)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed ID token claims: %w", err)
+	}
+
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != strings.TrimSuffix(meta.Issuer, "/") {
+		return nil, errors.New("ID token issuer mismatch")
+	}
+	if !containsString(ClaimValues(claims, "aud"), cfg.Security.OIDC.ClientID) {
+		return nil, errors.New("ID token audience mismatch")
+	}
+
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(oidcClockSkew)) {
+		return nil, errors.New("ID token expired")
+	}
+	if iat, ok := claims["iat"].(float64); ok && time.Unix(int64(iat), 0).After(now.Add(oidcClockSkew)) {
+		return nil, errors.New("ID token issued in the future")
+	}
+
+	return claims, nil
+}
+
+// decodeJWTPart decodes a base64url encoded JSON part of a JWT
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// oidcKey returns the provider's signing key with the given ID. The key set is fetched again
+// when it doesn't have the key, as providers rotate keys, but at most once a minute.
+func oidcKey(ctx context.Context, meta *oidcProvider, kid string) (crypto.PublicKey, error) {
+	oidcMu.Lock()
+	key, ok := lookupKey(oidcKeys, kid)
+	fresh := time.Since(oidcKeysTime) < time.Minute
+	oidcMu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if fresh {
+		return nil, fmt.Errorf("unknown ID token signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := oidcGetJSON(ctx, meta.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+			if errN != nil || errE != nil || len(e) > 4 {
+				continue
+			}
+			keys[jwk.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "EC":
+			if jwk.Crv != "P-256" {
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[jwk.Kid] = &ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+		}
+	}
+
+	oidcMu.Lock()
+	oidcKeys = keys
+	oidcKeysTime = time.Now()
+	oidcMu.Unlock()
+
+	if key, ok := lookupKey(keys, kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown ID token signing key %q", kid)
+}
+
+// lookupKey finds a key by ID. Tokens without a key ID match a key set holding a single key.
+func lookupKey(keys map[string]crypto.PublicKey, kid string) (crypto.PublicKey, bool) {
+	if key, ok := keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// ClaimValues returns a claim as a list of strings. Providers send groups and roles either as a
+// single string or as an array.
+func ClaimValues(claims map[string]interface{}, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// OIDCRole maps the role claim of an identity to a wiki role. It returns an empty string when
+// the user matches no role and there is no default.
+func OIDCRole(cfg *config.Config, identity *OIDCIdentity) string {
+	oidc := cfg.Security.OIDC
+	values := ClaimValues(identity.Claims, oidc.RoleClaim)
+
+	matches := func(list string) bool {
+		for _, want := range strings.Split(list, ",") {
+			want = strings.TrimSpace(want)
+			if want != "" && containsString(values, want) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case matches(oidc.AdminValues):
+		return config.RoleAdmin
+	case matches(oidc.EditorValues):
+		return config.RoleEditor
+	}
+
+	if oidc.DefaultRole != "" && RoleExists(oidc.DefaultRole) {
+		return oidc.DefaultRole
+	}
+	return ""
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"wiki-go/internal/config"
+)
+
+// testProvider is an OpenID provider whose token endpoint returns the ID token the test sets
+type testProvider struct {
+	server  *httptest.Server
+	key     *rsa.PrivateKey
+	idToken string
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	p := &testProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"id_token": p.idToken})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// sign returns a JWT with the given header and claims, signed with RS256 by key
+func sign(t *testing.T, key *rsa.PrivateKey, header, claims map[string]interface{}) string {
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("Failed to encode JWT part: %v", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(header) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign JWT: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestFinishOIDCLogin(t *testing.T) {
+	provider := newTestProvider(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Security.OIDC.Enabled = true
+	cfg.Security.OIDC.Issuer = provider.server.URL
+	cfg.Security.OIDC.ClientID = "wiki"
+	cfg.Security.OIDC.RedirectURL = "https://wiki.example.com/oidc/callback"
+
+	tests := []struct {
+		name    string
+		modify  func(header, claims map[string]interface{}) // Changes a valid token
+		key     *rsa.PrivateKey                             // Signing key, the provider's when nil
+		wantErr string
+	}{
+		{name: "Valid token"},
+		{name: "Audience list", modify: func(_, c map[string]interface{}) { c["aud"] = []string{"other", "wiki"} }},
+		{name: "Wrong signing key", key: otherKey, wantErr: "invalid ID token signature"},
+		{name: "Unsigned", modify: func(h, _ map[string]interface{}) { h["alg"] = "none" }, wantErr: "unsupported ID token algorithm"},
+		{name: "HMAC", modify: func(h, _ map[string]interface{}) { h["alg"] = "HS256" }, wantErr: "unsupported ID token algorithm"},
+		{name: "Unknown key ID", modify: func(h, _ map[string]interface{}) { h["kid"] = "other" }, wantErr: "unknown ID token signing key"},
+		{name: "Wrong issuer", modify: func(_, c map[string]interface{}) { c["iss"] = "https://evil.example.com" }, wantErr: "issuer mismatch"},
+		{name: "Wrong audience", modify: func(_, c map[string]interface{}) { c["aud"] = "other" }, wantErr: "audience mismatch"},
+		{name: "Expired", modify: func(_, c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, wantErr: "expired"},
+		{name: "No expiry", modify: func(_, c map[string]interface{}) { delete(c, "exp") }, wantErr: "expired"},
+		{name: "Issued in the future", modify: func(_, c map[string]interface{}) { c["iat"] = time.Now().Add(time.Hour).Unix() }, wantErr: "issued in the future"},
+		{name: "Wrong nonce", modify: func(_, c map[string]interface{}) { c["nonce"] = "replayed" }, wantErr: "nonce mismatch"},
+		{name: "No nonce", modify: func(_, c map[string]interface{}) { delete(c, "nonce") }, wantErr: "nonce mismatch"},
+		{name: "No subject", modify: func(_, c map[string]interface{}) { delete(c, "sub") }, wantErr: "no sub claim"},
+		{name: "No username", modify: func(_, c map[string]interface{}) { delete(c, "preferred_username") }, wantErr: "no \"preferred_username\" claim"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authURL, state, err := StartOIDCLogin(context.Background(), cfg, "/")
+			if err != nil {
+				t.Fatalf("Failed to start login: %v", err)
+			}
+			parsed, err := url.Parse(authURL)
+			if err != nil {
+				t.Fatalf("Invalid authorization URL %q: %v", authURL, err)
+			}
+
+			header := map[string]interface{}{"alg": "RS256", "kid": "test"}
+			claims := map[string]interface{}{
+				"iss":                provider.server.URL,
+				"aud":                "wiki",
+				"sub":                "248289761001",
+				"preferred_username": "jane",
+				"nonce":              parsed.Query().Get("nonce"),
+				"iat":                time.Now().Unix(),
+				"exp":                time.Now().Add(time.Hour).Unix(),
+			}
+			if tt.modify != nil {
+				tt.modify(header, claims)
+			}
+			key := tt.key
+			if key == nil {
+				key = provider.key
+			}
+			provider.idToken = sign(t, key, header, claims)
+
+			identity, err := FinishOIDCLogin(context.Background(), cfg, state, "code")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected an error containing %q, got: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected the login to succeed, got: %v", err)
+			}
+			if identity.Username != "jane" || identity.Subject != "248289761001" {
+				t.Errorf("Expected jane with subject 248289761001, got: %s with %s", identity.Username, identity.Subject)
+			}
+		})
+	}
+}
+
+func TestFinishOIDCLoginUnknownState(t *testing.T) {
+	if _, err := FinishOIDCLogin(context.Background(), &config.Config{}, "unknown", "code"); err == nil {
+		t.Error("Expected an error for a login that was never started")
+	}
+}
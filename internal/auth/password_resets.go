@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"wiki-go/internal/config"
+)
+
+// PasswordReset lets a user set a new password without knowing the current one. Like
+// invitations it can be used once and only a SHA-256 hash of its secret is stored.
+type PasswordReset struct {
+	ID        string    `json:"id"`
+	Hash      string    `json:"hash,omitempty"`
+	Username  string    `json:"username"`
+	CreatedBy string    `json:"createdBy"` // The admin who created it, or the user who requested it by email
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// ErrInvalidPasswordReset is returned for reset links that don't exist, were used or expired
+var ErrInvalidPasswordReset = errors.New("the password reset link is invalid or has expired")
+
+var (
+	passwordResets   = make(map[string]*PasswordReset)
+	passwordResetsMu sync.Mutex
+
+	passwordResetsFile string
+)
+
+// InitPasswordResets loads the open reset links saved in cfg.Wiki.RootDir/password_resets.json
+func InitPasswordResets(cfg *config.Config) error {
+	path := filepath.Join(cfg.Wiki.RootDir, "password_resets.json")
+
+	loaded := make(map[string]*PasswordReset)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+
+	passwordResetsMu.Lock()
+	passwordResetsFile = path
+	passwordResets = loaded
+	passwordResetsMu.Unlock()
+
+	return nil
+}
+
+// savePasswordResetsLocked writes the reset links to disk, dropping expired ones.
+// passwordResetsMu must be held.
+func savePasswordResetsLocked() {
+	now := time.Now()
+	for id, reset := range passwordResets {
+		if now.After(reset.ExpiresAt) {
+			delete(passwordResets, id)
+		}
+	}
+
+	if passwordResetsFile == "" {
+		return
+	}
+	data, err := json.Marshal(passwordResets)
+	if err != nil {
+		log.Printf("Warning: failed to encode password resets: %v", err)
+		return
+	}
+	if err := writeFileAtomic(passwordResetsFile, data); err != nil {
+		log.Printf("Warning: failed to save password resets: %v", err)
+	}
+}
+
+// CreatePasswordReset creates a reset link for the user, replacing the earlier ones of the same
+// creator so that only their newest link works. Links from someone else are kept: an email request
+// doesn't cancel the link an admin handed out. The returned secret is the only copy.
+func CreatePasswordReset(username, createdBy string, ttl time.Duration) (string, *PasswordReset, error) {
+	id, secret, err := newOneTimeSecret()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	reset := &PasswordReset{
+		ID:        id,
+		Hash:      hashToken(secret),
+		Username:  username,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	passwordResetsMu.Lock()
+	deleteUserPasswordResetsLocked(username, createdBy)
+	passwordResets[reset.ID] = reset
+	savePasswordResetsLocked()
+	passwordResetsMu.Unlock()
+
+	info := *reset
+	info.Hash = ""
+	return secret, &info, nil
+}
+
+// PasswordResetCreatedSince reports whether createdBy created a reset link for the user after since
+// that is still open
+func PasswordResetCreatedSince(username, createdBy string, since time.Time) bool {
+	passwordResetsMu.Lock()
+	defer passwordResetsMu.Unlock()
+
+	now := time.Now()
+	for _, reset := range passwordResets {
+		if reset.Username == username && reset.CreatedBy == createdBy && reset.CreatedAt.After(since) && now.Before(reset.ExpiresAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// RevokePasswordResets deletes the open reset links of the user
+func RevokePasswordResets(username string) {
+	passwordResetsMu.Lock()
+	defer passwordResetsMu.Unlock()
+
+	if deleteUserPasswordResetsLocked(username, "") {
+		savePasswordResetsLocked()
+	}
+}
+
+// RevokePasswordReset deletes a single reset link
+func RevokePasswordReset(id string) {
+	passwordResetsMu.Lock()
+	defer passwordResetsMu.Unlock()
+
+	if _, ok := passwordResets[id]; ok {
+		delete(passwordResets, id)
+		savePasswordResetsLocked()
+	}
+}
+
+// deleteUserPasswordResetsLocked deletes the reset links of the user created by createdBy, or all
+// of them when createdBy is empty, and reports whether there were any. passwordResetsMu must be
+// held.
+func deleteUserPasswordResetsLocked(username, createdBy string) bool {
+	deleted := false
+	for id, reset := range passwordResets {
+		if reset.Username == username && (createdBy == "" || reset.CreatedBy == createdBy) {
+			delete(passwordResets, id)
+			deleted = true
+		}
+	}
+	return deleted
+}
+
+// findPasswordResetLocked returns the open reset link with the given secret. passwordResetsMu
+// must be held.
+func findPasswordResetLocked(secret string) *PasswordReset {
+	hash := hashToken(secret)
+	for _, reset := range passwordResets {
+		if reset.Hash == hash && time.Now().Before(reset.ExpiresAt) {
+			return reset
+		}
+	}
+	return nil
+}
+
+// LookupPasswordReset returns the open reset link with the given secret without using it
+func LookupPasswordReset(secret string) (PasswordReset, error) {
+	passwordResetsMu.Lock()
+	defer passwordResetsMu.Unlock()
+
+	reset := findPasswordResetLocked(secret)
+	if secret == "" || reset == nil {
+		return PasswordReset{}, ErrInvalidPasswordReset
+	}
+	info := *reset
+	info.Hash = ""
+	return info, nil
+}
+
+// UsePasswordReset checks a reset link and calls apply with it. The link is deleted when apply
+// succeeds, so that it can only be used once; concurrent uses wait for each other.
+func UsePasswordReset(secret string, apply func(PasswordReset) error) error {
+	passwordResetsMu.Lock()
+	defer passwordResetsMu.Unlock()
+
+	reset := findPasswordResetLocked(secret)
+	if secret == "" || reset == nil {
+		return ErrInvalidPasswordReset
+	}
+	if err := apply(*reset); err != nil {
+		return err
+	}
+	delete(passwordResets, reset.ID)
+	savePasswordResetsLocked()
+	return nil
+}
@@ -0,0 +1,384 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"wiki-go/internal/config"
+	"wiki-go/internal/roles"
+)
+
+// CustomRole is a role defined by an admin as a set of permissions
+type CustomRole struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+// RoleInfo describes a built-in or custom role for listing
+type RoleInfo struct {
+	CustomRole
+	Builtin bool `json:"builtin"`
+}
+
+// Group is a named set of users. Members get the permissions of the group's roles on top of
+// their own, and access rules can name the group.
+type Group struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Members     []string `json:"members"`
+	Roles       []string `json:"roles,omitempty"`
+}
+
+// permissionsData is the layout of roles.json
+type permissionsData struct {
+	Roles  []CustomRole `json:"roles"`
+	Groups []Group      `json:"groups"`
+}
+
+// Errors returned when changing roles and groups
+var (
+	ErrInvalidName       = errors.New("names may only contain lowercase letters, digits, dots, dashes and underscores")
+	ErrBuiltinRole       = errors.New("built-in roles can't be changed")
+	ErrUnknownRole       = errors.New("unknown role")
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrUnknownGroup      = errors.New("unknown group")
+)
+
+// validName matches the names of custom roles and groups
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+var (
+	customRoles = make(map[string]CustomRole)
+	groups      = make(map[string]Group)
+	permsMu     sync.RWMutex
+
+	permissionsFile    string
+	permissionsPersist sync.Mutex
+)
+
+// InitPermissions loads the custom roles and groups saved in cfg.Wiki.RootDir/roles.json
+func InitPermissions(cfg *config.Config) error {
+	path := filepath.Join(cfg.Wiki.RootDir, "roles.json")
+
+	var loaded permissionsData
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+
+	permsMu.Lock()
+	permissionsFile = path
+	customRoles = make(map[string]CustomRole)
+	for _, role := range loaded.Roles {
+		if !roles.IsBuiltin(role.Name) {
+			customRoles[role.Name] = role
+		}
+	}
+	groups = make(map[string]Group)
+	for _, group := range loaded.Groups {
+		groups[group.Name] = group
+	}
+	permsMu.Unlock()
+
+	return nil
+}
+
+// savePermissions writes the custom roles and groups to disk
+func savePermissions() error {
+	permissionsPersist.Lock()
+	defer permissionsPersist.Unlock()
+
+	permsMu.RLock()
+	path := permissionsFile
+	data := permissionsData{Roles: []CustomRole{}, Groups: []Group{}}
+	for _, role := range customRoles {
+		data.Roles = append(data.Roles, role)
+	}
+	for _, group := range groups {
+		data.Groups = append(data.Groups, group)
+	}
+	permsMu.RUnlock()
+
+	if path == "" {
+		return nil
+	}
+	sort.Slice(data.Roles, func(i, j int) bool { return data.Roles[i].Name < data.Roles[j].Name })
+	sort.Slice(data.Groups, func(i, j int) bool { return data.Groups[i].Name < data.Groups[j].Name })
+
+	encoded, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, encoded)
+}
+
+// RoleExists reports whether role is a built-in or custom role
+func RoleExists(role string) bool {
+	if roles.IsBuiltin(role) {
+		return true
+	}
+	permsMu.RLock()
+	defer permsMu.RUnlock()
+	_, exists := customRoles[role]
+	return exists
+}
+
+// RolePermissions returns the permissions of a role, nil for unknown roles
+func RolePermissions(role string) []string {
+	if preset, ok := roles.Presets[role]; ok {
+		return preset
+	}
+	permsMu.RLock()
+	defer permsMu.RUnlock()
+	return customRoles[role].Permissions
+}
+
+// ListRoles returns the built-in roles followed by the custom ones, sorted by name
+func ListRoles() []RoleInfo {
+	list := []RoleInfo{}
+	for _, name := range []string{roles.RoleAdmin, roles.RoleEditor, roles.RoleViewer} {
+		list = append(list, RoleInfo{
+			CustomRole: CustomRole{Name: name, Permissions: roles.Presets[name]},
+			Builtin:    true,
+		})
+	}
+
+	permsMu.RLock()
+	custom := make([]RoleInfo, 0, len(customRoles))
+	for _, role := range customRoles {
+		custom = append(custom, RoleInfo{CustomRole: role})
+	}
+	permsMu.RUnlock()
+
+	sort.Slice(custom, func(i, j int) bool { return custom[i].Name < custom[j].Name })
+	return append(list, custom...)
+}
+
+// SaveRole creates or replaces a custom role
+func SaveRole(role CustomRole) error {
+	if !validName.MatchString(role.Name) {
+		return ErrInvalidName
+	}
+	if roles.IsBuiltin(role.Name) {
+		return ErrBuiltinRole
+	}
+
+	// Keep the permissions in their canonical order, without duplicates
+	wanted := make(map[string]bool)
+	for _, permission := range role.Permissions {
+		if !roles.IsPermission(permission) {
+			return fmt.Errorf("%w %q", ErrUnknownPermission, permission)
+		}
+		wanted[permission] = true
+	}
+	role.Permissions = []string{}
+	for _, permission := range roles.Permissions {
+		if wanted[permission] {
+			role.Permissions = append(role.Permissions, permission)
+		}
+	}
+
+	permsMu.Lock()
+	customRoles[role.Name] = role
+	permsMu.Unlock()
+	return savePermissions()
+}
+
+// DeleteRole removes a custom role. Callers make sure no user has the role any more.
+func DeleteRole(name string) error {
+	if roles.IsBuiltin(name) {
+		return ErrBuiltinRole
+	}
+
+	permsMu.Lock()
+	if _, exists := customRoles[name]; !exists {
+		permsMu.Unlock()
+		return ErrUnknownRole
+	}
+	delete(customRoles, name)
+	for key, group := range groups {
+		group.Roles = removeString(group.Roles, name)
+		groups[key] = group
+	}
+	permsMu.Unlock()
+	return savePermissions()
+}
+
+// ListGroups returns the groups sorted by name
+func ListGroups() []Group {
+	permsMu.RLock()
+	list := make([]Group, 0, len(groups))
+	for _, group := range groups {
+		list = append(list, group)
+	}
+	permsMu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// SaveGroup creates or replaces a group
+func SaveGroup(group Group) error {
+	if !validName.MatchString(group.Name) {
+		return ErrInvalidName
+	}
+	for _, role := range group.Roles {
+		if !RoleExists(role) {
+			return fmt.Errorf("%w %q", ErrUnknownRole, role)
+		}
+	}
+	if group.Members == nil {
+		group.Members = []string{}
+	}
+
+	permsMu.Lock()
+	groups[group.Name] = group
+	permsMu.Unlock()
+	return savePermissions()
+}
+
+// DeleteGroup removes a group
+func DeleteGroup(name string) error {
+	permsMu.Lock()
+	if _, exists := groups[name]; !exists {
+		permsMu.Unlock()
+		return ErrUnknownGroup
+	}
+	delete(groups, name)
+	permsMu.Unlock()
+	return savePermissions()
+}
+
+// RemoveGroupMember takes a deleted user out of every group
+func RemoveGroupMember(username string) {
+	permsMu.Lock()
+	changed := false
+	for key, group := range groups {
+		if !containsString(group.Members, username) {
+			continue
+		}
+		group.Members = removeString(group.Members, username)
+		groups[key] = group
+		changed = true
+	}
+	permsMu.Unlock()
+
+	if changed {
+		if err := savePermissions(); err != nil {
+			log.Printf("Warning: failed to save groups: %v", err)
+		}
+	}
+}
+
+// InGroup reports whether a user is a member of a group
+func InGroup(username, group string) bool {
+	permsMu.RLock()
+	defer permsMu.RUnlock()
+	return containsString(groups[group].Members, username)
+}
+
+// UserGroups returns the names of the groups a user is a member of
+func UserGroups(username string) []string {
+	permsMu.RLock()
+	defer permsMu.RUnlock()
+	names := []string{}
+	for _, group := range groups {
+		if containsString(group.Members, username) {
+			names = append(names, group.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Permissions returns what a session may do: the permissions of the user's role and of the
+// roles of their groups, in canonical order. Read-only tokens only get their own viewer role.
+func Permissions(session *Session) []string {
+	if session == nil {
+		return nil
+	}
+
+	granted := make(map[string]bool)
+	for _, permission := range RolePermissions(session.Role) {
+		granted[permission] = true
+	}
+	if !session.ReadOnly {
+		permsMu.RLock()
+		for _, group := range groups {
+			if !containsString(group.Members, session.Username) {
+				continue
+			}
+			for _, role := range group.Roles {
+				if preset, ok := roles.Presets[role]; ok {
+					for _, permission := range preset {
+						granted[permission] = true
+					}
+					continue
+				}
+				for _, permission := range customRoles[role].Permissions {
+					granted[permission] = true
+				}
+			}
+		}
+		permsMu.RUnlock()
+	}
+
+	list := []string{}
+	for _, permission := range roles.Permissions {
+		if granted[permission] {
+			list = append(list, permission)
+		}
+	}
+	return list
+}
+
+// Can reports whether the session has a permission
+func Can(session *Session, permission string) bool {
+	return containsString(Permissions(session), permission)
+}
+
+// RequirePermission checks if the user of the request has a permission
+func RequirePermission(r *http.Request, permission string) bool {
+	return Can(GetSession(r), permission)
+}
+
+// managesWiki reports whether a set of permissions reaches the wiki's settings or users
+func managesWiki(permissions []string) bool {
+	return containsString(permissions, roles.PermSettingsManage) || containsString(permissions, roles.PermUserManage)
+}
+
+// InterfaceRole returns the built-in role whose interface fits a set of permissions. Scripts and
+// styles that only know the three presets use it to show the editing tools.
+func InterfaceRole(permissions []string) string {
+	if !containsString(permissions, roles.PermPageEdit) {
+		return roles.RoleViewer
+	}
+	if managesWiki(permissions) {
+		return roles.RoleAdmin
+	}
+	return roles.RoleEditor
+}
+
+// removeString returns list without any occurrence of s
+func removeString(list []string, s string) []string {
+	var kept []string
+	for _, item := range list {
+		if item != s {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"wiki-go/internal/config"
+	"wiki-go/internal/users"
+)
+
+var (
+	proxyConfig *config.Config
+	proxyMu     sync.Mutex
+
+	// The parsed trusted_proxies setting, reparsed when the setting changes
+	trustedRaw  string
+	trustedNets []*net.IPNet
+)
+
+// InitReverseProxy makes the auth package follow the reverse proxy settings of cfg. The settings
+// are read on every request, so changes saved later take effect immediately.
+func InitReverseProxy(cfg *config.Config) {
+	proxyMu.Lock()
+	proxyConfig = cfg
+	proxyMu.Unlock()
+}
+
+// parseTrustedProxies parses a comma separated list of addresses and CIDRs, skipping invalid entries
+func parseTrustedProxies(list string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil {
+				bits := 8 * net.IPv6len
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 8*net.IPv4len
+				}
+				nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			}
+			continue
+		}
+		if _, n, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, n)
+		}
+	}
+	return nets
+}
+
+// isTrustedProxy reports whether ip belongs to one of the configured trusted proxies
+func isTrustedProxy(ip string) bool {
+	proxyMu.Lock()
+	defer proxyMu.Unlock()
+
+	if proxyConfig == nil {
+		return false
+	}
+	if raw := proxyConfig.Security.ReverseProxy.TrustedProxies; raw != trustedRaw {
+		trustedRaw = raw
+		trustedNets = parseTrustedProxies(raw)
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range trustedNets {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the address the request's connection comes from
+func remoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr // as-is (unlikely path)
+}
+
+// proxySession returns a session for the user named in the headers of a trusted authenticating
+// proxy, or nil when the request doesn't come through one
+func proxySession(r *http.Request) *Session {
+	proxyMu.Lock()
+	cfg := proxyConfig
+	proxyMu.Unlock()
+	if cfg == nil || !cfg.Security.ReverseProxy.AuthEnabled {
+		return nil
+	}
+
+	settings := cfg.Security.ReverseProxy
+	username := strings.TrimSpace(r.Header.Get(settings.UserHeader))
+	if username == "" || !isTrustedProxy(remoteIP(r)) {
+		return nil
+	}
+
+	var groups []string
+	if settings.GroupsHeader != "" {
+		for _, group := range strings.Split(r.Header.Get(settings.GroupsHeader), ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				groups = append(groups, group)
+			}
+		}
+	}
+
+	role := proxyRole(cfg, groups)
+	if role == "" {
+		return nil
+	}
+	if user, found := users.Get(username); found && user.Disabled {
+		return nil
+	}
+
+	now := time.Now()
+	return &Session{
+		Username:  username,
+		Role:      role,
+		CreatedAt: now,
+		LastSeen:  now,
+		IP:        ClientIP(r),
+		UserAgent: r.UserAgent(),
+		ViaProxy:  true,
+	}
+}
+
+// proxyRole maps the groups sent by the proxy to a wiki role. It returns an empty string when
+// the user is in no mapped group and there is no default.
+func proxyRole(cfg *config.Config, groups []string) string {
+	settings := cfg.Security.ReverseProxy
+
+	matches := func(list string) bool {
+		for _, want := range strings.Split(list, ",") {
+			want = strings.TrimSpace(want)
+			if want != "" && containsString(groups, want) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case matches(settings.AdminGroups):
+		return config.RoleAdmin
+	case matches(settings.EditorGroups):
+		return config.RoleEditor
+	}
+
+	if settings.DefaultRole != "" && RoleExists(settings.DefaultRole) {
+		return settings.DefaultRole
+	}
+	return ""
+}
@@ -0,0 +1,376 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"wiki-go/internal/config"
+	"wiki-go/internal/crypto"
+	"wiki-go/internal/users"
+)
+
+// Token scopes
+const (
+	ScopeRead  = "read"  // Safe methods only, with viewer access
+	ScopeWrite = "write" // Everything the owner's role allows
+)
+
+// tokenPrefix starts every personal access token, which makes them easy to recognise in scripts and logs
+const tokenPrefix = "wgo_"
+
+// APIToken is a personal access token. Only a bcrypt hash of the secret is stored.
+type APIToken struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Username  string     `json:"username"`
+	Hash      string     `json:"hash,omitempty"`
+	Scope     string     `json:"scope"`          // ScopeRead or ScopeWrite
+	Path      string     `json:"path,omitempty"` // Document path the token is limited to, empty for the whole wiki
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"` // Nil for tokens that don't expire
+	LastUsed  *time.Time `json:"lastUsed,omitempty"`
+}
+
+var (
+	tokens   = make(map[string]*APIToken)
+	tokensMu sync.RWMutex
+
+	// verifiedTokens caches the SHA-256 of tokens that passed the bcrypt check, keyed to their ID,
+	// so that scripts making many requests don't pay for bcrypt on every one of them
+	verifiedTokens = make(map[string]string)
+
+	tokensFile    string
+	tokensPersist sync.Mutex
+)
+
+// InitTokens loads the personal access tokens saved in cfg.Wiki.RootDir/tokens.json
+func InitTokens(cfg *config.Config) error {
+	path := filepath.Join(cfg.Wiki.RootDir, "tokens.json")
+
+	loaded := make(map[string]*APIToken)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+
+	tokensMu.Lock()
+	tokensFile = path
+	tokens = loaded
+	verifiedTokens = make(map[string]string)
+	tokensMu.Unlock()
+
+	return nil
+}
+
+// saveTokens writes the tokens to disk
+func saveTokens() {
+	tokensPersist.Lock()
+	defer tokensPersist.Unlock()
+
+	tokensMu.RLock()
+	path := tokensFile
+	data, err := json.Marshal(tokens)
+	tokensMu.RUnlock()
+
+	if path == "" {
+		return
+	}
+	if err != nil {
+		log.Printf("Warning: failed to encode tokens: %v", err)
+		return
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		log.Printf("Warning: failed to save tokens: %v", err)
+	}
+}
+
+// normalizeTokenPath cleans a document path for comparison, without leading or trailing slashes
+func normalizeTokenPath(p string) string {
+	p = filepath.ToSlash(filepath.Clean("/" + strings.TrimSpace(p)))
+	return strings.Trim(p, "/")
+}
+
+// CreateToken creates a personal access token for the user. The returned token is the only
+// copy of the secret, it can't be recovered later.
+func CreateToken(username, name, scope, path string, expiresAt *time.Time) (string, *APIToken, error) {
+	if scope != ScopeRead && scope != ScopeWrite {
+		return "", nil, fmt.Errorf("invalid scope %q", scope)
+	}
+
+	idBytes := make([]byte, 6)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", nil, err
+	}
+	secret, err := GenerateSessionToken()
+	if err != nil {
+		return "", nil, err
+	}
+	hash, err := crypto.HashPassword(secret)
+	if err != nil {
+		return "", nil, err
+	}
+
+	token := &APIToken{
+		ID:        hex.EncodeToString(idBytes),
+		Name:      name,
+		Username:  username,
+		Hash:      hash,
+		Scope:     scope,
+		Path:      normalizeTokenPath(path),
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+
+	tokensMu.Lock()
+	tokens[token.ID] = token
+	tokensMu.Unlock()
+	saveTokens()
+
+	info := *token
+	info.Hash = ""
+	return tokenPrefix + token.ID + "_" + secret, &info, nil
+}
+
+// ListTokens returns the tokens of a user, newest first, without their hashes
+func ListTokens(username string) []APIToken {
+	list := []APIToken{}
+
+	tokensMu.RLock()
+	for _, token := range tokens {
+		if token.Username == username {
+			info := *token
+			info.Hash = ""
+			list = append(list, info)
+		}
+	}
+	tokensMu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+// RevokeToken deletes a token of the user. It returns false if the user has no token with that ID.
+func RevokeToken(username, id string) bool {
+	tokensMu.Lock()
+	token, exists := tokens[id]
+	if exists && token.Username == username {
+		deleteTokenLocked(id)
+	}
+	tokensMu.Unlock()
+
+	if !exists || token.Username != username {
+		return false
+	}
+	saveTokens()
+	return true
+}
+
+// RevokeUserTokens deletes all tokens of the user and returns how many were deleted
+func RevokeUserTokens(username string) int {
+	count := 0
+
+	tokensMu.Lock()
+	for id, token := range tokens {
+		if token.Username == username {
+			deleteTokenLocked(id)
+			count++
+		}
+	}
+	tokensMu.Unlock()
+
+	if count > 0 {
+		saveTokens()
+	}
+	return count
+}
+
+// deleteTokenLocked removes a token and its cached verifications. tokensMu must be held.
+func deleteTokenLocked(id string) {
+	delete(tokens, id)
+	for key, verifiedID := range verifiedTokens {
+		if verifiedID == id {
+			delete(verifiedTokens, key)
+		}
+	}
+}
+
+// bearerToken returns the token of an Authorization: Bearer header
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(header[7:]), true
+}
+
+// HasBearerToken reports whether the request carries an Authorization: Bearer header. Such
+// requests are authenticated by their token alone, never by cookies.
+func HasBearerToken(r *http.Request) bool {
+	_, ok := bearerToken(r)
+	return ok
+}
+
+// tokenSession returns the session for a request authenticated with a personal access token
+func tokenSession(r *http.Request, raw string) *Session {
+	rest, ok := strings.CutPrefix(raw, tokenPrefix)
+	if !ok {
+		return nil
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok {
+		return nil
+	}
+
+	key := hashToken(raw)
+	now := time.Now()
+
+	tokensMu.RLock()
+	token, exists := tokens[id]
+	var info APIToken
+	if exists {
+		info = *token
+	}
+	verified := verifiedTokens[key] == id
+	tokensMu.RUnlock()
+
+	if !exists || (info.ExpiresAt != nil && now.After(*info.ExpiresAt)) {
+		return nil
+	}
+	if !verified {
+		if !crypto.CheckPasswordHash(secret, info.Hash) {
+			return nil
+		}
+		tokensMu.Lock()
+		verifiedTokens[key] = id
+		tokensMu.Unlock()
+	}
+
+	// Read tokens can't change anything
+	if info.Scope != ScopeWrite && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return nil
+	}
+
+	// The token acts with the owner's current role, so deleted or demoted users lose access
+	user, found := users.Get(info.Username)
+	if !found || user.Disabled || user.Pending || user.Role == "" {
+		return nil
+	}
+	role := user.Role
+	if info.Scope != ScopeWrite {
+		role = config.RoleViewer
+	}
+
+	session := &Session{
+		Username:  info.Username,
+		Role:      role,
+		CreatedAt: info.CreatedAt,
+		LastSeen:  now,
+		IP:        ClientIP(r),
+		UserAgent: r.UserAgent(),
+		TokenID:   info.ID,
+		TokenPath: info.Path,
+		ReadOnly:  info.Scope != ScopeWrite,
+	}
+
+	// Documents outside the token's path are off limits, and so is everything that isn't a
+	// document unless it is known to respect the path
+	if info.Path != "" {
+		if docPath, ok := requestDocumentPath(r); ok {
+			if !session.AllowsPath(docPath) {
+				return nil
+			}
+		} else if !pathRestrictedRoutes[r.URL.Path] {
+			return nil
+		}
+	}
+
+	if info.LastUsed == nil || now.Sub(*info.LastUsed) > lastSeenResolution {
+		tokensMu.Lock()
+		if token, exists := tokens[id]; exists {
+			token.LastUsed = &now
+		}
+		tokensMu.Unlock()
+		saveTokens()
+	}
+
+	return session
+}
+
+// AllowsPath reports whether the session may access the document at the given path.
+// Only sessions of path restricted tokens are limited.
+func (s *Session) AllowsPath(docPath string) bool {
+	if s == nil || s.TokenPath == "" {
+		return true
+	}
+	docPath = normalizeTokenPath(docPath)
+	return docPath == s.TokenPath || strings.HasPrefix(docPath, s.TokenPath+"/")
+}
+
+// documentPathPrefixes are the API routes that take a document path in the URL
+var documentPathPrefixes = []string{
+	"/api/save/",
+	"/api/source/",
+	"/api/document/",
+	"/api/files/list/",
+	"/api/files/delete/",
+	"/api/files/",
+	"/api/versions/",
+	"/api/comments/add/",
+	"/api/comments/delete/",
+	"/api/comments/",
+	"/api/export/epub/",
+}
+
+// pathRestrictedRoutes are the API routes without a document path in the URL that path
+// restricted tokens may use: their handlers check the path given in the body or filter their
+// results with AllowsPath, or they don't touch documents at all. Tokens limited to a path are
+// refused on every other such route, which includes all administration.
+var pathRestrictedRoutes = map[string]bool{
+	"/api/document/create": true,
+	"/api/document/move":   true,
+	"/api/files/upload":    true,
+	"/api/files/rename":    true,
+	"/api/search":          true,
+	"/api/documents/list":  true,
+	"/api/check-auth":      true,
+	"/api/render-markdown": true,
+	"/api/utils/slugify":   true,
+	"/api/data/emojis":     true,
+}
+
+// requestDocumentPath returns the document path a request addresses in its URL. Routes that
+// take the path in the body check it in their handlers.
+func requestDocumentPath(r *http.Request) (string, bool) {
+	urlPath := r.URL.Path
+
+	if pathRestrictedRoutes[urlPath] {
+		return "", false
+	}
+
+	if !strings.HasPrefix(urlPath, "/api/") {
+		return urlPath, true
+	}
+	for _, prefix := range documentPathPrefixes {
+		if strings.HasPrefix(urlPath, prefix) {
+			return strings.TrimPrefix(urlPath, prefix), true
+		}
+	}
+	return "", false
+}
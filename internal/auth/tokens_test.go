@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"wiki-go/internal/config"
+	"wiki-go/internal/users"
+)
+
+// setupTokenStore points the token and user stores at a temporary directory with the given users
+func setupTokenStore(t *testing.T, accounts ...users.User) {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Wiki.RootDir = t.TempDir()
+	if err := users.Init(filepath.Join(cfg.Wiki.RootDir, "users.json")); err != nil {
+		t.Fatalf("Failed to open the user store: %v", err)
+	}
+	for _, account := range accounts {
+		if err := users.Create(account); err != nil {
+			t.Fatalf("Failed to create %s: %v", account.Username, err)
+		}
+	}
+	if err := InitTokens(cfg); err != nil {
+		t.Fatalf("Failed to load tokens: %v", err)
+	}
+}
+
+// createTestToken creates a token and fails the test if that doesn't work
+func createTestToken(t *testing.T, username, scope, path string, expiresAt *time.Time) string {
+	t.Helper()
+	raw, _, err := CreateToken(username, "test", scope, path, expiresAt)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	return raw
+}
+
+func TestTokenSession(t *testing.T) {
+	setupTokenStore(t,
+		users.User{Username: "jane", Role: "editor"},
+		users.User{Username: "gone", Role: "editor", Disabled: true},
+	)
+	expired := time.Now().Add(-time.Minute)
+	later := time.Now().Add(time.Hour)
+
+	write := createTestToken(t, "jane", ScopeWrite, "", &later)
+	read := createTestToken(t, "jane", ScopeRead, "", nil)
+	team := createTestToken(t, "jane", ScopeWrite, "/docs/team/", nil)
+	old := createTestToken(t, "jane", ScopeWrite, "", &expired)
+	disabled := createTestToken(t, "gone", ScopeWrite, "", nil)
+	id, _, _ := strings.Cut(strings.TrimPrefix(write, tokenPrefix), "_")
+
+	tests := []struct {
+		name     string
+		header   string
+		method   string
+		target   string
+		wantRole string // Empty when the token must be refused
+		readOnly bool
+	}{
+		{name: "Write token", header: "Bearer " + write, method: http.MethodPost, target: "/api/save/docs/page", wantRole: "editor"},
+		{name: "Lower case scheme", header: "bearer " + write, method: http.MethodGet, target: "/docs/page", wantRole: "editor"},
+		{name: "Read token", header: "Bearer " + read, method: http.MethodGet, target: "/api/source/docs/page", wantRole: "viewer", readOnly: true},
+		{name: "Read token changing something", header: "Bearer " + read, method: http.MethodPost, target: "/api/save/docs/page"},
+		{name: "Expired", header: "Bearer " + old, method: http.MethodGet, target: "/docs/page"},
+		{name: "Disabled owner", header: "Bearer " + disabled, method: http.MethodGet, target: "/docs/page"},
+		{name: "Wrong secret", header: "Bearer " + tokenPrefix + id + "_wrong", method: http.MethodGet, target: "/docs/page"},
+		{name: "Unknown ID", header: "Bearer " + tokenPrefix + "000000000000_" + strings.Repeat("a", 43), method: http.MethodGet, target: "/docs/page"},
+		{name: "Without prefix", header: "Bearer " + strings.TrimPrefix(write, tokenPrefix), method: http.MethodGet, target: "/docs/page"},
+		{name: "Without secret", header: "Bearer " + tokenPrefix + id, method: http.MethodGet, target: "/docs/page"},
+		{name: "Path token inside its path", header: "Bearer " + team, method: http.MethodGet, target: "/docs/team/page", wantRole: "editor"},
+		{name: "Path token on its path", header: "Bearer " + team, method: http.MethodPost, target: "/api/save/docs/team", wantRole: "editor"},
+		{name: "Path token on a sibling with the same prefix", header: "Bearer " + team, method: http.MethodGet, target: "/docs/teammates"},
+		{name: "Path token outside its path", header: "Bearer " + team, method: http.MethodGet, target: "/api/source/docs/other"},
+		{name: "Path token escaping its path", header: "Bearer " + team, method: http.MethodGet, target: "/api/source/docs/team/../other"},
+		{name: "Path token on a route that checks the path", header: "Bearer " + team, method: http.MethodGet, target: "/api/search", wantRole: "editor"},
+		{name: "Path token on administration", header: "Bearer " + team, method: http.MethodGet, target: "/api/users"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://wiki.example.com/", nil)
+			r.URL.Path = tt.target // Unlike a parsed URL, keeps dot segments as a client could send them
+			r.Header.Set("Authorization", tt.header)
+
+			session := GetSession(r)
+			if tt.wantRole == "" {
+				if session != nil {
+					t.Fatalf("Expected the token to be refused, got a session for %s", session.Username)
+				}
+				return
+			}
+			if session == nil {
+				t.Fatal("Expected a session, got none")
+			}
+			if session.Role != tt.wantRole || session.ReadOnly != tt.readOnly {
+				t.Errorf("Expected role %s and read only %t, got: %s and %t", tt.wantRole, tt.readOnly, session.Role, session.ReadOnly)
+			}
+		})
+	}
+}
+
+func TestTokenFollowsOwner(t *testing.T) {
+	setupTokenStore(t, users.User{Username: "jane", Role: "editor"})
+	raw := createTestToken(t, "jane", ScopeWrite, "", nil)
+	request := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/docs/page", nil)
+		r.Header.Set("Authorization", "Bearer "+raw)
+		return r
+	}
+
+	if session := GetSession(request()); session == nil || session.Role != "editor" {
+		t.Fatalf("Expected an editor session, got: %+v", session)
+	}
+
+	// Demoting the owner demotes the token, even once its secret is cached as verified
+	if err := users.Update("jane", func(user *users.User) error {
+		user.Role = "viewer"
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to update jane: %v", err)
+	}
+	if session := GetSession(request()); session == nil || session.Role != "viewer" {
+		t.Errorf("Expected a viewer session after the demotion, got: %+v", session)
+	}
+
+	if revoked := RevokeUserTokens("jane"); revoked != 1 {
+		t.Errorf("Expected 1 token revoked, got: %d", revoked)
+	}
+	if session := GetSession(request()); session != nil {
+		t.Error("Expected a revoked token to be refused")
+	}
+}
+
+func TestCreateTokenScope(t *testing.T) {
+	setupTokenStore(t)
+	if _, _, err := CreateToken("admin", "test", "admin", "", nil); err == nil {
+		t.Error("Expected an unknown scope to be refused")
+	}
+	raw, info, err := CreateToken("admin", "test", ScopeRead, " docs//team/ ", nil)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	if !strings.HasPrefix(raw, tokenPrefix+info.ID+"_") {
+		t.Errorf("Expected the token to look like %s<id>_<secret>, got: %s", tokenPrefix, raw)
+	}
+	if info.Path != "docs/team" {
+		t.Errorf("Expected the path to be cleaned to docs/team, got: %q", info.Path)
+	}
+	if info.Hash != "" {
+		t.Error("Expected the returned token info to leave out the hash")
+	}
+}
+
+func TestAllowsPath(t *testing.T) {
+	tests := []struct {
+		name      string
+		tokenPath string
+		docPath   string
+		expected  bool
+	}{
+		{name: "Unrestricted", tokenPath: "", docPath: "anything/at/all", expected: true},
+		{name: "Same path", tokenPath: "docs/team", docPath: "docs/team", expected: true},
+		{name: "Below", tokenPath: "docs/team", docPath: "/docs/team/notes/", expected: true},
+		{name: "Parent", tokenPath: "docs/team", docPath: "docs", expected: false},
+		{name: "Sibling with the same prefix", tokenPath: "docs/team", docPath: "docs/teammates", expected: false},
+		{name: "Dot segments", tokenPath: "docs/team", docPath: "docs/team/../other", expected: false},
+		{name: "Backslashes", tokenPath: "docs/team", docPath: `docs\team\notes`, expected: filepath.Separator == '\\'},
+		{name: "Root", tokenPath: "docs/team", docPath: "/", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := &Session{Username: "jane", TokenPath: tt.tokenPath}
+			if result := session.AllowsPath(tt.docPath); result != tt.expected {
+				t.Errorf("Expected: %t, got: %t", tt.expected, result)
+			}
+		})
+	}
+
+	var visitor *Session
+	if !visitor.AllowsPath("docs") {
+		t.Error("Expected a nil session not to be limited by a path")
+	}
+}
@@ -0,0 +1,400 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"wiki-go/internal/config"
+	"wiki-go/internal/crypto"
+	"wiki-go/internal/roles"
+)
+
+// TOTP parameters (RFC 6238). These are the defaults of every authenticator app.
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	totpSkew   = 1 // Codes of the previous and next period are accepted too
+)
+
+// recoveryCodeCount is how many one-time recovery codes a user gets
+const recoveryCodeCount = 10
+
+// loginChallengeTimeout is how long the second login step may take
+const loginChallengeTimeout = 5 * time.Minute
+
+// loginChallengeAttempts is how many codes can be tried against one challenge
+const loginChallengeAttempts = 5
+
+// ErrInvalidTOTPCode is returned when a code doesn't match
+var ErrInvalidTOTPCode = errors.New("invalid code")
+
+// TOTPEnrollment holds the second factor of a user
+type TOTPEnrollment struct {
+	Secret        string     `json:"secret"`  // Base32, as shown to the user
+	Enabled       bool       `json:"enabled"` // False while the user hasn't confirmed a code yet
+	RecoveryCodes []string   `json:"recoveryCodes,omitempty"`
+	LastStep      int64      `json:"lastStep"` // Time step of the last accepted code, which can't be used again
+	EnabledAt     *time.Time `json:"enabledAt,omitempty"`
+}
+
+// LoginChallenge is a login that passed the password check and waits for the second factor
+type LoginChallenge struct {
+	Username     string
+	Role         string
+	KeepLoggedIn bool
+	Setup        bool // The user must enrol before the login completes
+	ExpiresAt    time.Time
+	attempts     int
+}
+
+var (
+	totpUsers   = make(map[string]*TOTPEnrollment)
+	totpMu      sync.Mutex
+	totpFile    string
+	totpPersist sync.Mutex
+
+	loginChallenges   = make(map[string]*LoginChallenge)
+	loginChallengesMu sync.Mutex
+)
+
+// InitTOTP loads the second factors saved in cfg.Wiki.RootDir/totp.json
+func InitTOTP(cfg *config.Config) error {
+	path := filepath.Join(cfg.Wiki.RootDir, "totp.json")
+
+	loaded := make(map[string]*TOTPEnrollment)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+
+	totpMu.Lock()
+	totpFile = path
+	totpUsers = loaded
+	totpMu.Unlock()
+
+	return nil
+}
+
+// saveTOTP writes the second factors to disk
+func saveTOTP() {
+	totpPersist.Lock()
+	defer totpPersist.Unlock()
+
+	totpMu.Lock()
+	path := totpFile
+	data, err := json.Marshal(totpUsers)
+	totpMu.Unlock()
+
+	if path == "" {
+		return
+	}
+	if err != nil {
+		log.Printf("Warning: failed to encode two-factor settings: %v", err)
+		return
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		log.Printf("Warning: failed to save two-factor settings: %v", err)
+	}
+}
+
+// TOTPEnabled reports whether the user has a confirmed second factor
+func TOTPEnabled(username string) bool {
+	totpMu.Lock()
+	defer totpMu.Unlock()
+	enrollment, exists := totpUsers[username]
+	return exists && enrollment.Enabled
+}
+
+// TOTPRecoveryCodesLeft returns how many unused recovery codes the user has
+func TOTPRecoveryCodesLeft(username string) int {
+	totpMu.Lock()
+	defer totpMu.Unlock()
+	if enrollment, exists := totpUsers[username]; exists && enrollment.Enabled {
+		return len(enrollment.RecoveryCodes)
+	}
+	return 0
+}
+
+// TOTPRequired reports whether the wiki requires a second factor for the user. Users who can
+// manage the wiki count as admins and users who can edit as editors, whatever their role is called.
+func TOTPRequired(cfg *config.Config, username, role string) bool {
+	permissions := Permissions(&Session{Username: username, Role: role})
+	switch {
+	case managesWiki(permissions):
+		return cfg.Security.TwoFactor.RequireForAdmins
+	case containsString(permissions, roles.PermPageEdit):
+		return cfg.Security.TwoFactor.RequireForEditors
+	}
+	return false
+}
+
+// BeginTOTPEnrollment creates a new secret for the user, which takes effect once a code from it
+// is confirmed. It returns the secret and the otpauth:// URI for authenticator apps.
+func BeginTOTPEnrollment(username, issuer string) (string, string, error) {
+	totpMu.Lock()
+	if enrollment, exists := totpUsers[username]; exists && enrollment.Enabled {
+		totpMu.Unlock()
+		return "", "", errors.New("two-factor authentication is already enabled")
+	}
+	totpMu.Unlock()
+
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw)
+
+	totpMu.Lock()
+	totpUsers[username] = &TOTPEnrollment{Secret: secret}
+	totpMu.Unlock()
+	saveTOTP()
+
+	label := url.PathEscape(issuer + ":" + username)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	uri := "otpauth://totp/" + label + "?" + strings.ReplaceAll(params.Encode(), "+", "%20")
+
+	return secret, uri, nil
+}
+
+// ConfirmTOTPEnrollment enables the second factor once the user proves their app has the secret,
+// and returns the recovery codes. They are only shown this once.
+func ConfirmTOTPEnrollment(username, code string) ([]string, error) {
+	totpMu.Lock()
+	enrollment, exists := totpUsers[username]
+	if !exists || enrollment.Enabled {
+		totpMu.Unlock()
+		return nil, errors.New("no two-factor setup in progress")
+	}
+	step, ok := matchTOTP(enrollment.Secret, code, 0, time.Now())
+	if !ok {
+		totpMu.Unlock()
+		return nil, ErrInvalidTOTPCode
+	}
+	totpMu.Unlock()
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	totpMu.Lock()
+	enrollment.Enabled = true
+	enrollment.EnabledAt = &now
+	enrollment.LastStep = step
+	enrollment.RecoveryCodes = hashes
+	totpMu.Unlock()
+	saveTOTP()
+
+	return codes, nil
+}
+
+// VerifyTOTP checks a code from the user's app, or one of their recovery codes, which is used up
+func VerifyTOTP(username, code string) bool {
+	code = strings.TrimSpace(code)
+
+	totpMu.Lock()
+	enrollment, exists := totpUsers[username]
+	if !exists || !enrollment.Enabled {
+		totpMu.Unlock()
+		return false
+	}
+
+	if step, ok := matchTOTP(enrollment.Secret, code, enrollment.LastStep, time.Now()); ok {
+		enrollment.LastStep = step
+		totpMu.Unlock()
+		saveTOTP()
+		return true
+	}
+
+	// Recovery codes are written with a dash, but accepted without
+	normalized := strings.ToLower(strings.ReplaceAll(code, "-", ""))
+	for i, hash := range enrollment.RecoveryCodes {
+		if crypto.CheckPasswordHash(normalized, hash) {
+			enrollment.RecoveryCodes = append(enrollment.RecoveryCodes[:i:i], enrollment.RecoveryCodes[i+1:]...)
+			totpMu.Unlock()
+			saveTOTP()
+			return true
+		}
+	}
+	totpMu.Unlock()
+	return false
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes
+func RegenerateRecoveryCodes(username string) ([]string, error) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	totpMu.Lock()
+	enrollment, exists := totpUsers[username]
+	if !exists || !enrollment.Enabled {
+		totpMu.Unlock()
+		return nil, errors.New("two-factor authentication is not enabled")
+	}
+	enrollment.RecoveryCodes = hashes
+	totpMu.Unlock()
+	saveTOTP()
+
+	return codes, nil
+}
+
+// DisableTOTP removes the user's second factor, or an unfinished setup. It returns false if
+// there was nothing to remove.
+func DisableTOTP(username string) bool {
+	totpMu.Lock()
+	_, exists := totpUsers[username]
+	delete(totpUsers, username)
+	totpMu.Unlock()
+
+	if exists {
+		saveTOTP()
+	}
+	return exists
+}
+
+// generateRecoveryCodes returns new recovery codes and their bcrypt hashes
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		code := hex.EncodeToString(raw)
+		hash, err := crypto.HashPassword(code)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hash)
+	}
+	return codes, hashes, nil
+}
+
+// matchTOTP checks a code against the periods around now, skipping those at or before
+// lastStep, and returns the time step it matched
+func matchTOTP(secret, code string, lastStep int64, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode computes the code of a time step (RFC 4226 dynamic truncation)
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// CreateLoginChallenge records a login that passed the password check and returns the token the
+// client completes it with
+func CreateLoginChallenge(username, role string, keepLoggedIn, setup bool) (string, error) {
+	token, err := randomURLString(24)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	loginChallengesMu.Lock()
+	for key, challenge := range loginChallenges {
+		if now.After(challenge.ExpiresAt) {
+			delete(loginChallenges, key)
+		}
+	}
+	loginChallenges[token] = &LoginChallenge{
+		Username:     username,
+		Role:         role,
+		KeepLoggedIn: keepLoggedIn,
+		Setup:        setup,
+		ExpiresAt:    now.Add(loginChallengeTimeout),
+	}
+	loginChallengesMu.Unlock()
+
+	return token, nil
+}
+
+// GetLoginChallenge returns a pending login challenge, or nil if it expired
+func GetLoginChallenge(token string) *LoginChallenge {
+	loginChallengesMu.Lock()
+	defer loginChallengesMu.Unlock()
+
+	challenge, exists := loginChallenges[token]
+	if !exists || time.Now().After(challenge.ExpiresAt) {
+		delete(loginChallenges, token)
+		return nil
+	}
+	copied := *challenge
+	return &copied
+}
+
+// FailLoginChallenge counts a wrong code against the challenge. After too many the challenge is
+// dropped and the user has to start over with their password.
+func FailLoginChallenge(token string) {
+	loginChallengesMu.Lock()
+	defer loginChallengesMu.Unlock()
+
+	if challenge, exists := loginChallenges[token]; exists {
+		challenge.attempts++
+		if challenge.attempts >= loginChallengeAttempts {
+			delete(loginChallenges, token)
+		}
+	}
+}
+
+// CompleteLoginChallenge removes a challenge once the login went through
+func CompleteLoginChallenge(token string) {
+	loginChallengesMu.Lock()
+	delete(loginChallenges, token)
+	loginChallengesMu.Unlock()
+}
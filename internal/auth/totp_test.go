@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the test vectors in RFC 6238, encoded like user secrets
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode(t *testing.T) {
+	// The RFC's vectors have 8 digits, the 6 digit codes are their last 6
+	tests := []struct {
+		time     int64
+		expected string
+	}{
+		{time: 59, expected: "287082"},
+		{time: 1111111109, expected: "081804"},
+		{time: 1111111111, expected: "050471"},
+		{time: 1234567890, expected: "005924"},
+		{time: 2000000000, expected: "279037"},
+	}
+
+	for _, tt := range tests {
+		t.Run(time.Unix(tt.time, 0).UTC().Format(time.RFC3339), func(t *testing.T) {
+			result := totpCode([]byte("12345678901234567890"), tt.time/totpPeriod)
+			if result != tt.expected {
+				t.Errorf("Expected: %q, got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestMatchTOTPWindow(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / totpPeriod
+	key, _ := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(rfcSecret)
+	codeAt := func(offset int64) string { return totpCode(key, current+offset) }
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "Current period", code: codeAt(0), wantStep: current, wantOK: true},
+		{name: "Previous period", code: codeAt(-1), wantStep: current - 1, wantOK: true},
+		{name: "Next period", code: codeAt(1), wantStep: current + 1, wantOK: true},
+		{name: "Two periods ago", code: codeAt(-2)},
+		{name: "Two periods ahead", code: codeAt(2)},
+		{name: "With spaces", code: codeAt(0)[:3] + " " + codeAt(0)[3:], wantStep: current, wantOK: true},
+		{name: "Already used", code: codeAt(0), lastStep: current},
+		{name: "Older than the last used", code: codeAt(-1), lastStep: current},
+		{name: "Newer than the last used", code: codeAt(1), lastStep: current, wantStep: current + 1, wantOK: true},
+		{name: "Too short", code: codeAt(0)[:5]},
+		{name: "Too long", code: codeAt(0) + "0"},
+		{name: "Empty", code: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := matchTOTP(rfcSecret, tt.code, tt.lastStep, now)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("Expected step %d and %t, got: %d and %t", tt.wantStep, tt.wantOK, step, ok)
+			}
+		})
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("Failed to generate recovery codes: %v", err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("Expected %d codes and hashes, got: %d and %d", recoveryCodeCount, len(codes), len(hashes))
+	}
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("Expected a code like xxxxx-xxxxx, got: %q", code)
+		}
+		if seen[code] {
+			t.Errorf("Duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+
+	const username = "recovery-test"
+	totpMu.Lock()
+	totpUsers[username] = &TOTPEnrollment{Secret: rfcSecret, Enabled: true, RecoveryCodes: hashes}
+	totpMu.Unlock()
+	t.Cleanup(func() { DisableTOTP(username) })
+
+	tests := []struct {
+		name     string
+		code     string
+		expected bool
+		left     int // Recovery codes left afterwards
+	}{
+		{name: "Unknown code", code: "00000-00000", expected: false, left: 10},
+		{name: "Code as shown", code: codes[0], expected: true, left: 9},
+		{name: "Code used twice", code: codes[0], expected: false, left: 9},
+		{name: "Without dash", code: strings.ReplaceAll(codes[1], "-", ""), expected: true, left: 8},
+		{name: "Upper case with spaces", code: "  " + strings.ToUpper(codes[2]) + " ", expected: true, left: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := VerifyTOTP(username, tt.code); result != tt.expected {
+				t.Errorf("Expected: %t, got: %t", tt.expected, result)
+			}
+			if left := TOTPRecoveryCodesLeft(username); left != tt.left {
+				t.Errorf("Expected %d codes left, got: %d", tt.left, left)
+			}
+		})
+	}
+
+	if VerifyTOTP("nobody", codes[3]) {
+		t.Error("Expected a recovery code not to work for another user")
+	}
+}
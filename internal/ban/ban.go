@@ -3,8 +3,11 @@ package ban
 import (
     "encoding/json"
     "errors"
+    "fmt"
+    "net"
     "os"
     "path/filepath"
+    "strings"
     "sync"
     "time"
 )
@@ -50,9 +53,10 @@ type Attempt struct {
 }
 
 type BanList struct {
-    mu       sync.Mutex
-    entries  map[string]*Attempt
-    filePath string
+    mu        sync.Mutex
+    entries   map[string]*Attempt
+    filePath  string
+    allowlist []*net.IPNet // Addresses that are never banned
 }
 
 // NewBanList loads the ban list from disk (if present) and returns a ready-to-use instance.
@@ -93,6 +97,10 @@ func (b *BanList) IsBanned(key string) time.Duration {
     b.mu.Lock()
     defer b.mu.Unlock()
 
+    if b.allowed(key) {
+        return 0
+    }
+
     at, ok := b.entries[key]
     if !ok || at == nil {
         return 0
@@ -122,6 +130,10 @@ func (b *BanList) RegisterFailure(key string) (time.Duration, bool) {
     b.mu.Lock()
     defer b.mu.Unlock()
 
+    if b.allowed(key) {
+        return 0, false
+    }
+
     now := time.Now()
     at, ok := b.entries[key]
     if !ok {
@@ -180,6 +192,89 @@ func (b *BanList) Clear(key string) {
     b.persistAsync()
 }
 
+// Entries returns a copy of the failure and ban information of every key.
+func (b *BanList) Entries() map[string]Attempt {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    entries := make(map[string]Attempt, len(b.entries))
+    for k, v := range b.entries {
+        if v != nil {
+            entries[k] = *v
+        }
+    }
+    return entries
+}
+
+// Unban lifts the ban on key and forgets its failures, including the length of its last ban.
+// It reports whether there was anything to remove.
+func (b *BanList) Unban(key string) bool {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    if _, ok := b.entries[key]; !ok {
+        return false
+    }
+    delete(b.entries, key)
+    b.persistAsync()
+    return true
+}
+
+// SetAllowlist replaces the addresses that are never banned. Failures from them aren't counted.
+func (b *BanList) SetAllowlist(nets []*net.IPNet) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    b.allowlist = nets
+}
+
+// allowed reports whether key is an address on the allowlist. The caller holds b.mu.
+func (b *BanList) allowed(key string) bool {
+    if len(b.allowlist) == 0 {
+        return false
+    }
+    ip := net.ParseIP(key)
+    if ip == nil {
+        return false
+    }
+    for _, n := range b.allowlist {
+        if n.Contains(ip) {
+            return true
+        }
+    }
+    return false
+}
+
+// ParseAllowlist parses a comma separated list of addresses and CIDRs such as
+// "127.0.0.1, 10.0.0.0/8". Single addresses become networks of one address.
+func ParseAllowlist(list string) ([]*net.IPNet, error) {
+    var nets []*net.IPNet
+    for _, entry := range strings.Split(list, ",") {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+        if !strings.Contains(entry, "/") {
+            ip := net.ParseIP(entry)
+            if ip == nil {
+                return nil, fmt.Errorf("invalid address %q", entry)
+            }
+            bits := 8 * net.IPv6len
+            if ip.To4() != nil {
+                ip, bits = ip.To4(), 8*net.IPv4len
+            }
+            nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+            continue
+        }
+        _, n, err := net.ParseCIDR(entry)
+        if err != nil {
+            return nil, fmt.Errorf("invalid CIDR %q", entry)
+        }
+        nets = append(nets, n)
+    }
+    return nets, nil
+}
+
 // persistAsync serialises the entries map in a goroutine so we don't block callers.
 func (b *BanList) persistAsync() {
     // Make a snapshot to avoid holding the lock while encoding.
@@ -0,0 +1,87 @@
+package comments
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpamPolicy is what a comment has to respect to be accepted. Zero values disable a check.
+type SpamPolicy struct {
+	MinInterval time.Duration // Time a user has to wait between two comments
+	MaxLinks    int           // Most links a comment may contain
+	BannedWords []string      // Words and phrases a comment may not contain, compared ignoring case
+}
+
+// Reasons a comment is refused as spam
+var (
+	ErrTooSoon      = errors.New("please wait before posting another comment")
+	ErrTooManyLinks = errors.New("comment contains too many links")
+	ErrBannedWord   = errors.New("comment contains a banned word")
+)
+
+// linkPattern matches web addresses, whether bare or in a markdown link
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+var (
+	lastPostMu sync.Mutex
+	lastPost   = make(map[string]time.Time) // When each user last posted a comment
+)
+
+// ParseBannedWords splits a comma separated list of banned words and phrases
+func ParseBannedWords(list string) []string {
+	var words []string
+	for _, word := range strings.Split(list, ",") {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// CheckSpam returns an error when the comment of username breaks the policy
+func CheckSpam(username, content string, policy SpamPolicy) error {
+	if policy.MinInterval > 0 {
+		lastPostMu.Lock()
+		last, ok := lastPost[username]
+		lastPostMu.Unlock()
+		if ok {
+			if wait := policy.MinInterval - time.Since(last); wait > 0 {
+				return fmt.Errorf("%w (%d seconds)", ErrTooSoon, int(wait.Seconds())+1)
+			}
+		}
+	}
+
+	if policy.MaxLinks > 0 && len(linkPattern.FindAllString(content, policy.MaxLinks+1)) > policy.MaxLinks {
+		return ErrTooManyLinks
+	}
+
+	if len(policy.BannedWords) > 0 {
+		lower := strings.ToLower(content)
+		for _, word := range policy.BannedWords {
+			if strings.Contains(lower, word) {
+				return ErrBannedWord
+			}
+		}
+	}
+	return nil
+}
+
+// RecordPost notes that username just posted a comment, for the minimum interval of CheckSpam
+func RecordPost(username string) {
+	lastPostMu.Lock()
+	defer lastPostMu.Unlock()
+
+	now := time.Now()
+	lastPost[username] = now
+
+	// Forget users whose last comment is old enough not to matter to any sensible interval
+	for user, t := range lastPost {
+		if now.Sub(t) > 24*time.Hour {
+			delete(lastPost, user)
+		}
+	}
+}
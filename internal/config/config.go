@@ -6,8 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
-	"wiki-go/internal/crypto"
+	"strconv"
 	"wiki-go/internal/roles"
 
 	"gopkg.in/yaml.v3"
@@ -16,13 +15,6 @@ import (
 // ConfigFilePath defines the global path to the configuration file
 const ConfigFilePath = "data/config.yaml"
 
-// User represents a user with authentication credentials
-type User struct {
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
-	Role     string `yaml:"role"`     // "admin", "editor", or "viewer"
-}
-
 // Role constants - using the ones defined in roles package
 var (
 	RoleAdmin  = roles.RoleAdmin  // Can do anything
@@ -63,16 +55,111 @@ type Config struct {
 		MaxUploadSize             int    `yaml:"max_upload_size"` // Maximum upload file size in MB
 		Language                  string `yaml:"language"`        // Default language for the wiki
 	} `yaml:"wiki"`
-	Users []User `yaml:"users"`
 	Security struct {
 		LoginBan struct {
-			Enabled           bool `yaml:"enabled"`
-			MaxFailures       int  `yaml:"max_failures"`
-			WindowSeconds     int  `yaml:"window_seconds"`
-			InitialBanSeconds int  `yaml:"initial_ban_seconds"`
-			MaxBanSeconds     int  `yaml:"max_ban_seconds"`
+			Enabled           bool   `yaml:"enabled"`
+			MaxFailures       int    `yaml:"max_failures"`
+			WindowSeconds     int    `yaml:"window_seconds"`
+			InitialBanSeconds int    `yaml:"initial_ban_seconds"`
+			MaxBanSeconds     int    `yaml:"max_ban_seconds"`
+			Allowlist         string `yaml:"allowlist"` // Comma separated addresses or CIDRs that are never banned
 		} `yaml:"login_ban"`
+		Sessions struct {
+			AbsoluteTimeoutHours  int `yaml:"absolute_timeout_hours"`
+			PersistentTimeoutDays int `yaml:"persistent_timeout_days"`
+			IdleTimeoutHours      int `yaml:"idle_timeout_hours"`
+		} `yaml:"sessions"`
+		OIDC struct {
+			Enabled       bool   `yaml:"enabled"`
+			Issuer        string `yaml:"issuer"`
+			ClientID      string `yaml:"client_id"`
+			ClientSecret  string `yaml:"client_secret"`
+			RedirectURL   string `yaml:"redirect_url"`
+			Scopes        string `yaml:"scopes"`         // Space separated scopes to request
+			UsernameClaim string `yaml:"username_claim"` // ID token claim holding the username
+			RoleClaim     string `yaml:"role_claim"`     // ID token claim holding groups or roles
+			AdminValues   string `yaml:"admin_values"`   // Comma separated claim values that grant the admin role
+			EditorValues  string `yaml:"editor_values"`  // Comma separated claim values that grant the editor role
+			DefaultRole   string `yaml:"default_role"`   // Role of users matching neither, empty to refuse them
+			ButtonLabel   string `yaml:"button_label"`
+		} `yaml:"oidc"`
+		LDAP struct {
+			Enabled            bool   `yaml:"enabled"`
+			URL                string `yaml:"url"` // ldap://host:389 or ldaps://host:636
+			StartTLS           bool   `yaml:"start_tls"`
+			InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+			BindDN             string `yaml:"bind_dn"` // Service account used to search for users
+			BindPassword       string `yaml:"bind_password"`
+			UserDNTemplate     string `yaml:"user_dn_template"` // Binds directly as e.g. uid=%s,ou=people,dc=example,dc=com instead of searching
+			BaseDN             string `yaml:"base_dn"`
+			UserFilter         string `yaml:"user_filter"`     // Search filter, %s is the username
+			GroupAttribute     string `yaml:"group_attribute"` // User attribute listing the user's groups
+			AdminGroups        string `yaml:"admin_groups"`    // Semicolon separated group DNs or names that grant the admin role
+			EditorGroups       string `yaml:"editor_groups"`   // Semicolon separated group DNs or names that grant the editor role
+			DefaultRole        string `yaml:"default_role"`    // Role of users in neither, empty to refuse them
+		} `yaml:"ldap"`
+		TwoFactor struct {
+			RequireForAdmins  bool `yaml:"require_for_admins"`
+			RequireForEditors bool `yaml:"require_for_editors"`
+		} `yaml:"two_factor"`
+		PasswordPolicy struct {
+			MinLength     int  `yaml:"min_length"`     // Minimum number of characters of new passwords
+			CheckBreached bool `yaml:"check_breached"` // Refuse passwords found in the bundled list of breached passwords
+		} `yaml:"password_policy"`
+		Registration struct {
+			Enabled     bool   `yaml:"enabled"`      // Let visitors create accounts that wait for an admin's approval
+			DefaultRole string `yaml:"default_role"` // Role of self-registered users once approved
+		} `yaml:"registration"`
+		PasswordReset struct {
+			LinkValidHours int    `yaml:"link_valid_hours"` // How long a reset link can be used
+			SelfService    bool   `yaml:"self_service"`     // Let users request a reset link by email, needs smtp
+			BaseURL        string `yaml:"base_url"`         // External address of the wiki, used in emailed links
+		} `yaml:"password_reset"`
+		CSRF struct {
+			TrustedOrigins string `yaml:"trusted_origins"` // Comma separated origins, besides the wiki's own, allowed to send changing requests
+		} `yaml:"csrf"`
+		CSP struct {
+			Mode string `yaml:"mode"` // "enforce", or "report-only" to only report what the policy would block
+		} `yaml:"csp"`
+		ReverseProxy struct {
+			TrustedProxies string `yaml:"trusted_proxies"` // Comma separated addresses or CIDRs of proxies whose forwarding headers are believed
+			AuthEnabled    bool   `yaml:"auth_enabled"`    // Log users in from the headers of an authenticating proxy
+			UserHeader     string `yaml:"user_header"`
+			GroupsHeader   string `yaml:"groups_header"` // Comma separated groups of the user
+			AdminGroups    string `yaml:"admin_groups"`  // Comma separated groups that grant the admin role
+			EditorGroups   string `yaml:"editor_groups"` // Comma separated groups that grant the editor role
+			DefaultRole    string `yaml:"default_role"`  // Role of users in neither, empty to refuse them
+		} `yaml:"reverse_proxy"`
+		RateLimit struct {
+			Enabled           bool `yaml:"enabled"` // Limit requests per user, or per IP address without a login
+			APIPerMinute      int  `yaml:"api_per_minute"`
+			APIBurst          int  `yaml:"api_burst"`
+			SearchPerMinute    int  `yaml:"search_per_minute"`
+			SearchBurst       int  `yaml:"search_burst"`
+			RenderPerMinute    int  `yaml:"render_per_minute"`
+			RenderBurst       int  `yaml:"render_burst"`
+			CommentsPerMinute  int  `yaml:"comments_per_minute"`
+			CommentsBurst      int  `yaml:"comments_burst"`
+			MetadataPerMinute  int  `yaml:"metadata_per_minute"`
+			MetadataBurst      int  `yaml:"metadata_burst"`
+		} `yaml:"rate_limit"`
+		CommentSpam struct {
+			MinIntervalSeconds int    `yaml:"min_interval_seconds"` // Time a user has to wait between two comments
+			MaxLinks           int    `yaml:"max_links"`            // Comments with more links are refused, 0 for no limit
+			BannedWords        string `yaml:"banned_words"`         // Comma separated words and phrases that comments may not contain
+		} `yaml:"comment_spam"`
+		LinkMetadata struct {
+			AllowedNetworks string `yaml:"allowed_networks"` // Comma separated addresses or CIDRs of otherwise refused networks that may be fetched
+			CacheHours      int    `yaml:"cache_hours"`      // How long fetched titles and descriptions are kept, 0 to not cache them
+		} `yaml:"link_metadata"`
 	} `yaml:"security"`
+	SMTP struct {
+		Host     string `yaml:"host"` // Empty when the wiki doesn't send email
+		Port     int    `yaml:"port"` // 587 for STARTTLS, 465 for implicit TLS
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+		From     string `yaml:"from"`
+	} `yaml:"smtp"`
 }
 
 // LoadConfig loads the configuration from a YAML file
@@ -100,7 +187,6 @@ func LoadConfig(path string) (*Config, error) {
 	config.Wiki.MaxVersions = 10   // Default value
 	config.Wiki.MaxUploadSize = 10 // Default value
 	config.Wiki.Language = "en"    // Default to English
-	config.Users = []User{}        // Initialize empty users array
 
 	// Security defaults
 	config.Security.LoginBan.Enabled = true
@@ -108,6 +194,52 @@ func LoadConfig(path string) (*Config, error) {
 	config.Security.LoginBan.WindowSeconds = 180
 	config.Security.LoginBan.InitialBanSeconds = 60
 	config.Security.LoginBan.MaxBanSeconds = 86400 // 24h
+	config.Security.LoginBan.Allowlist = ""
+	config.Security.Sessions.AbsoluteTimeoutHours = 24
+	config.Security.Sessions.PersistentTimeoutDays = 30
+	config.Security.Sessions.IdleTimeoutHours = 168 // 7 days
+	config.Security.OIDC.Enabled = false
+	config.Security.OIDC.Scopes = "openid profile email"
+	config.Security.OIDC.UsernameClaim = "preferred_username"
+	config.Security.OIDC.RoleClaim = "groups"
+	config.Security.OIDC.DefaultRole = RoleViewer
+	config.Security.OIDC.ButtonLabel = "Log in with SSO"
+	config.Security.LDAP.Enabled = false
+	config.Security.LDAP.UserFilter = "(uid=%s)"
+	config.Security.LDAP.GroupAttribute = "memberOf"
+	config.Security.LDAP.DefaultRole = RoleViewer
+	config.Security.TwoFactor.RequireForAdmins = false
+	config.Security.TwoFactor.RequireForEditors = false
+	config.Security.PasswordPolicy.MinLength = 8
+	config.Security.PasswordPolicy.CheckBreached = true
+	config.Security.Registration.Enabled = false
+	config.Security.Registration.DefaultRole = RoleViewer
+	config.Security.PasswordReset.LinkValidHours = 24
+	config.Security.PasswordReset.SelfService = false
+	config.Security.CSRF.TrustedOrigins = ""
+	config.Security.CSP.Mode = "enforce"
+	config.Security.ReverseProxy.TrustedProxies = ""
+	config.Security.ReverseProxy.AuthEnabled = false
+	config.Security.ReverseProxy.UserHeader = "X-Forwarded-User"
+	config.Security.ReverseProxy.GroupsHeader = "X-Forwarded-Groups"
+	config.Security.ReverseProxy.DefaultRole = RoleViewer
+	config.Security.RateLimit.Enabled = true
+	config.Security.RateLimit.APIPerMinute = 600
+	config.Security.RateLimit.APIBurst = 100
+	config.Security.RateLimit.SearchPerMinute = 60
+	config.Security.RateLimit.SearchBurst = 20
+	config.Security.RateLimit.RenderPerMinute = 120
+	config.Security.RateLimit.RenderBurst = 30
+	config.Security.RateLimit.CommentsPerMinute = 6
+	config.Security.RateLimit.CommentsBurst = 3
+	config.Security.RateLimit.MetadataPerMinute = 20
+	config.Security.RateLimit.MetadataBurst = 5
+	config.Security.CommentSpam.MinIntervalSeconds = 15
+	config.Security.CommentSpam.MaxLinks = 3
+	config.Security.CommentSpam.BannedWords = ""
+	config.Security.LinkMetadata.AllowedNetworks = ""
+	config.Security.LinkMetadata.CacheHours = 24
+	config.SMTP.Port = 587
 
 	// Read config file
 	data, err := os.ReadFile(path)
@@ -119,43 +251,21 @@ func LoadConfig(path string) (*Config, error) {
 				return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
 			}
 
-			// Hash the default admin password
-			hashedPassword, err := crypto.HashPassword("admin")
-			if err != nil {
-				return nil, err
-			}
-
-			// Add default admin user
-			config.Users = append(config.Users, User{
-				Username: "admin",
-				Password: hashedPassword,
-				Role:     RoleAdmin,
-			})
-
-			// Format all users
-			var usersStr strings.Builder
-			for _, user := range config.Users {
-				if usersStr.Len() > 0 {
-					usersStr.WriteString("\n")
-				}
-				usersStr.WriteString(FormatUserEntry(user))
-			}
-
 			// Fill in the template with values from the config
 			configData := fmt.Sprintf(
 				GetConfigTemplate(),
-				config.Server.Host,
+				yamlEscape(config.Server.Host),
 				config.Server.Port,
 				config.Server.AllowInsecureCookies,
 				config.Server.SSL,
-				config.Server.SSLCert,
-				config.Server.SSLKey,
-				config.Wiki.RootDir,
-				config.Wiki.DocumentsDir,
-				config.Wiki.Title,
-				config.Wiki.Owner,
-				config.Wiki.Notice,
-				config.Wiki.Timezone,
+				yamlEscape(config.Server.SSLCert),
+				yamlEscape(config.Server.SSLKey),
+				yamlEscape(config.Wiki.RootDir),
+				yamlEscape(config.Wiki.DocumentsDir),
+				yamlEscape(config.Wiki.Title),
+				yamlEscape(config.Wiki.Owner),
+				yamlEscape(config.Wiki.Notice),
+				yamlEscape(config.Wiki.Timezone),
 				config.Wiki.Private,
 				config.Wiki.DisableComments,
 				config.Wiki.DisableFileUploadChecking,
@@ -164,17 +274,84 @@ func LoadConfig(path string) (*Config, error) {
 				config.Wiki.DisableContentMaxWidth,
 				config.Wiki.MaxVersions,
 				config.Wiki.MaxUploadSize,
-				config.Wiki.Language,
+				yamlEscape(config.Wiki.Language),
 				config.Security.LoginBan.Enabled,
 				config.Security.LoginBan.MaxFailures,
 				config.Security.LoginBan.WindowSeconds,
 				config.Security.LoginBan.InitialBanSeconds,
 				config.Security.LoginBan.MaxBanSeconds,
-				usersStr.String(),
+				yamlEscape(config.Security.LoginBan.Allowlist),
+				config.Security.Sessions.AbsoluteTimeoutHours,
+				config.Security.Sessions.PersistentTimeoutDays,
+				config.Security.Sessions.IdleTimeoutHours,
+				config.Security.OIDC.Enabled,
+				yamlEscape(config.Security.OIDC.Issuer),
+				yamlEscape(config.Security.OIDC.ClientID),
+				yamlEscape(config.Security.OIDC.ClientSecret),
+				yamlEscape(config.Security.OIDC.RedirectURL),
+				yamlEscape(config.Security.OIDC.Scopes),
+				yamlEscape(config.Security.OIDC.UsernameClaim),
+				yamlEscape(config.Security.OIDC.RoleClaim),
+				yamlEscape(config.Security.OIDC.AdminValues),
+				yamlEscape(config.Security.OIDC.EditorValues),
+				yamlEscape(config.Security.OIDC.DefaultRole),
+				yamlEscape(config.Security.OIDC.ButtonLabel),
+				config.Security.LDAP.Enabled,
+				yamlEscape(config.Security.LDAP.URL),
+				config.Security.LDAP.StartTLS,
+				config.Security.LDAP.InsecureSkipVerify,
+				yamlEscape(config.Security.LDAP.BindDN),
+				yamlEscape(config.Security.LDAP.BindPassword),
+				yamlEscape(config.Security.LDAP.UserDNTemplate),
+				yamlEscape(config.Security.LDAP.BaseDN),
+				yamlEscape(config.Security.LDAP.UserFilter),
+				yamlEscape(config.Security.LDAP.GroupAttribute),
+				yamlEscape(config.Security.LDAP.AdminGroups),
+				yamlEscape(config.Security.LDAP.EditorGroups),
+				yamlEscape(config.Security.LDAP.DefaultRole),
+				config.Security.TwoFactor.RequireForAdmins,
+				config.Security.TwoFactor.RequireForEditors,
+				config.Security.PasswordPolicy.MinLength,
+				config.Security.PasswordPolicy.CheckBreached,
+				config.Security.Registration.Enabled,
+				yamlEscape(config.Security.Registration.DefaultRole),
+				config.Security.PasswordReset.LinkValidHours,
+				config.Security.PasswordReset.SelfService,
+				yamlEscape(config.Security.PasswordReset.BaseURL),
+				yamlEscape(config.Security.CSRF.TrustedOrigins),
+				yamlEscape(config.Security.CSP.Mode),
+				yamlEscape(config.Security.ReverseProxy.TrustedProxies),
+				config.Security.ReverseProxy.AuthEnabled,
+				yamlEscape(config.Security.ReverseProxy.UserHeader),
+				yamlEscape(config.Security.ReverseProxy.GroupsHeader),
+				yamlEscape(config.Security.ReverseProxy.AdminGroups),
+				yamlEscape(config.Security.ReverseProxy.EditorGroups),
+				yamlEscape(config.Security.ReverseProxy.DefaultRole),
+				config.Security.RateLimit.Enabled,
+				config.Security.RateLimit.APIPerMinute,
+				config.Security.RateLimit.APIBurst,
+				config.Security.RateLimit.SearchPerMinute,
+				config.Security.RateLimit.SearchBurst,
+				config.Security.RateLimit.RenderPerMinute,
+				config.Security.RateLimit.RenderBurst,
+				config.Security.RateLimit.CommentsPerMinute,
+				config.Security.RateLimit.CommentsBurst,
+				config.Security.RateLimit.MetadataPerMinute,
+				config.Security.RateLimit.MetadataBurst,
+				config.Security.CommentSpam.MinIntervalSeconds,
+				config.Security.CommentSpam.MaxLinks,
+				yamlEscape(config.Security.CommentSpam.BannedWords),
+				yamlEscape(config.Security.LinkMetadata.AllowedNetworks),
+				config.Security.LinkMetadata.CacheHours,
+				yamlEscape(config.SMTP.Host),
+				config.SMTP.Port,
+				yamlEscape(config.SMTP.Username),
+				yamlEscape(config.SMTP.Password),
+				yamlEscape(config.SMTP.From),
 			)
 
 			// Write the config file
-			err = os.WriteFile(path, []byte(configData), 0644)
+			err = writeConfigFile(path, []byte(configData))
 			if err != nil {
 				return nil, err
 			}
@@ -248,42 +425,176 @@ security:
         initial_ban_seconds: %d
         # Maximum ban duration in seconds (24 hours)
         max_ban_seconds: %d
-users:
-%s`
+        # Comma separated addresses or CIDRs that are never banned (e.g. 127.0.0.1, 10.0.0.0/8)
+        allowlist: "%s"
+    sessions:
+        # Maximum lifetime of a session in hours
+        absolute_timeout_hours: %d
+        # Maximum lifetime in days of a session created with "keep me logged in"
+        persistent_timeout_days: %d
+        # Sessions unused for this many hours expire (0 disables the idle timeout)
+        idle_timeout_hours: %d
+    oidc:
+        # Enable single sign-on with an OpenID Connect provider. Local login stays available.
+        enabled: %t
+        # Issuer URL, used to discover the provider's endpoints
+        issuer: "%s"
+        client_id: "%s"
+        client_secret: "%s"
+        # Callback URL registered with the provider, e.g. https://wiki.example.com/api/oidc/callback
+        redirect_url: "%s"
+        # Space separated scopes to request
+        scopes: "%s"
+        # ID token claim holding the username
+        username_claim: "%s"
+        # ID token claim holding the user's groups or roles
+        role_claim: "%s"
+        # Comma separated claim values that grant the admin and editor roles
+        admin_values: "%s"
+        editor_values: "%s"
+        # Role of users matching neither list; leave empty to refuse them
+        default_role: "%s"
+        # Text of the single sign-on button on the login form
+        button_label: "%s"
+    ldap:
+        # Let users log in with their LDAP or Active Directory password. Local users keep working.
+        enabled: %t
+        # ldap://host:389 or ldaps://host:636
+        url: "%s"
+        # Upgrade ldap:// connections with StartTLS
+        start_tls: %t
+        # Skip certificate verification (testing only)
+        insecure_skip_verify: %t
+        # Service account used to search for users; leave empty to search anonymously
+        bind_dn: "%s"
+        bind_password: "%s"
+        # Bind directly with this DN, %%s being the username, instead of searching (e.g. uid=%%s,ou=people,dc=example,dc=com)
+        user_dn_template: "%s"
+        # Where to search for users, and the filter that finds them (%%s is the username)
+        base_dn: "%s"
+        user_filter: "%s"
+        # User attribute listing the user's groups
+        group_attribute: "%s"
+        # Semicolon separated group DNs or names (e.g. cn=wiki-admins,ou=groups,dc=example,dc=com or wiki-admins)
+        # that grant the admin and editor roles
+        admin_groups: "%s"
+        editor_groups: "%s"
+        # Role of users in neither group list; leave empty to refuse them
+        default_role: "%s"
+    two_factor:
+        # Require admins and editors to set up an authenticator app (TOTP) before they can log in
+        require_for_admins: %t
+        require_for_editors: %t
+    password_policy:
+        # Applied to new passwords; existing passwords keep working
+        min_length: %d
+        # Refuse passwords that appear in the bundled list of common breached passwords
+        check_breached: %t
+    registration:
+        # Let visitors sign up on /register. Their accounts can't log in until an admin approves them
+        # in the users panel. Invitation links work whether this is enabled or not.
+        enabled: %t
+        # Role of self-registered users
+        default_role: "%s"
+    password_reset:
+        # Hours a password reset link can be used, whether created by an admin or requested by email
+        link_valid_hours: %d
+        # Let users request a reset link by email from the login page; needs the smtp settings below
+        self_service: %t
+        # External address of the wiki (e.g. https://wiki.example.com) used in emailed links
+        base_url: "%s"
+    csrf:
+        # Browsers may only send changing requests (POST, PUT, DELETE) from the wiki's own pages.
+        # List other origins that may, comma separated (e.g. https://wiki.example.com when a proxy
+        # rewrites the Host header). Requests with API tokens are always allowed.
+        trusted_origins: "%s"
+    csp:
+        # "enforce" blocks scripts that don't come from the wiki; "report-only" only logs what would be
+        # blocked, to try the policy with custom scripts or styles first
+        mode: "%s"
+    reverse_proxy:
+        # Comma separated addresses or CIDRs of reverse proxies (e.g. 127.0.0.1, 10.0.0.0/8); only their
+        # X-Forwarded-For headers are believed when telling clients apart
+        trusted_proxies: "%s"
+        # Log users in from headers set by an authenticating proxy such as oauth2-proxy or Authelia.
+        # The headers are only read from requests coming from a trusted proxy.
+        auth_enabled: %t
+        user_header: "%s"
+        # Header with the user's comma separated groups, mapped to roles with the lists below
+        groups_header: "%s"
+        admin_groups: "%s"
+        editor_groups: "%s"
+        # Role of users in neither group list; leave empty to refuse them
+        default_role: "%s"
+    rate_limit:
+        # Limit API requests per user, or per IP address for requests without a login. Every class of
+        # requests has its own budget: requests per minute, and how many may come at once (burst).
+        # A per_minute of 0 removes the limit of that class.
+        enabled: %t
+        # All API requests not in one of the classes below
+        api_per_minute: %d
+        api_burst: %d
+        search_per_minute: %d
+        search_burst: %d
+        # Markdown previews, which need no login
+        render_per_minute: %d
+        render_burst: %d
+        # Posting comments
+        comments_per_minute: %d
+        comments_burst: %d
+        # Fetching titles and descriptions of pasted links
+        metadata_per_minute: %d
+        metadata_burst: %d
+    comment_spam:
+        # Seconds a user has to wait between two comments (0 disables the check)
+        min_interval_seconds: %d
+        # Comments with more links than this are refused (0 disables the check)
+        max_links: %d
+        # Comma separated words and phrases that comments may not contain, ignoring case
+        banned_words: "%s"
+    link_metadata:
+        # Titles and descriptions of pasted links are never fetched from loopback, private or link-local
+        # addresses. List the networks that may be fetched from anyway, comma separated addresses or
+        # CIDRs (e.g. 10.1.0.0/16 for an intranet)
+        allowed_networks: "%s"
+        # Hours fetched titles and descriptions are kept on disk (0 disables the cache)
+        cache_hours: %d
+smtp:
+    # Mail server for password reset emails; leave the host empty to send no email
+    host: "%s"
+    # 587 uses STARTTLS, 465 implicit TLS
+    port: %d
+    username: "%s"
+    password: "%s"
+    # Sender address, e.g. "Wiki <wiki@example.com>"
+    from: "%s"`
 }
 
-// FormatUserEntry formats a single user entry for the config file
-func FormatUserEntry(user User) string {
-	return fmt.Sprintf("    - username: %s\n      password: %s\n      role: %s",
-		user.Username, user.Password, user.Role)
+// yamlEscape escapes s for a double-quoted YAML string of the template, so quotes, backslashes
+// and line breaks in a value can't end the string early and add settings of their own
+func yamlEscape(s string) string {
+	// The escapes of strconv.Quote (\\, \", \n, \uNNNN...) mean the same in YAML for valid UTF-8
+	quoted := strconv.Quote(s)
+	return quoted[1 : len(quoted)-1]
 }
 
 // SaveConfig saves the configuration to a writer
 func SaveConfig(cfg *Config, w io.Writer) error {
-	// Format all users
-	var usersStr strings.Builder
-	for _, user := range cfg.Users {
-		if usersStr.Len() > 0 {
-			usersStr.WriteString("\n")
-		}
-		usersStr.WriteString(FormatUserEntry(user))
-	}
-
 	// Fill in the template with values from the config
 	configData := fmt.Sprintf(
 		GetConfigTemplate(),
-		cfg.Server.Host,
+		yamlEscape(cfg.Server.Host),
 		cfg.Server.Port,
 		cfg.Server.AllowInsecureCookies,
 		cfg.Server.SSL,
-		cfg.Server.SSLCert,
-		cfg.Server.SSLKey,
-		cfg.Wiki.RootDir,
-		cfg.Wiki.DocumentsDir,
-		cfg.Wiki.Title,
-		cfg.Wiki.Owner,
-		cfg.Wiki.Notice,
-		cfg.Wiki.Timezone,
+		yamlEscape(cfg.Server.SSLCert),
+		yamlEscape(cfg.Server.SSLKey),
+		yamlEscape(cfg.Wiki.RootDir),
+		yamlEscape(cfg.Wiki.DocumentsDir),
+		yamlEscape(cfg.Wiki.Title),
+		yamlEscape(cfg.Wiki.Owner),
+		yamlEscape(cfg.Wiki.Notice),
+		yamlEscape(cfg.Wiki.Timezone),
 		cfg.Wiki.Private,
 		cfg.Wiki.DisableComments,
 		cfg.Wiki.DisableFileUploadChecking,
@@ -292,13 +603,80 @@ func SaveConfig(cfg *Config, w io.Writer) error {
 		cfg.Wiki.DisableContentMaxWidth,
 		cfg.Wiki.MaxVersions,
 		cfg.Wiki.MaxUploadSize,
-		cfg.Wiki.Language,
+		yamlEscape(cfg.Wiki.Language),
 		cfg.Security.LoginBan.Enabled,
 		cfg.Security.LoginBan.MaxFailures,
 		cfg.Security.LoginBan.WindowSeconds,
 		cfg.Security.LoginBan.InitialBanSeconds,
 		cfg.Security.LoginBan.MaxBanSeconds,
-		usersStr.String(),
+		yamlEscape(cfg.Security.LoginBan.Allowlist),
+		cfg.Security.Sessions.AbsoluteTimeoutHours,
+		cfg.Security.Sessions.PersistentTimeoutDays,
+		cfg.Security.Sessions.IdleTimeoutHours,
+		cfg.Security.OIDC.Enabled,
+		yamlEscape(cfg.Security.OIDC.Issuer),
+		yamlEscape(cfg.Security.OIDC.ClientID),
+		yamlEscape(cfg.Security.OIDC.ClientSecret),
+		yamlEscape(cfg.Security.OIDC.RedirectURL),
+		yamlEscape(cfg.Security.OIDC.Scopes),
+		yamlEscape(cfg.Security.OIDC.UsernameClaim),
+		yamlEscape(cfg.Security.OIDC.RoleClaim),
+		yamlEscape(cfg.Security.OIDC.AdminValues),
+		yamlEscape(cfg.Security.OIDC.EditorValues),
+		yamlEscape(cfg.Security.OIDC.DefaultRole),
+		yamlEscape(cfg.Security.OIDC.ButtonLabel),
+		cfg.Security.LDAP.Enabled,
+		yamlEscape(cfg.Security.LDAP.URL),
+		cfg.Security.LDAP.StartTLS,
+		cfg.Security.LDAP.InsecureSkipVerify,
+		yamlEscape(cfg.Security.LDAP.BindDN),
+		yamlEscape(cfg.Security.LDAP.BindPassword),
+		yamlEscape(cfg.Security.LDAP.UserDNTemplate),
+		yamlEscape(cfg.Security.LDAP.BaseDN),
+		yamlEscape(cfg.Security.LDAP.UserFilter),
+		yamlEscape(cfg.Security.LDAP.GroupAttribute),
+		yamlEscape(cfg.Security.LDAP.AdminGroups),
+		yamlEscape(cfg.Security.LDAP.EditorGroups),
+		yamlEscape(cfg.Security.LDAP.DefaultRole),
+		cfg.Security.TwoFactor.RequireForAdmins,
+		cfg.Security.TwoFactor.RequireForEditors,
+		cfg.Security.PasswordPolicy.MinLength,
+		cfg.Security.PasswordPolicy.CheckBreached,
+		cfg.Security.Registration.Enabled,
+		yamlEscape(cfg.Security.Registration.DefaultRole),
+		cfg.Security.PasswordReset.LinkValidHours,
+		cfg.Security.PasswordReset.SelfService,
+		yamlEscape(cfg.Security.PasswordReset.BaseURL),
+		yamlEscape(cfg.Security.CSRF.TrustedOrigins),
+		yamlEscape(cfg.Security.CSP.Mode),
+		yamlEscape(cfg.Security.ReverseProxy.TrustedProxies),
+		cfg.Security.ReverseProxy.AuthEnabled,
+		yamlEscape(cfg.Security.ReverseProxy.UserHeader),
+		yamlEscape(cfg.Security.ReverseProxy.GroupsHeader),
+		yamlEscape(cfg.Security.ReverseProxy.AdminGroups),
+		yamlEscape(cfg.Security.ReverseProxy.EditorGroups),
+		yamlEscape(cfg.Security.ReverseProxy.DefaultRole),
+		cfg.Security.RateLimit.Enabled,
+		cfg.Security.RateLimit.APIPerMinute,
+		cfg.Security.RateLimit.APIBurst,
+		cfg.Security.RateLimit.SearchPerMinute,
+		cfg.Security.RateLimit.SearchBurst,
+		cfg.Security.RateLimit.RenderPerMinute,
+		cfg.Security.RateLimit.RenderBurst,
+		cfg.Security.RateLimit.CommentsPerMinute,
+		cfg.Security.RateLimit.CommentsBurst,
+		cfg.Security.RateLimit.MetadataPerMinute,
+		cfg.Security.RateLimit.MetadataBurst,
+		cfg.Security.CommentSpam.MinIntervalSeconds,
+		cfg.Security.CommentSpam.MaxLinks,
+		yamlEscape(cfg.Security.CommentSpam.BannedWords),
+		yamlEscape(cfg.Security.LinkMetadata.AllowedNetworks),
+		cfg.Security.LinkMetadata.CacheHours,
+		yamlEscape(cfg.SMTP.Host),
+		cfg.SMTP.Port,
+		yamlEscape(cfg.SMTP.Username),
+		yamlEscape(cfg.SMTP.Password),
+		yamlEscape(cfg.SMTP.From),
 	)
 
 	_, err := w.Write([]byte(configData))
@@ -326,9 +704,34 @@ func ensureCompleteConfig(path string, cfg *Config, original []byte) error {
 
 	// Otherwise, overwrite the file with the fully rendered configuration that now contains
 	// any newly introduced settings.
-	if err := os.WriteFile(path, newData, 0644); err != nil {
+	if err := writeConfigFile(path, newData); err != nil {
 		return fmt.Errorf("failed to update config file with new settings: %w", err)
 	}
 
 	return nil
 }
+
+// writeConfigFile replaces the config file with data. The file holds secrets such as the SSO
+// client secret and SMTP password, so it is only readable by its owner, and it is written to a
+// temporary file first so that a crash can't leave a half written config behind.
+func writeConfigFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0600)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	return err
+}
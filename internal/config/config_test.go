@@ -0,0 +1,59 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigCreatesPrivateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "config.yaml")
+	if _, err := LoadConfig(path); err != nil {
+		t.Fatalf("Failed to create the default config: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected the config file to exist: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("Expected mode 0600, got: %o", mode)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".*.tmp")); len(leftovers) > 0 {
+		t.Errorf("Expected no temporary files left behind, got: %v", leftovers)
+	}
+}
+
+func TestSaveConfigEscapesValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to create the default config: %v", err)
+	}
+
+	// Values that would end the quoted string early and add settings of their own
+	cfg.Wiki.Title = "Team \"wiki\"\nserver:\n  port: 1"
+	cfg.SMTP.Password = `p\a"ss`
+	cfg.Security.OIDC.ClientSecret = "tab\there ünïcode"
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to open the config file: %v", err)
+	}
+	err = SaveConfig(cfg, f)
+	f.Close()
+	if err != nil {
+		t.Fatalf("Failed to save the config: %v", err)
+	}
+
+	loaded, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to reload the config: %v", err)
+	}
+	if loaded.Wiki.Title != cfg.Wiki.Title || loaded.SMTP.Password != cfg.SMTP.Password || loaded.Security.OIDC.ClientSecret != cfg.Security.OIDC.ClientSecret {
+		t.Errorf("Expected values to survive a round trip, got: %q, %q, %q", loaded.Wiki.Title, loaded.SMTP.Password, loaded.Security.OIDC.ClientSecret)
+	}
+	if loaded.Server.Port != cfg.Server.Port {
+		t.Errorf("Expected port %d, got: %d", cfg.Server.Port, loaded.Server.Port)
+	}
+}
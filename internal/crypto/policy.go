@@ -0,0 +1,59 @@
+package crypto
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// breachedList is a bundled list of common passwords from public breach corpora
+//
+//go:embed breached_passwords.txt
+var breachedList string
+
+var (
+	breachedOnce sync.Once
+	breached     map[string]bool
+)
+
+// ErrBreachedPassword is returned for passwords that appear in the list of breached passwords
+var ErrBreachedPassword = errors.New("this password is too common and appears in lists of breached passwords")
+
+// PasswordTooShortError is returned for passwords shorter than the minimum length
+type PasswordTooShortError struct {
+	MinLength int
+}
+
+func (e *PasswordTooShortError) Error() string {
+	return fmt.Sprintf("password must be at least %d characters long", e.MinLength)
+}
+
+// CheckPasswordPolicy checks a new password against the password policy. A minLength of zero or
+// less doesn't limit the length.
+func CheckPasswordPolicy(password string, minLength int, checkBreached bool) error {
+	if utf8.RuneCountInString(password) < minLength {
+		return &PasswordTooShortError{MinLength: minLength}
+	}
+	if checkBreached && IsBreachedPassword(password) {
+		return ErrBreachedPassword
+	}
+	return nil
+}
+
+// IsBreachedPassword reports whether password is in the bundled list of breached passwords,
+// ignoring case
+func IsBreachedPassword(password string) bool {
+	breachedOnce.Do(func() {
+		breached = make(map[string]bool)
+		for _, line := range strings.Split(breachedList, "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				breached[strings.ToLower(line)] = true
+			}
+		}
+	})
+	return breached[strings.ToLower(password)]
+}
@@ -0,0 +1,73 @@
+// Package csp builds the Content-Security-Policy of the wiki's pages and carries the per-request
+// nonce that lets the few inline scripts of the templates run.
+package csp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// Modes of the policy
+const (
+	ModeEnforce    = "enforce"
+	ModeReportOnly = "report-only"
+)
+
+// ReportPath is where browsers send violation reports
+const ReportPath = "/api/csp-report"
+
+type nonceKey struct{}
+
+// NewNonce returns a random nonce for one response
+func NewNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// WithNonce returns a copy of the request that carries the nonce for its templates
+func WithNonce(r *http.Request, nonce string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), nonceKey{}, nonce))
+}
+
+// Nonce returns the nonce of the request, or an empty string outside of the middleware
+func Nonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(nonceKey{}).(string)
+	return nonce
+}
+
+// HeaderName returns the response header that carries the policy in the given mode
+func HeaderName(mode string) string {
+	if mode == ModeReportOnly {
+		return "Content-Security-Policy-Report-Only"
+	}
+	return "Content-Security-Policy"
+}
+
+// Policy returns the policy for a response with the given nonce. Scripts need the nonce or must
+// come from the wiki itself; styles still allow inline style attributes, which templates,
+// rendered markdown and libraries such as MathJax and Mermaid rely on.
+func Policy(nonce string) string {
+	directives := []string{
+		"default-src 'self'",
+		"script-src 'self' 'nonce-" + nonce + "'",
+		"style-src 'self' 'unsafe-inline'",
+		// Documents may show images and media from anywhere
+		"img-src 'self' data: blob: https:",
+		"media-src 'self' https:",
+		"connect-src 'self'",
+		"font-src 'self' data:",
+		"object-src 'none'",
+		// Video embeds from YouTube and Vimeo
+		"frame-src 'self' https://*.youtube.com https://*.youtube-nocookie.com https://*.vimeo.com",
+		"frame-ancestors 'self'",
+		"form-action 'self'",
+		"base-uri 'self'",
+		"report-uri " + ReportPath,
+		"report-to csp",
+	}
+	return strings.Join(directives, "; ")
+}
@@ -2,6 +2,9 @@ package frontmatter
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -10,14 +13,38 @@ import (
 // Metadata represents the frontmatter data structure
 // This can be expanded with additional fields in the future
 type Metadata struct {
-	Layout string `yaml:"layout,omitempty"`
+	Layout string  `yaml:"layout,omitempty"`
+	Access *Access `yaml:"access,omitempty"` // Who may read and edit this directory and everything below it
 	// Add additional fields here as needed
 }
 
+// Access lists the users allowed into a directory. Entries are usernames, "group:<name>",
+// "role:<role>" or "*" for everyone. A list that is left out is inherited from the parent directory.
+type Access struct {
+	Read  []string `yaml:"read,omitempty"`
+	Write []string `yaml:"write,omitempty"`
+}
+
+// ErrInvalidAccess is returned by ParseAccess when the frontmatter has an access block that can't be read
+var ErrInvalidAccess = errors.New("invalid access rules in frontmatter")
+
+// accessKey matches the access key of a frontmatter block
+var accessKey = regexp.MustCompile(`(?m)^access\s*:`)
+
+// normalize converts the line endings of content with Windows style frontmatter, so that the
+// delimiters are found either way
+func normalize(content string) string {
+	if strings.HasPrefix(content, "---\r\n") {
+		return strings.ReplaceAll(content, "\r\n", "\n")
+	}
+	return content
+}
+
 // Parse extracts and parses frontmatter from markdown content
 // Returns the parsed metadata and the content without frontmatter
 func Parse(content string) (Metadata, string, bool) {
 	var metadata Metadata
+	content = normalize(content)
 
 	// Check if the content starts with frontmatter delimiter
 	if !strings.HasPrefix(content, "---\n") {
@@ -47,8 +74,28 @@ func Parse(content string) (Metadata, string, bool) {
 	return metadata, remainingContent, true
 }
 
+// ParseAccess returns the access rules in the frontmatter of content, or nil when it has none.
+// Unlike Parse, it doesn't pass over frontmatter that fails to parse when it has an access key:
+// rules that can't be read must not be mistaken for no rules at all.
+func ParseAccess(content string) (*Access, error) {
+	fmContent := Extract(content)
+	if fmContent == "" {
+		return nil, nil
+	}
+
+	var metadata Metadata
+	if err := yaml.Unmarshal([]byte(fmContent), &metadata); err != nil {
+		if accessKey.MatchString(fmContent) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAccess, err)
+		}
+		return nil, nil
+	}
+	return metadata.Access, nil
+}
+
 // HasFrontmatter checks if content has frontmatter
 func HasFrontmatter(content string) bool {
+	content = normalize(content)
 	if !strings.HasPrefix(content, "---\n") {
 		return false
 	}
@@ -59,6 +106,7 @@ func HasFrontmatter(content string) bool {
 
 // Extract returns just the frontmatter as a string
 func Extract(content string) string {
+	content = normalize(content)
 	if !strings.HasPrefix(content, "---\n") {
 		return ""
 	}
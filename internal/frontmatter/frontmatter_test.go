@@ -0,0 +1,61 @@
+package frontmatter
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseAccess(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected *Access
+		wantErr  bool
+	}{
+		{name: "No frontmatter", content: "# Title\n", expected: nil},
+		{name: "Frontmatter without access", content: "---\nlayout: kanban\n---\n# Title\n", expected: nil},
+		{
+			name:     "Read and write lists",
+			content:  "---\naccess:\n  read: [\"*\"]\n  write: [jane, \"group:staff\", \"role:editor\"]\n---\n",
+			expected: &Access{Read: []string{"*"}, Write: []string{"jane", "group:staff", "role:editor"}},
+		},
+		{
+			name:     "Missing write list",
+			content:  "---\naccess:\n  read: [jane]\n---\n",
+			expected: &Access{Read: []string{"jane"}},
+		},
+		{
+			name:     "Empty write list",
+			content:  "---\naccess:\n  read: [jane]\n  write: []\n---\n",
+			expected: &Access{Read: []string{"jane"}, Write: []string{}},
+		},
+		{
+			name:     "Windows line endings",
+			content:  "---\r\naccess:\r\n  read: [jane]\r\n---\r\n",
+			expected: &Access{Read: []string{"jane"}},
+		},
+		{name: "Broken access block", content: "---\naccess:\n  read: [jane\n---\n", wantErr: true},
+		{name: "Access key of the wrong type", content: "---\naccess: everyone\n---\n", wantErr: true},
+		{name: "Broken frontmatter without access", content: "---\nlayout: [kanban\n---\n", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ParseAccess(tt.content)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAccess) {
+					t.Fatalf("Expected ErrInvalidAccess, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			// DeepEqual tells an empty list, which locks everyone out, from a missing one
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Expected: %#v, got: %#v", tt.expected, result)
+			}
+		})
+	}
+}
@@ -457,7 +457,7 @@ func RenderLinks(content string) (string, error) {
 
     <!-- Floating Add Link button for admin/editor users -->
     <div class="floating-add-link-container editor-admin-only">
-        <button class="floating-add-link-btn" onclick="showAddLinkDialog()" title="` + i18n.Translate("links.add_new_link") + `">
+        <button class="floating-add-link-btn" title="` + i18n.Translate("links.add_new_link") + `">
             <i class="fa fa-plus"></i>
         </button>
     </div>
@@ -10,6 +10,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"wiki-go/internal/acl"
 )
 
 // StatsPreprocessor processes stats shortcodes in markdown text
@@ -189,7 +190,7 @@ func countDocuments(dirPath string) int {
 		}
 
 		// Count only document.md files
-		if !info.IsDir() && filepath.Base(path) == "document.md" {
+		if !info.IsDir() && filepath.Base(path) == "document.md" && publicDocument(filepath.Dir(path)) {
 			count++
 		}
 
@@ -215,7 +216,7 @@ func getRecentDocuments(dirPath string, count int) []Document {
 		}
 
 		// Process only document.md files
-		if !info.IsDir() && filepath.Base(path) == "document.md" {
+		if !info.IsDir() && filepath.Base(path) == "document.md" && publicDocument(filepath.Dir(path)) {
 			// Get the document directory
 			docDir := filepath.Dir(path)
 
@@ -258,6 +259,16 @@ func getRecentDocuments(dirPath string, count int) []Document {
 	return docs
 }
 
+// publicDocument reports whether everyone may read the document in docDir. Stats are rendered
+// the same for every visitor, so documents with read restrictions are left out of them.
+func publicDocument(docDir string) bool {
+	relPath, err := filepath.Rel("data/documents", docDir)
+	if err != nil {
+		return false
+	}
+	return acl.CanRead(nil, relPath)
+}
+
 // extractDocumentTitle extracts the first H1 title from a markdown file
 func extractDocumentTitle(filePath string) string {
 	file, err := os.Open(filePath)
@@ -6,6 +6,14 @@ import (
 	"strings"
 )
 
+// TocHeading is a heading collected for the table of contents
+type TocHeading struct {
+	Level int
+	Text  string
+	ID    string
+	Line  string // Store the original line
+}
+
 // TocPreprocessor adds support for [toc] markers
 // This generates the complete table of contents during markdown processing
 // by scanning for headings in the document and building the TOC HTML structure
@@ -14,18 +22,78 @@ func TocPreprocessor(markdown string, _ string) string {
 	lines := strings.Split(markdown, "\n")
 	var result []string
 
-	inCodeBlock := false
 	tocMarker := regexp.MustCompile(`^\s*\[toc\]\s*$`)
-	headingRegex := regexp.MustCompile(`^(#{1,6})\s+(.+?)(?:\s+\{#([a-zA-Z0-9-]+)\})?$`)
 
 	// First pass: collect all headings and their levels
-	var headings []struct {
-		Level int
-		Text  string
-		ID    string
-		Line  string // Store the original line
+	headings := collectHeadings(lines)
+
+	// Second pass: Replace [toc] markers with generated TOC, but use the updated lines
+	inCodeBlock := false
+	for _, line := range lines {
+		trimmedLine := strings.TrimSpace(line)
+
+		// Check if this line starts or ends a code block
+		if strings.HasPrefix(trimmedLine, "```") || strings.HasPrefix(trimmedLine, "~~~") {
+			inCodeBlock = !inCodeBlock
+			result = append(result, line)
+			continue
+		}
+
+		// If we're in a code block, don't process
+		if inCodeBlock {
+			result = append(result, line)
+			continue
+		}
+
+		// Process [toc] markers outside of code blocks
+		if tocMarker.MatchString(trimmedLine) {
+			// Generate TOC HTML
+			tocHTML := generateTOCHTML(headings)
+			result = append(result, tocHTML)
+		} else {
+			// Check for inline code sections and preserve them
+			var processedLine string
+			segments := strings.Split(line, "`")
+
+			for j, segment := range segments {
+				if j%2 == 0 {
+					// Outside inline code
+					if strings.Contains(segment, "[toc]") {
+						// Replace [toc] with generated TOC HTML
+						segment = strings.ReplaceAll(segment, "[toc]", generateTOCHTML(headings))
+					}
+					processedLine += segment
+				} else {
+					// Inside inline code - preserve it
+					processedLine += "`" + segment + "`"
+				}
+			}
+
+			if processedLine != "" {
+				result = append(result, processedLine)
+			} else {
+				result = append(result, line)
+			}
+		}
 	}
 
+	return strings.Join(result, "\n")
+}
+
+// CollectHeadings returns the headings of a markdown document with the same IDs
+// that TocPreprocessor assigns to them
+func CollectHeadings(markdown string) []TocHeading {
+	return collectHeadings(strings.Split(markdown, "\n"))
+}
+
+// collectHeadings collects all headings outside of code blocks and adds an {#id}
+// attribute to every heading line that doesn't have one yet
+func collectHeadings(lines []string) []TocHeading {
+	inCodeBlock := false
+	headingRegex := regexp.MustCompile(`^(#{1,6})\s+(.+?)(?:\s+\{#([a-zA-Z0-9-]+)\})?$`)
+
+	var headings []TocHeading
+
 	// Track used IDs to avoid duplicates
 	usedIDs := make(map[string]bool)
 
@@ -66,7 +134,7 @@ func TocPreprocessor(markdown string, _ string) string {
 			if existingID != "" {
 				id = existingID
 			} else {
-				id = makeSlug(idText)
+				id = MakeSlug(idText)
 			}
 
 			// Ensure unique IDs
@@ -80,12 +148,7 @@ func TocPreprocessor(markdown string, _ string) string {
 			// Mark this ID as used
 			usedIDs[id] = true
 
-			headings = append(headings, struct {
-				Level int
-				Text  string
-				ID    string
-				Line  string
-			}{Level: level, Text: text, ID: id, Line: line})
+			headings = append(headings, TocHeading{Level: level, Text: text, ID: id, Line: line})
 
 			// If this heading doesn't already have an ID, we need to update it in the original lines
 			if existingID == "" {
@@ -94,61 +157,11 @@ func TocPreprocessor(markdown string, _ string) string {
 		}
 	}
 
-	// Second pass: Replace [toc] markers with generated TOC, but use the updated lines
-	inCodeBlock = false
-	for _, line := range lines {
-		trimmedLine := strings.TrimSpace(line)
-
-		// Check if this line starts or ends a code block
-		if strings.HasPrefix(trimmedLine, "```") || strings.HasPrefix(trimmedLine, "~~~") {
-			inCodeBlock = !inCodeBlock
-			result = append(result, line)
-			continue
-		}
-
-		// If we're in a code block, don't process
-		if inCodeBlock {
-			result = append(result, line)
-			continue
-		}
-
-		// Process [toc] markers outside of code blocks
-		if tocMarker.MatchString(trimmedLine) {
-			// Generate TOC HTML
-			tocHTML := generateTOCHTML(headings)
-			result = append(result, tocHTML)
-		} else {
-			// Check for inline code sections and preserve them
-			var processedLine string
-			segments := strings.Split(line, "`")
-
-			for j, segment := range segments {
-				if j%2 == 0 {
-					// Outside inline code
-					if strings.Contains(segment, "[toc]") {
-						// Replace [toc] with generated TOC HTML
-						segment = strings.ReplaceAll(segment, "[toc]", generateTOCHTML(headings))
-					}
-					processedLine += segment
-				} else {
-					// Inside inline code - preserve it
-					processedLine += "`" + segment + "`"
-				}
-			}
-
-			if processedLine != "" {
-				result = append(result, processedLine)
-			} else {
-				result = append(result, line)
-			}
-		}
-	}
-
-	return strings.Join(result, "\n")
+	return headings
 }
 
-// makeSlug creates a URL-friendly slug from text
-func makeSlug(text string) string {
+// MakeSlug creates a URL-friendly slug from text
+func MakeSlug(text string) string {
 	// Convert to lowercase
 	text = strings.ToLower(text)
 
@@ -182,12 +195,7 @@ func makeSlug(text string) string {
 }
 
 // Generate the HTML for the table of contents
-func generateTOCHTML(headings []struct {
-	Level int
-	Text  string
-	ID    string
-	Line  string
-}) string {
+func generateTOCHTML(headings []TocHeading) string {
 	if len(headings) == 0 {
 		return `<div class="wiki-toc"><p class="toc-empty">No headings found in this document.</p></div>`
 	}
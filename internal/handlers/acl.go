@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"wiki-go/internal/acl"
+	"wiki-go/internal/auth"
+	"wiki-go/internal/frontmatter"
+	"wiki-go/internal/roles"
+	"wiki-go/internal/types"
+)
+
+// denyDocument answers a page request for a document the session may not read. Visitors are
+// sent to the login page; logged in users get the not found page, so that restricted documents
+// look the same as missing ones.
+func denyDocument(w http.ResponseWriter, r *http.Request, session *auth.Session) {
+	if session == nil {
+		http.Redirect(w, r, "/login?redirect="+url.QueryEscape(r.URL.Path), http.StatusFound)
+		return
+	}
+	NotFoundHandler(w, r, cfg)
+}
+
+// pagePermissions returns what the session may do on a page, for the templates, along with the
+// built-in role whose controls fit. Users that may not change the page lose the permissions to
+// edit it, so they only get a viewer's controls there.
+func pagePermissions(session *auth.Session, writable bool) (string, map[string]bool) {
+	granted := make(map[string]bool)
+	if session == nil {
+		return "", granted
+	}
+
+	var kept []string
+	for _, permission := range auth.Permissions(session) {
+		switch permission {
+		case roles.PermPageEdit, roles.PermPageDelete, roles.PermFileUpload:
+			if !writable {
+				continue
+			}
+		}
+		granted[permission] = true
+		kept = append(kept, permission)
+	}
+	return auth.InterfaceRole(kept), granted
+}
+
+// fileDocumentPath returns the document an attachment path of the files API belongs to. Paths
+// under pages/ are the homepage's.
+func fileDocumentPath(path string) string {
+	if strings.HasPrefix(path, "pages/") {
+		return ""
+	}
+	return path
+}
+
+// filterNavigation removes the directories the session may not read from a navigation tree
+func filterNavigation(item *types.NavItem, session *auth.Session) {
+	if item == nil {
+		return
+	}
+	children := item.Children[:0]
+	for _, child := range item.Children {
+		if !acl.CanRead(session, child.Path) {
+			continue
+		}
+		filterNavigation(child, session)
+		children = append(children, child)
+	}
+	item.Children = children
+}
+
+// subtreeWritable reports whether the session may change docPath and every directory below it,
+// fullPath being its location on disk. Deleting or moving a directory takes its subdirectories
+// along, and those can have stricter rules of their own.
+func subtreeWritable(session *auth.Session, docPath, fullPath string) bool {
+	writable := true
+	err := filepath.WalkDir(fullPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(fullPath, p)
+		if err != nil {
+			return err
+		}
+		if !acl.CanWrite(session, path.Join(docPath, filepath.ToSlash(rel))) {
+			writable = false
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return writable && err == nil
+}
+
+// accessChanged reports whether new document content changes the access frontmatter of the old
+func accessChanged(oldContent, newContent string) bool {
+	oldAccess, oldErr := frontmatter.ParseAccess(oldContent)
+	newAccess, newErr := frontmatter.ParseAccess(newContent)
+	if oldErr != nil || newErr != nil {
+		// Rules that can't be read deny everyone, so fixing or breaking them is a change too
+		return true
+	}
+	if oldAccess == nil {
+		oldAccess = &frontmatter.Access{}
+	}
+	if newAccess == nil {
+		newAccess = &frontmatter.Access{}
+	}
+
+	// An empty list locks everyone out while a missing one inherits, so they differ
+	sameList := func(a, b []string) bool {
+		return (a == nil) == (b == nil) && slices.Equal(a, b)
+	}
+	return !sameList(oldAccess.Read, newAccess.Read) || !sameList(oldAccess.Write, newAccess.Write)
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"wiki-go/internal/auth"
+	"wiki-go/internal/types"
+)
+
+// writeTestDocuments writes document.md files into the test wiki, by document path
+func writeTestDocuments(t *testing.T, documents map[string]string) {
+	t.Helper()
+	for docPath, content := range documents {
+		dir := filepath.Join(cfg.Wiki.RootDir, cfg.Wiki.DocumentsDir, filepath.FromSlash(docPath))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", docPath, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "document.md"), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", docPath, err)
+		}
+	}
+}
+
+func TestAccessChanged(t *testing.T) {
+	tests := []struct {
+		name     string
+		old      string
+		new      string
+		expected bool
+	}{
+		{name: "Body edited", old: "# Guide\n", new: "# Guide\n\nMore text\n", expected: false},
+		{name: "Other frontmatter edited", old: "---\nlayout: kanban\naccess:\n  read: [jane]\n---\n", new: "---\naccess:\n  read: [jane]\n---\n", expected: false},
+		{name: "Line endings changed", old: "---\naccess:\n  read: [jane]\n---\n", new: "---\r\naccess:\r\n  read: [jane]\r\n---\r\n", expected: false},
+		{name: "Rules added", old: "# Guide\n", new: "---\naccess:\n  read: [jane]\n---\n# Guide\n", expected: true},
+		{name: "Rules removed", old: "---\naccess:\n  write: [jane]\n---\n", new: "# Guide\n", expected: true},
+		{name: "User added", old: "---\naccess:\n  read: [jane]\n---\n", new: "---\naccess:\n  read: [jane, bob]\n---\n", expected: true},
+		{name: "Missing list made empty", old: "---\naccess:\n  read: [jane]\n---\n", new: "---\naccess:\n  read: [jane]\n  write: []\n---\n", expected: true},
+		{name: "Rules broken", old: "---\naccess:\n  read: [jane]\n---\n", new: "---\naccess:\n  read: [jane\n---\n", expected: true},
+		{name: "Broken rules fixed", old: "---\naccess: jane\n---\n", new: "---\naccess:\n  read: [jane]\n---\n", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := accessChanged(tt.old, tt.new); result != tt.expected {
+				t.Errorf("Expected: %t, got: %t", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestSubtreeWritable(t *testing.T) {
+	setupTestWiki(t)
+	writeTestDocuments(t, map[string]string{
+		"guide":                "# Guide\n",
+		"guide/intro":          "# Intro\n",
+		"guide/internal":       "---\naccess:\n  write: [jane]\n---\n# Internal\n",
+		"guide/internal/notes": "# Notes\n",
+	})
+
+	tests := []struct {
+		name     string
+		session  *auth.Session
+		docPath  string
+		expected bool
+	}{
+		{name: "Restricted subdirectory", session: &auth.Session{Username: "bob", Role: "editor"}, docPath: "guide", expected: false},
+		{name: "Restricted subdirectory allowing the user", session: &auth.Session{Username: "jane", Role: "editor"}, docPath: "guide", expected: true},
+		{name: "Unrestricted sibling", session: &auth.Session{Username: "bob", Role: "editor"}, docPath: "guide/intro", expected: true},
+		{name: "Restricted directory itself", session: &auth.Session{Username: "bob", Role: "editor"}, docPath: "guide/internal", expected: false},
+		{name: "Bypass", session: &auth.Session{Username: "root", Role: "admin"}, docPath: "guide", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fullPath := filepath.Join(cfg.Wiki.RootDir, cfg.Wiki.DocumentsDir, filepath.FromSlash(tt.docPath))
+			if result := subtreeWritable(tt.session, tt.docPath, fullPath); result != tt.expected {
+				t.Errorf("Expected: %t, got: %t", tt.expected, result)
+			}
+		})
+	}
+}
+
+// moveDocument calls MoveDocumentHandler with the test wiki's config
+func moveDocument(w http.ResponseWriter, r *http.Request) {
+	MoveDocumentHandler(w, r, cfg)
+}
+
+func TestDeleteAndMoveRestrictedSubtree(t *testing.T) {
+	setupTestWiki(t)
+	writeTestDocuments(t, map[string]string{
+		"guide":          "# Guide\n",
+		"guide/intro":    "# Intro\n",
+		"guide/internal": "---\naccess:\n  write: [jane]\n---\n# Internal\n",
+	})
+	bob := loginAs(t, "bob", "editor")
+	jane := loginAs(t, "jane", "editor")
+	exists := func(docPath string) bool {
+		_, err := os.Stat(filepath.Join(cfg.Wiki.RootDir, cfg.Wiki.DocumentsDir, docPath))
+		return err == nil
+	}
+
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		request  *http.Request
+		expected int
+		gone     string // Path that no longer exists afterwards
+	}{
+		{
+			name:     "Deleting a directory with a restricted subdirectory",
+			handler:  DeleteDocumentHandler,
+			request:  bob(http.MethodDelete, "/api/document/guide", ""),
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "Moving a directory with a restricted subdirectory",
+			handler:  moveDocument,
+			request:  bob(http.MethodPost, "/api/document/move", `{"sourcePath":"guide","newSlug":"manual"}`),
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "Deleting an unrestricted subdirectory",
+			handler:  DeleteDocumentHandler,
+			request:  bob(http.MethodDelete, "/api/document/guide/intro", ""),
+			expected: http.StatusOK,
+			gone:     "guide/intro",
+		},
+		{
+			name:     "Moving as a user the restriction allows",
+			handler:  moveDocument,
+			request:  jane(http.MethodPost, "/api/document/move", `{"sourcePath":"guide","newSlug":"manual"}`),
+			expected: http.StatusOK,
+			gone:     "guide",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler(rec, tt.request)
+			if rec.Code != tt.expected {
+				t.Fatalf("Expected status %d, got: %d (%s)", tt.expected, rec.Code, rec.Body.String())
+			}
+			if tt.gone != "" && exists(tt.gone) {
+				t.Errorf("Expected %s to be gone", tt.gone)
+			}
+		})
+	}
+
+	if !exists("manual/internal/document.md") {
+		t.Error("Expected the restricted subdirectory to move along")
+	}
+}
+
+func TestFilterNavigation(t *testing.T) {
+	setupTestWiki(t)
+	writeTestDocuments(t, map[string]string{
+		"open":        "# Open\n",
+		"open/hidden": "---\naccess:\n  read: [jane]\n---\n",
+		"hr":          "---\naccess:\n  read: [\"group:staff\"]\n---\n",
+		"hr/policies": "# Policies\n",
+	})
+	if err := os.WriteFile(filepath.Join(cfg.Wiki.RootDir, "acl.yaml"), []byte("groups:\n  staff: [amy]\n"), 0644); err != nil {
+		t.Fatalf("Failed to write acl.yaml: %v", err)
+	}
+
+	tree := func() *types.NavItem {
+		return &types.NavItem{Path: "/", Children: []*types.NavItem{
+			{Path: "/open", Children: []*types.NavItem{{Path: "/open/hidden"}}},
+			{Path: "/hr", Children: []*types.NavItem{{Path: "/hr/policies"}}},
+		}}
+	}
+	paths := func(item *types.NavItem) []string {
+		var list []string
+		var walk func(*types.NavItem)
+		walk = func(item *types.NavItem) {
+			for _, child := range item.Children {
+				list = append(list, child.Path)
+				walk(child)
+			}
+		}
+		walk(item)
+		return list
+	}
+
+	tests := []struct {
+		name     string
+		session  *auth.Session
+		expected []string
+	}{
+		{name: "Visitor", session: nil, expected: []string{"/open"}},
+		{name: "Listed user", session: &auth.Session{Username: "jane", Role: "viewer"}, expected: []string{"/open", "/open/hidden"}},
+		{name: "Group member", session: &auth.Session{Username: "amy", Role: "viewer"}, expected: []string{"/open", "/hr", "/hr/policies"}},
+		{name: "Bypass", session: &auth.Session{Username: "root", Role: "admin"}, expected: []string{"/open", "/open/hidden", "/hr", "/hr/policies"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := tree()
+			filterNavigation(item, tt.session)
+			if result := paths(item); !slices.Equal(result, tt.expected) {
+				t.Errorf("Expected: %v, got: %v", tt.expected, result)
+			}
+		})
+	}
+}
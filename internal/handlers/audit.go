@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+	"wiki-go/internal/audit"
+	"wiki-go/internal/auth"
+)
+
+// Number of audit entries returned when the query doesn't ask for a limit, and the most it may
+// ask for
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// recordAudit records an action taken by the user of the request
+func recordAudit(r *http.Request, action, target string, err error, details string) {
+	audit.Record(auditEntry(r, action, target, err, details))
+}
+
+// auditEntry returns the audit entry of an action taken by the user of the request, for actions
+// that finish after the request
+func auditEntry(r *http.Request, action, target string, err error, details string) audit.Entry {
+	entry := audit.Entry{
+		IP:      auth.ClientIP(r),
+		Action:  action,
+		Target:  target,
+		Outcome: audit.OutcomeSuccess,
+		Details: details,
+	}
+	if session := auth.GetSession(r); session != nil {
+		entry.Actor = session.Username
+	}
+	if err != nil {
+		entry.Outcome = audit.OutcomeFailure
+		if entry.Details == "" {
+			entry.Details = err.Error()
+		}
+	}
+	return entry
+}
+
+// recordLogin records a login attempt. The actor is the user logging in, who has no session yet.
+func recordLogin(r *http.Request, username, outcome, details string) {
+	audit.Record(audit.Entry{
+		Actor:   username,
+		IP:      auth.ClientIP(r),
+		Action:  audit.ActionLogin,
+		Outcome: outcome,
+		Details: details,
+	})
+}
+
+// AuditHandler lets admins query the audit log. Query parameters filter the entries: actor, ip,
+// action (an action such as document.delete or a group such as document), target (a prefix),
+// outcome, since and until (RFC 3339 times) and limit.
+func AuditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+		return
+	}
+
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Actor:   query.Get("actor"),
+		IP:      query.Get("ip"),
+		Action:  query.Get("action"),
+		Target:  query.Get("target"),
+		Outcome: query.Get("outcome"),
+		Limit:   defaultAuditLimit,
+	}
+
+	for name, dest := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			sendJSONError(w, "Invalid "+name+" time, expected RFC 3339 such as 2024-01-02T15:04:05Z", http.StatusBadRequest, "")
+			return
+		}
+		*dest = t
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			sendJSONError(w, "Limit must be a positive number", http.StatusBadRequest, "")
+			return
+		}
+		filter.Limit = min(limit, maxAuditLimit)
+	}
+
+	entries, err := audit.Query(filter)
+	if err != nil {
+		sendJSONError(w, "Failed to read audit log", http.StatusInternalServerError, err.Error())
+		return
+	}
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"entries": entries,
+	})
+}
@@ -2,20 +2,23 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"html/template"
 	"log"
 	"net/http"
-	"net"
 	"path/filepath"
 	"strconv"
-	"strings"
+	"wiki-go/internal/audit"
 	"wiki-go/internal/auth"
 	"wiki-go/internal/config"
 	"wiki-go/internal/ban"
 	"wiki-go/internal/crypto"
+	"wiki-go/internal/csp"
 	"wiki-go/internal/resources"
 	"wiki-go/internal/i18n"
+	"wiki-go/internal/ldap"
 	"wiki-go/internal/roles"
+	"wiki-go/internal/users"
 	"wiki-go/internal/version"
 )
 
@@ -28,26 +31,6 @@ type LoginRequest struct {
 // loginBan handles IP-based banning for failed login attempts.
 var loginBan *ban.BanList
 
-// clientIP extracts the real client IP address, considering proxy headers.
-func clientIP(r *http.Request) string {
-	// Prioritise common proxy headers
-	if ip := r.Header.Get("X-Forwarded-For"); ip != "" {
-		// X-Forwarded-For may contain multiple IPs, the first is the client
-		if comma := strings.Index(ip, ","); comma != -1 {
-			return strings.TrimSpace(ip[:comma])
-		}
-		return strings.TrimSpace(ip)
-	}
-	if ip := r.Header.Get("X-Real-IP"); ip != "" {
-		return ip
-	}
-	// Fallback to RemoteAddr
-	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
-		return host
-	}
-	return r.RemoteAddr // as-is (unlikely path)
-}
-
 // LoginHandler handles API login requests
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -71,11 +54,12 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ip := clientIP(r)
+	ip := auth.ClientIP(r)
 
 	// If IP is currently banned, short-circuit before doing any work.
 	if loginBan != nil {
 		if remaining := loginBan.IsBanned(ip); remaining > 0 {
+			recordLogin(r, req.Username, audit.OutcomeFailure, "address is banned")
 			w.Header().Set("Retry-After", strconv.Itoa(int(remaining.Seconds())))
 			w.WriteHeader(http.StatusTooManyRequests)
 			json.NewEncoder(w).Encode(map[string]interface{}{
@@ -88,8 +72,26 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate credentials
-	valid, role := auth.ValidateCredentials(req.Username, req.Password, cfg)
+	valid, role := auth.ValidateCredentials(req.Username, req.Password)
+	if !valid && auth.LDAPEnabled(cfg) {
+		valid, role = ldapLogin(req.Username, req.Password)
+	}
+
+	// Users waiting for approval are told so, but only once they gave their password
+	if !valid {
+		if user, found := users.Get(req.Username); found && user.Pending && crypto.CheckPasswordHash(req.Password, user.Password) {
+			recordLogin(r, req.Username, audit.OutcomeFailure, "account waits for approval")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"pending": true,
+				"message": "Your account is waiting for approval by an administrator",
+			})
+			return
+		}
+	}
 	if !valid {
+		recordLogin(r, req.Username, audit.OutcomeFailure, "invalid credentials")
 		if loginBan != nil {
 			if dur, bannedNow := loginBan.RegisterFailure(ip); bannedNow {
 				// Immediately inform client of new ban
@@ -111,12 +113,37 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Users with a second factor, or who have to set one up, finish logging in with a code.
+	// Failures aren't cleared yet, so that the code step can't be retried indefinitely.
+	totpEnabled := auth.TOTPEnabled(req.Username)
+	if totpEnabled || auth.TOTPRequired(cfg, req.Username, role) {
+		challenge, err := auth.CreateLoginChallenge(req.Username, role, req.KeepLoggedIn, !totpEnabled)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": "Failed to create session",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":           false,
+			"twoFactorRequired": true,
+			"setup":             !totpEnabled,
+			"challenge":         challenge,
+			"message":           "Two-factor authentication required",
+		})
+		return
+	}
+
 	if loginBan != nil {
 		loginBan.Clear(ip) // successful login resets failures / ban
 	}
 
 	// Create session
-	if err := auth.CreateSession(w, req.Username, role, req.KeepLoggedIn, cfg); err != nil {
+	if err := auth.CreateSession(w, r, req.Username, role, req.KeepLoggedIn, cfg); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -124,6 +151,7 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	recordLogin(r, req.Username, audit.OutcomeSuccess, "")
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -132,6 +160,28 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// ldapLogin checks the credentials against the directory and caches the user on success, so
+// that they show up in user management. Names of local users are never sent to the directory.
+func ldapLogin(username, password string) (bool, string) {
+	if user, found := users.Get(username); found && user.Source != users.SourceLDAP {
+		return false, ""
+	}
+
+	role, err := auth.AuthenticateLDAP(cfg, username, password)
+	if err != nil {
+		if !errors.Is(err, ldap.ErrInvalidCredentials) {
+			log.Printf("LDAP login of %s failed: %v", username, err)
+		}
+		return false, ""
+	}
+
+	if err := provisionExternalUser(username, "", role, users.SourceLDAP); err != nil {
+		log.Printf("Failed to cache LDAP user %s: %v", username, err)
+		return false, ""
+	}
+	return true, role
+}
+
 // CheckAuthHandler checks if the user is authenticated
 func CheckAuthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -146,14 +196,27 @@ func CheckAuthHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Return user information including role
+	// Return user information including role and what it allows
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
 		"username": session.Username,
 		"role":     session.Role,
+		"permissions": auth.Permissions(session),
+		"groups":   auth.UserGroups(session.Username),
+		"preferences": userPreferences(session.Username),
 	})
 }
 
+// userPreferences returns the interface preferences of a user for the browser to apply
+func userPreferences(username string) map[string]string {
+	user, _ := users.Get(username)
+	return map[string]string{
+		"display_name": user.DisplayName,
+		"language":     user.Language,
+		"theme":        user.Theme,
+	}
+}
+
 // LogoutHandler handles user logout
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -177,11 +240,15 @@ func LoginPageHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Prepare the data for the template
 	data := struct {
-		Config *config.Config
-		Theme  string
+		Config   *config.Config
+		Theme    string
+		SSOError bool   // A single sign-on login failed and sent the user back here
+		CSPNonce string // Nonce that lets the inline scripts run
 	}{
-		Config: cfg,
-		Theme:  "light", // Default theme
+		Config:   cfg,
+		Theme:    "light", // Default theme
+		SSOError: r.URL.Query().Get("sso_error") != "",
+		CSPNonce: csp.Nonce(r),
 	}
 
 	// Get theme from cookie if available
@@ -200,7 +267,7 @@ func LoginPageHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get and execute login template with translation function
-	tmpl, err := template.New("login.html").Funcs(funcMap).ParseFS(resources.GetTemplatesFS(), "templates/login.html")
+	tmpl, err := template.New("login.html").Funcs(funcMap).ParseFS(resources.GetTemplatesFS(), "templates/login.html", "templates/two-factor-step.html")
 	if err != nil {
 		http.Error(w, "Error loading login template: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -227,14 +294,9 @@ func CheckDefaultPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	// Check if any admin user still has the default password
 	defaultPasswordInUse := false
 
-	for _, user := range cfg.Users {
-		if user.Role == roles.RoleAdmin && user.Username == defaultUsername {
-			// Check if password is still the default
-			if crypto.CheckPasswordHash(defaultPassword, user.Password) {
-				defaultPasswordInUse = true
-				break
-			}
-		}
+	if user, found := users.Get(defaultUsername); found && user.Role == roles.RoleAdmin && !user.Disabled {
+		// Check if password is still the default
+		defaultPasswordInUse = crypto.CheckPasswordHash(defaultPassword, user.Password)
 	}
 
 	// Return the result
@@ -266,4 +328,13 @@ func InitLoginBan(cfg *config.Config) {
 	} else {
 		loginBan = bl
 	}
+	if loginBan == nil {
+		return
+	}
+
+	allowlist, err := ban.ParseAllowlist(cfg.Security.LoginBan.Allowlist)
+	if err != nil {
+		log.Printf("Warning: ignoring login ban allowlist: %v", err)
+	}
+	loginBan.SetAllowlist(allowlist)
 }
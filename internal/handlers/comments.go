@@ -2,12 +2,16 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"html/template"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"wiki-go/internal/acl"
+	"wiki-go/internal/audit"
 	"wiki-go/internal/auth"
 	"wiki-go/internal/comments"
 	"wiki-go/internal/roles"
@@ -61,6 +65,12 @@ func AddCommentHandler(w http.ResponseWriter, r *http.Request) {
 	// Clean and normalize the path
 	docPath = utils.SanitizePath(docPath)
 
+	// Only users who can read a document can comment on it
+	if !acl.CanRead(session, docPath) {
+		sendJSONError(w, "Document not found", http.StatusNotFound, "")
+		return
+	}
+
 	// Check if the document exists
 	documentDir := filepath.Join(cfg.Wiki.RootDir, cfg.Wiki.DocumentsDir)
 	fullDocPath := filepath.Join(documentDir, docPath, "document.md")
@@ -96,12 +106,30 @@ func AddCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Moderators aren't held to the spam rules
+	if !auth.Can(session, roles.PermCommentModerate) {
+		policy := comments.SpamPolicy{
+			MinInterval: time.Duration(cfg.Security.CommentSpam.MinIntervalSeconds) * time.Second,
+			MaxLinks:    cfg.Security.CommentSpam.MaxLinks,
+			BannedWords: comments.ParseBannedWords(cfg.Security.CommentSpam.BannedWords),
+		}
+		if err := comments.CheckSpam(session.Username, req.Content, policy); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, comments.ErrTooSoon) {
+				status = http.StatusTooManyRequests
+			}
+			sendJSONError(w, err.Error(), status, "")
+			return
+		}
+	}
+
 	// Add the comment
 	err = comments.AddComment(docPath, req.Content, session.Username)
 	if err != nil {
 		sendJSONError(w, "Failed to add comment", http.StatusInternalServerError, err.Error())
 		return
 	}
+	comments.RecordPost(session.Username)
 
 	// Send success response
 	w.Header().Set("Content-Type", "application/json")
@@ -151,6 +179,12 @@ func GetCommentsHandler(w http.ResponseWriter, r *http.Request) {
 	// Clean and normalize the path
 	docPath = utils.SanitizePath(docPath)
 
+	// Comments are as restricted as their document
+	if !acl.CanRead(auth.GetSession(r), docPath) {
+		sendJSONError(w, "Document not found", http.StatusNotFound, "")
+		return
+	}
+
 	// Get comments for the document
 	commentsList, err := comments.GetComments(docPath)
 	if err != nil {
@@ -182,7 +216,7 @@ func DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user is authenticated and has admin role
+	// Check if user is authenticated and may moderate comments
 	session := auth.GetSession(r)
 	if session == nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -194,8 +228,8 @@ func DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if session.Role != roles.RoleAdmin {
-		sendJSONError(w, "Admin privileges required", http.StatusForbidden, "")
+	if !auth.Can(session, roles.PermCommentModerate) {
+		sendJSONError(w, "Comment moderation permission required", http.StatusForbidden, "")
 		return
 	}
 
@@ -216,6 +250,7 @@ func DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Delete the comment
 	err := comments.DeleteComment(commentID, docPath, true)
+	recordAudit(r, audit.ActionCommentDelete, "/"+docPath, err, "comment "+commentID)
 	if err != nil {
 		sendJSONError(w, "Failed to delete comment", http.StatusInternalServerError, err.Error())
 		return
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// maxCSPReportSize limits the size of a violation report
+const maxCSPReportSize = 64 << 10
+
+// cspViolation holds the fields of a violation report worth logging. Browsers send either the
+// older report-uri format, with dashed names, or the Reporting API format, in camel case.
+type cspViolation struct {
+	DocumentURI        string `json:"document-uri"`
+	BlockedURI         string `json:"blocked-uri"`
+	ViolatedDirective  string `json:"violated-directive"`
+	EffectiveDirective string `json:"effective-directive"`
+	SourceFile         string `json:"source-file"`
+	LineNumber         int    `json:"line-number"`
+
+	DocumentURL            string `json:"documentURL"`
+	BlockedURL             string `json:"blockedURL"`
+	EffectiveDirectiveName string `json:"effectiveDirective"`
+	SourceFileName         string `json:"sourceFile"`
+	Line                   int    `json:"lineNumber"`
+}
+
+// log writes the violation to the server log, whichever format it came in
+func (v cspViolation) log() {
+	document := firstNonEmpty(v.DocumentURI, v.DocumentURL)
+	blocked := firstNonEmpty(v.BlockedURI, v.BlockedURL)
+	directive := firstNonEmpty(v.EffectiveDirective, v.EffectiveDirectiveName, v.ViolatedDirective)
+	source := firstNonEmpty(v.SourceFile, v.SourceFileName)
+	line := v.LineNumber
+	if line == 0 {
+		line = v.Line
+	}
+
+	// Values come from the browser; keep them to a single log line
+	clean := strings.NewReplacer("\n", " ", "\r", " ")
+	log.Printf("CSP violation: %s blocked %q on %s (source %s:%d)",
+		clean.Replace(directive), clean.Replace(blocked), clean.Replace(document), clean.Replace(source), line)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// CSPReportHandler logs the Content Security Policy violations that browsers report
+func CSPReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCSPReportSize))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if strings.HasPrefix(strings.TrimSpace(string(body)), "[") {
+		// Reporting API: a list of reports of different types
+		var reports []struct {
+			Type string       `json:"type"`
+			Body cspViolation `json:"body"`
+		}
+		if err := json.Unmarshal(body, &reports); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, report := range reports {
+			if report.Type == "csp-violation" {
+				report.Body.log()
+			}
+		}
+	} else {
+		var report struct {
+			Report cspViolation `json:"csp-report"`
+		}
+		if err := json.Unmarshal(body, &report); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		report.Report.log()
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -10,6 +10,8 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+	"wiki-go/internal/acl"
+	"wiki-go/internal/audit"
 	"wiki-go/internal/auth"
 	"wiki-go/internal/roles"
 	"wiki-go/internal/utils"
@@ -34,11 +36,11 @@ func SourceHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Check if user is authenticated and has appropriate permissions
 	session := auth.GetSession(r)
-	if session == nil || (session.Role != roles.RoleAdmin && session.Role != roles.RoleEditor) {
+	if !auth.Can(session, roles.PermPageEdit) {
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"message": "Unauthorized. Admin or editor access required.",
+			"message": "Unauthorized. Editing permission required.",
 		})
 		return
 	}
@@ -46,6 +48,15 @@ func SourceHandler(w http.ResponseWriter, r *http.Request) {
 	// Get the path from the URL, removing the /api/source prefix
 	path := strings.TrimPrefix(r.URL.Path, "/api/source")
 
+	if !acl.CanWrite(session, path) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "You don't have permission to edit this document",
+		})
+		return
+	}
+
 	var docPath string
 	var dirPath string
 
@@ -126,17 +137,27 @@ func SaveHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Check if user is authenticated and has appropriate permissions
 	session := auth.GetSession(r)
-	if session == nil || (session.Role != roles.RoleAdmin && session.Role != roles.RoleEditor) {
+	if !auth.Can(session, roles.PermPageEdit) {
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"message": "Unauthorized. Admin or editor access required.",
+			"message": "Unauthorized. Editing permission required.",
 		})
 		return
 	}
 
 	// Get the path from the URL, removing the /api/save prefix
 	path := strings.TrimPrefix(r.URL.Path, "/api/save")
+	target := "/" + strings.Trim(path, "/")
+
+	if !acl.CanWrite(session, path) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "You don't have permission to edit this document",
+		})
+		return
+	}
 
 	var docPath string
 	var relativePath string // To store path relative to the documents dir
@@ -171,6 +192,19 @@ func SaveHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
+	// Access rules in the frontmatter are for those who bypass them, or editors could let themselves in
+	if !auth.Can(session, roles.PermAccessBypass) {
+		currentContent, _ := os.ReadFile(docPath)
+		if accessChanged(string(currentContent), string(content)) {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": "Only admins can change the access rules of a document",
+			})
+			return
+		}
+	}
+
 	// VERSION CONTROL: Save current version before overwriting
 	// Check if the document already exists
 	if _, err := os.Stat(docPath); err == nil && cfg.Wiki.MaxVersions > 0 {
@@ -213,6 +247,7 @@ func SaveHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Write the content to the file
 	if err := os.WriteFile(docPath, content, 0644); err != nil {
+		recordAudit(r, audit.ActionDocumentSave, target, err, "")
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -221,6 +256,8 @@ func SaveHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordAudit(r, audit.ActionDocumentSave, target, nil, fmt.Sprintf("%d bytes", len(content)))
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
@@ -257,12 +294,12 @@ func CreateDocumentHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Check authentication and permissions
 	session := auth.GetSession(r)
-	if session == nil || (session.Role != roles.RoleAdmin && session.Role != roles.RoleEditor) {
+	if !auth.Can(session, roles.PermPageEdit) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"message": "Unauthorized. Admin or editor access required.",
+			"message": "Unauthorized. Editing permission required.",
 		})
 		return
 	}
@@ -292,6 +329,18 @@ func CreateDocumentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Path restricted tokens can only create documents within their path
+	if !session.AllowsPath(cleanPath) {
+		sendJSONError(w, "Token is not allowed to access this path", http.StatusForbidden, "")
+		return
+	}
+
+	// New documents take on the rules of the directory they are created in
+	if !acl.CanWrite(session, cleanPath) {
+		sendJSONError(w, "You don't have permission to create documents here", http.StatusForbidden, "")
+		return
+	}
+
 	log.Printf("Creating document: Title=%s, Path=%s, CleanPath=%s", req.Title, req.Path, cleanPath)
 
 	// Get the config from the package variable
@@ -337,6 +386,7 @@ func CreateDocumentHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Write to the file
 	err = os.WriteFile(docFile, []byte(content), 0644)
+	recordAudit(r, audit.ActionDocumentCreate, "/"+cleanPath, err, req.Type)
 	if err != nil {
 		log.Printf("Error creating document: %v", err)
 		sendJSONError(w, "Failed to create document", http.StatusInternalServerError, err.Error())
@@ -411,8 +461,8 @@ func DeleteDocumentHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Check authentication and permissions
 	session := auth.GetSession(r)
-	if session == nil || (session.Role != roles.RoleAdmin && session.Role != roles.RoleEditor) {
-		sendJSONError(w, "Authentication required", http.StatusUnauthorized, "Admin or editor access required to delete documents")
+	if !auth.Can(session, roles.PermPageDelete) {
+		sendJSONError(w, "Permission to delete documents required", http.StatusUnauthorized, "")
 		return
 	}
 
@@ -430,6 +480,11 @@ func DeleteDocumentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !acl.CanWrite(session, docPath) {
+		sendJSONError(w, "Forbidden", http.StatusForbidden, "You don't have permission to delete this document")
+		return
+	}
+
 	// Build the file path
 	docPath = filepath.Clean(docPath)
 	documentDir := filepath.Join(cfg.Wiki.RootDir, cfg.Wiki.DocumentsDir)
@@ -451,10 +506,16 @@ func DeleteDocumentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if fileInfo.IsDir() && !subtreeWritable(session, docPath, fullPath) {
+		sendJSONError(w, "Forbidden", http.StatusForbidden, "You don't have permission to delete everything below this document")
+		return
+	}
+
 	// Delete the file or directory recursively
 	if fileInfo.IsDir() {
 		// Use RemoveAll to recursively delete the directory and all its contents
 		if err := os.RemoveAll(fullPath); err != nil {
+			recordAudit(r, audit.ActionDocumentDelete, docPath, err, "")
 			sendJSONError(w, "Error deleting directory", http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -462,11 +523,13 @@ func DeleteDocumentHandler(w http.ResponseWriter, r *http.Request) {
 	} else {
 		// Delete the file
 		if err := os.Remove(fullPath); err != nil {
+			recordAudit(r, audit.ActionDocumentDelete, docPath, err, "")
 			sendJSONError(w, "Error deleting document", http.StatusInternalServerError, err.Error())
 			return
 		}
 		log.Printf("Deleted file: %s", fullPath)
 	}
+	recordAudit(r, audit.ActionDocumentDelete, docPath, nil, "")
 
 	// Also delete the corresponding versions directory
 	var versionsPath string
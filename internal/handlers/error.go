@@ -9,6 +9,7 @@ import (
 
     "wiki-go/internal/auth"
     "wiki-go/internal/config"
+    "wiki-go/internal/csp"
     "wiki-go/internal/i18n"
     "wiki-go/internal/types"
     "wiki-go/internal/utils"
@@ -23,10 +24,7 @@ func NotFoundHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config)
     // Session / role information
     session := auth.GetSession(r)
     isAuthenticated := session != nil
-    userRole := ""
-    if isAuthenticated {
-        userRole = session.Role
-    }
+    userRole, permissions := pagePermissions(session, true)
 
     // Navigation tree
     nav, err := utils.BuildNavigation(cfg.Wiki.RootDir, cfg.Wiki.DocumentsDir)
@@ -34,6 +32,7 @@ func NotFoundHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config)
         http.Error(w, "Error building navigation: "+err.Error(), http.StatusInternalServerError)
         return
     }
+    filterNavigation(nav, session)
 
     // Requested path and breadcrumbs
     requestedPath := r.URL.Path
@@ -63,7 +62,9 @@ func NotFoundHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config)
         AvailableLanguages: i18n.GetAvailableLanguages(),
         IsAuthenticated:    isAuthenticated,
         UserRole:           userRole,
+        Permissions:        permissions,
         LastModified:       time.Now(),
+        CSPNonce:           csp.Nonce(r),
     }
 
     // Render the not-found specific template fragment into .Content
@@ -0,0 +1,482 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"wiki-go/internal/acl"
+	"wiki-go/internal/auth"
+	"wiki-go/internal/config"
+	"wiki-go/internal/frontmatter"
+	"wiki-go/internal/goldext"
+	"wiki-go/internal/types"
+	"wiki-go/internal/utils"
+)
+
+// epubChapter is a single document of an EPUB export
+type epubChapter struct {
+	Title    string
+	Path     string // Wiki URL path of the document
+	File     string // File name inside the EPUB package
+	Depth    int    // Depth relative to the exported root
+	Headings []goldext.TocHeading
+	Body     string
+}
+
+// epubImage is an attachment packed into an EPUB export
+type epubImage struct {
+	ID        string
+	File      string
+	MediaType string
+	Source    string // Path of the file on disk
+}
+
+var (
+	epubVoidTagRegex   = regexp.MustCompile(`<(area|br|col|embed|hr|img|input|link|meta|param|source|track|wbr)\b([^>]*?)\s*/?>`)
+	epubEntityRegex    = regexp.MustCompile(`&([a-zA-Z][a-zA-Z0-9]*);`)
+	epubScriptRegex    = regexp.MustCompile(`(?is)<script\b.*?</script>`)
+	epubFileSrcRegex   = regexp.MustCompile(`src="/api/files/([^"]+)"`)
+	epubPageHrefRegex  = regexp.MustCompile(`href="(/[^"#]*)(#[^"]*)?"`)
+	epubHeadingLinkTag = regexp.MustCompile(`<[^>]+>`)
+)
+
+// ExportEPUBHandler serves a document and all of its children as an EPUB 3 package
+func ExportEPUBHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Authentication: Require login if the wiki is private
+	if !auth.RequireAuth(r, cfg) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rootPath := "/" + strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/export/epub"), "/")
+	if rootPath == "/" || strings.Contains(rootPath, "..") {
+		http.Error(w, "A document path is required", http.StatusBadRequest)
+		return
+	}
+
+	session := auth.GetSession(r)
+	if !acl.CanRead(session, rootPath) {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := WriteEPUB(&buf, cfg, rootPath, session); err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Document not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to create EPUB: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filename := utils.ToURLPath(strings.ToLower(filepath.Base(rootPath))) + ".epub"
+	w.Header().Set("Content-Type", "application/epub+zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	buf.WriteTo(w)
+}
+
+// WriteEPUB writes the document at rootPath and all of its children that session may read as an
+// EPUB 3 package to w. Chapters follow the navigation order and the table of contents is built from
+// the document headings.
+func WriteEPUB(w io.Writer, cfg *config.Config, rootPath string, session *auth.Session) error {
+	nav, err := utils.BuildNavigation(cfg.Wiki.RootDir, cfg.Wiki.DocumentsDir)
+	if err != nil {
+		return err
+	}
+	filterNavigation(nav, session)
+
+	root := utils.FindNavItem(nav, rootPath)
+	if root == nil {
+		return os.ErrNotExist
+	}
+
+	// Collect the chapters in navigation order
+	var chapters []*epubChapter
+	var collect func(item *types.NavItem, depth int)
+	collect = func(item *types.NavItem, depth int) {
+		chapters = append(chapters, &epubChapter{
+			Title: item.Title,
+			Path:  item.Path,
+			File:  fmt.Sprintf("chapter-%03d.xhtml", len(chapters)+1),
+			Depth: depth,
+		})
+		for _, child := range item.Children {
+			collect(child, depth+1)
+		}
+	}
+	collect(root, 0)
+
+	chapterFiles := make(map[string]string, len(chapters))
+	for _, chapter := range chapters {
+		chapterFiles[chapter.Path] = chapter.File
+	}
+
+	images := make(map[string]*epubImage)
+	var imageOrder []*epubImage
+
+	for _, chapter := range chapters {
+		decodedPath, err := url.PathUnescape(chapter.Path)
+		if err != nil {
+			decodedPath = chapter.Path
+		}
+
+		docPath := filepath.Join(cfg.Wiki.RootDir, cfg.Wiki.DocumentsDir, decodedPath, "document.md")
+		mdContent, err := os.ReadFile(docPath)
+		if err != nil {
+			// Directories without a document still get a title page
+			chapter.Body = fmt.Sprintf("<h1>%s</h1>", html.EscapeString(chapter.Title))
+			continue
+		}
+
+		_, content, hasFrontmatter := frontmatter.Parse(string(mdContent))
+		if !hasFrontmatter {
+			content = string(mdContent)
+		}
+		chapter.Headings = goldext.CollectHeadings(content)
+
+		body := string(utils.RenderMarkdownXHTML(string(mdContent), decodedPath))
+
+		// Pack embedded images and point them at their location inside the package
+		body = epubFileSrcRegex.ReplaceAllStringFunc(body, func(match string) string {
+			filePath := epubFileSrcRegex.FindStringSubmatch(match)[1]
+			img := images[filePath]
+			if img == nil {
+				img = epubImageFor(cfg, filePath, len(imageOrder)+1)
+				if img == nil {
+					return match
+				}
+				images[filePath] = img
+				imageOrder = append(imageOrder, img)
+			}
+			return fmt.Sprintf(`src="%s"`, img.File)
+		})
+
+		// Point links between exported documents at their chapters
+		body = epubPageHrefRegex.ReplaceAllStringFunc(body, func(match string) string {
+			parts := epubPageHrefRegex.FindStringSubmatch(match)
+			file, ok := chapterFiles[strings.TrimSuffix(parts[1], "/")]
+			if !ok {
+				return match
+			}
+			return fmt.Sprintf(`href="%s%s"`, file, parts[2])
+		})
+
+		chapter.Body = toEPUBXHTML(body)
+	}
+
+	return writeEPUBPackage(w, cfg, root.Title, chapters, imageOrder)
+}
+
+// epubImageFor returns the EPUB manifest entry for an attachment referenced as /api/files/<filePath>,
+// or nil if the file is not an image that exists on disk
+func epubImageFor(cfg *config.Config, filePath string, n int) *epubImage {
+	decoded, err := url.PathUnescape(filePath)
+	if err != nil || strings.Contains(decoded, "..") {
+		return nil
+	}
+
+	var source string
+	if strings.HasPrefix(decoded, "pages/") {
+		source = filepath.Join(cfg.Wiki.RootDir, decoded)
+	} else {
+		source = filepath.Join(cfg.Wiki.RootDir, cfg.Wiki.DocumentsDir, decoded)
+	}
+	if info, err := os.Stat(source); err != nil || info.IsDir() {
+		return nil
+	}
+
+	ext := strings.ToLower(filepath.Ext(source))
+	mediaType := config.GetMimeTypeForExtension(ext)
+	if !strings.HasPrefix(mediaType, "image/") {
+		return nil
+	}
+
+	return &epubImage{
+		ID:        fmt.Sprintf("image-%03d", n),
+		File:      fmt.Sprintf("images/image-%03d%s", n, ext),
+		MediaType: mediaType,
+		Source:    source,
+	}
+}
+
+// toEPUBXHTML turns rendered HTML into markup that XML parsers in e-readers accept
+func toEPUBXHTML(body string) string {
+	// Scripts don't run in most readers and are not needed for reading
+	body = epubScriptRegex.ReplaceAllString(body, "")
+
+	// Self-close void elements
+	body = epubVoidTagRegex.ReplaceAllString(body, "<$1$2 />")
+
+	// XHTML only knows the XML entities, so convert named HTML entities to numeric ones
+	return epubEntityRegex.ReplaceAllStringFunc(body, func(entity string) string {
+		switch entity {
+		case "&amp;", "&lt;", "&gt;", "&quot;", "&apos;":
+			return entity
+		}
+		decoded := html.UnescapeString(entity)
+		if decoded == entity {
+			return "&amp;" + entity[1:]
+		}
+		var b strings.Builder
+		for _, r := range decoded {
+			fmt.Fprintf(&b, "&#%d;", r)
+		}
+		return b.String()
+	})
+}
+
+// writeEPUBPackage writes the EPUB container with all chapters and images
+func writeEPUBPackage(w io.Writer, cfg *config.Config, title string, chapters []*epubChapter, images []*epubImage) error {
+	zw := zip.NewWriter(w)
+
+	// The mimetype file must come first and must not be compressed
+	mimetype, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mimetype, "application/epub+zip"); err != nil {
+		return err
+	}
+
+	language := cfg.Wiki.Language
+	if language == "" {
+		language = "en"
+	}
+	identifier := fmt.Sprintf("urn:wiki-go:%x", sha1.Sum([]byte(cfg.Wiki.Owner+chapters[0].Path)))
+
+	files := map[string]string{
+		"META-INF/container.xml": epubContainerXML,
+		"OEBPS/content.opf":      epubPackageDocument(title, language, identifier, cfg.Wiki.Owner, chapters, images),
+		"OEBPS/nav.xhtml":        epubNavDocument(title, language, chapters),
+		"OEBPS/style.css":        epubStylesheet,
+	}
+	for _, name := range []string{"META-INF/container.xml", "OEBPS/content.opf", "OEBPS/nav.xhtml", "OEBPS/style.css"} {
+		if err := writeZipEntry(zw, name, []byte(files[name])); err != nil {
+			return err
+		}
+	}
+
+	for _, chapter := range chapters {
+		doc := fmt.Sprintf(epubChapterTemplate, xmlEscape(language), xmlEscape(chapter.Title), chapter.Body)
+		if err := writeZipEntry(zw, "OEBPS/"+chapter.File, []byte(doc)); err != nil {
+			return err
+		}
+	}
+
+	for _, img := range images {
+		data, err := os.ReadFile(img.Source)
+		if err != nil {
+			return err
+		}
+		if err := writeZipEntry(zw, "OEBPS/"+img.File, data); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// writeZipEntry writes a single compressed file to the ZIP archive
+func writeZipEntry(zw *zip.Writer, name string, data []byte) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// epubPackageDocument builds the OPF package document with metadata, manifest and spine
+func epubPackageDocument(title, language, identifier, publisher string, chapters []*epubChapter, images []*epubImage) string {
+	var manifest, spine strings.Builder
+	manifest.WriteString(`    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>` + "\n")
+	manifest.WriteString(`    <item id="style" href="style.css" media-type="text/css"/>` + "\n")
+	for i, chapter := range chapters {
+		fmt.Fprintf(&manifest, `    <item id="chapter-%d" href="%s" media-type="application/xhtml+xml"/>`+"\n", i+1, chapter.File)
+		fmt.Fprintf(&spine, `    <itemref idref="chapter-%d"/>`+"\n", i+1)
+	}
+	for _, img := range images {
+		fmt.Fprintf(&manifest, `    <item id="%s" href="%s" media-type="%s"/>`+"\n", img.ID, img.File, img.MediaType)
+	}
+
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="%s">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">%s</dc:identifier>
+    <dc:title>%s</dc:title>
+    <dc:language>%s</dc:language>
+    <dc:publisher>%s</dc:publisher>
+    <meta property="dcterms:modified">%s</meta>
+  </metadata>
+  <manifest>
+%s  </manifest>
+  <spine>
+%s  </spine>
+</package>
+`, xmlEscape(language), xmlEscape(identifier), xmlEscape(title), xmlEscape(language), xmlEscape(publisher),
+		time.Now().UTC().Format("2006-01-02T15:04:05Z"), manifest.String(), spine.String())
+}
+
+// epubNavDocument builds the EPUB 3 navigation document. Chapters are nested following
+// the wiki hierarchy and each chapter lists its own headings before its children.
+func epubNavDocument(title, language string, chapters []*epubChapter) string {
+	var b strings.Builder
+	b.WriteString("<ol>")
+	for i := 0; i < len(chapters); {
+		i = writeEPUBNavItem(&b, chapters, i)
+	}
+	b.WriteString("</ol>")
+
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="%s" lang="%s">
+<head>
+  <title>%s</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <h1>%s</h1>
+    %s
+  </nav>
+</body>
+</html>
+`, xmlEscape(language), xmlEscape(language), xmlEscape(title), xmlEscape(title), b.String())
+}
+
+// writeEPUBNavItem writes the navigation entry for chapters[i] including its headings and
+// child chapters, and returns the index of the next chapter that is not a descendant
+func writeEPUBNavItem(b *strings.Builder, chapters []*epubChapter, i int) int {
+	chapter := chapters[i]
+	fmt.Fprintf(b, `<li><a href="%s">%s</a>`, chapter.File, xmlEscape(chapter.Title))
+
+	headings := epubHeadingItems(chapter)
+	next := i + 1
+	hasChildren := next < len(chapters) && chapters[next].Depth > chapter.Depth
+	if headings != "" || hasChildren {
+		b.WriteString("<ol>")
+		b.WriteString(headings)
+		for next < len(chapters) && chapters[next].Depth > chapter.Depth {
+			next = writeEPUBNavItem(b, chapters, next)
+		}
+		b.WriteString("</ol>")
+	}
+
+	b.WriteString("</li>")
+	return next
+}
+
+// epubHeadingItems renders the headings of a chapter as nested list items. The top-level
+// heading is skipped when it only repeats the chapter title.
+func epubHeadingItems(chapter *epubChapter) string {
+	headings := chapter.Headings
+	if len(headings) > 0 && headings[0].Level == 1 && epubHeadingText(headings[0].Text) == chapter.Title {
+		headings = headings[1:]
+	}
+	if len(headings) == 0 {
+		return ""
+	}
+
+	// Clamp heading levels so that each heading is at most one level deeper than the previous
+	// one, which keeps the list valid when documents skip heading levels
+	levels := make([]int, len(headings))
+	for i, h := range headings {
+		levels[i] = 1
+		if i > 0 {
+			levels[i] = h.Level - headings[0].Level + 1
+			if levels[i] > levels[i-1]+1 {
+				levels[i] = levels[i-1] + 1
+			}
+			if levels[i] < 1 {
+				levels[i] = 1
+			}
+		}
+	}
+
+	var b strings.Builder
+	level := 1
+	for i, h := range headings {
+		switch {
+		case i == 0:
+		case levels[i] > level:
+			b.WriteString("<ol>")
+		case levels[i] < level:
+			for ; level > levels[i]; level-- {
+				b.WriteString("</li></ol>")
+			}
+			b.WriteString("</li>")
+		default:
+			b.WriteString("</li>")
+		}
+		level = levels[i]
+		fmt.Fprintf(&b, `<li><a href="%s#%s">%s</a>`, chapter.File, h.ID, xmlEscape(epubHeadingText(h.Text)))
+	}
+	for ; level > 1; level-- {
+		b.WriteString("</li></ol>")
+	}
+	b.WriteString("</li>")
+	return b.String()
+}
+
+// epubHeadingText strips markdown and inline HTML from a heading for display in the table of contents
+func epubHeadingText(text string) string {
+	text = epubHeadingLinkTag.ReplaceAllString(text, "")
+	text = strings.NewReplacer("`", "", "**", "", "__", "").Replace(text)
+	return strings.TrimSpace(html.UnescapeString(goldext.EmojiPreprocessor(text, "")))
+}
+
+// xmlEscape escapes text for use in XML content and attributes
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+const epubContainerXML = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+const epubChapterTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="%s">
+<head>
+  <title>%s</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+%s
+</body>
+</html>
+`
+
+const epubStylesheet = `body { font-family: serif; line-height: 1.5; }
+pre, code { font-family: monospace; font-size: 0.9em; }
+pre { white-space: pre-wrap; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #999; padding: 0.2em 0.5em; }
+img { max-width: 100%; }
+.heading-anchor { display: none; }
+nav ol { list-style-type: none; }
+`
@@ -0,0 +1,397 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"wiki-go/internal/acl"
+	"wiki-go/internal/config"
+	"wiki-go/internal/frontmatter"
+	"wiki-go/internal/i18n"
+	"wiki-go/internal/resources"
+	"wiki-go/internal/types"
+	"wiki-go/internal/utils"
+)
+
+// staticSearchEntry is a single page in the prebuilt search index of a static export
+type staticSearchEntry struct {
+	Title   string `json:"title"`
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// staticLinkRegex matches root-relative href and src attributes in rendered HTML
+var staticLinkRegex = regexp.MustCompile(`(\s(?:href|src))="(/[^"]*)"`)
+
+// ExportStaticSite renders every page of the wiki into a self-contained static site in outDir.
+// Pages are written as relative .html files, attachments are copied under files/, static assets
+// under static/, and a prebuilt search index is written so search works without the server.
+func ExportStaticSite(cfg *config.Config, outDir string) error {
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	tmpl, err := getTemplate()
+	if err != nil {
+		return fmt.Errorf("failed to load templates: %w", err)
+	}
+
+	nav, err := utils.BuildNavigation(cfg.Wiki.RootDir, cfg.Wiki.DocumentsDir)
+	if err != nil {
+		return fmt.Errorf("failed to build navigation: %w", err)
+	}
+
+	// The export is meant to be published, so it holds what anonymous visitors may read
+	filterNavigation(nav, nil)
+
+	// Collect every page path, starting with the homepage
+	pages := []string{"/"}
+	var collect func(item *types.NavItem)
+	collect = func(item *types.NavItem) {
+		for _, child := range item.Children {
+			pages = append(pages, child.Path)
+			collect(child)
+		}
+	}
+	collect(nav)
+
+	var index []staticSearchEntry
+	for _, pagePath := range pages {
+		data, markdown, err := buildStaticPageData(cfg, nav, pagePath)
+		if err != nil {
+			log.Printf("Warning: skipping %s in static export: %v", pagePath, err)
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return fmt.Errorf("failed to render %s: %w", pagePath, err)
+		}
+
+		outPath := staticPageFile(pagePath)
+		html := rewriteStaticLinks(buf.String(), outPath)
+		target := filepath.Join(outDir, filepath.FromSlash(outPath))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, []byte(html), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", target, err)
+		}
+
+		index = append(index, staticSearchEntry{
+			Title:   data.CurrentDir.Title,
+			Path:    outPath,
+			Content: strings.ToLower(markdown),
+		})
+	}
+
+	if err := writeStaticSearchIndex(outDir, index); err != nil {
+		return err
+	}
+
+	// Copy attachments of all documents and of the homepage
+	docsDir := filepath.Join(cfg.Wiki.RootDir, cfg.Wiki.DocumentsDir)
+	if err := copyStaticAttachments(docsDir, filepath.Join(outDir, "files"), anonymousReadable); err != nil {
+		return fmt.Errorf("failed to copy attachments: %w", err)
+	}
+	homeDir := filepath.Join(cfg.Wiki.RootDir, "pages", "home")
+	homeReadable := func(string) bool { return acl.CanRead(nil, "") }
+	if err := copyStaticAttachments(homeDir, filepath.Join(outDir, "files", "pages", "home"), homeReadable); err != nil {
+		return fmt.Errorf("failed to copy homepage attachments: %w", err)
+	}
+
+	if err := copyStaticAssets(cfg, filepath.Join(outDir, "static")); err != nil {
+		return fmt.Errorf("failed to copy static assets: %w", err)
+	}
+
+	log.Printf("Exported %d pages to %s", len(index), outDir)
+	return nil
+}
+
+// buildStaticPageData prepares the template data for a single page of a static export,
+// returning the page data and the markdown, without frontmatter, used for the search index
+func buildStaticPageData(cfg *config.Config, nav *types.NavItem, pagePath string) (*types.PageData, string, error) {
+	resetActiveNavItems(nav)
+	utils.MarkActiveNavItem(nav, pagePath)
+
+	data := &types.PageData{
+		Navigation:         nav,
+		Config:             cfg,
+		AvailableLanguages: i18n.GetAvailableLanguages(),
+		StaticExport:       true,
+	}
+
+	if pagePath == "/" {
+		homepagePath := filepath.Join(cfg.Wiki.RootDir, "pages", "home", "document.md")
+		content, err := os.ReadFile(homepagePath)
+		if err != nil {
+			return nil, "", err
+		}
+		// The homepage path resolves its relative links and images to pages/home
+		data.Content = template.HTML(utils.RenderMarkdownWithPath(string(content), "/"))
+		data.Breadcrumbs = []types.BreadcrumbItem{{Title: "Home", Path: "/", IsLast: true}}
+		data.CurrentDir = &types.NavItem{Title: "Home", Path: "/", IsDir: true, IsActive: true}
+		data.LastModified = modTime(homepagePath)
+		_, body, _ := frontmatter.Parse(string(content))
+		return data, body, nil
+	}
+
+	decodedPath, err := url.PathUnescape(pagePath)
+	if err != nil {
+		return nil, "", err
+	}
+	fsPath := filepath.Join(cfg.Wiki.RootDir, cfg.Wiki.DocumentsDir, decodedPath)
+
+	navItem := utils.FindNavItem(nav, pagePath)
+	if navItem == nil {
+		return nil, "", fmt.Errorf("page not found in navigation")
+	}
+
+	data.CurrentDir = navItem
+	data.Breadcrumbs = generateBreadcrumbs(nav, pagePath)
+	data.DocPath = decodedPath
+
+	dirContent, err := buildDirectoryListing(fsPath, pagePath, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	data.DirContent = dirContent
+
+	docPath := filepath.Join(fsPath, "document.md")
+	mdContent, err := os.ReadFile(docPath)
+	if err != nil {
+		// Directories without a document only show their listing
+		data.Content = template.HTML(fmt.Sprintf("<h1>%s</h1>", template.HTMLEscapeString(navItem.Title)))
+		data.LastModified = modTime(fsPath)
+		return data, navItem.Title, nil
+	}
+
+	metadata, body, hasFrontmatter := frontmatter.Parse(string(mdContent))
+	if hasFrontmatter {
+		navItem.DocumentLayout = metadata.Layout
+		data.DocumentLayout = metadata.Layout
+	}
+	data.Content = template.HTML(utils.RenderMarkdownWithPath(string(mdContent), decodedPath))
+	data.LastModified = modTime(docPath)
+
+	// The search index holds the text only, not the frontmatter
+	return data, body, nil
+}
+
+// resetActiveNavItems clears the active flag on every navigation item
+func resetActiveNavItems(item *types.NavItem) {
+	item.IsActive = false
+	for _, child := range item.Children {
+		resetActiveNavItems(child)
+	}
+}
+
+// modTime returns the modification time of a file, or the current time if it cannot be read
+func modTime(path string) time.Time {
+	if info, err := os.Stat(path); err == nil {
+		return info.ModTime()
+	}
+	return time.Now()
+}
+
+// staticPageFile maps a wiki URL path to the .html file it is exported to
+func staticPageFile(pagePath string) string {
+	pagePath = strings.Trim(pagePath, "/")
+	if pagePath == "" {
+		return "index.html"
+	}
+	if decoded, err := url.PathUnescape(pagePath); err == nil {
+		pagePath = decoded
+	}
+	return pagePath + ".html"
+}
+
+// rewriteStaticLinks rewrites root-relative links in rendered HTML so they resolve
+// relative to the exported file at outPath
+func rewriteStaticLinks(html string, outPath string) string {
+	prefix := strings.Repeat("../", strings.Count(outPath, "/"))
+
+	return staticLinkRegex.ReplaceAllStringFunc(html, func(match string) string {
+		parts := staticLinkRegex.FindStringSubmatch(match)
+		attr, link := parts[1], parts[2]
+
+		// Keep protocol-relative URLs untouched
+		if strings.HasPrefix(link, "//") {
+			return match
+		}
+
+		fragment := ""
+		if i := strings.Index(link, "#"); i != -1 {
+			link, fragment = link[:i], link[i:]
+		}
+		if i := strings.Index(link, "?"); i != -1 {
+			link = link[:i]
+		}
+
+		var target string
+		switch {
+		case strings.HasPrefix(link, "/static/"), link == "/search-index.js":
+			target = strings.TrimPrefix(link, "/")
+		case strings.HasPrefix(link, "/api/files/"):
+			target = "files/" + strings.TrimPrefix(link, "/api/files/")
+		case strings.HasPrefix(link, "/api/"), strings.HasPrefix(link, "/sitemap"):
+			// Dynamic endpoints have no static equivalent
+			return match
+		default:
+			target = url.PathEscape(staticPageFile(link))
+			target = strings.ReplaceAll(target, "%2F", "/")
+		}
+
+		return fmt.Sprintf(`%s="%s%s%s"`, attr, prefix, target, fragment)
+	})
+}
+
+// writeStaticSearchIndex writes the prebuilt search index both as plain JSON and as a
+// script that can be loaded from file:// URLs where fetching JSON is not allowed
+func writeStaticSearchIndex(outDir string, index []staticSearchEntry) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(outDir, "search-index.json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write search index: %w", err)
+	}
+
+	script := fmt.Sprintf("// Search index for the static export - generated\n"+
+		"window.STATIC_SEARCH_INDEX = {\n"+
+		"    root: document.currentScript.src.replace(/search-index\\.js$/, ''),\n"+
+		"    pages: %s\n"+
+		"};\n", data)
+	if err := os.WriteFile(filepath.Join(outDir, "search-index.js"), []byte(script), 0644); err != nil {
+		return fmt.Errorf("failed to write search index script: %w", err)
+	}
+
+	return nil
+}
+
+// anonymousReadable reports whether visitors who aren't logged in may read a document
+func anonymousReadable(docPath string) bool {
+	return acl.CanRead(nil, docPath)
+}
+
+// copyStaticAttachments copies every non-markdown file below srcDir into destDir,
+// keeping the directory structure intact. Directories for which readable returns false
+// are left out.
+func copyStaticAttachments(srcDir, destDir string, readable func(rel string) bool) error {
+	if _, err := os.Stat(srcDir); os.IsNotExist(err) {
+		return nil
+	}
+
+	return filepath.Walk(srcDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".") && p != srcDir {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(srcDir, p)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if !readable(filepath.ToSlash(rel)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.ToLower(filepath.Ext(p)) == ".md" {
+			return nil
+		}
+		return copyFileTo(p, filepath.Join(destDir, rel))
+	})
+}
+
+// copyStaticAssets copies the embedded static assets followed by any overrides in data/static
+func copyStaticAssets(cfg *config.Config, destDir string) error {
+	staticFS := resources.GetStaticFS()
+	err := fs.WalkDir(staticFS, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		src, err := staticFS.Open(p)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		return writeStaticFile(filepath.Join(destDir, filepath.FromSlash(p)), src)
+	})
+	if err != nil {
+		return err
+	}
+
+	// The file extensions script is generated dynamically by the server
+	extensionsJS := fmt.Sprintf("// File extensions configuration - dynamically generated\n"+
+		"var ALLOWED_FILE_EXTENSIONS = %s;\nvar FILE_EXTENSION_MIME_TYPES = %s;\n",
+		config.GetAllowedExtensionsJSON(), config.GetExtensionMimeTypesJSON())
+	if err := os.WriteFile(filepath.Join(destDir, "js", "file-extensions.js"), []byte(extensionsJS), 0644); err != nil {
+		return err
+	}
+
+	customDir := filepath.Join(cfg.Wiki.RootDir, "static")
+	return filepath.Walk(customDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(customDir, p)
+		if err != nil {
+			return err
+		}
+		return copyFileTo(p, filepath.Join(destDir, rel))
+	})
+}
+
+// copyFileTo copies the file at src to dest, creating parent directories as needed
+func copyFileTo(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return writeStaticFile(dest, in)
+}
+
+// writeStaticFile writes the contents of r to dest, creating parent directories as needed
+func writeStaticFile(dest string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, r)
+	return err
+}
@@ -12,9 +12,12 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"wiki-go/internal/acl"
+	"wiki-go/internal/audit"
 	"wiki-go/internal/auth"
 	"wiki-go/internal/config"
 	"wiki-go/internal/i18n"
+	"wiki-go/internal/roles"
 )
 
 // FileResponse represents the response for file operations
@@ -53,11 +56,11 @@ func UploadFileHandler(w http.ResponseWriter, r *http.Request, cfg *config.Confi
 
 	// Check if user is authenticated and has appropriate permissions
 	session := auth.GetSession(r)
-	if session == nil || (session.Role != config.RoleAdmin && session.Role != config.RoleEditor) {
+	if !auth.Can(session, roles.PermFileUpload) {
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(FileResponse{
 			Success: false,
-			Message: "Unauthorized. Admin or editor access required.",
+			Message: "Unauthorized. Upload permission required.",
 		})
 		return
 	}
@@ -103,6 +106,25 @@ func UploadFileHandler(w http.ResponseWriter, r *http.Request, cfg *config.Confi
 	docPath = strings.TrimSuffix(docPath, "/")
 	docPath = strings.ReplaceAll(docPath, "\\", "/")
 
+	// Path restricted tokens can only upload to their documents
+	if !session.AllowsPath(docPath) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(FileResponse{
+			Success: false,
+			Message: "Token is not allowed to access this path.",
+		})
+		return
+	}
+
+	if !acl.CanWrite(session, docPath) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(FileResponse{
+			Success: false,
+			Message: "You don't have permission to change this document.",
+		})
+		return
+	}
+
 	// Special case for homepage
 	if docPath == "" || docPath == "/" {
 		docPath = "pages/home"
@@ -207,6 +229,7 @@ func UploadFileHandler(w http.ResponseWriter, r *http.Request, cfg *config.Confi
 
 	// Create safe filename - remove any potentially unsafe characters
 	filename := sanitizeFilename(fileHeader.Filename)
+	target := "/" + strings.TrimPrefix(filepath.ToSlash(filepath.Join(docPath, filename)), "/")
 
 	// Special handling for SVG files to prevent XSS attacks
 	if strings.ToLower(filepath.Ext(filename)) == ".svg" && !cfg.Wiki.DisableFileUploadChecking {
@@ -237,6 +260,7 @@ func UploadFileHandler(w http.ResponseWriter, r *http.Request, cfg *config.Confi
 
 		// Write the sanitized SVG directly to the file
 		if err := os.WriteFile(savePath, sanitizedSVG, 0644); err != nil {
+			recordAudit(r, audit.ActionFileUpload, target, err, "")
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(FileResponse{
 				Success: false,
@@ -249,6 +273,7 @@ func UploadFileHandler(w http.ResponseWriter, r *http.Request, cfg *config.Confi
 		urlPath := filepath.Join("/api/files", docPath, filename)
 		// Replace backslashes with forward slashes for URLs
 		urlPath = strings.ReplaceAll(urlPath, "\\", "/")
+		recordAudit(r, audit.ActionFileUpload, target, nil, fmt.Sprintf("%d bytes", len(sanitizedSVG)))
 
 		// Return success response
 		w.WriteHeader(http.StatusOK)
@@ -266,6 +291,7 @@ func UploadFileHandler(w http.ResponseWriter, r *http.Request, cfg *config.Confi
 	// Create destination file
 	dst, err := os.Create(savePath)
 	if err != nil {
+		recordAudit(r, audit.ActionFileUpload, target, err, "")
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(FileResponse{
 			Success: false,
@@ -276,7 +302,8 @@ func UploadFileHandler(w http.ResponseWriter, r *http.Request, cfg *config.Confi
 	defer dst.Close()
 
 	// Copy the uploaded file to the destination file
-	_, err = io.Copy(dst, file)
+	size, err := io.Copy(dst, file)
+	recordAudit(r, audit.ActionFileUpload, target, err, fmt.Sprintf("%d bytes", size))
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(FileResponse{
@@ -341,6 +368,15 @@ func ListFilesHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config
 	path = strings.TrimSuffix(path, "/")
 	path = strings.ReplaceAll(path, "\\", "/")
 
+	if !acl.CanRead(auth.GetSession(r), fileDocumentPath(path)) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(FileResponse{
+			Success: false,
+			Message: "Document directory does not exist.",
+		})
+		return
+	}
+
 	// Determine the full filesystem path to the document's directory
 	var dirPath string
 	if strings.HasPrefix(path, "pages/") {
@@ -430,11 +466,11 @@ func DeleteFileHandler(w http.ResponseWriter, r *http.Request, cfg *config.Confi
 
 	// Check if user is authenticated and has appropriate permissions
 	session := auth.GetSession(r)
-	if session == nil || (session.Role != config.RoleAdmin && session.Role != config.RoleEditor) {
+	if !auth.Can(session, roles.PermFileUpload) {
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(FileResponse{
 			Success: false,
-			Message: "Unauthorized. Admin or editor access required.",
+			Message: "Unauthorized. Upload permission required.",
 		})
 		return
 	}
@@ -470,6 +506,15 @@ func DeleteFileHandler(w http.ResponseWriter, r *http.Request, cfg *config.Confi
 		return
 	}
 
+	if !acl.CanWrite(session, fileDocumentPath(path)) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(FileResponse{
+			Success: false,
+			Message: "You don't have permission to change this document.",
+		})
+		return
+	}
+
 	// Determine the full filesystem path to the file
 	var filePath string
 	if strings.HasPrefix(path, "pages/") {
@@ -513,6 +558,7 @@ func DeleteFileHandler(w http.ResponseWriter, r *http.Request, cfg *config.Confi
 
 	// Delete the file
 	err = os.Remove(filePath)
+	recordAudit(r, audit.ActionFileDelete, "/"+strings.TrimPrefix(path, "/"), err, "")
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(FileResponse{
@@ -554,6 +600,12 @@ func ServeFileHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config
 	path = filepath.Clean(path)
 	path = strings.ReplaceAll(path, "\\", "/")
 
+	// Attachments are as restricted as their document
+	if !acl.CanRead(auth.GetSession(r), fileDocumentPath(path)) {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
 	// Determine the full filesystem path to the file
 	var filePath string
 	if strings.HasPrefix(path, "pages/") {
@@ -996,11 +1048,11 @@ func ListDocumentsHandler(w http.ResponseWriter, r *http.Request, cfg *config.Co
 
 	// Check if user is authenticated and has appropriate permissions
 	session := auth.GetSession(r)
-	if session == nil || (session.Role != config.RoleAdmin && session.Role != config.RoleEditor) {
+	if !auth.Can(session, roles.PermPageEdit) {
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(DocumentsResponse{
 			Success: false,
-			Message: "Unauthorized. Admin or editor access required.",
+			Message: "Unauthorized. Editing permission required.",
 		})
 		return
 	}
@@ -1044,6 +1096,11 @@ func ListDocumentsHandler(w http.ResponseWriter, r *http.Request, cfg *config.Co
 				relPath = strings.TrimPrefix(relPath, "/")
 			}
 
+			// Leave out documents the user may not read, or that are outside the token's path
+			if !acl.CanRead(session, relPath) || !session.AllowsPath(relPath) {
+				return nil
+			}
+
 			// Add to documents list
 			documents = append(documents, Document{
 				Title: title,
@@ -1097,11 +1154,11 @@ func RenameFileHandler(w http.ResponseWriter, r *http.Request, cfg *config.Confi
 
 	// Check if user is authenticated and has appropriate permissions
 	session := auth.GetSession(r)
-	if session == nil || (session.Role != config.RoleAdmin && session.Role != config.RoleEditor) {
+	if !auth.Can(session, roles.PermFileUpload) {
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(FileResponse{
 			Success: false,
-			Message: "Unauthorized. Admin or editor access required.",
+			Message: "Unauthorized. Upload permission required.",
 		})
 		return
 	}
@@ -1150,6 +1207,25 @@ func RenameFileHandler(w http.ResponseWriter, r *http.Request, cfg *config.Confi
 	path = strings.TrimSuffix(path, "/")
 	path = strings.ReplaceAll(path, "\\", "/")
 
+	// Path restricted tokens can only rename files of their documents
+	if !session.AllowsPath(path) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(FileResponse{
+			Success: false,
+			Message: "Token is not allowed to access this path.",
+		})
+		return
+	}
+
+	if !acl.CanWrite(session, path) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(FileResponse{
+			Success: false,
+			Message: "You don't have permission to change this document.",
+		})
+		return
+	}
+
 	// Extract directory and filename
 	dir := filepath.Dir(path)
 	filename := filepath.Base(path)
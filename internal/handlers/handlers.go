@@ -2,6 +2,9 @@ package handlers
 
 import (
 	"log"
+	"wiki-go/internal/acl"
+	"wiki-go/internal/audit"
+	"wiki-go/internal/auth"
 	"wiki-go/internal/config"
 	"wiki-go/internal/i18n"
 )
@@ -20,6 +23,47 @@ func InitHandlers(config *config.Config) {
 	// Initialise IP-based ban list for login attempts
 	InitLoginBan(cfg)
 
+	// Trust forwarding and login headers only from the configured reverse proxies
+	auth.InitReverseProxy(cfg)
+
+	// Read per-path access rules from acl.yaml and directory frontmatter
+	acl.Init(cfg)
+
+	// Load persisted sessions and start expiring them
+	if err := auth.InitSessions(cfg); err != nil {
+		log.Printf("Warning: Failed to load sessions: %v", err)
+	}
+
+	// Load personal access tokens
+	if err := auth.InitTokens(cfg); err != nil {
+		log.Printf("Warning: Failed to load API tokens: %v", err)
+	}
+
+	// Load two-factor authentication settings
+	if err := auth.InitTOTP(cfg); err != nil {
+		log.Printf("Warning: Failed to load two-factor settings: %v", err)
+	}
+
+	// Load custom roles and groups
+	if err := auth.InitPermissions(cfg); err != nil {
+		log.Printf("Warning: Failed to load roles and groups: %v", err)
+	}
+
+	// Load open invitation links
+	if err := auth.InitInvitations(cfg); err != nil {
+		log.Printf("Warning: Failed to load invitations: %v", err)
+	}
+
+	// Load open password reset links
+	if err := auth.InitPasswordResets(cfg); err != nil {
+		log.Printf("Warning: Failed to load password reset links: %v", err)
+	}
+
+	// Open the audit log for appending
+	if err := audit.Init(cfg); err != nil {
+		log.Printf("Warning: Failed to open audit log: %v", err)
+	}
+
 	// Routes are now managed in the routes package
 }
 
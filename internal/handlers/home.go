@@ -10,9 +10,11 @@ import (
 	"time"
 
 	"wiki-go/internal/config"
+	"wiki-go/internal/csp"
 	"wiki-go/internal/i18n"
 	"wiki-go/internal/types"
 	"wiki-go/internal/utils"
+	"wiki-go/internal/acl"
 	"wiki-go/internal/auth"
 )
 
@@ -490,6 +492,13 @@ func HomeHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
 		return
 	}
 
+	// Rules for the whole wiki cover the homepage too
+	session := auth.GetSession(r)
+	if !acl.CanRead(session, "") {
+		denyDocument(w, r, session)
+		return
+	}
+
 	// Get navigation items
 	nav, err := utils.BuildNavigation(cfg.Wiki.RootDir, cfg.Wiki.DocumentsDir)
 	if err != nil {
@@ -497,6 +506,7 @@ func HomeHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
 		http.Error(w, "Failed to build navigation", http.StatusInternalServerError)
 		return
 	}
+	filterNavigation(nav, session)
 
 	// Mark active navigation item
 	utils.MarkActiveNavItem(nav, "/")
@@ -523,14 +533,10 @@ func HomeHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
 	}
 
 	// Get authentication status
-	session := auth.GetSession(r)
 	isAuthenticated := session != nil
 	
-	// Get user role
-	userRole := ""
-	if isAuthenticated && session != nil {
-		userRole = session.Role
-	}
+	// Get user role and permissions
+	userRole, permissions := pagePermissions(session, acl.CanWrite(session, ""))
 
 	// Render the page
 	data := &types.PageData{
@@ -543,6 +549,8 @@ func HomeHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
 		AvailableLanguages: i18n.GetAvailableLanguages(),
 		IsAuthenticated:    isAuthenticated,
 		UserRole:           userRole,
+		Permissions:        permissions,
+		CSPNonce:           csp.Nonce(r),
 	}
 
 	renderTemplate(w, data)
@@ -7,14 +7,21 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
 	"time"
+	"wiki-go/internal/acl"
+	"wiki-go/internal/audit"
 	"wiki-go/internal/auth"
 	"wiki-go/internal/config"
+	"wiki-go/internal/i18n"
+	"wiki-go/internal/roles"
+	"wiki-go/internal/utils"
 )
 
 // ImportResponse represents the response for the import API
@@ -27,14 +34,19 @@ type ImportResponse struct {
 
 // ImportStatusResponse represents the status of an import job
 type ImportStatusResponse struct {
-	Status       string       `json:"status"` // "processing", "completed", "failed"
-	Progress     int          `json:"progress"`
-	CurrentFile  string       `json:"currentFile,omitempty"`
-	SuccessCount int          `json:"successCount"`
-	ErrorCount   int          `json:"errorCount"`
-	ImportedFiles []ImportedFile `json:"importedFiles,omitempty"`
-	Errors       []string     `json:"errors,omitempty"`
-	Message      string       `json:"message,omitempty"`
+	Status         string         `json:"status"` // "processing", "completed", "failed"
+	Progress       int            `json:"progress"`
+	CurrentFile    string         `json:"currentFile,omitempty"`
+	SuccessCount   int            `json:"successCount"`
+	ErrorCount     int            `json:"errorCount"`
+	ImportedFiles  []ImportedFile `json:"importedFiles,omitempty"`
+	Errors         []string       `json:"errors,omitempty"`
+	Message        string         `json:"message,omitempty"`
+	DryRun         bool           `json:"dryRun"`
+	ImportedAssets []ImportedFile `json:"importedAssets,omitempty"`
+	Skipped        []string       `json:"skipped,omitempty"`
+
+	auditEntry audit.Entry // Recorded with the outcome once the job finishes
 }
 
 // ImportedFile represents a successfully imported file
@@ -47,18 +59,176 @@ type ImportedFile struct {
 var importJobs = make(map[string]*ImportStatusResponse)
 var importJobsMutex sync.RWMutex
 
-// ImportHandler handles the import of documents from a ZIP file
+// Conflict strategies for documents and attachments that already exist in the wiki
+const (
+	ImportConflictSkip      = "skip"
+	ImportConflictOverwrite = "overwrite"
+	ImportConflictRename    = "rename"
+)
+
+// ImportOptions controls how an import job treats existing content
+type ImportOptions struct {
+	Format   string        // Archive format, one of the keys of importFormats
+	Conflict string        // One of the ImportConflict* strategies
+	DryRun   bool          // Only report what would be imported without writing anything
+	Session  *auth.Session // User running the import, whose access rules apply to every document
+}
+
+// importFormat describes a supported import format
+type importFormat struct {
+	extension string // Required extension of the uploaded file
+	process   func(data []byte, jobID string, opts ImportOptions, cfg *config.Config)
+}
+
+// importFormats maps the supported formats to the function processing them
+var importFormats = map[string]importFormat{
+	"markdown":  {extension: ".zip", process: processImportFromBytes},
+	"obsidian":  {extension: ".zip", process: processObsidianImport},
+	"mediawiki": {extension: ".xml", process: processMediaWikiImport},
+	"html":      {extension: ".zip", process: processHTMLImport},
+}
+
+// importDocument is a document planned for import
+type importDocument struct {
+	Source   string          // Path of the document in the imported archive
+	Target   string          // Document path in the wiki, relative to the documents directory
+	Content  []byte          // Markdown content to write
+	Modified time.Time       // Modification time to keep, if known
+	Assets   []*importAsset  // Attachments stored next to the document
+	Versions []importVersion // Older revisions, oldest first
+}
+
+// importAsset is an attachment planned for import
+type importAsset struct {
+	Source string                        // Path of the file in the imported archive
+	Name   string                        // File name in the document directory
+	Skip   bool                          // Whether an existing file is kept because of the skip strategy
+	Open   func() (io.ReadCloser, error) // Opens the file contents
+}
+
+// importVersion is an older revision of an imported document
+type importVersion struct {
+	Timestamp time.Time
+	Content   []byte
+}
+
+// importPlanner assigns wiki paths to imported documents and attachments according to the conflict strategy
+type importPlanner struct {
+	cfg     *config.Config
+	opts    ImportOptions
+	planned map[string]bool
+}
+
+// newImportPlanner creates a planner for a single import job
+func newImportPlanner(cfg *config.Config, opts ImportOptions) *importPlanner {
+	return &importPlanner{cfg: cfg, opts: opts, planned: make(map[string]bool)}
+}
+
+// documentExists reports whether a document already exists at the target path or is planned by this import
+func (p *importPlanner) documentExists(target string) bool {
+	if p.planned[target] {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(p.cfg.Wiki.RootDir, p.cfg.Wiki.DocumentsDir, filepath.FromSlash(target), "document.md"))
+	return err == nil
+}
+
+// resolveTarget returns the path a document should be imported to, or false when it must be skipped
+func (p *importPlanner) resolveTarget(target string) (string, bool) {
+	// Documents of the same import never replace each other
+	if p.planned[target] {
+		base := target
+		for i := 1; p.planned[target]; i++ {
+			target = fmt.Sprintf("%s-%d", base, i)
+		}
+	}
+
+	if p.documentExists(target) {
+		switch p.opts.Conflict {
+		case ImportConflictSkip:
+			return "", false
+		case ImportConflictRename:
+			base := target
+			for i := 1; p.documentExists(target); i++ {
+				target = fmt.Sprintf("%s-%d", base, i)
+			}
+		}
+	}
+
+	p.planned[target] = true
+	return target, true
+}
+
+// addAsset attaches a file to a document and returns the file name to reference it by
+func (p *importPlanner) addAsset(doc *importDocument, source string, open func() (io.ReadCloser, error)) string {
+	// Reuse the attachment when the document references the same file more than once
+	for _, asset := range doc.Assets {
+		if asset.Source == source {
+			return asset.Name
+		}
+	}
+
+	name := sanitizeFilename(path.Base(source))
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	// Files with the same name from different folders end up in the same document directory
+	taken := func(name string) bool {
+		for _, asset := range doc.Assets {
+			if asset.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+	for i := 1; taken(name); i++ {
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+
+	docDir := filepath.Join(p.cfg.Wiki.RootDir, p.cfg.Wiki.DocumentsDir, filepath.FromSlash(doc.Target))
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(docDir, name))
+		return err == nil
+	}
+
+	asset := &importAsset{Source: source, Name: name, Open: open}
+	if exists(name) {
+		switch p.opts.Conflict {
+		case ImportConflictSkip:
+			asset.Skip = true
+		case ImportConflictRename:
+			for i := 1; exists(asset.Name) || taken(asset.Name); i++ {
+				asset.Name = fmt.Sprintf("%s-%d%s", base, i, ext)
+			}
+		}
+	}
+
+	doc.Assets = append(doc.Assets, asset)
+	return asset.Name
+}
+
+// ImportHandler handles the import of documents from a ZIP archive or MediaWiki XML export
 func ImportHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
 	// Set appropriate headers
 	w.Header().Set("Content-Type", "application/json")
 
-	// Check if user is authenticated and has admin role
+	// Check if user is authenticated and may import
 	session := auth.GetSession(r)
-	if session == nil || session.Role != config.RoleAdmin {
+	if !auth.Can(session, roles.PermContentImport) {
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(ImportResponse{
 			Success: false,
-			Message: "Unauthorized. Admin access required.",
+			Message: "Unauthorized. Import permission required.",
+		})
+		return
+	}
+
+	// An import writes wherever the archive says, which a token limited to a path can't vouch for
+	if session.TokenPath != "" {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(ImportResponse{
+			Success: false,
+			Message: "Tokens limited to a path can't import",
 		})
 		return
 	}
@@ -100,12 +270,25 @@ func ImportHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
 	}
 	defer file.Close()
 
+	// Get the import options, keeping the previous markdown import with overwrites by default
+	opts, ok := importOptionsFromRequest(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ImportResponse{
+			Success: false,
+			Message: "Invalid import options. Check the format and conflict strategy.",
+		})
+		return
+	}
+	opts.Session = session
+
 	// Validate file extension
-	if !strings.HasSuffix(strings.ToLower(fileHeader.Filename), ".zip") {
+	extension := importFormats[opts.Format].extension
+	if !strings.HasSuffix(strings.ToLower(fileHeader.Filename), extension) {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(ImportResponse{
 			Success: false,
-			Message: "Invalid file type. Only ZIP files are allowed.",
+			Message: fmt.Sprintf("Invalid file type. Only %s files are allowed for this format.", strings.ToUpper(strings.TrimPrefix(extension, "."))),
 		})
 		return
 	}
@@ -121,23 +304,31 @@ func ImportHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
 		return
 	}
 
+	// The job is audited when it finishes, with the user who started it
+	details := opts.Format + " archive"
+	if opts.DryRun {
+		details += ", dry run"
+	}
+
 	// Generate a unique job ID
 	jobID := fmt.Sprintf("import-%d", time.Now().UnixNano())
 
 	// Create initial job status
 	importJobsMutex.Lock()
 	importJobs[jobID] = &ImportStatusResponse{
-		Status:       "processing",
-		Progress:     0,
-		SuccessCount: 0,
-		ErrorCount:   0,
+		Status:        "processing",
+		Progress:      0,
+		SuccessCount:  0,
+		ErrorCount:    0,
 		ImportedFiles: []ImportedFile{},
-		Errors:       []string{},
+		Errors:        []string{},
+		DryRun:        opts.DryRun,
+		auditEntry:    auditEntry(r, audit.ActionImport, fileHeader.Filename, nil, details),
 	}
 	importJobsMutex.Unlock()
 
 	// Start the import process in a goroutine
-	go processImportFromBytes(fileBytes, jobID, cfg)
+	go importFormats[opts.Format].process(fileBytes, jobID, opts, cfg)
 
 	// Return success response with job ID
 	w.WriteHeader(http.StatusOK)
@@ -149,18 +340,43 @@ func ImportHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
 	})
 }
 
+// importOptionsFromRequest reads the archive format, conflict strategy and dry run flag from the import form
+func importOptionsFromRequest(r *http.Request) (ImportOptions, bool) {
+	opts := ImportOptions{
+		Format:   r.FormValue("format"),
+		Conflict: r.FormValue("conflict"),
+		DryRun:   r.FormValue("dryRun") == "true",
+	}
+
+	if opts.Format == "" {
+		opts.Format = "markdown"
+	}
+	if _, ok := importFormats[opts.Format]; !ok {
+		return opts, false
+	}
+
+	switch opts.Conflict {
+	case "":
+		opts.Conflict = ImportConflictOverwrite
+	case ImportConflictSkip, ImportConflictOverwrite, ImportConflictRename:
+	default:
+		return opts, false
+	}
+	return opts, true
+}
+
 // ImportStatusHandler handles requests to check the status of an import job
 func ImportStatusHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
 	// Set appropriate headers
 	w.Header().Set("Content-Type", "application/json")
 
-	// Check if user is authenticated and has admin role
+	// Check if user is authenticated and may import
 	session := auth.GetSession(r)
-	if session == nil || session.Role != config.RoleAdmin {
+	if !auth.Can(session, roles.PermContentImport) {
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(ImportResponse{
 			Success: false,
-			Message: "Unauthorized. Admin access required.",
+			Message: "Unauthorized. Import permission required.",
 		})
 		return
 	}
@@ -199,7 +415,7 @@ func ImportStatusHandler(w http.ResponseWriter, r *http.Request, cfg *config.Con
 }
 
 // processImportFromBytes processes the import of documents from ZIP file bytes
-func processImportFromBytes(zipFileBytes []byte, jobID string, cfg *config.Config) {
+func processImportFromBytes(zipFileBytes []byte, jobID string, opts ImportOptions, cfg *config.Config) {
 	// Create a reader from the bytes
 	zipReader, err := zip.NewReader(bytes.NewReader(zipFileBytes), int64(len(zipFileBytes)))
 	if err != nil {
@@ -207,119 +423,355 @@ func processImportFromBytes(zipFileBytes []byte, jobID string, cfg *config.Confi
 		return
 	}
 
-	// Count total files for progress calculation
-	var totalFiles int
-	var markdownFiles int
+	// Index all files in the archive by their cleaned path
+	entries := make(map[string]*zip.File)
+	var markdownFiles []*zip.File
 	for _, file := range zipReader.File {
-		if !file.FileInfo().IsDir() {
-			totalFiles++
-			if strings.HasSuffix(strings.ToLower(file.Name), ".md") {
-				markdownFiles++
-			}
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		entries[path.Clean(file.Name)] = file
+		if strings.HasSuffix(strings.ToLower(file.Name), ".md") {
+			markdownFiles = append(markdownFiles, file)
 		}
 	}
 
-	if markdownFiles == 0 {
+	if len(markdownFiles) == 0 {
 		updateImportStatus(jobID, "failed", 0, "", "No markdown files found in the ZIP archive.")
 		return
 	}
 
-	// Process each file in the ZIP
-	processedFiles := 0
-	for _, file := range zipReader.File {
-		// Skip directories
-		if file.FileInfo().IsDir() {
+	// Plan every document first so that links between documents can point at their final paths
+	planner := newImportPlanner(cfg, opts)
+	var docs []*importDocument
+	existingTargets := make(map[string]string) // Skipped documents, whose links point at the existing document
+	for _, file := range markdownFiles {
+		updateImportStatusFile(jobID, file.Name)
+
+		content, err := readZipFile(file)
+		if err != nil {
+			addImportError(jobID, fmt.Sprintf("Error processing %s: %v", file.Name, err))
 			continue
 		}
 
-		// Update current file in status
-		updateImportStatusFile(jobID, file.Name)
+		targetPath, err := determineTargetPath(file.Name)
+		if err != nil {
+			addImportError(jobID, fmt.Sprintf("Error processing %s: failed to determine target path: %v", file.Name, err))
+			continue
+		}
 
-		// Only process markdown files
-		if !strings.HasSuffix(strings.ToLower(file.Name), ".md") {
-			processedFiles++
-			progress := int((float64(processedFiles) / float64(totalFiles)) * 100)
-			updateImportStatusProgress(jobID, progress)
+		target, ok := planner.resolveTarget(targetPath)
+		if !ok {
+			addImportSkipped(jobID, fmt.Sprintf("%s: /%s already exists", file.Name, targetPath))
+			existingTargets[path.Clean(file.Name)] = targetPath
 			continue
 		}
 
-		// Process the markdown file
-		err := processMarkdownFile(file, jobID, cfg)
-		if err != nil {
+		docs = append(docs, &importDocument{
+			Source:  path.Clean(file.Name),
+			Target:  target,
+			Content: content,
+		})
+	}
+
+	// Map archive paths of markdown files to their wiki paths
+	docTargets := make(map[string]string, len(docs))
+	for _, doc := range docs {
+		docTargets[doc.Source] = doc.Target
+	}
+
+	// Rewrite relative references and collect the attachments each document needs
+	referenced := make(map[string]bool)
+	for _, doc := range docs {
+		doc.Content = []byte(rewriteImportReferences(string(doc.Content), doc, func(ref string) (string, bool) {
+			if target, ok := docTargets[ref]; ok {
+				return "/" + target, true
+			}
+			if target, ok := existingTargets[ref]; ok {
+				return "/" + target, true
+			}
+
+			file, ok := entries[ref]
+			if !ok {
+				return "", false
+			}
+			if strings.HasSuffix(strings.ToLower(ref), ".md") {
+				// A document that failed to import, which is reported already
+				if !referenced[ref] {
+					addImportSkipped(jobID, fmt.Sprintf("%s: linked document was not imported", ref))
+				}
+				referenced[ref] = true
+				return "", false
+			}
+			if !config.IsAllowedExtension(strings.ToLower(path.Ext(ref))) {
+				if !referenced[ref] {
+					addImportSkipped(jobID, fmt.Sprintf("%s: file type is not allowed", ref))
+				}
+				referenced[ref] = true
+				return "", false
+			}
+
+			referenced[ref] = true
+			return planner.addAsset(doc, ref, file.Open), true
+		}))
+	}
+
+	// Report files that were not picked up by any document
+	for _, file := range zipReader.File {
+		name := path.Clean(file.Name)
+		if _, ok := entries[name]; ok && !strings.HasSuffix(strings.ToLower(name), ".md") && !referenced[name] {
+			addImportSkipped(jobID, fmt.Sprintf("%s: not referenced by any document", name))
+		}
+	}
+
+	applyImport(jobID, docs, opts, cfg)
+}
+
+// readZipFile reads the full contents of a file in a ZIP archive
+func readZipFile(file *zip.File) ([]byte, error) {
+	fileReader, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer fileReader.Close()
+
+	content, err := io.ReadAll(fileReader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	return content, nil
+}
+
+// importReferenceRegex matches markdown links and images: [text](destination "title")
+var importReferenceRegex = regexp.MustCompile(`(!?\[[^\]]*\]\()(<[^>]+>|[^)\s]+)((?:\s+"[^"]*")?\))`)
+
+// rewriteImportReferences rewrites relative link and image destinations in a document. The
+// resolve callback receives the referenced path inside the archive and returns its replacement.
+func rewriteImportReferences(content string, doc *importDocument, resolve func(ref string) (string, bool)) string {
+	return mapImportText(content, func(text string) string {
+		return importReferenceRegex.ReplaceAllStringFunc(text, func(match string) string {
+			parts := importReferenceRegex.FindStringSubmatch(match)
+			dest := strings.TrimSuffix(strings.TrimPrefix(parts[2], "<"), ">")
+
+			if !isRelativeImportReference(dest) {
+				return match
+			}
+
+			fragment := ""
+			if i := strings.Index(dest, "#"); i != -1 {
+				dest, fragment = dest[:i], dest[i:]
+			}
+			if unescaped, err := url.PathUnescape(dest); err == nil {
+				dest = unescaped
+			}
+
+			ref := path.Clean(path.Join(path.Dir(doc.Source), dest))
+			replacement, ok := resolve(ref)
+			if !ok {
+				return match
+			}
+			return parts[1] + replacement + fragment + parts[3]
+		})
+	})
+}
+
+// mapImportText applies fn to the parts of a markdown document that are outside fenced code blocks and inline code
+func mapImportText(content string, fn func(text string) string) string {
+	lines := strings.Split(content, "\n")
+	inCodeBlock := false
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		// Track fenced code blocks (``` or ~~~)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inCodeBlock = !inCodeBlock
+			continue
+		}
+		if inCodeBlock {
+			continue
+		}
+
+		// Only process segments outside inline code
+		segments := strings.Split(line, "`")
+		for j := 0; j < len(segments); j += 2 {
+			segments[j] = fn(segments[j])
+		}
+		lines[i] = strings.Join(segments, "`")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// isRelativeImportReference reports whether a link destination points at another file in the import
+func isRelativeImportReference(dest string) bool {
+	if dest == "" || strings.HasPrefix(dest, "#") || strings.HasPrefix(dest, "/") {
+		return false
+	}
+	if strings.Contains(dest, "://") || strings.HasPrefix(dest, "mailto:") || strings.HasPrefix(dest, "data:") {
+		return false
+	}
+	return true
+}
+
+// applyImport writes the planned documents and their attachments, or only reports them in a dry run
+func applyImport(jobID string, docs []*importDocument, opts ImportOptions, cfg *config.Config) {
+	for i, doc := range docs {
+		updateImportStatusFile(jobID, doc.Source)
+
+		if err := writeImportDocument(jobID, doc, opts, cfg); err != nil {
 			// Add error but continue processing other files
-			addImportError(jobID, fmt.Sprintf("Error processing %s: %v", file.Name, err))
+			addImportError(jobID, fmt.Sprintf("Error processing %s: %v", doc.Source, err))
 		}
 
 		// Update progress
-		processedFiles++
-		progress := int((float64(processedFiles) / float64(totalFiles)) * 100)
+		progress := int((float64(i+1) / float64(len(docs))) * 100)
 		updateImportStatusProgress(jobID, progress)
 	}
 
 	// Mark job as completed
 	importJobsMutex.RLock()
 	status := importJobs[jobID]
+	successCount, errorCount, assetCount := status.SuccessCount, status.ErrorCount, len(status.ImportedAssets)
 	importJobsMutex.RUnlock()
 
-	if status.ErrorCount == 0 {
+	if opts.DryRun {
+		updateImportStatus(jobID, "completed", 100, "", fmt.Sprintf("Dry run: %d documents and %d attachments would be imported, %d errors.", successCount, assetCount, errorCount))
+	} else if errorCount == 0 {
 		updateImportStatus(jobID, "completed", 100, "", "Import completed successfully.")
-	} else if status.SuccessCount == 0 {
+	} else if successCount == 0 {
 		updateImportStatus(jobID, "failed", 100, "", "Import failed. No files were imported successfully.")
 	} else {
-		updateImportStatus(jobID, "completed", 100, "", fmt.Sprintf("Import completed with %d errors.", status.ErrorCount))
+		updateImportStatus(jobID, "completed", 100, "", fmt.Sprintf("Import completed with %d errors.", errorCount))
 	}
 }
 
-// processMarkdownFile processes a single markdown file from the ZIP
-func processMarkdownFile(file *zip.File, jobID string, cfg *config.Config) error {
-	// Open the file from the ZIP
-	fileReader, err := file.Open()
-	if err != nil {
-		return fmt.Errorf("failed to open file: %v", err)
+// writeImportDocument writes a single planned document with its attachments and version history
+func writeImportDocument(jobID string, doc *importDocument, opts ImportOptions, cfg *config.Config) error {
+	// Create the full path to the document directory
+	docDir := filepath.Join(cfg.Wiki.RootDir, cfg.Wiki.DocumentsDir, filepath.FromSlash(doc.Target))
+	docPath := filepath.Join(docDir, "document.md")
+
+	// Imported documents are held to the same access rules as documents saved in the editor
+	if !acl.CanWrite(opts.Session, doc.Target) {
+		return fmt.Errorf("you don't have permission to edit /%s", doc.Target)
+	}
+	if !auth.Can(opts.Session, roles.PermAccessBypass) {
+		current, _ := os.ReadFile(docPath)
+		if accessChanged(string(current), string(doc.Content)) {
+			return fmt.Errorf("only admins can change the access rules of a document")
+		}
 	}
-	defer fileReader.Close()
 
-	// Read the file content
-	content, err := io.ReadAll(fileReader)
-	if err != nil {
-		return fmt.Errorf("failed to read file: %v", err)
+	// Validate attachments before anything is written
+	assets := make([][]byte, len(doc.Assets))
+	for i, asset := range doc.Assets {
+		data, err := readImportAsset(asset, cfg)
+		if err != nil {
+			return fmt.Errorf("attachment %s: %v", asset.Source, err)
+		}
+		assets[i] = data
 	}
 
-	// Determine the target path based on the file's path in the ZIP
-	originalPath := file.Name
-	targetPath, err := determineTargetPath(originalPath)
-	if err != nil {
-		return fmt.Errorf("failed to determine target path: %v", err)
+	if !opts.DryRun {
+		// Create the directory if it doesn't exist
+		if err := os.MkdirAll(docDir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %v", err)
+		}
+
+		// Write the imported history first, so that it is ordered before the current content.
+		// Only the revisions that the version limit keeps are written.
+		versions := doc.Versions
+		if cfg.Wiki.MaxVersions > 0 && len(versions) > cfg.Wiki.MaxVersions {
+			versions = versions[len(versions)-cfg.Wiki.MaxVersions:]
+		}
+		for _, version := range versions {
+			if err := utils.SaveVersion(cfg.Wiki.RootDir, "documents/"+doc.Target, version.Content, version.Timestamp, cfg.Wiki.MaxVersions); err != nil {
+				return fmt.Errorf("failed to write version: %v", err)
+			}
+		}
+
+		// Keep the replaced content in the version history when overwriting
+		if current, err := os.ReadFile(docPath); err == nil && len(current) > 0 && cfg.Wiki.MaxVersions > 0 {
+			_ = utils.SaveVersion(cfg.Wiki.RootDir, "documents/"+doc.Target, current, time.Now(), cfg.Wiki.MaxVersions)
+		}
+
+		// Write the content to document.md in the target directory
+		if err := os.WriteFile(docPath, doc.Content, 0644); err != nil {
+			return fmt.Errorf("failed to write file: %v", err)
+		}
+
+		// Explicitly set permissions to ensure it's readable and writable
+		if err := os.Chmod(docPath, 0644); err != nil {
+			return fmt.Errorf("failed to set file permissions: %v", err)
+		}
+
+		// Keep the original modification time when the source has one
+		if !doc.Modified.IsZero() {
+			_ = os.Chtimes(docPath, doc.Modified, doc.Modified)
+		}
 	}
 
-	// Create the full path to the document directory
-	docDir := filepath.Join(cfg.Wiki.RootDir, cfg.Wiki.DocumentsDir, targetPath)
+	if !opts.DryRun {
+		for i, asset := range doc.Assets {
+			if asset.Skip {
+				continue
+			}
+			if err := os.WriteFile(filepath.Join(docDir, asset.Name), assets[i], 0644); err != nil {
+				return fmt.Errorf("failed to write attachment %s: %v", asset.Name, err)
+			}
+		}
+	}
+
+	// Only now that everything is written does the document count as imported
+	addImportedFile(jobID, doc.Source, "/"+doc.Target)
 
-	// Create the directory if it doesn't exist
-	err = os.MkdirAll(docDir, 0755)
+	for _, asset := range doc.Assets {
+		if asset.Skip {
+			addImportSkipped(jobID, fmt.Sprintf("%s: /%s/%s already exists", asset.Source, doc.Target, asset.Name))
+			continue
+		}
+		addImportedAsset(jobID, asset.Source, "/api/files/"+doc.Target+"/"+asset.Name)
+	}
+
+	return nil
+}
+
+// readImportAsset reads an attachment and applies the same content checks as file uploads
+func readImportAsset(asset *importAsset, cfg *config.Config) ([]byte, error) {
+	reader, err := asset.Open()
 	if err != nil {
-		return fmt.Errorf("failed to create directory: %v", err)
+		return nil, err
 	}
+	defer reader.Close()
 
-	// Write the content to document.md in the target directory
-	docPath := filepath.Join(docDir, "document.md")
-	
-	// Ensure the content has proper permissions
-	err = os.WriteFile(docPath, content, 0644)
+	data, err := io.ReadAll(io.LimitReader(reader, config.GetMaxUploadSizeBytes(cfg)+1))
 	if err != nil {
-		return fmt.Errorf("failed to write file: %v", err)
+		return nil, err
+	}
+	if int64(len(data)) > config.GetMaxUploadSizeBytes(cfg) {
+		return nil, fmt.Errorf("file is larger than %s", config.GetMaxUploadSizeFormatted(cfg))
 	}
-	
-	// Explicitly set permissions to ensure it's readable and writable
-	err = os.Chmod(docPath, 0644)
+
+	if cfg.Wiki.DisableFileUploadChecking {
+		return data, nil
+	}
+
+	detected, err := detectFileContentType(data, asset.Name)
 	if err != nil {
-		return fmt.Errorf("failed to set file permissions: %v", err)
+		return nil, err
+	}
+	expected := config.GetMimeTypeForExtension(strings.ToLower(filepath.Ext(asset.Name)))
+	if !isContentTypeCompatible(detected, expected, data, asset.Name) {
+		return nil, fmt.Errorf("%s", i18n.Translate("attachments.error_content_mismatch"))
 	}
 
-	// Add to successful imports
-	addImportedFile(jobID, originalPath, "/"+targetPath)
+	// Sanitize SVG files to prevent XSS attacks
+	if strings.ToLower(filepath.Ext(asset.Name)) == ".svg" {
+		return sanitizeSVG(data)
+	}
 
-	return nil
+	return data, nil
 }
 
 // determineTargetPath converts an original file path to a target path
@@ -368,6 +820,15 @@ func updateImportStatus(jobID, status string, progress int, currentFile, message
 		job.Progress = progress
 		job.CurrentFile = currentFile
 		job.Message = message
+
+		if status == "completed" || status == "failed" {
+			entry := job.auditEntry
+			if status == "failed" {
+				entry.Outcome = audit.OutcomeFailure
+			}
+			entry.Details += ": " + message
+			audit.Record(entry)
+		}
 	}
 }
 
@@ -415,3 +876,26 @@ func addImportError(jobID, errorMsg string) {
 		job.ErrorCount++
 	}
 }
+
+// addImportedAsset adds a successfully imported attachment to the job status
+func addImportedAsset(jobID, originalPath, newPath string) {
+	importJobsMutex.Lock()
+	defer importJobsMutex.Unlock()
+
+	if job, exists := importJobs[jobID]; exists {
+		job.ImportedAssets = append(job.ImportedAssets, ImportedFile{
+			OriginalPath: originalPath,
+			NewPath:      newPath,
+		})
+	}
+}
+
+// addImportSkipped records a file that was left out of the import
+func addImportSkipped(jobID, message string) {
+	importJobsMutex.Lock()
+	defer importJobsMutex.Unlock()
+
+	if job, exists := importJobs[jobID]; exists {
+		job.Skipped = append(job.Skipped, message)
+	}
+}
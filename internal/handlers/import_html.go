@@ -0,0 +1,1030 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"wiki-go/internal/config"
+)
+
+// htmlNode is an element or text node of a parsed HTML page
+type htmlNode struct {
+	Tag      string // Lowercase tag name, empty for text nodes
+	Attrs    map[string]string
+	Text     string
+	Children []*htmlNode
+}
+
+// attr returns the value of an attribute, or "" if it isn't set
+func (n *htmlNode) attr(name string) string {
+	return n.Attrs[name]
+}
+
+// hasClass reports whether the element has the given class
+func (n *htmlNode) hasClass(class string) bool {
+	for _, c := range strings.Fields(n.attr("class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// find returns the first descendant, in document order, that matches
+func (n *htmlNode) find(match func(*htmlNode) bool) *htmlNode {
+	for _, child := range n.Children {
+		if child.Tag != "" && match(child) {
+			return child
+		}
+		if found := child.find(match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// textContent returns the text of the node and its descendants
+func (n *htmlNode) textContent() string {
+	if n.Tag == "" {
+		return n.Text
+	}
+	if n.Tag == "br" {
+		return "\n"
+	}
+	var b strings.Builder
+	for _, child := range n.Children {
+		b.WriteString(child.textContent())
+	}
+	return b.String()
+}
+
+// byTag matches elements with one of the given tag names
+func byTag(tags ...string) func(*htmlNode) bool {
+	return func(n *htmlNode) bool {
+		for _, tag := range tags {
+			if n.Tag == tag {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// byID matches the element with the given id
+func byID(id string) func(*htmlNode) bool {
+	return func(n *htmlNode) bool {
+		return n.attr("id") == id
+	}
+}
+
+// htmlStripRegex matches scripts, styles and comments, which are removed before parsing
+var htmlStripRegex = regexp.MustCompile(`(?is)<script\b.*?</script>|<style\b.*?</style>|<!--.*?-->`)
+
+// parseHTMLPage parses an HTML page into a tree. The XML decoder is used in its lenient mode,
+// which copes with the HTML that Confluence and static site generators produce.
+func parseHTMLPage(data []byte) (*htmlNode, error) {
+	data = htmlStripRegex.ReplaceAll(data, nil)
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		// Exports are written as UTF-8 regardless of the declared charset
+		return input, nil
+	}
+
+	root := &htmlNode{Tag: "#document"}
+	stack := []*htmlNode{root}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		parent := stack[len(stack)-1]
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &htmlNode{Tag: strings.ToLower(t.Name.Local), Attrs: make(map[string]string, len(t.Attr))}
+			for _, a := range t.Attr {
+				node.Attrs[strings.ToLower(a.Name.Local)] = a.Value
+			}
+			parent.Children = append(parent.Children, node)
+			stack = append(stack, node)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			parent.Children = append(parent.Children, &htmlNode{Text: string(t)})
+		}
+	}
+
+	return root, nil
+}
+
+// Labels of Confluence info panels and of the admonitions of generic HTML documentation
+var (
+	confluencePanelLabels = map[string]string{
+		"information": "Info",
+		"tip":         "Tip",
+		"note":        "Note",
+		"warning":     "Warning",
+	}
+	admonitionLabels = map[string]string{
+		"note":      "Note",
+		"info":      "Info",
+		"seealso":   "See also",
+		"tip":       "Tip",
+		"hint":      "Hint",
+		"success":   "Success",
+		"important": "Important",
+		"attention": "Attention",
+		"warning":   "Warning",
+		"caution":   "Caution",
+		"danger":    "Danger",
+		"error":     "Error",
+	}
+)
+
+// Patterns used while converting HTML
+var (
+	htmlWhitespaceRegex  = regexp.MustCompile(`\s+`)
+	htmlBlankLinesRegex  = regexp.MustCompile(`[ \t]*\n[ \t]*\n[ \t\n]*`)
+	htmlPlaceholderRegex = regexp.MustCompile("\x00(\\d+)\x00")
+	htmlCellBreakRegex   = regexp.MustCompile(`\s*\n+\s*`)
+	htmlBrushRegex       = regexp.MustCompile(`brush:\s*([\w+#-]+)`)
+	htmlLanguageRegex    = regexp.MustCompile(`(?:^|\s)(?:language|lang)-([\w+#-]+)`)
+	htmlTextEscaper      = strings.NewReplacer(`\`, `\\`, "*", `\*`, "`", "\\`", "[", `\[`, "]", `\]`, "<", "&lt;")
+)
+
+// htmlConverter converts the content of an HTML page to markdown
+type htmlConverter struct {
+	resolve      func(ref string) (string, bool) // Returns the wiki URL or attachment name for a link or image
+	headingShift int                             // Levels added to headings, so that the page title stays the only h1
+	protected    []string
+}
+
+// Convert converts the children of the given nodes to markdown
+func (c *htmlConverter) Convert(nodes ...*htmlNode) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		b.WriteString("\n\n" + c.children(n) + "\n\n")
+	}
+
+	md := htmlBlankLinesRegex.ReplaceAllString(b.String(), "\n\n")
+	md = strings.TrimSpace(md)
+
+	return htmlPlaceholderRegex.ReplaceAllStringFunc(md, func(match string) string {
+		i, _ := strconv.Atoi(strings.Trim(match, "\x00"))
+		return c.protected[i]
+	})
+}
+
+// protect stores markdown that must be kept as is and returns a placeholder for it
+func (c *htmlConverter) protect(text string) string {
+	c.protected = append(c.protected, text)
+	return fmt.Sprintf("\x00%d\x00", len(c.protected)-1)
+}
+
+// children converts the children of a node
+func (c *htmlConverter) children(n *htmlNode) string {
+	var b strings.Builder
+	for _, child := range n.Children {
+		b.WriteString(c.node(child))
+	}
+	return b.String()
+}
+
+// block wraps block level markdown in blank lines
+func block(md string) string {
+	return "\n\n" + strings.TrimSpace(md) + "\n\n"
+}
+
+// node converts a single node
+func (c *htmlConverter) node(n *htmlNode) string {
+	if n.Tag == "" {
+		return htmlTextEscaper.Replace(htmlWhitespaceRegex.ReplaceAllString(n.Text, " "))
+	}
+
+	switch n.Tag {
+	case "head", "script", "style", "nav", "button", "form", "input", "select", "textarea", "noscript", "iframe", "object":
+		return ""
+
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level := int(n.Tag[1]-'0') + c.headingShift
+		if level > 6 {
+			level = 6
+		}
+		text := strings.TrimSpace(strings.ReplaceAll(c.children(n), "\n", " "))
+		if text == "" {
+			return ""
+		}
+		return block(strings.Repeat("#", level) + " " + text)
+
+	case "p", "section", "article", "main", "body", "header", "footer", "center", "figure", "dl", "address":
+		return block(c.children(n))
+
+	case "dt":
+		return block("**" + strings.TrimSpace(c.children(n)) + "**")
+
+	case "dd", "figcaption":
+		return block(c.children(n))
+
+	case "div":
+		return c.div(n)
+
+	case "br":
+		return "<br>"
+
+	case "hr":
+		return block("---")
+
+	case "strong", "b":
+		return wrapInline(c.children(n), "**")
+
+	case "em", "i", "cite":
+		return wrapInline(c.children(n), "*")
+
+	case "del", "s", "strike":
+		return wrapInline(c.children(n), "~~")
+
+	case "u", "sup", "sub", "mark", "kbd":
+		return "<" + n.Tag + ">" + c.children(n) + "</" + n.Tag + ">"
+
+	case "code", "tt":
+		text := htmlWhitespaceRegex.ReplaceAllString(n.textContent(), " ")
+		if strings.TrimSpace(text) == "" {
+			return text
+		}
+		if strings.Contains(text, "`") {
+			return c.protect("`` " + text + " ``")
+		}
+		return c.protect("`" + text + "`")
+
+	case "pre":
+		return c.pre(n, "")
+
+	case "a":
+		return c.link(n)
+
+	case "img":
+		return c.image(n)
+
+	case "ul", "ol":
+		return c.list(n)
+
+	case "blockquote":
+		return block(quoteLines(c.Convert(n), ""))
+
+	case "table":
+		return c.table(n)
+	}
+
+	return c.children(n)
+}
+
+// div converts a div, which may be one of the Confluence macros
+func (c *htmlConverter) div(n *htmlNode) string {
+	switch {
+	case n.hasClass("toc-macro") || n.hasClass("client-side-toc-macro"):
+		return block("[toc]")
+
+	case n.hasClass("code") && n.hasClass("panel"):
+		title := ""
+		if header := n.find(func(m *htmlNode) bool { return m.hasClass("codeHeader") }); header != nil {
+			title = strings.TrimSpace(header.textContent())
+		}
+		if pre := n.find(byTag("pre")); pre != nil {
+			code := c.pre(pre, "")
+			if title != "" {
+				code = block("**"+htmlTextEscaper.Replace(title)+"**") + code
+			}
+			return code
+		}
+
+	case n.hasClass("confluence-information-macro"):
+		label := "Info"
+		for class, l := range confluencePanelLabels {
+			if n.hasClass("confluence-information-macro-" + class) {
+				label = l
+			}
+		}
+		title := ""
+		if t := n.find(func(m *htmlNode) bool { return m.hasClass("title") }); t != nil {
+			title = strings.TrimSpace(t.textContent())
+		}
+		body := n
+		if b := n.find(func(m *htmlNode) bool { return m.hasClass("confluence-information-macro-body") }); b != nil {
+			body = b
+		}
+		return c.panel(label, title, body)
+
+	case n.hasClass("admonition"):
+		label := "Note"
+		for class, l := range admonitionLabels {
+			if n.hasClass(class) {
+				label = l
+			}
+		}
+		title := ""
+		var body []*htmlNode
+		for _, child := range n.Children {
+			if child.hasClass("admonition-title") {
+				title = strings.TrimSpace(child.textContent())
+				continue
+			}
+			body = append(body, child)
+		}
+		return c.panel(label, title, &htmlNode{Tag: "div", Children: body})
+
+	case n.hasClass("panel"):
+		title := ""
+		if header := n.find(func(m *htmlNode) bool { return m.hasClass("panelHeader") }); header != nil {
+			title = strings.TrimSpace(header.textContent())
+		}
+		body := n
+		if content := n.find(func(m *htmlNode) bool { return m.hasClass("panelContent") }); content != nil {
+			body = content
+		}
+		return c.panel("", title, body)
+
+	case n.hasClass("expand-container"):
+		title := ""
+		if control := n.find(func(m *htmlNode) bool { return m.hasClass("expand-control-text") }); control != nil {
+			title = strings.TrimSpace(control.textContent())
+		}
+		body := n
+		if content := n.find(func(m *htmlNode) bool { return m.hasClass("expand-content") }); content != nil {
+			body = content
+		}
+		if title == "" {
+			return block(c.Convert(body))
+		}
+		return block("**"+htmlTextEscaper.Replace(title)+"**") + block(c.Convert(body))
+
+	case n.hasClass("aui-icon") || n.hasClass("confluence-information-macro-icon"):
+		return ""
+	}
+
+	return block(c.children(n))
+}
+
+// panel converts a panel to a blockquote headed by its label and title in bold, for example
+// > **Warning: Before you start**
+func (c *htmlConverter) panel(label, title string, body *htmlNode) string {
+	title = strings.Join(strings.Fields(title), " ")
+	if label != "" && title != "" {
+		title = label + ": " + title
+	} else if title == "" {
+		title = label
+	}
+
+	content := c.Convert(body)
+	if title == "" {
+		return block(quoteLines(content, ""))
+	}
+	header := "**" + htmlTextEscaper.Replace(title) + "**"
+	if content == "" {
+		return block("> " + header)
+	}
+	return block("> " + header + "\n>\n" + quoteLines(content, ""))
+}
+
+// quoteLines prefixes every line with > for a blockquote, after the given indentation
+func quoteLines(md, indent string) string {
+	lines := strings.Split(md, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = indent + ">"
+		} else {
+			lines[i] = indent + "> " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// wrapInline wraps inline markdown in emphasis markers, keeping surrounding whitespace outside
+func wrapInline(md, marker string) string {
+	trimmed := strings.TrimSpace(md)
+	if trimmed == "" {
+		return md
+	}
+	leading := md[:len(md)-len(strings.TrimLeft(md, " "))]
+	trailing := md[len(strings.TrimRight(md, " ")):]
+	return leading + marker + trimmed + marker + trailing
+}
+
+// pre converts preformatted text to a fenced code block
+func (c *htmlConverter) pre(n *htmlNode, lang string) string {
+	if m := htmlBrushRegex.FindStringSubmatch(n.attr("data-syntaxhighlighter-params")); m != nil {
+		lang = m[1]
+	}
+	for _, candidate := range []*htmlNode{n, n.find(byTag("code"))} {
+		if candidate == nil || lang != "" {
+			continue
+		}
+		if m := htmlLanguageRegex.FindStringSubmatch(candidate.attr("class")); m != nil {
+			lang = m[1]
+		}
+	}
+	if lang == "text" || lang == "none" {
+		lang = ""
+	}
+
+	code := strings.Trim(n.textContent(), "\n")
+	fence := "```"
+	if strings.Contains(code, "```") {
+		fence = "~~~"
+	}
+	return block(c.protect(fence + lang + "\n" + code + "\n" + fence))
+}
+
+// link converts an anchor. Links that can't be resolved keep only their text.
+func (c *htmlConverter) link(n *htmlNode) string {
+	text := c.children(n)
+
+	// Thumbnails that link to the full image are kept as the image
+	if strings.HasPrefix(strings.TrimSpace(text), "![") {
+		return text
+	}
+
+	href := strings.TrimSpace(n.attr("href"))
+	if strings.TrimSpace(text) == "" || href == "" {
+		return text
+	}
+
+	target, ok := c.resolve(href)
+	if !ok {
+		return text
+	}
+	return wrapLink(text, target)
+}
+
+// wrapLink formats a markdown link, keeping surrounding whitespace outside of it
+func wrapLink(text, target string) string {
+	leading := text[:len(text)-len(strings.TrimLeft(text, " "))]
+	trailing := text[len(strings.TrimRight(text, " ")):]
+	if strings.ContainsAny(target, " ()") {
+		target = "<" + target + ">"
+	}
+	return leading + "[" + strings.TrimSpace(text) + "](" + target + ")" + trailing
+}
+
+// image converts an image, replacing emoticons with their text
+func (c *htmlConverter) image(n *htmlNode) string {
+	alt := n.attr("alt")
+	if n.hasClass("emoticon") {
+		if emoji := n.attr("data-emoji-fallback"); emoji != "" {
+			return emoji
+		}
+		return alt
+	}
+
+	src := strings.TrimSpace(n.attr("src"))
+	if src == "" {
+		return ""
+	}
+	target, ok := c.resolve(src)
+	if !ok {
+		return ""
+	}
+	if alt == "" {
+		alt = n.attr("title")
+	}
+	if strings.ContainsAny(target, " ()") {
+		target = "<" + target + ">"
+	}
+	return "![" + htmlTextEscaper.Replace(alt) + "](" + target + ")"
+}
+
+// list converts an ordered or unordered list, including Confluence task lists
+func (c *htmlConverter) list(n *htmlNode) string {
+	number := 1
+	if start, err := strconv.Atoi(n.attr("start")); err == nil {
+		number = start
+	}
+
+	var lines []string
+	for _, item := range n.Children {
+		if item.Tag != "li" {
+			continue
+		}
+
+		marker := "- "
+		if n.Tag == "ol" {
+			marker = fmt.Sprintf("%d. ", number)
+			number++
+		} else if n.hasClass("inline-task-list") {
+			if item.hasClass("checked") {
+				marker = "- [x] "
+			} else {
+				marker = "- [ ] "
+			}
+		}
+
+		// Items are kept tight, so nested blocks only use single line breaks
+		content := strings.TrimSpace(c.Convert(item))
+		content = strings.ReplaceAll(content, "\n\n", "\n")
+
+		indent := strings.Repeat(" ", len(marker))
+		itemLines := strings.Split(content, "\n")
+		for i, line := range itemLines {
+			if i == 0 {
+				itemLines[i] = marker + line
+			} else if line != "" {
+				itemLines[i] = indent + line
+			}
+		}
+		lines = append(lines, itemLines...)
+	}
+
+	return block(c.protect(strings.Join(lines, "\n")))
+}
+
+// table converts a table to a markdown table. Cells are kept on a single line.
+func (c *htmlConverter) table(n *htmlNode) string {
+	var rows [][]string
+	header := false
+
+	var collect func(node *htmlNode, inHead bool)
+	collect = func(node *htmlNode, inHead bool) {
+		for _, child := range node.Children {
+			switch child.Tag {
+			case "thead", "tbody", "tfoot":
+				collect(child, child.Tag == "thead")
+			case "tr":
+				var row []string
+				allHeaders := true
+				for _, cell := range child.Children {
+					if cell.Tag != "td" && cell.Tag != "th" {
+						continue
+					}
+					allHeaders = allHeaders && cell.Tag == "th"
+
+					content := strings.TrimSpace(c.Convert(cell))
+					content = htmlCellBreakRegex.ReplaceAllString(content, "<br>")
+					content = strings.ReplaceAll(content, "|", "\\|")
+					row = append(row, content)
+
+					// Repeat the cell for columns it spans, markdown has no colspan
+					if span, err := strconv.Atoi(cell.attr("colspan")); err == nil {
+						for i := 1; i < span; i++ {
+							row = append(row, "")
+						}
+					}
+				}
+				if len(rows) == 0 && len(row) > 0 && (inHead || allHeaders) {
+					header = true
+				}
+				if len(row) > 0 {
+					rows = append(rows, row)
+				}
+			}
+		}
+	}
+	collect(n, false)
+
+	if len(rows) == 0 {
+		return ""
+	}
+
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+
+	// Markdown tables need a header row, an empty one is used when the table has none
+	if !header {
+		rows = append([][]string{make([]string, columns)}, rows...)
+	}
+
+	var lines []string
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, strings.TrimSuffix(strings.Repeat("| --- ", columns), " ")+" |")
+		}
+	}
+
+	return block(c.protect(strings.Join(lines, "\n")))
+}
+
+// htmlPage is a page of an HTML export
+type htmlPage struct {
+	Source   string      // Path of the page in the archive
+	Title    string      // Page title
+	Content  []*htmlNode // Nodes holding the page content
+	Parent   string      // Source of the parent page, if the export defines a hierarchy
+	Document *htmlNode   // The whole parsed page
+}
+
+// Patterns for links to the live Confluence site, which are mapped back to exported pages
+var (
+	confluencePageIDRegex  = regexp.MustCompile(`[?&]pageId=(\d+)`)
+	confluenceDisplayRegex = regexp.MustCompile(`/display/[^/]+/([^?#]+)`)
+	confluenceFileIDRegex  = regexp.MustCompile(`(?:^|_)(\d+)\.html?$`)
+)
+
+// readHTMLPage parses an exported page and locates its title, content and breadcrumb parent
+func readHTMLPage(name string, data []byte, pages map[string]*zip.File) (*htmlPage, error) {
+	doc, err := parseHTMLPage(data)
+	if err != nil {
+		return nil, err
+	}
+	page := &htmlPage{Source: name, Document: doc}
+
+	// Confluence pages keep the content in #main-content and the title as "Space : Page"
+	if main := doc.find(byID("main-content")); main != nil {
+		page.Content = append(page.Content, main)
+		if attachments := doc.find(byID("attachments")); attachments != nil {
+			if section := doc.find(func(n *htmlNode) bool {
+				return n.hasClass("pageSection") && n.find(byID("attachments")) != nil
+			}); section != nil {
+				page.Content = append(page.Content, section)
+			}
+		}
+
+		title := doc.find(byID("title-text"))
+		if title == nil {
+			title = doc.find(byTag("title"))
+		}
+		if title != nil {
+			page.Title = strings.TrimSpace(title.textContent())
+			if i := strings.Index(page.Title, " : "); i != -1 {
+				page.Title = strings.TrimSpace(page.Title[i+3:])
+			}
+		}
+
+		// The last breadcrumb that is an exported page is the parent
+		if breadcrumbs := doc.find(byID("breadcrumbs")); breadcrumbs != nil {
+			var walk func(n *htmlNode)
+			walk = func(n *htmlNode) {
+				for _, child := range n.Children {
+					if child.Tag == "a" {
+						if ref, ok := resolveArchivePath(name, child.attr("href")); ok && ref != name && path.Base(ref) != "index.html" {
+							if _, exists := pages[ref]; exists {
+								page.Parent = ref
+							}
+						}
+					}
+					walk(child)
+				}
+			}
+			walk(breadcrumbs)
+		}
+	} else {
+		// Generic pages use <main>, <article> or the body, titled by their first heading
+		content := doc.find(byTag("main"))
+		if content == nil {
+			content = doc.find(byTag("article"))
+		}
+		if content == nil {
+			content = doc.find(byTag("body"))
+		}
+		if content == nil {
+			content = doc
+		}
+		page.Content = append(page.Content, content)
+
+		if h1 := content.find(byTag("h1")); h1 != nil && strings.TrimSpace(h1.textContent()) != "" {
+			page.Title = strings.Join(strings.Fields(h1.textContent()), " ")
+			// The title becomes the heading of the document
+			h1.Tag, h1.Children = "span", nil
+		} else if title := doc.find(byTag("title")); title != nil {
+			page.Title = strings.TrimSpace(title.textContent())
+		}
+	}
+
+	if page.Title == "" {
+		page.Title = strings.TrimSuffix(path.Base(name), path.Ext(name))
+	}
+	return page, nil
+}
+
+// resolveArchivePath resolves a relative link in an archive page to the path of the file it points to
+func resolveArchivePath(from, ref string) (string, bool) {
+	if i := strings.IndexAny(ref, "?#"); i != -1 {
+		ref = ref[:i]
+	}
+	if !isRelativeImportReference(ref) {
+		return "", false
+	}
+	if unescaped, err := url.PathUnescape(ref); err == nil {
+		ref = unescaped
+	}
+	return path.Clean(path.Join(path.Dir(from), ref)), true
+}
+
+// htmlIndexHierarchy reads the page tree from the nested lists of an export's index page
+func htmlIndexHierarchy(index *htmlNode, indexPath string, pages map[string]*htmlPage) map[string]string {
+	parents := make(map[string]string)
+
+	var walkList func(list *htmlNode, parent string)
+	walkList = func(list *htmlNode, parent string) {
+		for _, item := range list.Children {
+			if item.Tag != "li" {
+				continue
+			}
+
+			// The item's own link comes before any nested list
+			page := parent
+			var nested []*htmlNode
+			var visit func(n *htmlNode)
+			visit = func(n *htmlNode) {
+				for _, child := range n.Children {
+					switch child.Tag {
+					case "ul", "ol":
+						nested = append(nested, child)
+					case "a":
+						if ref, ok := resolveArchivePath(indexPath, child.attr("href")); ok && page == parent {
+							if _, exists := pages[ref]; exists {
+								page = ref
+								parents[ref] = parent
+							}
+						}
+					default:
+						visit(child)
+					}
+				}
+			}
+			visit(item)
+
+			for _, list := range nested {
+				walkList(list, page)
+			}
+		}
+	}
+
+	// Start from the lists that aren't nested in another list
+	var findLists func(n *htmlNode)
+	findLists = func(n *htmlNode) {
+		for _, child := range n.Children {
+			if child.Tag == "ul" || child.Tag == "ol" {
+				walkList(child, "")
+				continue
+			}
+			findLists(child)
+		}
+	}
+	findLists(index)
+
+	return parents
+}
+
+// htmlArchiveRoot returns the folder all files of an archive are in, if there is a single one
+func htmlArchiveRoot(names []string) string {
+	root := ""
+	for _, name := range names {
+		i := strings.Index(name, "/")
+		if i == -1 {
+			return ""
+		}
+		if root != "" && name[:i+1] != root {
+			return ""
+		}
+		root = name[:i+1]
+	}
+	return root
+}
+
+// processHTMLImport processes the import of a Confluence space export or another ZIP of HTML pages
+func processHTMLImport(zipFileBytes []byte, jobID string, opts ImportOptions, cfg *config.Config) {
+	// Create a reader from the bytes
+	zipReader, err := zip.NewReader(bytes.NewReader(zipFileBytes), int64(len(zipFileBytes)))
+	if err != nil {
+		updateImportStatus(jobID, "failed", 0, "", fmt.Sprintf("Failed to read ZIP file: %v", err))
+		return
+	}
+
+	// Index all files, relative to the export folder when everything is in one
+	var names []string
+	for _, file := range zipReader.File {
+		if !file.FileInfo().IsDir() && !isHiddenImportPath(path.Clean(file.Name)) {
+			names = append(names, path.Clean(file.Name))
+		}
+	}
+	root := htmlArchiveRoot(names)
+
+	var order []string
+	entries := make(map[string]*zip.File)
+	pageFiles := make(map[string]*zip.File)
+	for _, file := range zipReader.File {
+		name := path.Clean(file.Name)
+		if file.FileInfo().IsDir() || isHiddenImportPath(name) {
+			continue
+		}
+		name = strings.TrimPrefix(name, root)
+		order = append(order, name)
+		entries[name] = file
+		if ext := strings.ToLower(path.Ext(name)); ext == ".html" || ext == ".htm" {
+			pageFiles[name] = file
+		}
+	}
+
+	// Parse all pages
+	pages := make(map[string]*htmlPage)
+	var pageOrder []string
+	for _, name := range order {
+		file, ok := pageFiles[name]
+		if !ok {
+			continue
+		}
+		updateImportStatusFile(jobID, name)
+
+		data, err := readZipFile(file)
+		if err != nil {
+			addImportError(jobID, fmt.Sprintf("Error processing %s: %v", name, err))
+			continue
+		}
+		page, err := readHTMLPage(name, data, pageFiles)
+		if err != nil {
+			addImportError(jobID, fmt.Sprintf("Error processing %s: failed to parse HTML: %v", name, err))
+			continue
+		}
+		pages[name] = page
+		pageOrder = append(pageOrder, name)
+	}
+
+	if len(pages) == 0 {
+		updateImportStatus(jobID, "failed", 0, "", "No HTML pages found in the ZIP archive.")
+		return
+	}
+
+	// The index page of an export lists the page tree. When it does, it is only used for the hierarchy.
+	hierarchy := false
+	if index, ok := pages["index.html"]; ok {
+		for page, parent := range htmlIndexHierarchy(index.Document, "index.html", pages) {
+			if page != "index.html" {
+				pages[page].Parent = parent
+				hierarchy = true
+			}
+		}
+		if hierarchy {
+			delete(pages, "index.html")
+			addImportSkipped(jobID, "index.html: used for the page hierarchy")
+		}
+	}
+	for _, page := range pages {
+		hierarchy = hierarchy || page.Parent != ""
+	}
+
+	// Plan targets, parents first, so that children are placed below the path their parent got
+	planner := newImportPlanner(cfg, opts)
+	targets := make(map[string]string)
+	var docs []*importDocument
+	docPages := make(map[*importDocument]*htmlPage)
+	var plan func(name string, visiting map[string]bool) string
+	plan = func(name string, visiting map[string]bool) string {
+		if target, ok := targets[name]; ok {
+			return target
+		}
+		page := pages[name]
+
+		var targetPath string
+		if hierarchy {
+			component := normalizePathComponent(page.Title)
+			if component == "" {
+				component = normalizePathComponent(strings.TrimSuffix(path.Base(name), path.Ext(name)))
+			}
+			if component == "" {
+				component = "page"
+			}
+			targetPath = component
+			if _, ok := pages[page.Parent]; ok && !visiting[page.Parent] {
+				visiting[name] = true
+				targetPath = plan(page.Parent, visiting) + "/" + component
+			}
+		} else {
+			// Without a hierarchy the folder structure is kept, with index pages as the folder document
+			withoutIndex := strings.TrimSuffix(strings.TrimSuffix(name, path.Ext(name)), "index")
+			withoutIndex = strings.TrimSuffix(withoutIndex, "/")
+			if withoutIndex == "" {
+				withoutIndex = page.Title
+			}
+			targetPath, _ = determineTargetPath(withoutIndex)
+			if targetPath == "" {
+				targetPath = "page"
+			}
+		}
+
+		target, ok := planner.resolveTarget(targetPath)
+		if !ok {
+			addImportSkipped(jobID, fmt.Sprintf("%s: /%s already exists", name, targetPath))
+			// Children are still placed below the existing document
+			targets[name] = targetPath
+			return targetPath
+		}
+		targets[name] = target
+
+		doc := &importDocument{Source: name, Target: target}
+		docs = append(docs, doc)
+		docPages[doc] = page
+		return target
+	}
+	for _, name := range pageOrder {
+		if _, ok := pages[name]; ok {
+			plan(name, make(map[string]bool))
+		}
+	}
+
+	// Confluence links to pages by id or title on the live site
+	pagesByID := make(map[string]string)
+	pagesByTitle := make(map[string]string)
+	for name, page := range pages {
+		if m := confluenceFileIDRegex.FindStringSubmatch(path.Base(name)); m != nil {
+			pagesByID[m[1]] = name
+		}
+		pagesByTitle[strings.ToLower(page.Title)] = name
+	}
+
+	// Convert pages, collecting the attachments each page needs
+	referenced := make(map[string]bool)
+	for _, doc := range docs {
+		page := docPages[doc]
+		updateImportStatusFile(jobID, page.Source)
+
+		resolve := func(ref string) (string, bool) {
+			if strings.HasPrefix(ref, "#") {
+				return ref, true
+			}
+
+			name, ok := resolveArchivePath(page.Source, ref)
+			if !ok {
+				// Links to pages on the live Confluence site point at the imported page
+				if m := confluencePageIDRegex.FindStringSubmatch(ref); m != nil {
+					if name, ok := pagesByID[m[1]]; ok {
+						return "/" + targets[name], true
+					}
+				}
+				if m := confluenceDisplayRegex.FindStringSubmatch(ref); m != nil {
+					if title, err := url.QueryUnescape(m[1]); err == nil {
+						if name, ok := pagesByTitle[strings.ToLower(title)]; ok {
+							return "/" + targets[name], true
+						}
+					}
+				}
+				return ref, true
+			}
+
+			if target, ok := targets[name]; ok {
+				fragment := ""
+				if i := strings.Index(ref, "#"); i != -1 {
+					fragment = ref[i:]
+				}
+				return "/" + target + fragment, true
+			}
+
+			file, ok := entries[name]
+			if !ok || pageFiles[name] != nil {
+				return "", false
+			}
+			if !config.IsAllowedExtension(strings.ToLower(path.Ext(name))) {
+				if !referenced[name] {
+					addImportSkipped(jobID, fmt.Sprintf("%s: file type is not allowed", name))
+				}
+				referenced[name] = true
+				return "", false
+			}
+
+			referenced[name] = true
+			return planner.addAsset(doc, name, file.Open), true
+		}
+
+		converter := &htmlConverter{resolve: resolve}
+		for _, content := range page.Content {
+			if content.find(byTag("h1")) != nil {
+				converter.headingShift = 1
+			}
+		}
+
+		doc.Content = []byte("# " + page.Title + "\n\n" + converter.Convert(page.Content...) + "\n")
+	}
+
+	// Report files that were not picked up by any page. Stylesheets, scripts and the
+	// icons of Confluence exports are expected to be left out.
+	for _, name := range order {
+		ext := strings.ToLower(path.Ext(name))
+		if pageFiles[name] != nil || referenced[name] || ext == ".css" || ext == ".js" || strings.HasPrefix(name, "images/icons/") {
+			continue
+		}
+		addImportSkipped(jobID, fmt.Sprintf("%s: not referenced by any page", name))
+	}
+
+	applyImport(jobID, docs, opts, cfg)
+}
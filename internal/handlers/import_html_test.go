@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestHTMLImportGolden(t *testing.T) {
+	tests := []struct {
+		name    string
+		archive string
+	}{
+		{name: "confluence", archive: "export"},
+		{name: "html", archive: "site"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestWiki(t)
+			report := runTestImport(t, "html", zipDirectory(t, filepath.Join("testdata", "import", tt.name, tt.archive)))
+			checkGolden(t, tt.name, report)
+		})
+	}
+}
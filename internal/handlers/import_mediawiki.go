@@ -0,0 +1,861 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+	"wiki-go/internal/config"
+	"wiki-go/internal/goldext"
+)
+
+// MediaWiki namespace numbers used by the importer
+const (
+	mediaWikiNamespaceMain     = 0
+	mediaWikiNamespaceFile     = 6
+	mediaWikiNamespaceCategory = 14
+)
+
+// mediaWikiPage is a page of a MediaWiki XML export
+type mediaWikiPage struct {
+	Title     string              `xml:"title"`
+	Namespace int                 `xml:"ns"`
+	Redirect  *mediaWikiRedirect  `xml:"redirect"`
+	Revisions []mediaWikiRevision `xml:"revision"`
+}
+
+// mediaWikiRedirect marks a page as a redirect to another title
+type mediaWikiRedirect struct {
+	Title string `xml:"title,attr"`
+}
+
+// mediaWikiRevision is a single revision of a page
+type mediaWikiRevision struct {
+	Timestamp string `xml:"timestamp"`
+	Text      string `xml:"text"`
+}
+
+// mediaWikiSiteInfo holds the namespace names of the exporting wiki, which may be localized
+type mediaWikiSiteInfo struct {
+	Namespaces []struct {
+		Key  int    `xml:"key,attr"`
+		Name string `xml:",chardata"`
+	} `xml:"namespaces>namespace"`
+}
+
+// mediaWikiCanonicalNamespaces are the English namespace names every MediaWiki install understands
+var mediaWikiCanonicalNamespaces = map[string]int{
+	"media":          -2,
+	"special":        -1,
+	"talk":           1,
+	"user":           2,
+	"user talk":      3,
+	"project":        4,
+	"project talk":   5,
+	"file":           mediaWikiNamespaceFile,
+	"image":          mediaWikiNamespaceFile,
+	"file talk":      7,
+	"mediawiki":      8,
+	"mediawiki talk": 9,
+	"template":       10,
+	"template talk":  11,
+	"help":           12,
+	"help talk":      13,
+	"category":       mediaWikiNamespaceCategory,
+	"category talk":  15,
+}
+
+// mediaWikiRedirectRegex matches the redirect marker at the start of a page
+var mediaWikiRedirectRegex = regexp.MustCompile(`(?i)^\s*#REDIRECT\s*:?\s*\[\[([^\]|]+)(?:\|[^\]]*)?\]\]`)
+
+// parseMediaWikiExport reads the pages and namespace names from a MediaWiki XML export
+func parseMediaWikiExport(r io.Reader) ([]mediaWikiPage, map[string]int, error) {
+	namespaces := make(map[string]int, len(mediaWikiCanonicalNamespaces))
+	for name, key := range mediaWikiCanonicalNamespaces {
+		namespaces[name] = key
+	}
+
+	var pages []mediaWikiPage
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "siteinfo":
+			var info mediaWikiSiteInfo
+			if err := decoder.DecodeElement(&info, &start); err != nil {
+				return nil, nil, err
+			}
+			for _, ns := range info.Namespaces {
+				if ns.Name != "" {
+					namespaces[strings.ToLower(ns.Name)] = ns.Key
+				}
+			}
+		case "page":
+			var page mediaWikiPage
+			if err := decoder.DecodeElement(&page, &start); err != nil {
+				return nil, nil, err
+			}
+			pages = append(pages, page)
+		}
+	}
+
+	return pages, namespaces, nil
+}
+
+// mediaWikiTitleKey normalizes a title the way MediaWiki compares them: underscores are spaces
+// and the first letter is case-insensitive
+func mediaWikiTitleKey(title string) string {
+	title = strings.Join(strings.Fields(strings.ReplaceAll(title, "_", " ")), " ")
+	r, size := utf8.DecodeRuneInString(title)
+	if size == 0 {
+		return title
+	}
+	return string(unicode.ToUpper(r)) + title[size:]
+}
+
+// splitMediaWikiTitle splits a title into its namespace and the title within the namespace
+func splitMediaWikiTitle(title string, namespaces map[string]int) (int, string) {
+	title = mediaWikiTitleKey(title)
+	if i := strings.Index(title, ":"); i != -1 {
+		if ns, ok := namespaces[strings.ToLower(strings.TrimSpace(title[:i]))]; ok {
+			return ns, mediaWikiTitleKey(title[i+1:])
+		}
+	}
+	return mediaWikiNamespaceMain, title
+}
+
+// mediaWikiPageKey identifies a page by its namespace and normalized title
+func mediaWikiPageKey(ns int, title string) string {
+	return fmt.Sprintf("%d:%s", ns, title)
+}
+
+// mediaWikiTargetPath maps a page title onto the document structure. Subpages (Page/Subpage) become
+// child documents and categories are collected under /category.
+func mediaWikiTargetPath(ns int, title string) (string, error) {
+	var components []string
+	if ns == mediaWikiNamespaceCategory {
+		components = append(components, "category")
+	}
+
+	for _, component := range strings.Split(title, "/") {
+		normalized := normalizePathComponent(strings.TrimSpace(component))
+		if normalized == "" {
+			return "", fmt.Errorf("title %q has no characters usable in a path", title)
+		}
+		components = append(components, normalized)
+	}
+
+	return strings.Join(components, "/"), nil
+}
+
+// processMediaWikiImport processes the import of a MediaWiki XML export
+func processMediaWikiImport(data []byte, jobID string, opts ImportOptions, cfg *config.Config) {
+	pages, namespaces, err := parseMediaWikiExport(bytes.NewReader(data))
+	if err != nil {
+		updateImportStatus(jobID, "failed", 0, "", fmt.Sprintf("Failed to read MediaWiki export: %v", err))
+		return
+	}
+
+	// Plan every page first so that links between pages can point at their final paths
+	planner := newImportPlanner(cfg, opts)
+	pageTargets := make(map[string]string)
+	type plannedPage struct {
+		page *mediaWikiPage
+		doc  *importDocument
+	}
+	var planned []plannedPage
+	for i := range pages {
+		page := &pages[i]
+		updateImportStatusFile(jobID, page.Title)
+
+		if page.Namespace != mediaWikiNamespaceMain && page.Namespace != mediaWikiNamespaceCategory {
+			addImportSkipped(jobID, fmt.Sprintf("%s: pages in this namespace are not imported", page.Title))
+			continue
+		}
+		if len(page.Revisions) == 0 {
+			addImportSkipped(jobID, fmt.Sprintf("%s: page has no revisions", page.Title))
+			continue
+		}
+
+		_, title := splitMediaWikiTitle(page.Title, namespaces)
+		targetPath, err := mediaWikiTargetPath(page.Namespace, title)
+		if err != nil {
+			addImportError(jobID, fmt.Sprintf("Error processing %s: failed to determine target path: %v", page.Title, err))
+			continue
+		}
+
+		// Links to skipped pages still point at the existing document
+		key := mediaWikiPageKey(page.Namespace, title)
+		pageTargets[key] = targetPath
+
+		target, ok := planner.resolveTarget(targetPath)
+		if !ok {
+			addImportSkipped(jobID, fmt.Sprintf("%s: /%s already exists", page.Title, targetPath))
+			continue
+		}
+		pageTargets[key] = target
+
+		planned = append(planned, plannedPage{page: page, doc: &importDocument{Source: page.Title, Target: target}})
+	}
+
+	if len(pageTargets) == 0 {
+		updateImportStatus(jobID, "failed", 0, "", "No pages found in the MediaWiki export.")
+		return
+	}
+
+	// Links resolve to imported pages, and to the path a page would have otherwise
+	link := func(title string) string {
+		ns, name := splitMediaWikiTitle(title, namespaces)
+		if ns != mediaWikiNamespaceMain && ns != mediaWikiNamespaceCategory {
+			return ""
+		}
+		if target, ok := pageTargets[mediaWikiPageKey(ns, name)]; ok {
+			return "/" + target
+		}
+		if target, err := mediaWikiTargetPath(ns, name); err == nil {
+			return "/" + target
+		}
+		return ""
+	}
+
+	// Convert every revision, keeping the categories of the current one for the category pages
+	members := make(map[string][]string)
+	categoryPages := make(map[string]*importDocument)
+	var docs []*importDocument
+	for _, p := range planned {
+		converter := &wikitextConverter{namespaces: namespaces, link: link}
+
+		revisions := sortedMediaWikiRevisions(p.page.Revisions)
+		for i, revision := range revisions {
+			converter.reset()
+			content := converter.convertPage(p.page, revision.Text)
+
+			if i < len(revisions)-1 {
+				p.doc.Versions = append(p.doc.Versions, importVersion{Timestamp: revision.time, Content: []byte(content)})
+				continue
+			}
+
+			p.doc.Content = []byte(content)
+			p.doc.Modified = revision.time
+
+			for _, file := range converter.files {
+				addImportSkipped(jobID, fmt.Sprintf("%s: file %s is not part of the XML export, upload it to /%s", p.page.Title, file, p.doc.Target))
+			}
+			for _, category := range converter.categories {
+				members[category] = append(members[category], fmt.Sprintf("- [%s](/%s)", p.page.Title, p.doc.Target))
+			}
+		}
+
+		if p.page.Namespace == mediaWikiNamespaceCategory {
+			_, name := splitMediaWikiTitle(p.page.Title, namespaces)
+			categoryPages[name] = p.doc
+		}
+		docs = append(docs, p.doc)
+	}
+
+	// List the members of each category on its page, creating pages for categories without one
+	categories := make([]string, 0, len(members))
+	for category := range members {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		doc, ok := categoryPages[category]
+		if !ok {
+			if _, exists := pageTargets[mediaWikiPageKey(mediaWikiNamespaceCategory, category)]; exists {
+				// The category page was skipped because it already exists
+				continue
+			}
+
+			targetPath, err := mediaWikiTargetPath(mediaWikiNamespaceCategory, category)
+			if err != nil {
+				continue
+			}
+			target, ok := planner.resolveTarget(targetPath)
+			if !ok {
+				continue
+			}
+			doc = &importDocument{Source: "Category:" + category, Target: target, Content: []byte("# " + category + "\n")}
+			docs = append(docs, doc)
+		}
+
+		doc.Content = append(bytes.TrimRight(doc.Content, "\n"), []byte("\n\n## Pages in this category\n\n"+strings.Join(members[category], "\n")+"\n")...)
+	}
+
+	applyImport(jobID, docs, opts, cfg)
+}
+
+// timedMediaWikiRevision is a revision with its parsed timestamp
+type timedMediaWikiRevision struct {
+	mediaWikiRevision
+	time time.Time
+}
+
+// sortedMediaWikiRevisions returns the revisions of a page from oldest to newest
+func sortedMediaWikiRevisions(revisions []mediaWikiRevision) []timedMediaWikiRevision {
+	timed := make([]timedMediaWikiRevision, len(revisions))
+	for i, revision := range revisions {
+		timed[i].mediaWikiRevision = revision
+		if t, err := time.Parse(time.RFC3339, strings.TrimSpace(revision.Timestamp)); err == nil {
+			timed[i].time = t
+		} else {
+			timed[i].time = time.Now()
+		}
+	}
+
+	sort.SliceStable(timed, func(i, j int) bool {
+		return timed[i].time.Before(timed[j].time)
+	})
+	return timed
+}
+
+// wikitextConverter converts MediaWiki wikitext to markdown
+type wikitextConverter struct {
+	namespaces map[string]int
+	link       func(title string) string // Returns the wiki URL for a page title, or "" if it can't be linked
+
+	categories []string
+	files      []string
+	footnotes  []string
+	refNames   map[string]int
+	protected  []string
+}
+
+// Patterns for the wikitext constructs the converter understands
+var (
+	wikitextCodeBlockRegex   = regexp.MustCompile(`(?is)<(pre|syntaxhighlight|source)((?:\s[^>]*)?)>(.*?)</(?:pre|syntaxhighlight|source)>`)
+	wikitextLangRegex        = regexp.MustCompile(`(?i)\blang\s*=\s*"?([\w+#-]+)`)
+	wikitextInlineCodeRegex  = regexp.MustCompile(`(?is)<(code|tt|nowiki)>(.*?)</(?:code|tt|nowiki)>`)
+	wikitextRefRegex         = regexp.MustCompile(`(?is)<ref((?:\s[^>]*?)?)(?:/>|>(.*?)</ref>)`)
+	wikitextRefNameRegex     = regexp.MustCompile(`(?i)\bname\s*=\s*"?([^">/]+?)"?\s*$`)
+	wikitextReferencesRegex  = regexp.MustCompile(`(?i)<references\s*/>|<references>.*?</references>`)
+	wikitextHeadingRegex     = regexp.MustCompile(`^(={1,6})\s*(.+?)\s*(={1,6})\s*$`)
+	wikitextListRegex        = regexp.MustCompile(`^([*#:;]+)\s*(.*)$`)
+	wikitextMagicWordRegex   = regexp.MustCompile(`__[A-Z]+__`)
+	wikitextBoldItalicRegex  = regexp.MustCompile(`'''''(.+?)'''''`)
+	wikitextBoldRegex        = regexp.MustCompile(`'''(.+?)'''`)
+	wikitextItalicRegex      = regexp.MustCompile(`''(.+?)''`)
+	wikitextExternalRegex    = regexp.MustCompile(`\[((?:https?|ftp)://[^\s\]]+|mailto:[^\s\]]+)(?:\s+([^\]]*))?\]`)
+	wikitextStrikeRegex      = regexp.MustCompile(`(?i)<(?:s|del|strike)>(.*?)</(?:s|del|strike)>`)
+	wikitextImageOptionRegex = regexp.MustCompile(`^(thumb|thumbnail|frame|framed|frameless|border|left|right|center|centre|none|baseline|middle|sub|super|top|text-top|bottom|text-bottom|upright(=.*)?|\d*x?\d+px|(link|alt|page|class|lang)=.*)$`)
+	wikitextPlaceholderRegex = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+// reset clears the state collected while converting a revision
+func (c *wikitextConverter) reset() {
+	c.categories = nil
+	c.files = nil
+	c.footnotes = nil
+	c.refNames = make(map[string]int)
+	c.protected = nil
+}
+
+// convertPage converts a page revision to a markdown document, titled like the page
+func (c *wikitextConverter) convertPage(page *mediaWikiPage, text string) string {
+	_, title := splitMediaWikiTitle(page.Title, c.namespaces)
+	if i := strings.LastIndex(title, "/"); i != -1 {
+		title = title[i+1:]
+	}
+
+	var body string
+	if m := mediaWikiRedirectRegex.FindStringSubmatch(text); m != nil {
+		body = "Redirect to " + c.convertInline("[["+m[1]+"]]")
+	} else {
+		body = c.Convert(text)
+	}
+
+	var b strings.Builder
+	b.WriteString("# " + title + "\n\n" + body + "\n")
+
+	if len(c.categories) > 0 {
+		links := make([]string, len(c.categories))
+		for i, category := range c.categories {
+			links[i] = category
+			if url := c.link("Category:" + category); url != "" {
+				links[i] = fmt.Sprintf("[%s](%s)", category, url)
+			}
+		}
+		b.WriteString("\n**Categories:** " + strings.Join(links, ", ") + "\n")
+	}
+
+	return b.String()
+}
+
+// Convert converts wikitext to markdown
+func (c *wikitextConverter) Convert(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	// Protect code and nowiki sections from further conversion
+	text = wikitextCodeBlockRegex.ReplaceAllStringFunc(text, func(match string) string {
+		m := wikitextCodeBlockRegex.FindStringSubmatch(match)
+		lang := ""
+		if l := wikitextLangRegex.FindStringSubmatch(m[2]); l != nil {
+			lang = strings.ToLower(l[1])
+		}
+		return "\n" + c.protect("```"+lang+"\n"+strings.Trim(m[3], "\n")+"\n```") + "\n"
+	})
+	text = wikitextInlineCodeRegex.ReplaceAllStringFunc(text, func(match string) string {
+		m := wikitextInlineCodeRegex.FindStringSubmatch(match)
+		if strings.EqualFold(m[1], "nowiki") {
+			return c.protect(m[2])
+		}
+		return c.protect("`" + m[2] + "`")
+	})
+
+	// References become footnotes, which are listed at the end of the document
+	text = wikitextReferencesRegex.ReplaceAllString(text, "")
+	text = wikitextRefRegex.ReplaceAllStringFunc(text, func(match string) string {
+		m := wikitextRefRegex.FindStringSubmatch(match)
+		return c.footnote(m[1], m[2])
+	})
+
+	var out []string
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "{|"):
+			// Collect the table up to its closing line, counting nested tables
+			depth := 0
+			var table []string
+			for ; i < len(lines); i++ {
+				t := strings.TrimSpace(lines[i])
+				if strings.HasPrefix(t, "{|") {
+					depth++
+				} else if strings.HasPrefix(t, "|}") {
+					depth--
+				}
+				table = append(table, lines[i])
+				if depth == 0 {
+					break
+				}
+			}
+			out = append(out, "")
+			out = append(out, c.convertTable(table)...)
+			out = append(out, "")
+
+		case wikitextHeadingRegex.MatchString(trimmed):
+			m := wikitextHeadingRegex.FindStringSubmatch(trimmed)
+			level := len(m[1])
+			if len(m[3]) < level {
+				level = len(m[3])
+			}
+			out = append(out, "", strings.Repeat("#", level)+" "+c.convertInline(m[2]), "")
+
+		case strings.HasPrefix(trimmed, "----"):
+			out = append(out, "", "---", "")
+
+		case wikitextListRegex.MatchString(line):
+			out = append(out, c.convertListItem(line)...)
+
+		case strings.HasPrefix(line, " ") && trimmed != "" && !strings.HasPrefix(trimmed, "\x00"):
+			// Lines starting with a space are preformatted text
+			var block []string
+			for ; i < len(lines) && strings.HasPrefix(lines[i], " ") && strings.TrimSpace(lines[i]) != ""; i++ {
+				block = append(block, lines[i][1:])
+			}
+			i--
+			out = append(out, "", "```", strings.Join(block, "\n"), "```", "")
+
+		default:
+			out = append(out, c.convertInline(line))
+		}
+	}
+
+	result := strings.Join(out, "\n")
+
+	// Remove magic words, keeping the table of contents marker
+	result = strings.ReplaceAll(result, "__TOC__", "\n[toc]\n")
+	result = wikitextMagicWordRegex.ReplaceAllString(result, "")
+
+	// Collapse the blank lines left behind by block conversions
+	result = regexp.MustCompile(`\n{3,}`).ReplaceAllString(strings.TrimSpace(result), "\n\n")
+
+	if len(c.footnotes) > 0 {
+		result += "\n"
+		for i, note := range c.footnotes {
+			result += fmt.Sprintf("\n[^%d]: %s", i+1, c.convertInline(note))
+		}
+	}
+
+	return c.restore(result)
+}
+
+// protect stores text that must not be converted and returns a placeholder for it
+func (c *wikitextConverter) protect(text string) string {
+	c.protected = append(c.protected, text)
+	return fmt.Sprintf("\x00%d\x00", len(c.protected)-1)
+}
+
+// restore replaces placeholders with the protected text
+func (c *wikitextConverter) restore(text string) string {
+	return wikitextPlaceholderRegex.ReplaceAllStringFunc(text, func(match string) string {
+		i, _ := strconv.Atoi(strings.Trim(match, "\x00"))
+		return c.protected[i]
+	})
+}
+
+// footnote registers a reference and returns its footnote marker. Named references that were
+// defined before are reused.
+func (c *wikitextConverter) footnote(attrs, content string) string {
+	name := ""
+	if m := wikitextRefNameRegex.FindStringSubmatch(strings.TrimSpace(attrs)); m != nil {
+		name = m[1]
+	}
+
+	if name != "" {
+		if n, ok := c.refNames[name]; ok {
+			if strings.TrimSpace(content) != "" && c.footnotes[n-1] == "" {
+				c.footnotes[n-1] = strings.Join(strings.Fields(content), " ")
+			}
+			return fmt.Sprintf("[^%d]", n)
+		}
+	}
+
+	c.footnotes = append(c.footnotes, strings.Join(strings.Fields(content), " "))
+	n := len(c.footnotes)
+	if name != "" {
+		c.refNames[name] = n
+	}
+	return fmt.Sprintf("[^%d]", n)
+}
+
+// convertListItem converts a list, definition list or indented line
+func (c *wikitextConverter) convertListItem(line string) []string {
+	m := wikitextListRegex.FindStringSubmatch(line)
+	prefix, content := m[1], m[2]
+
+	// Indented text without a list is shown as a quote
+	if strings.Trim(prefix, ":") == "" {
+		return []string{strings.Repeat("> ", len(prefix)) + c.convertInline(content)}
+	}
+
+	indent := ""
+	for _, marker := range prefix[:len(prefix)-1] {
+		if marker == '#' {
+			indent += "   "
+		} else {
+			indent += "  "
+		}
+	}
+
+	switch prefix[len(prefix)-1] {
+	case '#':
+		return []string{indent + "1. " + c.convertInline(content)}
+	case ';':
+		// A definition can follow its term on the same line: ; term : definition
+		term, definition := content, ""
+		if i := strings.Index(content, " : "); i != -1 {
+			term, definition = content[:i], content[i+3:]
+		}
+		lines := []string{"", indent + c.convertInline(term)}
+		if definition != "" {
+			lines = append(lines, indent+": "+c.convertInline(definition))
+		}
+		return lines
+	case ':':
+		if strings.HasSuffix(strings.TrimRight(prefix, ":"), ";") {
+			return []string{indent + ": " + c.convertInline(content)}
+		}
+		return []string{indent + "  " + c.convertInline(content)}
+	default:
+		return []string{indent + "- " + c.convertInline(content)}
+	}
+}
+
+// convertTable converts a wikitext table to a markdown table. Cell attributes are dropped and
+// multi-line cells are joined with line breaks.
+func (c *wikitextConverter) convertTable(lines []string) []string {
+	var caption string
+	var rows [][]string
+	var current []string
+	header := false
+
+	flush := func() {
+		if len(current) > 0 {
+			rows = append(rows, current)
+		}
+		current = nil
+	}
+
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "|}"):
+			flush()
+		case strings.HasPrefix(trimmed, "|+"):
+			caption = c.convertInline(strings.TrimSpace(stripWikitextCellAttributes(trimmed[2:])))
+		case strings.HasPrefix(trimmed, "|-"):
+			flush()
+		case strings.HasPrefix(trimmed, "!"):
+			if len(rows) == 0 {
+				header = true
+			}
+			for _, cell := range splitWikitextCells(trimmed[1:], "!!", "||") {
+				current = append(current, c.convertTableCell(cell))
+			}
+		case strings.HasPrefix(trimmed, "|"):
+			for _, cell := range splitWikitextCells(trimmed[1:], "||") {
+				current = append(current, c.convertTableCell(cell))
+			}
+		case trimmed != "" && len(current) > 0:
+			// Continuation of the previous cell, which may be followed by more cells
+			cells := splitWikitextCells(trimmed, "||")
+			current[len(current)-1] += "<br>" + c.convertTableCell(cells[0])
+			for _, cell := range cells[1:] {
+				current = append(current, c.convertTableCell(cell))
+			}
+		}
+	}
+	flush()
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+
+	// Markdown tables need a header row, an empty one is used when the table has none
+	if !header {
+		rows = append([][]string{make([]string, columns)}, rows...)
+	}
+
+	var out []string
+	if caption != "" {
+		out = append(out, "**"+caption+"**", "")
+	}
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		out = append(out, "| "+strings.Join(row, " | ")+" |")
+		if i == 0 {
+			out = append(out, strings.TrimSuffix(strings.Repeat("| --- ", columns), " ")+" |")
+		}
+	}
+	return out
+}
+
+// convertTableCell converts the content of a single table cell
+func (c *wikitextConverter) convertTableCell(cell string) string {
+	content := c.convertInline(strings.TrimSpace(stripWikitextCellAttributes(cell)))
+	return strings.ReplaceAll(content, "|", "\\|")
+}
+
+// stripWikitextCellAttributes removes the attributes of a cell, written as: style="..." | content
+func stripWikitextCellAttributes(cell string) string {
+	parts := splitWikitextCells(cell, "|")
+	if len(parts) > 1 && strings.Contains(parts[0], "=") {
+		return strings.Join(parts[1:], "|")
+	}
+	return cell
+}
+
+// splitWikitextCells splits a table line on the given separators, ignoring separators inside links
+// and templates
+func splitWikitextCells(line string, separators ...string) []string {
+	var cells []string
+	depth := 0
+	start := 0
+	for i := 0; i < len(line); i++ {
+		switch {
+		case strings.HasPrefix(line[i:], "[[") || strings.HasPrefix(line[i:], "{{"):
+			depth++
+			i++
+			continue
+		case strings.HasPrefix(line[i:], "]]") || strings.HasPrefix(line[i:], "}}"):
+			if depth > 0 {
+				depth--
+			}
+			i++
+			continue
+		}
+		if depth > 0 {
+			continue
+		}
+		for _, sep := range separators {
+			if strings.HasPrefix(line[i:], sep) {
+				cells = append(cells, line[start:i])
+				start = i + len(sep)
+				i += len(sep) - 1
+				break
+			}
+		}
+	}
+	return append(cells, line[start:])
+}
+
+// convertInline converts inline formatting and links within a line
+func (c *wikitextConverter) convertInline(text string) string {
+	text = c.convertLinks(text)
+
+	text = wikitextExternalRegex.ReplaceAllStringFunc(text, func(match string) string {
+		m := wikitextExternalRegex.FindStringSubmatch(match)
+		if strings.TrimSpace(m[2]) == "" {
+			return "<" + m[1] + ">"
+		}
+		return fmt.Sprintf("[%s](%s)", strings.TrimSpace(m[2]), m[1])
+	})
+
+	text = wikitextBoldItalicRegex.ReplaceAllString(text, "***$1***")
+	text = wikitextBoldRegex.ReplaceAllString(text, "**$1**")
+	text = wikitextItalicRegex.ReplaceAllString(text, "*$1*")
+	text = wikitextStrikeRegex.ReplaceAllString(text, "~~$1~~")
+
+	return text
+}
+
+// convertLinks converts internal [[links]], including file embeds whose captions may contain links
+func (c *wikitextConverter) convertLinks(text string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(text, "[[")
+		if start == -1 {
+			b.WriteString(text)
+			return b.String()
+		}
+
+		// Find the matching closing brackets
+		end, depth := -1, 0
+		for i := start; i < len(text)-1; i++ {
+			if strings.HasPrefix(text[i:], "[[") {
+				depth++
+				i++
+			} else if strings.HasPrefix(text[i:], "]]") {
+				depth--
+				i++
+				if depth == 0 {
+					end = i - 1
+					break
+				}
+			}
+		}
+		if end == -1 {
+			b.WriteString(text)
+			return b.String()
+		}
+
+		// Letters directly after a link are part of its text: [[apple]]s
+		trailEnd := end + 2
+		for trailEnd < len(text) {
+			r, size := utf8.DecodeRuneInString(text[trailEnd:])
+			if !unicode.IsLetter(r) {
+				break
+			}
+			trailEnd += size
+		}
+
+		b.WriteString(text[:start])
+		b.WriteString(c.convertLink(text[start+2:end], text[end+2:trailEnd]))
+		text = text[trailEnd:]
+	}
+}
+
+// convertLink converts the inside of a single [[link]]
+func (c *wikitextConverter) convertLink(inner, trail string) string {
+	parts := splitWikitextCells(inner, "|")
+	target := strings.TrimSpace(parts[0])
+
+	// A leading colon links to a category or file instead of adding or embedding it
+	explicit := strings.HasPrefix(target, ":")
+	target = strings.TrimPrefix(target, ":")
+	ns, name := splitMediaWikiTitle(target, c.namespaces)
+
+	if !explicit && ns == mediaWikiNamespaceCategory {
+		c.categories = appendUnique(c.categories, name)
+		return ""
+	}
+
+	if !explicit && ns == mediaWikiNamespaceFile {
+		caption, alt := "", ""
+		for _, option := range parts[1:] {
+			option = strings.TrimSpace(option)
+			if strings.HasPrefix(option, "alt=") {
+				alt = strings.TrimPrefix(option, "alt=")
+			} else if !wikitextImageOptionRegex.MatchString(option) {
+				caption = c.convertInline(option)
+			}
+		}
+		if alt == "" {
+			alt = caption
+		}
+
+		file := sanitizeFilename(name)
+		c.files = appendUnique(c.files, file)
+		if alt == "" {
+			alt = strings.TrimSuffix(file, path.Ext(file))
+		}
+		if strings.HasPrefix(config.GetMimeTypeForExtension(strings.ToLower(path.Ext(file))), "image/") {
+			return fmt.Sprintf("![%s](%s)", alt, file)
+		}
+		return fmt.Sprintf("[%s](%s)", alt, file)
+	}
+
+	// Link text: the label if given, else the title as written
+	text := target
+	if len(parts) > 1 {
+		text = strings.TrimSpace(strings.Join(parts[1:], "|"))
+		if text == "" {
+			// Pipe trick: [[Page (disambiguation)|]] shows "Page"
+			text = regexp.MustCompile(`\s*\([^)]*\)$`).ReplaceAllString(name, "")
+		}
+	}
+	text = c.convertInline(text) + trail
+
+	page, section := target, ""
+	if i := strings.Index(target, "#"); i != -1 {
+		page, section = target[:i], target[i+1:]
+	}
+
+	fragment := ""
+	if section != "" {
+		fragment = "#" + goldext.MakeSlug(section)
+	}
+
+	if strings.TrimSpace(page) == "" {
+		return fmt.Sprintf("[%s](%s)", text, fragment)
+	}
+
+	url := c.link(page)
+	if url == "" {
+		return text
+	}
+	return fmt.Sprintf("[%s](%s%s)", text, url, fragment)
+}
+
+// appendUnique appends a value to a list unless it's already present
+func appendUnique(list []string, value string) []string {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
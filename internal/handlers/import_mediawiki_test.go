@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMediaWikiImportGolden(t *testing.T) {
+	setupTestWiki(t)
+	cfg.Wiki.MaxVersions = 10
+	data, err := os.ReadFile(filepath.Join("testdata", "import", "mediawiki", "export.xml"))
+	if err != nil {
+		t.Fatalf("Failed to read the export: %v", err)
+	}
+	report := runTestImport(t, "mediawiki", data)
+	checkGolden(t, "mediawiki", report)
+}
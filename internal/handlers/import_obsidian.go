@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"wiki-go/internal/config"
+	"wiki-go/internal/frontmatter"
+	"wiki-go/internal/goldext"
+
+	"gopkg.in/yaml.v3"
+)
+
+// obsidianWikilinkRegex matches [[Note]], [[Note#Heading|Alias]] and their ![[embed]] forms
+var obsidianWikilinkRegex = regexp.MustCompile(`(!?)\[\[([^\[\]|#]*)(#[^\[\]|]*)?(?:\|([^\[\]]*))?\]\]`)
+
+// obsidianTagRegex matches #inline-tags, which may contain letters, digits, _, - and / for nested tags
+var obsidianTagRegex = regexp.MustCompile(`(^|\s)#([\p{L}\p{N}_/-]+)`)
+
+// obsidianEmbedSizeRegex matches the size option of an embed, for example ![[image.png|300]]
+var obsidianEmbedSizeRegex = regexp.MustCompile(`^\d+(x\d+)?$`)
+
+// obsidianVault indexes the files of an Obsidian vault so that links can be resolved the way Obsidian does
+type obsidianVault struct {
+	paths  []string             // Vault-relative paths of all files in archive order
+	files  map[string]*zip.File // Files by vault-relative path
+	byPath map[string]string    // Lowercase path, with and without .md, to vault-relative path
+	byName map[string][]string  // Lowercase file name, with and without .md, to vault-relative paths
+}
+
+// newObsidianVault indexes the files of a vault archive. The vault root is the folder containing
+// .obsidian, so vaults zipped together with their top-level folder import the same way.
+func newObsidianVault(zipReader *zip.Reader) *obsidianVault {
+	root := ""
+	for _, file := range zipReader.File {
+		name := path.Clean(file.Name)
+		if name == ".obsidian" || strings.HasPrefix(name, ".obsidian/") {
+			break
+		}
+		if i := strings.Index(name+"/", "/.obsidian/"); i != -1 {
+			root = name[:i+1]
+			break
+		}
+	}
+
+	vault := &obsidianVault{
+		files:  make(map[string]*zip.File),
+		byPath: make(map[string]string),
+		byName: make(map[string][]string),
+	}
+
+	for _, file := range zipReader.File {
+		name := path.Clean(file.Name)
+		if file.FileInfo().IsDir() || !strings.HasPrefix(name, root) {
+			continue
+		}
+		name = strings.TrimPrefix(name, root)
+
+		// Skip vault settings, the trash and other hidden files
+		if isHiddenImportPath(name) {
+			continue
+		}
+
+		vault.paths = append(vault.paths, name)
+		vault.files[name] = file
+
+		lower := strings.ToLower(name)
+		base := path.Base(lower)
+		vault.byPath[lower] = name
+		vault.byName[base] = append(vault.byName[base], name)
+		if strings.HasSuffix(lower, ".md") {
+			vault.byPath[strings.TrimSuffix(lower, ".md")] = name
+			vault.byName[strings.TrimSuffix(base, ".md")] = append(vault.byName[strings.TrimSuffix(base, ".md")], name)
+		}
+	}
+
+	// Obsidian prefers the file with the shortest path when a name is ambiguous
+	for _, paths := range vault.byName {
+		sort.SliceStable(paths, func(i, j int) bool {
+			return strings.Count(paths[i], "/") < strings.Count(paths[j], "/")
+		})
+	}
+
+	return vault
+}
+
+// isHiddenImportPath reports whether any component of an archive path is hidden or macOS metadata
+func isHiddenImportPath(name string) bool {
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") || component == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve finds the file a link refers to: by path from the vault root, relative to the linking
+// note, and finally by file name anywhere in the vault
+func (v *obsidianVault) resolve(link, from string) (string, bool) {
+	link = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(link), "/"))
+	if link == "" {
+		return "", false
+	}
+
+	if name, ok := v.byPath[link]; ok {
+		return name, true
+	}
+	if name, ok := v.byPath[path.Clean(path.Join(strings.ToLower(path.Dir(from)), link))]; ok {
+		return name, true
+	}
+	if names := v.byName[path.Base(link)]; len(names) > 0 {
+		return names[0], true
+	}
+	return "", false
+}
+
+// obsidianTargetPath maps a note onto the document structure. A folder note, a note named like
+// the folder it is in, becomes the document of that folder.
+func obsidianTargetPath(notePath string) (string, error) {
+	dir, file := path.Split(strings.TrimSuffix(notePath, path.Ext(notePath)))
+	if dir != "" && strings.EqualFold(path.Base(dir), file) {
+		notePath = strings.TrimSuffix(dir, "/")
+	}
+	return determineTargetPath(notePath)
+}
+
+// processObsidianImport processes the import of an Obsidian vault from ZIP file bytes
+func processObsidianImport(zipFileBytes []byte, jobID string, opts ImportOptions, cfg *config.Config) {
+	// Create a reader from the bytes
+	zipReader, err := zip.NewReader(bytes.NewReader(zipFileBytes), int64(len(zipFileBytes)))
+	if err != nil {
+		updateImportStatus(jobID, "failed", 0, "", fmt.Sprintf("Failed to read ZIP file: %v", err))
+		return
+	}
+
+	vault := newObsidianVault(zipReader)
+
+	// Plan every note first so that links between notes can point at their final paths
+	planner := newImportPlanner(cfg, opts)
+	noteTargets := make(map[string]string)
+	var docs []*importDocument
+	for _, name := range vault.paths {
+		if !strings.HasSuffix(strings.ToLower(name), ".md") {
+			continue
+		}
+		updateImportStatusFile(jobID, name)
+
+		content, err := readZipFile(vault.files[name])
+		if err != nil {
+			addImportError(jobID, fmt.Sprintf("Error processing %s: %v", name, err))
+			continue
+		}
+
+		targetPath, err := obsidianTargetPath(name)
+		if err != nil {
+			addImportError(jobID, fmt.Sprintf("Error processing %s: failed to determine target path: %v", name, err))
+			continue
+		}
+
+		// Links to skipped notes still point at the existing document
+		noteTargets[name] = targetPath
+
+		target, ok := planner.resolveTarget(targetPath)
+		if !ok {
+			addImportSkipped(jobID, fmt.Sprintf("%s: /%s already exists", name, targetPath))
+			continue
+		}
+		noteTargets[name] = target
+
+		docs = append(docs, &importDocument{
+			Source:  name,
+			Target:  target,
+			Content: bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n")),
+		})
+	}
+
+	if len(noteTargets) == 0 {
+		updateImportStatus(jobID, "failed", 0, "", "No markdown notes found in the vault.")
+		return
+	}
+
+	// Convert links, embeds and tags, collecting the attachments each note needs
+	referenced := make(map[string]bool)
+	for _, doc := range docs {
+		resolve := func(name string) (string, bool) {
+			if target, ok := noteTargets[name]; ok {
+				return "/" + target, true
+			}
+
+			if !config.IsAllowedExtension(strings.ToLower(path.Ext(name))) {
+				if !referenced[name] {
+					addImportSkipped(jobID, fmt.Sprintf("%s: file type is not allowed", name))
+				}
+				referenced[name] = true
+				return "", false
+			}
+
+			referenced[name] = true
+			return planner.addAsset(doc, name, vault.files[name].Open), true
+		}
+
+		doc.Content = []byte(convertObsidianNote(string(doc.Content), doc, vault, jobID, resolve))
+	}
+
+	// Report files that were not picked up by any note
+	for _, name := range vault.paths {
+		if !strings.HasSuffix(strings.ToLower(name), ".md") && !referenced[name] {
+			addImportSkipped(jobID, fmt.Sprintf("%s: not referenced by any note", name))
+		}
+	}
+
+	applyImport(jobID, docs, opts, cfg)
+}
+
+// convertObsidianNote converts the vault conventions of a note to markdown the wiki understands
+func convertObsidianNote(content string, doc *importDocument, vault *obsidianVault, jobID string, resolve func(name string) (string, bool)) string {
+	fm := ""
+	body := content
+	if frontmatter.HasFrontmatter(content) {
+		fm = frontmatter.Extract(content)
+		body = strings.TrimLeft(content[len("---\n")+len(fm)+len("\n---"):], "\n")
+	}
+
+	// Standard markdown links and images, which Obsidian also resolves by file name
+	body = rewriteImportReferences(body, doc, func(ref string) (string, bool) {
+		name, ok := vault.resolve(ref, "")
+		if !ok {
+			return "", false
+		}
+		return resolve(name)
+	})
+
+	var tags []string
+	body = mapImportText(body, func(text string) string {
+		for _, m := range obsidianTagRegex.FindAllStringSubmatch(text, -1) {
+			// Purely numeric tags are not tags in Obsidian, for example issue numbers like #123
+			if strings.Trim(m[2], "0123456789") != "" {
+				tags = append(tags, m[2])
+			}
+		}
+
+		return obsidianWikilinkRegex.ReplaceAllStringFunc(text, func(match string) string {
+			return convertObsidianWikilink(match, doc, vault, jobID, resolve)
+		})
+	})
+
+	fm, err := mergeObsidianTags(fm, tags)
+	if err != nil {
+		addImportError(jobID, fmt.Sprintf("Error processing %s: failed to read tags from frontmatter: %v", doc.Source, err))
+	}
+	if fm == "" {
+		return body
+	}
+	return "---\n" + fm + "---\n\n" + body
+}
+
+// convertObsidianWikilink converts a single [[wikilink]] or ![[embed]] to a markdown link or image
+func convertObsidianWikilink(match string, doc *importDocument, vault *obsidianVault, jobID string, resolve func(name string) (string, bool)) string {
+	parts := obsidianWikilinkRegex.FindStringSubmatch(match)
+	embed := parts[1] == "!"
+	// Inside tables the alias separator is escaped as \|
+	name := strings.TrimSpace(strings.TrimSuffix(parts[2], "\\"))
+	alias := strings.TrimSpace(parts[4])
+
+	// Nested headings are written as [[Note#Heading#Subheading]], block references as [[Note#^id]]
+	heading := parts[3]
+	if i := strings.LastIndex(heading, "#"); i != -1 {
+		heading = strings.TrimSpace(heading[i+1:])
+	}
+	if strings.HasPrefix(heading, "^") {
+		heading = ""
+	}
+
+	fragment := ""
+	if heading != "" {
+		fragment = "#" + goldext.MakeSlug(heading)
+	}
+
+	// Links to a heading in the same note
+	if name == "" {
+		if alias == "" {
+			alias = heading
+		}
+		return fmt.Sprintf("[%s](%s)", alias, fragment)
+	}
+
+	text := alias
+	if text == "" {
+		text = name
+		if heading != "" {
+			text += " > " + heading
+		}
+	}
+
+	file, ok := vault.resolve(name, doc.Source)
+	if !ok {
+		addImportSkipped(jobID, fmt.Sprintf("%s: link target %q not found", doc.Source, name))
+		return text
+	}
+
+	replacement, ok := resolve(file)
+	if !ok {
+		return text
+	}
+
+	// Embedded notes become links, as the wiki has no transclusion
+	if !embed || strings.HasSuffix(strings.ToLower(file), ".md") {
+		return fmt.Sprintf("[%s](%s%s)", text, replacement, fragment)
+	}
+
+	alt := alias
+	if alt == "" || obsidianEmbedSizeRegex.MatchString(alt) {
+		alt = strings.TrimSuffix(path.Base(file), path.Ext(file))
+	}
+	if strings.HasPrefix(config.GetMimeTypeForExtension(strings.ToLower(path.Ext(file))), "image/") || strings.EqualFold(path.Ext(file), ".mp4") {
+		return fmt.Sprintf("![%s](%s)", alt, replacement)
+	}
+	return fmt.Sprintf("[%s](%s)", alt, replacement)
+}
+
+// mergeObsidianTags adds inline tags to the tags list of a note's frontmatter. Obsidian accepts
+// tags as a list or as a comma or space separated string, with or without a leading #.
+func mergeObsidianTags(fm string, inlineTags []string) (string, error) {
+	var doc yaml.Node
+	if strings.TrimSpace(fm) != "" {
+		if err := yaml.Unmarshal([]byte(fm), &doc); err != nil {
+			return fm + "\n", err
+		}
+	}
+	if len(doc.Content) == 0 {
+		if len(inlineTags) == 0 {
+			return "", nil
+		}
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+
+	mapping := doc.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return fm + "\n", fmt.Errorf("frontmatter is not a mapping")
+	}
+
+	// Collect existing tags and remove the tag keys, they are written back as a single list
+	var tags []string
+	var content []*yaml.Node
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		if key.Value != "tags" && key.Value != "tag" {
+			content = append(content, key, value)
+			continue
+		}
+
+		switch value.Kind {
+		case yaml.SequenceNode:
+			for _, item := range value.Content {
+				tags = append(tags, item.Value)
+			}
+		case yaml.ScalarNode:
+			tags = append(tags, strings.FieldsFunc(value.Value, func(r rune) bool {
+				return r == ',' || r == ' '
+			})...)
+		}
+	}
+	tags = append(tags, inlineTags...)
+
+	// Normalize and deduplicate while keeping the original order
+	seen := make(map[string]bool)
+	list := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, tag := range tags {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "#")
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: tag})
+	}
+	if len(list.Content) > 0 {
+		content = append(content, &yaml.Node{Kind: yaml.ScalarNode, Value: "tags"}, list)
+	}
+	mapping.Content = content
+
+	if len(mapping.Content) == 0 {
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return fm + "\n", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"wiki-go/internal/auth"
+	"wiki-go/internal/roles"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the expected output of the import tests")
+
+// zipDirectory packs a directory into a ZIP archive, with paths relative to the directory
+func zipDirectory(t *testing.T, dir string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	err := filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		w, err := archive.Create(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		t.Fatalf("Failed to zip %s: %v", dir, err)
+	}
+	return buf.Bytes()
+}
+
+// runTestImport runs an import job to completion as an admin of the test wiki and returns its
+// report: the skipped files and errors, one per line
+func runTestImport(t *testing.T, format string, data []byte) string {
+	t.Helper()
+	jobID := "test-" + t.Name()
+	importJobsMutex.Lock()
+	importJobs[jobID] = &ImportStatusResponse{Status: "processing", ImportedFiles: []ImportedFile{}, Errors: []string{}}
+	importJobsMutex.Unlock()
+	defer func() {
+		importJobsMutex.Lock()
+		delete(importJobs, jobID)
+		importJobsMutex.Unlock()
+	}()
+
+	opts := ImportOptions{
+		Format:   format,
+		Conflict: ImportConflictRename,
+		Session:  &auth.Session{Username: "admin", Role: roles.RoleAdmin},
+	}
+	importFormats[format].process(data, jobID, opts, cfg)
+
+	importJobsMutex.RLock()
+	job := importJobs[jobID]
+	lines := append(append([]string{}, job.Skipped...), job.Errors...)
+	status := job.Status
+	importJobsMutex.RUnlock()
+
+	if status != "completed" {
+		t.Fatalf("Expected the import to complete, got: %s (%s)", status, strings.Join(lines, "; "))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// checkGolden compares the files the import wrote to the wiki, and its report, with
+// testdata/import/<name>/expected. Run the tests with -update to rewrite the expected files.
+func checkGolden(t *testing.T, name, report string) {
+	t.Helper()
+	expectedDir := filepath.Join("testdata", "import", name, "expected")
+	written := readTree(t, cfg.Wiki.RootDir, true)
+	written["report.txt"] = report
+
+	if *updateGolden {
+		if err := os.RemoveAll(expectedDir); err != nil {
+			t.Fatalf("Failed to clear %s: %v", expectedDir, err)
+		}
+		for rel, content := range written {
+			file := filepath.Join(expectedDir, filepath.FromSlash(rel))
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				t.Fatalf("Failed to create %s: %v", filepath.Dir(file), err)
+			}
+			if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write %s: %v", file, err)
+			}
+		}
+		return
+	}
+
+	expected := readTree(t, expectedDir, false)
+	for rel, content := range expected {
+		got, found := written[rel]
+		if !found {
+			t.Errorf("Expected %s to be written", rel)
+		} else if got != content {
+			t.Errorf("Unexpected content of %s\nExpected:\n%s\nGot:\n%s", rel, content, got)
+		}
+	}
+	for rel := range written {
+		if _, found := expected[rel]; !found {
+			t.Errorf("Unexpected file %s", rel)
+		}
+	}
+}
+
+// readTree reads the files below a directory by slash separated relative path. Of a wiki only
+// the documents and versions directories are read.
+func readTree(t *testing.T, dir string, wiki bool) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if wiki && !strings.HasPrefix(rel, "documents/") && !strings.HasPrefix(rel, "versions/") {
+			return nil
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		files[rel] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", dir, err)
+	}
+	return files
+}
+
+func TestObsidianImportGolden(t *testing.T) {
+	setupTestWiki(t)
+	report := runTestImport(t, "obsidian", zipDirectory(t, filepath.Join("testdata", "import", "obsidian", "vault")))
+	checkGolden(t, "obsidian", report)
+}
+
+func TestMergeObsidianTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		fm       string
+		tags     []string
+		expected string
+	}{
+		{name: "No frontmatter or tags", expected: ""},
+		{name: "Inline tags only", tags: []string{"wiki", "a/b"}, expected: "tags:\n  - wiki\n  - a/b\n"},
+		{name: "List", fm: "title: Home\ntags: [one, '#two']", tags: []string{"Two", "three"}, expected: "title: Home\ntags:\n  - one\n  - two\n  - three\n"},
+		{name: "Comma and space separated", fm: "tag: one, two three", expected: "tags:\n  - one\n  - two\n  - three\n"},
+		{name: "Empty tags are dropped", fm: "tags: []", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := mergeObsidianTags(tt.fm, tt.tags)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected: %q, got: %q", tt.expected, result)
+			}
+		})
+	}
+
+	if _, err := mergeObsidianTags("- not\n- a mapping", nil); err == nil {
+		t.Error("Expected an error for frontmatter that isn't a mapping")
+	}
+}
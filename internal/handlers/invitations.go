@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"wiki-go/internal/audit"
+	"wiki-go/internal/auth"
+	"wiki-go/internal/config"
+)
+
+// InvitationCreateRequest represents the request body for creating an invitation
+type InvitationCreateRequest struct {
+	Role          string `json:"role"`
+	Note          string `json:"note"`
+	ExpiresInDays int    `json:"expiresInDays"`
+}
+
+// maxInvitationDays is the longest an invitation can stay open
+const maxInvitationDays = 30
+
+// InvitationsHandler lets user managers list, create and revoke invitation links
+func InvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	session := auth.GetSession(r)
+	if session == nil {
+		sendJSONError(w, "Unauthorized", http.StatusUnauthorized, "")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":     true,
+			"invitations": auth.ListInvitations(),
+		})
+
+	case http.MethodPost:
+		var req InvitationCreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendJSONError(w, "Invalid request payload", http.StatusBadRequest, err.Error())
+			return
+		}
+		defer r.Body.Close()
+
+		if req.Role == "" {
+			req.Role = config.RoleViewer
+		}
+		if !canGrant(session, auth.RolePermissions(req.Role)) {
+			sendJSONError(w, errGrantBeyondOwn, http.StatusForbidden, "")
+			return
+		}
+		if req.ExpiresInDays <= 0 {
+			req.ExpiresInDays = 7
+		}
+		if req.ExpiresInDays > maxInvitationDays {
+			sendJSONError(w, "Invitations can stay open for at most 30 days", http.StatusBadRequest, "")
+			return
+		}
+
+		secret, invitation, err := auth.CreateInvitation(session.Username, req.Role, strings.TrimSpace(req.Note), time.Duration(req.ExpiresInDays)*24*time.Hour)
+		if errors.Is(err, auth.ErrUnknownRole) {
+			sendJSONError(w, err.Error(), http.StatusBadRequest, "")
+			return
+		}
+		if err != nil {
+			recordAudit(r, audit.ActionInviteCreate, "", err, "")
+			sendJSONError(w, "Failed to create invitation", http.StatusInternalServerError, err.Error())
+			return
+		}
+		recordAudit(r, audit.ActionInviteCreate, invitation.ID, nil, "role "+invitation.Role)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":    true,
+			"message":    "Invitation created successfully",
+			"invitation": invitation,
+			"link":       "/register?invite=" + url.QueryEscape(secret),
+		})
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			sendJSONError(w, "Invitation ID is required", http.StatusBadRequest, "")
+			return
+		}
+		if !auth.RevokeInvitation(id) {
+			sendJSONError(w, "Invitation not found", http.StatusNotFound, "")
+			return
+		}
+		recordAudit(r, audit.ActionInviteRevoke, id, nil, "")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Invitation revoked",
+		})
+
+	default:
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"wiki-go/internal/audit"
+)
+
+// LoginBanEntry is an address with failed logins or a ban, as listed in the security settings
+type LoginBanEntry struct {
+	IP          string     `json:"ip"`
+	Fails       int        `json:"fails"` // Failures in the current window
+	Banned      bool       `json:"banned"`
+	BannedUntil *time.Time `json:"bannedUntil,omitempty"` // Set while the address is banned
+	BanSeconds  int64      `json:"banSeconds"`            // Length of the last ban, doubled by the next one
+}
+
+// LoginBansHandler lets admins list the addresses in the login ban list (GET) and lift the ban on
+// one of them (DELETE with ?ip=)
+func LoginBansHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		entries := []LoginBanEntry{}
+		if loginBan != nil {
+			now := time.Now()
+			for ip, attempt := range loginBan.Entries() {
+				if attempt.Fails == 0 && attempt.BanUntil == 0 && attempt.BanLen == 0 {
+					continue
+				}
+				entry := LoginBanEntry{
+					IP:         ip,
+					Fails:      attempt.Fails,
+					BanSeconds: attempt.BanLen,
+				}
+				if until := time.Unix(attempt.BanUntil, 0); attempt.BanUntil != 0 && until.After(now) {
+					entry.Banned = true
+					entry.BannedUntil = &until
+				}
+				entries = append(entries, entry)
+			}
+		}
+
+		// Banned addresses first, the longest ban on top
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].Banned != entries[j].Banned {
+				return entries[i].Banned
+			}
+			if entries[i].Banned && !entries[i].BannedUntil.Equal(*entries[j].BannedUntil) {
+				return entries[i].BannedUntil.After(*entries[j].BannedUntil)
+			}
+			return entries[i].IP < entries[j].IP
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"enabled": loginBan != nil,
+			"entries": entries,
+		})
+
+	case http.MethodDelete:
+		ip := strings.TrimSpace(r.URL.Query().Get("ip"))
+		if ip == "" {
+			sendJSONError(w, "IP address is required", http.StatusBadRequest, "")
+			return
+		}
+		if loginBan == nil || !loginBan.Unban(ip) {
+			sendJSONError(w, "Address not found in the ban list", http.StatusNotFound, "")
+			return
+		}
+		recordAudit(r, audit.ActionLoginUnban, ip, nil, "")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Ban lifted",
+		})
+
+	default:
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+	}
+}
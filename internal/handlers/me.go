@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"wiki-go/internal/auth"
+	"wiki-go/internal/crypto"
+	"wiki-go/internal/i18n"
+	"wiki-go/internal/users"
+)
+
+// maxDisplayNameLength limits the length of display names, in characters
+const maxDisplayNameLength = 100
+
+// ProfileResponse is the profile of the logged in user
+type ProfileResponse struct {
+	Username    string     `json:"username"`
+	Role        string     `json:"role"`
+	Source      string     `json:"source,omitempty"` // Set for users of an external identity provider
+	DisplayName string     `json:"display_name"`
+	Email       string     `json:"email"`
+	Language    string     `json:"language"` // Empty for the wiki's default language
+	Theme       string     `json:"theme"`    // Empty to follow the system
+	Groups      []string   `json:"groups"`
+	Permissions []string   `json:"permissions"`
+	Created     *time.Time `json:"created,omitempty"`
+	LastLogin   *time.Time `json:"last_login,omitempty"`
+	Languages   []string   `json:"languages"` // Languages the user can choose from
+}
+
+// ProfileUpdateRequest changes the preferences of the logged in user. Omitted fields are left
+// unchanged, and an empty language or theme goes back to the default.
+type ProfileUpdateRequest struct {
+	DisplayName *string `json:"display_name,omitempty"`
+	Language    *string `json:"language,omitempty"`
+	Theme       *string `json:"theme,omitempty"`
+}
+
+// PasswordChangeRequest changes the password of the logged in user
+type PasswordChangeRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// MeHandler lets users view their profile and change their preferences
+func MeHandler(w http.ResponseWriter, r *http.Request) {
+	session := auth.GetSession(r)
+	if session == nil {
+		sendJSONError(w, "Unauthorized", http.StatusUnauthorized, "")
+		return
+	}
+
+	// Users of the reverse proxy have no account in the wiki
+	user, found := users.Get(session.Username)
+	if !found {
+		sendJSONError(w, "Your account is managed outside the wiki", http.StatusNotFound, "")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"profile": ProfileResponse{
+				Username:    user.Username,
+				Role:        session.Role,
+				Source:      user.Source,
+				DisplayName: user.DisplayName,
+				Email:       user.Email,
+				Language:    user.Language,
+				Theme:       user.Theme,
+				Groups:      auth.UserGroups(user.Username),
+				Permissions: auth.Permissions(session),
+				Created:     timeOrNil(user.Created),
+				LastLogin:   timeOrNil(user.LastLogin),
+				Languages:   i18n.GetAvailableLanguages(),
+			},
+		})
+
+	case http.MethodPut:
+		// The profile is changed from a logged in session, not with tokens
+		if session.TokenID != "" {
+			sendJSONError(w, "Your profile can only be changed from a logged in session", http.StatusForbidden, "")
+			return
+		}
+
+		var req ProfileUpdateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendJSONError(w, "Invalid request payload", http.StatusBadRequest, err.Error())
+			return
+		}
+		defer r.Body.Close()
+
+		if req.DisplayName != nil {
+			trimmed := strings.TrimSpace(*req.DisplayName)
+			if utf8.RuneCountInString(trimmed) > maxDisplayNameLength {
+				sendJSONError(w, "Display name can be at most "+strconv.Itoa(maxDisplayNameLength)+" characters long", http.StatusBadRequest, "")
+				return
+			}
+			req.DisplayName = &trimmed
+		}
+		if req.Language != nil && *req.Language != "" && !slices.Contains(i18n.GetAvailableLanguages(), *req.Language) {
+			sendJSONError(w, "Unknown language", http.StatusBadRequest, "")
+			return
+		}
+		if req.Theme != nil && *req.Theme != "" && *req.Theme != "light" && *req.Theme != "dark" {
+			sendJSONError(w, "Theme must be light or dark", http.StatusBadRequest, "")
+			return
+		}
+
+		err := users.Update(session.Username, func(user *users.User) error {
+			if req.DisplayName != nil {
+				user.DisplayName = *req.DisplayName
+			}
+			if req.Language != nil {
+				user.Language = *req.Language
+			}
+			if req.Theme != nil {
+				user.Theme = *req.Theme
+			}
+			return nil
+		})
+		if err != nil {
+			sendJSONError(w, "Failed to save profile", http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Profile updated successfully",
+		})
+
+	default:
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+	}
+}
+
+// MePasswordHandler lets users change their own password. The current password is required, so
+// that someone who finds a logged in browser can't take the account over.
+func MePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+		return
+	}
+
+	session := auth.GetSession(r)
+	if session == nil {
+		sendJSONError(w, "Unauthorized", http.StatusUnauthorized, "")
+		return
+	}
+	if session.TokenID != "" {
+		sendJSONError(w, "Your password can only be changed from a logged in session", http.StatusForbidden, "")
+		return
+	}
+
+	user, found := users.Get(session.Username)
+	if !found || user.Source != "" {
+		sendJSONError(w, "Your password is managed by your identity provider", http.StatusBadRequest, "")
+		return
+	}
+
+	var req PasswordChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSONError(w, "Invalid request payload", http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	// Guessing the current password counts as a failed login
+	ip := auth.ClientIP(r)
+	if loginBan != nil {
+		if remaining := loginBan.IsBanned(ip); remaining > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(remaining.Seconds())))
+			sendJSONError(w, "Too many failed attempts; try again later", http.StatusTooManyRequests, "")
+			return
+		}
+	}
+	if !crypto.CheckPasswordHash(req.CurrentPassword, user.Password) {
+		if loginBan != nil {
+			loginBan.RegisterFailure(ip)
+		}
+		sendJSONError(w, "Current password is incorrect", http.StatusForbidden, "")
+		return
+	}
+
+	if err := checkPasswordPolicy(req.NewPassword); err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest, "")
+		return
+	}
+
+	hashedPassword, err := crypto.HashPassword(req.NewPassword)
+	if err != nil {
+		sendJSONError(w, "Failed to hash password", http.StatusInternalServerError, err.Error())
+		return
+	}
+	err = users.Update(session.Username, func(user *users.User) error {
+		user.Password = hashedPassword
+		return nil
+	})
+	if errors.Is(err, users.ErrNotFound) {
+		sendJSONError(w, "User not found", http.StatusNotFound, "")
+		return
+	}
+	if err != nil {
+		sendJSONError(w, "Failed to save password", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Other sessions were opened with the old password; this one stays logged in
+	auth.RevokeUserSessions(session.Username, auth.SessionID(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Password changed successfully",
+	})
+}
@@ -2,14 +2,26 @@ package handlers
 
 import (
 	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"mime"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"time"
+	"wiki-go/internal/ban"
+	"wiki-go/internal/ssrf"
 )
 
 // MetadataRequest represents the request structure for metadata fetching
@@ -55,11 +67,19 @@ func FetchMetadataHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Fetch metadata
-	metadata, err := fetchURLMetadata(targetURL)
-	if err != nil {
-		respondWithError(w, fmt.Sprintf("Failed to fetch metadata: %v", err), http.StatusInternalServerError)
-		return
+	// Fetch metadata, unless it was fetched recently
+	metadata := cachedURLMetadata(targetURL)
+	if metadata == nil {
+		metadata, err = fetchURLMetadata(targetURL)
+		if errors.Is(err, ssrf.ErrBlocked) {
+			respondWithError(w, fmt.Sprintf("Failed to fetch metadata: %v", err), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			respondWithError(w, fmt.Sprintf("Failed to fetch metadata: %v", err), http.StatusInternalServerError)
+			return
+		}
+		cacheURLMetadata(targetURL, metadata)
 	}
 
 	// Return successful response
@@ -80,39 +100,44 @@ type URLMetadata struct {
 	Description string
 }
 
-// fetchURLMetadata fetches and parses HTML metadata from a URL
+// maxMetadataRedirects is the most redirects followed when fetching link metadata
+const maxMetadataRedirects = 5
+
+// metadataContentTypes are the response types metadata is read from
+var metadataContentTypes = []string{"text/html", "application/xhtml+xml"}
+
+// fetchURLMetadata fetches and parses HTML metadata from a URL. Loopback, private and link-local
+// addresses are refused unless allowed in the settings, whether the URL or a redirect leads there.
 func fetchURLMetadata(targetURL string) (*URLMetadata, error) {
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 2 * time.Second,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			// Allow up to 5 redirects
-			if len(via) >= 5 {
-				return fmt.Errorf("too many redirects")
-			}
-			return nil
-		},
+	allowed, err := ban.ParseAllowlist(cfg.Security.LinkMetadata.AllowedNetworks)
+	if err != nil {
+		log.Printf("Warning: ignoring invalid link_metadata.allowed_networks: %v", err)
 	}
 
+	// Create HTTP client with timeout
+	client := ssrf.NewClient(2*time.Second, maxMetadataRedirects, allowed)
+
 	// Create request with proper headers
 	req, err := http.NewRequest("GET", targetURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
+	if err := ssrf.CheckHost(req.Context(), req.URL.Hostname(), allowed); err != nil {
+		return nil, err
+	}
 
 	// Set realistic browser headers (but don't request compression for easier parsing)
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9")
 	req.Header.Set("Accept-Language", "en-US,en;q=0.5")
 	req.Header.Set("Accept-Charset", "utf-8,*;q=0.1")
 	// Removed Accept-Encoding to avoid compression issues
 	req.Header.Set("Cache-Control", "no-cache")
-	req.Header.Set("Connection", "keep-alive")
 
 	// Perform request
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch URL: %v", err)
+		return nil, fmt.Errorf("failed to fetch URL: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -121,10 +146,15 @@ func fetchURLMetadata(targetURL string) (*URLMetadata, error) {
 		return nil, fmt.Errorf("HTTP error: %d %s", resp.StatusCode, resp.Status)
 	}
 
+	// Only pages have metadata; don't download images, archives or anything else
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !slices.Contains(metadataContentTypes, strings.ToLower(mediaType)) {
+		return nil, fmt.Errorf("unsupported content type %q", mediaType)
+	}
+
 	// Handle gzip decompression if needed
 	var reader io.Reader = resp.Body
 	if resp.Header.Get("Content-Encoding") == "gzip" {
-		fmt.Printf("DEBUG: Response is gzipped, decompressing...\n")
 		gzipReader, err := gzip.NewReader(resp.Body)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create gzip reader: %v", err)
@@ -153,6 +183,124 @@ func fetchURLMetadata(targetURL string) (*URLMetadata, error) {
 	return metadata, nil
 }
 
+// cachedMetadata is the metadata of a URL as kept in the cache
+type cachedMetadata struct {
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	FetchedAt   time.Time `json:"fetchedAt"`
+}
+
+// maxMetadataCacheEntries is how many link previews are kept on disk. The oldest are removed
+// first once there are more.
+const maxMetadataCacheEntries = 1000
+
+// metadataCacheMu serializes sweeps of the cache directory
+var metadataCacheMu sync.Mutex
+
+// metadataCachePath returns the cache file of a URL, in cfg.Wiki.RootDir/temp/link_metadata
+func metadataCachePath(targetURL string) string {
+	sum := sha256.Sum256([]byte(targetURL))
+	return filepath.Join(cfg.Wiki.RootDir, "temp", "link_metadata", hex.EncodeToString(sum[:])+".json")
+}
+
+// cachedURLMetadata returns the cached metadata of a URL, or nil when it isn't cached or has expired
+func cachedURLMetadata(targetURL string) *URLMetadata {
+	hours := cfg.Security.LinkMetadata.CacheHours
+	if hours <= 0 {
+		return nil
+	}
+
+	data, err := os.ReadFile(metadataCachePath(targetURL))
+	if err != nil {
+		return nil
+	}
+	var cached cachedMetadata
+	if err := json.Unmarshal(data, &cached); err != nil || cached.URL != targetURL {
+		return nil
+	}
+	if time.Since(cached.FetchedAt) > time.Duration(hours)*time.Hour {
+		return nil
+	}
+	return &URLMetadata{Title: cached.Title, Description: cached.Description}
+}
+
+// cacheURLMetadata stores the metadata of a URL. Failing to is only logged; the next paste fetches again.
+func cacheURLMetadata(targetURL string, metadata *URLMetadata) {
+	if cfg.Security.LinkMetadata.CacheHours <= 0 {
+		return
+	}
+
+	path := metadataCachePath(targetURL)
+	data, err := json.Marshal(cachedMetadata{
+		URL:         targetURL,
+		Title:       metadata.Title,
+		Description: metadata.Description,
+		FetchedAt:   time.Now(),
+	})
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+	}
+	if err == nil {
+		// Write then rename, so concurrent readers never see half a file
+		tmp := path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, path)
+		}
+	}
+	if err != nil {
+		log.Printf("Warning: failed to cache link metadata of %s: %v", targetURL, err)
+		return
+	}
+
+	sweepMetadataCache(filepath.Dir(path), time.Duration(cfg.Security.LinkMetadata.CacheHours)*time.Hour)
+}
+
+// sweepMetadataCache removes expired entries from the cache directory, and the oldest entries
+// beyond maxMetadataCacheEntries. Entries are aged by their modification time, which is when
+// they were fetched.
+func sweepMetadataCache(dir string, maxAge time.Duration) {
+	metadataCacheMu.Lock()
+	defer metadataCacheMu.Unlock()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	type cacheFile struct {
+		path     string
+		modified time.Time
+	}
+	var files []cacheFile
+	now := time.Now()
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		// Expired entries, and temporary files left behind by a failed write
+		if now.Sub(info.ModTime()) > maxAge {
+			os.Remove(path)
+			continue
+		}
+		if strings.HasSuffix(entry.Name(), ".json") {
+			files = append(files, cacheFile{path: path, modified: info.ModTime()})
+		}
+	}
+
+	if len(files) <= maxMetadataCacheEntries {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modified.Before(files[j].modified)
+	})
+	for _, file := range files[:len(files)-maxMetadataCacheEntries] {
+		os.Remove(file.path)
+	}
+}
+
 // convertToUTF8 converts the HTML content to UTF-8 if it's in a different encoding
 func convertToUTF8(body []byte, contentType string) string {
 	// First, try to detect charset from Content-Type header
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// metadataCacheFiles returns the names of the files in the link metadata cache
+func metadataCacheFiles(t *testing.T) map[string]bool {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(cfg.Wiki.RootDir, "temp", "link_metadata"))
+	if err != nil {
+		t.Fatalf("Failed to read the cache: %v", err)
+	}
+	names := make(map[string]bool)
+	for _, entry := range entries {
+		names[entry.Name()] = true
+	}
+	return names
+}
+
+// backdate sets the modification time of a file as if it was written the given time ago
+func backdate(t *testing.T, path string, age time.Duration) {
+	t.Helper()
+	when := time.Now().Add(-age)
+	if err := os.Chtimes(path, when, when); err != nil {
+		t.Fatalf("Failed to backdate %s: %v", path, err)
+	}
+}
+
+func TestMetadataCacheRemovesExpired(t *testing.T) {
+	setupTestWiki(t)
+	cfg.Security.LinkMetadata.CacheHours = 1
+
+	cacheURLMetadata("https://old.example.com", &URLMetadata{Title: "Old"})
+	cacheURLMetadata("https://recent.example.com", &URLMetadata{Title: "Recent"})
+	old := metadataCachePath("https://old.example.com")
+	backdate(t, old, 2*time.Hour)
+	leftover := filepath.Join(filepath.Dir(old), "abc.json.tmp")
+	if err := os.WriteFile(leftover, []byte("{"), 0644); err != nil {
+		t.Fatalf("Failed to write a temporary file: %v", err)
+	}
+	backdate(t, leftover, 2*time.Hour)
+
+	cacheURLMetadata("https://new.example.com", &URLMetadata{Title: "New"})
+
+	files := metadataCacheFiles(t)
+	if files[filepath.Base(old)] || files["abc.json.tmp"] {
+		t.Error("Expected the expired entry and the old temporary file to be removed")
+	}
+	if !files[filepath.Base(metadataCachePath("https://recent.example.com"))] || !files[filepath.Base(metadataCachePath("https://new.example.com"))] {
+		t.Error("Expected entries that haven't expired to be kept")
+	}
+	if metadata := cachedURLMetadata("https://recent.example.com"); metadata == nil || metadata.Title != "Recent" {
+		t.Errorf("Expected the cached metadata, got: %+v", metadata)
+	}
+}
+
+func TestMetadataCacheLimit(t *testing.T) {
+	setupTestWiki(t)
+	cfg.Security.LinkMetadata.CacheHours = 24
+
+	// Fill the cache, the first entry being the oldest
+	for i := 0; i < maxMetadataCacheEntries; i++ {
+		target := fmt.Sprintf("https://example.com/%d", i)
+		path := metadataCachePath(target)
+		if i == 0 {
+			cacheURLMetadata(target, &URLMetadata{Title: "First"})
+			backdate(t, path, time.Hour)
+			continue
+		}
+		if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	cacheURLMetadata("https://example.com/new", &URLMetadata{Title: "New"})
+
+	files := metadataCacheFiles(t)
+	if len(files) != maxMetadataCacheEntries {
+		t.Errorf("Expected %d entries, got: %d", maxMetadataCacheEntries, len(files))
+	}
+	if files[filepath.Base(metadataCachePath("https://example.com/0"))] {
+		t.Error("Expected the oldest entry to be removed")
+	}
+	if !files[filepath.Base(metadataCachePath("https://example.com/new"))] {
+		t.Error("Expected the new entry to be kept")
+	}
+}
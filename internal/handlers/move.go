@@ -7,6 +7,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"wiki-go/internal/acl"
+	"wiki-go/internal/audit"
 	"wiki-go/internal/auth"
 	"wiki-go/internal/config"
 )
@@ -100,6 +102,22 @@ func MoveDocumentHandler(w http.ResponseWriter, r *http.Request, cfg *config.Con
 		log.Printf("Detected move to root operation: %s -> %s", moveReq.SourcePath, moveReq.NewSlug)
 	}
 	
+	// Path restricted tokens can only move documents within their path
+	destination := moveReq.TargetPath
+	if destination == "" && !moveToRoot {
+		destination = sourceDir
+	}
+	if !session.AllowsPath(moveReq.SourcePath) || !session.AllowsPath(destination) {
+		sendJSONResponse(w, false, "Token is not allowed to access this path", http.StatusForbidden, "", "")
+		return
+	}
+
+	// Moving needs write access on both ends, or a document could be moved out of its restrictions
+	if !acl.CanWrite(session, moveReq.SourcePath) || !acl.CanWrite(session, destination) {
+		sendJSONResponse(w, false, "You don't have permission to move this document there", http.StatusForbidden, "", "")
+		return
+	}
+
 	// Determine if this is a move operation
 	isMove := moveReq.TargetPath != "" || moveToRoot
 	
@@ -121,6 +139,12 @@ func MoveDocumentHandler(w http.ResponseWriter, r *http.Request, cfg *config.Con
 		return
 	}
 
+	// Rules below the source only match at its current path, so all of it has to be writable
+	if !subtreeWritable(session, moveReq.SourcePath, fullSourcePath) {
+		sendJSONResponse(w, false, "You don't have permission to move everything below this document", http.StatusForbidden, "", "")
+		return
+	}
+
 	// Determine the target path based on operation type
 	var fullTargetPath string
 	var newPath string
@@ -218,6 +242,7 @@ func MoveDocumentHandler(w http.ResponseWriter, r *http.Request, cfg *config.Con
 	
 	// Move the document or category
 	if err := os.Rename(fullSourcePath, fullTargetPath); err != nil {
+		recordAudit(r, audit.ActionDocumentMove, "/"+moveReq.SourcePath, err, "to /"+newPath)
 		log.Printf("Error moving document: %v", err)
 		sendJSONResponse(w, false, "Failed to move: "+err.Error(), http.StatusInternalServerError, "", "")
 		return
@@ -278,6 +303,8 @@ func MoveDocumentHandler(w http.ResponseWriter, r *http.Request, cfg *config.Con
 		}
 	}
 
+	recordAudit(r, audit.ActionDocumentMove, "/"+moveReq.SourcePath, nil, "to /"+newPath)
+
 	// Return success response with both old and new paths
 	sendJSONResponse(w, true, "Document moved successfully", http.StatusOK, newPath, moveReq.SourcePath)
 }
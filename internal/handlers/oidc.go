@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"wiki-go/internal/audit"
+	"wiki-go/internal/auth"
+	"wiki-go/internal/users"
+)
+
+// oidcStateCookie binds a single sign-on login to the browser that started it
+const oidcStateCookie = "oidc_state"
+
+// oidcRedirectPage sends the browser on after a single sign-on login. A plain redirect would
+// drop the SameSite=Strict session cookie, because the request chain started at the provider.
+var oidcRedirectPage = template.Must(template.New("oidc-redirect").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="0;url={{.}}">
+</head>
+<body><a href="{{.}}">Continue</a></body>
+</html>`))
+
+// OIDCLoginHandler starts a single sign-on login by sending the browser to the provider
+func OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+		return
+	}
+	if !auth.OIDCEnabled(cfg) {
+		sendJSONError(w, "Single sign-on is not enabled", http.StatusNotFound, "")
+		return
+	}
+
+	authURL, state, err := auth.StartOIDCLogin(r.Context(), cfg, safeRedirectTarget(r.URL.Query().Get("next")))
+	if err != nil {
+		log.Printf("Single sign-on: %v", err)
+		http.Redirect(w, r, "/login?sso_error=1", http.StatusSeeOther)
+		return
+	}
+
+	// Lax, so that the cookie comes along when the provider redirects back
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/oidc/",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   !cfg.Server.AllowInsecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallbackHandler completes a single sign-on login when the provider redirects back.
+// Users are created on their first login and their role follows the provider on every login.
+func OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if !auth.OIDCEnabled(cfg) {
+		sendJSONError(w, "Single sign-on is not enabled", http.StatusNotFound, "")
+		return
+	}
+
+	// The state cookie is single use
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    "",
+		Path:     "/api/oidc/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   !cfg.Server.AllowInsecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	fail := func(format string, args ...interface{}) {
+		log.Printf("Single sign-on: "+format, args...)
+		recordLogin(r, "", audit.OutcomeFailure, "single sign-on: "+fmt.Sprintf(format, args...))
+		http.Redirect(w, r, "/login?sso_error=1", http.StatusSeeOther)
+	}
+
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		fail("provider returned %s: %s", errCode, query.Get("error_description"))
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if state == "" || err != nil || cookie.Value != state {
+		fail("state mismatch")
+		return
+	}
+	code := query.Get("code")
+	if code == "" {
+		fail("no authorization code")
+		return
+	}
+
+	identity, err := auth.FinishOIDCLogin(r.Context(), cfg, state, code)
+	if err != nil {
+		fail("%v", err)
+		return
+	}
+
+	role := auth.OIDCRole(cfg, identity)
+	if role == "" {
+		fail("user %s has no role", identity.Username)
+		return
+	}
+	if err := provisionExternalUser(identity.Username, identity.Subject, role, users.SourceOIDC); err != nil {
+		fail("%v", err)
+		return
+	}
+
+	if err := auth.CreateSession(w, r, identity.Username, role, false, cfg); err != nil {
+		fail("failed to create session: %v", err)
+		return
+	}
+	recordLogin(r, identity.Username, audit.OutcomeSuccess, "single sign-on")
+
+	next := identity.Next
+	if next == "" {
+		next = "/"
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := oidcRedirectPage.Execute(w, next); err != nil {
+		log.Printf("Error rendering single sign-on redirect: %v", err)
+	}
+}
+
+// safeRedirectTarget only allows redirects to paths on this wiki
+func safeRedirectTarget(target string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return ""
+	}
+	if u, err := url.Parse(target); err != nil || u.Host != "" || u.Scheme != "" {
+		return ""
+	}
+	return target
+}
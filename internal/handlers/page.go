@@ -10,9 +10,11 @@ import (
 	"strings"
 	"time"
 
+	"wiki-go/internal/acl"
 	"wiki-go/internal/auth"
 	"wiki-go/internal/comments"
 	"wiki-go/internal/config"
+	"wiki-go/internal/csp"
 	"wiki-go/internal/i18n"
 	"wiki-go/internal/types"
 	"wiki-go/internal/utils"
@@ -43,12 +45,20 @@ func PageHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
 		return
 	}
 
+	// Check access before anything about the document is revealed
+	session := auth.GetSession(r)
+	if !acl.CanRead(session, decodedPath) {
+		denyDocument(w, r, session)
+		return
+	}
+
 	// Build navigation
 	nav, err := utils.BuildNavigation(cfg.Wiki.RootDir, cfg.Wiki.DocumentsDir)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	filterNavigation(nav, session)
 
 	// Mark active navigation item
 	utils.MarkActiveNavItem(nav, path)
@@ -107,42 +117,12 @@ func PageHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
 	}
 
 	// List directory contents
-	files, err := os.ReadDir(fsPath)
+	dirContent, err = buildDirectoryListing(fsPath, path, session)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Build directory listing HTML
-	var dirItems []string
-	for _, f := range files {
-		if !f.IsDir() || strings.HasPrefix(f.Name(), ".") || f.Name() == "document.md" {
-			continue // Skip non-directories, hidden files, and document.md
-		}
-
-		dirName := f.Name()
-		urlPath := filepath.Join(path, dirName)
-
-		// Check if subdirectory has a document.md
-		subDocPath := filepath.Join(fsPath, dirName, "document.md")
-		if _, err := os.Stat(subDocPath); err == nil {
-			// Use the GetDocumentTitle function which includes emoji processing
-			dirTitle := utils.GetDocumentTitle(filepath.Join(fsPath, dirName))
-			dirItems = append(dirItems, fmt.Sprintf(`<div class="directory-item is-dir"><a href="%s">%s</a></div>`,
-				urlPath, dirTitle))
-			continue
-		}
-
-		// Fallback to formatted directory name if no document.md or no title found
-		dirTitle := utils.FormatDirName(dirName)
-		dirItems = append(dirItems, fmt.Sprintf(`<div class="directory-item is-dir"><a href="%s">%s</a></div>`,
-			urlPath, dirTitle))
-	}
-
-	if len(dirItems) > 0 {
-		dirContent = template.HTML(strings.Join(dirItems, "\n"))
-	}
-
 	// If no document.md exists, show directory title and listing
 	if docInfo == nil {
 		content = template.HTML(fmt.Sprintf("<h1>%s</h1>", navItem.Title))
@@ -158,14 +138,11 @@ func PageHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
 	var isAuthenticated bool
 
 	// Get authentication status - do this for ALL pages
-	session := auth.GetSession(r)
 	isAuthenticated = session != nil
 
-	// Get user role
-	userRole := ""
-	if isAuthenticated && session != nil {
-		userRole = session.Role
-	}
+	// Get user role and permissions; editors that may not change this document only get the
+	// viewer's controls here
+	userRole, permissions := pagePermissions(session, acl.CanWrite(session, decodedPath))
 
 	// Comments are only available for documents
 	if isDocument {
@@ -206,13 +183,58 @@ func PageHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
 		CommentsAllowed:    commentsAllowed,
 		IsAuthenticated:    isAuthenticated,
 		UserRole:           userRole,
+		Permissions:        permissions,
 		DocPath:            decodedPath,
 		DocumentLayout:     navItem.DocumentLayout,
+		CSPNonce:           csp.Nonce(r),
 	}
 
 	renderTemplate(w, data)
 }
 
+// buildDirectoryListing renders the list of subdirectories of fsPath that the session may read
+// as HTML links rooted at urlPath
+func buildDirectoryListing(fsPath string, urlPath string, session *auth.Session) (template.HTML, error) {
+	files, err := os.ReadDir(fsPath)
+	if err != nil {
+		return "", err
+	}
+
+	// Build directory listing HTML
+	var dirItems []string
+	for _, f := range files {
+		if !f.IsDir() || strings.HasPrefix(f.Name(), ".") || f.Name() == "document.md" {
+			continue // Skip non-directories, hidden files, and document.md
+		}
+
+		dirName := f.Name()
+		itemPath := filepath.Join(urlPath, dirName)
+		if !acl.CanRead(session, itemPath) {
+			continue
+		}
+
+		// Check if subdirectory has a document.md
+		subDocPath := filepath.Join(fsPath, dirName, "document.md")
+		if _, err := os.Stat(subDocPath); err == nil {
+			// Use the GetDocumentTitle function which includes emoji processing
+			dirTitle := utils.GetDocumentTitle(filepath.Join(fsPath, dirName))
+			dirItems = append(dirItems, fmt.Sprintf(`<div class="directory-item is-dir"><a href="%s">%s</a></div>`,
+				itemPath, dirTitle))
+			continue
+		}
+
+		// Fallback to formatted directory name if no document.md or no title found
+		dirTitle := utils.FormatDirName(dirName)
+		dirItems = append(dirItems, fmt.Sprintf(`<div class="directory-item is-dir"><a href="%s">%s</a></div>`,
+			itemPath, dirTitle))
+	}
+
+	if len(dirItems) == 0 {
+		return "", nil
+	}
+	return template.HTML(strings.Join(dirItems, "\n")), nil
+}
+
 // generateBreadcrumbs creates a breadcrumb trail from a path
 func generateBreadcrumbs(nav *types.NavItem, path string) []types.BreadcrumbItem {
 	if path == "" || path == "/" {
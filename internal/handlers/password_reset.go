@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"wiki-go/internal/audit"
+	"wiki-go/internal/auth"
+	"wiki-go/internal/config"
+	"wiki-go/internal/crypto"
+	"wiki-go/internal/csp"
+	"wiki-go/internal/i18n"
+	"wiki-go/internal/mailer"
+	"wiki-go/internal/resources"
+	"wiki-go/internal/users"
+	"wiki-go/internal/version"
+)
+
+// passwordResetCooldown is how long a user waits before another reset link is emailed to them
+const passwordResetCooldown = 5 * time.Minute
+
+// PasswordResetRequest sets a new password with a reset link
+type PasswordResetRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// PasswordResetEmailRequest asks for a reset link to be emailed
+type PasswordResetEmailRequest struct {
+	Username string `json:"username"` // Username or email address
+}
+
+// passwordResetTTL returns how long reset links can be used
+func passwordResetTTL() time.Duration {
+	hours := cfg.Security.PasswordReset.LinkValidHours
+	if hours <= 0 {
+		hours = 24
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// selfServicePasswordReset reports whether users can request reset links by email. Emailed
+// links need a configured base URL; the request's Host header can't be trusted for them.
+func selfServicePasswordReset() bool {
+	return cfg.Security.PasswordReset.SelfService && cfg.Security.PasswordReset.BaseURL != "" && mailer.Configured(cfg)
+}
+
+// passwordResetLink returns the path of the page that consumes a reset link
+func passwordResetLink(secret string) string {
+	return "/reset-password?token=" + url.QueryEscape(secret)
+}
+
+// UserPasswordResetHandler lets user managers create a reset link for a user, to be shared out
+// of band
+func UserPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+		return
+	}
+
+	session := auth.GetSession(r)
+	if session == nil {
+		sendJSONError(w, "Unauthorized", http.StatusUnauthorized, "")
+		return
+	}
+
+	username := r.URL.Query().Get("username")
+	user, found := users.Get(username)
+	if !found {
+		sendJSONError(w, "User not found", http.StatusNotFound, "")
+		return
+	}
+	if user.Source != "" {
+		sendJSONError(w, "The user's password is managed by their identity provider", http.StatusBadRequest, "")
+		return
+	}
+
+	secret, reset, err := auth.CreatePasswordReset(user.Username, session.Username, passwordResetTTL())
+	recordAudit(r, audit.ActionPasswordLink, user.Username, err, "")
+	if err != nil {
+		sendJSONError(w, "Failed to create password reset link", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"message":   "Password reset link created",
+		"link":      passwordResetLink(secret),
+		"expiresAt": reset.ExpiresAt,
+	})
+}
+
+// PasswordResetPageHandler renders the page that sets a new password from a reset link, or,
+// without a link, lets users request one by email
+func PasswordResetPageHandler(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Config       *config.Config
+		Theme        string
+		Token        string // Secret of the reset link
+		TokenInvalid bool   // The link was used, replaced or expired
+		CanRequest   bool   // Reset links can be requested by email
+		CSPNonce     string // Nonce that lets the inline scripts run
+	}{
+		Config:     cfg,
+		Theme:      "light",
+		Token:      r.URL.Query().Get("token"),
+		CanRequest: selfServicePasswordReset(),
+		CSPNonce:   csp.Nonce(r),
+	}
+	if cookie, err := r.Cookie("theme"); err == nil {
+		data.Theme = cookie.Value
+	}
+
+	if data.Token != "" {
+		_, err := auth.LookupPasswordReset(data.Token)
+		data.TokenInvalid = err != nil
+	}
+
+	funcMap := template.FuncMap{
+		"t": func(key string) string {
+			return i18n.Translate(key)
+		},
+		"getVersion": func() string {
+			return version.Version
+		},
+	}
+
+	tmpl, err := template.New("reset-password.html").Funcs(funcMap).ParseFS(resources.GetTemplatesFS(), "templates/reset-password.html")
+	if err != nil {
+		http.Error(w, "Error loading password reset template: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The link must not leak to other sites through the Referer header
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Error rendering password reset template: %v", err)
+	}
+}
+
+// PasswordResetHandler sets a new password with a reset link and logs the user out everywhere
+func PasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+		return
+	}
+
+	var req PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSONError(w, "Invalid request payload", http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	// Guessing reset links counts as failed logins
+	ip := auth.ClientIP(r)
+	if loginBan != nil {
+		if remaining := loginBan.IsBanned(ip); remaining > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(remaining.Seconds())))
+			sendJSONError(w, "Too many failed attempts; try again later", http.StatusTooManyRequests, "")
+			return
+		}
+	}
+
+	if err := checkPasswordPolicy(req.Password); err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest, "")
+		return
+	}
+	hashedPassword, err := crypto.HashPassword(req.Password)
+	if err != nil {
+		sendJSONError(w, "Failed to hash password", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var username string
+	err = auth.UsePasswordReset(req.Token, func(reset auth.PasswordReset) error {
+		username = reset.Username
+		return users.Update(reset.Username, func(user *users.User) error {
+			user.Password = hashedPassword
+			return nil
+		})
+	})
+
+	// The actor is the user whose password is reset, who isn't logged in
+	entry := auditEntry(r, audit.ActionPasswordReset, username, err, "")
+	entry.Actor = username
+	audit.Record(entry)
+
+	switch {
+	case errors.Is(err, auth.ErrInvalidPasswordReset):
+		if loginBan != nil {
+			loginBan.RegisterFailure(ip)
+		}
+		sendJSONError(w, "The password reset link is invalid or has expired", http.StatusForbidden, "")
+		return
+	case errors.Is(err, users.ErrNotFound):
+		sendJSONError(w, "User not found", http.StatusNotFound, "")
+		return
+	case err != nil:
+		sendJSONError(w, "Failed to save password", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Whoever knew the old password is logged out
+	auth.RevokeUserSessions(username, "")
+	log.Printf("Password of user %s was reset", username)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Your password was changed, you can log in now",
+	})
+}
+
+// PasswordResetEmailHandler emails a reset link to a user who forgot their password. It answers
+// the same whether or not the user exists, so that it can't be used to find accounts.
+func PasswordResetEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+		return
+	}
+	if !selfServicePasswordReset() {
+		sendJSONError(w, "Password reset by email is not available", http.StatusForbidden, "")
+		return
+	}
+
+	var req PasswordResetEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSONError(w, "Invalid request payload", http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	if loginBan != nil {
+		if remaining := loginBan.IsBanned(auth.ClientIP(r)); remaining > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(remaining.Seconds())))
+			sendJSONError(w, "Too many failed attempts; try again later", http.StatusTooManyRequests, "")
+			return
+		}
+	}
+
+	name := strings.TrimSpace(req.Username)
+	if user, found := findUserForPasswordReset(name); found {
+		// Sending takes a while; answering right away doesn't tell whether the user exists.
+		// The request is audited once the email is sent.
+		go sendPasswordResetEmail(user, auditEntry(r, audit.ActionPasswordEmail, user.Username, nil, ""))
+	} else {
+		recordAudit(r, audit.ActionPasswordEmail, name, errors.New("no matching account"), "")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "If an account with that name or email exists, a password reset link was sent to its email address",
+	})
+}
+
+// findUserForPasswordReset returns the local, active user with the given username or email
+// address, if that user has an email address to send the link to
+func findUserForPasswordReset(name string) (users.User, bool) {
+	if name == "" {
+		return users.User{}, false
+	}
+
+	user, found := users.Get(name)
+	if !found {
+		for _, candidate := range users.List() {
+			if candidate.Email != "" && strings.EqualFold(candidate.Email, name) {
+				user, found = candidate, true
+				break
+			}
+		}
+	}
+	if !found || user.Email == "" || user.Source != "" || user.Disabled || user.Pending {
+		return users.User{}, false
+	}
+	return user, true
+}
+
+// sendPasswordResetEmail creates a reset link for the user and emails it, unless one was sent
+// recently, then records entry with the outcome
+func sendPasswordResetEmail(user users.User, entry audit.Entry) {
+	if auth.PasswordResetCreatedSince(user.Username, user.Username, time.Now().Add(-passwordResetCooldown)) {
+		log.Printf("Not sending another password reset link to %s yet", user.Username)
+		entry.Outcome = audit.OutcomeFailure
+		entry.Details = "a link was sent recently"
+		audit.Record(entry)
+		return
+	}
+
+	ttl := passwordResetTTL()
+	secret, reset, err := auth.CreatePasswordReset(user.Username, user.Username, ttl)
+	if err != nil {
+		log.Printf("Failed to create password reset link for %s: %v", user.Username, err)
+		entry.Outcome = audit.OutcomeFailure
+		entry.Details = err.Error()
+		audit.Record(entry)
+		return
+	}
+
+	link := strings.TrimRight(cfg.Security.PasswordReset.BaseURL, "/") + passwordResetLink(secret)
+	body := "Hello " + user.Username + ",\n\n" +
+		"Someone asked to reset the password of your account on " + cfg.Wiki.Title + ". " +
+		"Open this link to choose a new password:\n\n" +
+		link + "\n\n" +
+		"The link works once and expires in " + strconv.Itoa(int(ttl.Hours())) + " hours. " +
+		"If you didn't ask for it, you can ignore this email; your password stays the same.\n"
+
+	if err := mailer.Send(cfg, user.Email, "Password reset for "+cfg.Wiki.Title, body); err != nil {
+		log.Printf("Failed to send password reset email to %s: %v", user.Username, err)
+		auth.RevokePasswordReset(reset.ID)
+		entry.Outcome = audit.OutcomeFailure
+		entry.Details = err.Error()
+	}
+	audit.Record(entry)
+}
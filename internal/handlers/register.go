@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"wiki-go/internal/audit"
+	"wiki-go/internal/auth"
+	"wiki-go/internal/config"
+	"wiki-go/internal/crypto"
+	"wiki-go/internal/csp"
+	"wiki-go/internal/i18n"
+	"wiki-go/internal/resources"
+	"wiki-go/internal/users"
+	"wiki-go/internal/version"
+)
+
+// validUsername matches the usernames people can pick for themselves
+var validUsername = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@-]{0,63}$`)
+
+// RegisterRequest represents the request body for creating an account
+type RegisterRequest struct {
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	DisplayName string `json:"display_name"`
+	Email       string `json:"email"`
+	Invite      string `json:"invite"` // Secret of an invitation link, empty for self-registration
+}
+
+// RegisterPageHandler renders the page where invited users and, when self-registration is
+// enabled, visitors create their account
+func RegisterPageHandler(w http.ResponseWriter, r *http.Request) {
+	// If user is already logged in, redirect to home page
+	if auth.GetSession(r) != nil {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	data := struct {
+		Config        *config.Config
+		Theme         string
+		Invite        string // Secret of the invitation link
+		InviteInvalid bool   // The link's invitation was used, revoked or expired
+		Open          bool   // An account can be created on this page
+		CSPNonce      string // Nonce that lets the inline scripts run
+	}{
+		Config:   cfg,
+		Theme:    "light",
+		Invite:   r.URL.Query().Get("invite"),
+		CSPNonce: csp.Nonce(r),
+	}
+	if cookie, err := r.Cookie("theme"); err == nil {
+		data.Theme = cookie.Value
+	}
+
+	if data.Invite != "" {
+		_, err := auth.LookupInvitation(data.Invite)
+		data.InviteInvalid = err != nil
+		data.Open = err == nil
+	} else {
+		data.Open = cfg.Security.Registration.Enabled
+	}
+
+	funcMap := template.FuncMap{
+		"t": func(key string) string {
+			return i18n.Translate(key)
+		},
+		"getVersion": func() string {
+			return version.Version
+		},
+	}
+
+	tmpl, err := template.New("register.html").Funcs(funcMap).ParseFS(resources.GetTemplatesFS(), "templates/register.html")
+	if err != nil {
+		http.Error(w, "Error loading register template: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if !data.Open {
+		w.WriteHeader(http.StatusForbidden)
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Error rendering register template: %v", err)
+	}
+}
+
+// RegisterHandler creates an account from an invitation, with the invitation's role, or as a
+// self-registration that waits for an admin's approval
+func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+		return
+	}
+
+	var req RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSONError(w, "Invalid request payload", http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Invite == "" && !cfg.Security.Registration.Enabled {
+		sendJSONError(w, "Registration is closed", http.StatusForbidden, "")
+		return
+	}
+
+	// Guessing invitations counts as failed logins
+	ip := auth.ClientIP(r)
+	if loginBan != nil {
+		if remaining := loginBan.IsBanned(ip); remaining > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(remaining.Seconds())))
+			sendJSONError(w, "Too many failed attempts; try again later", http.StatusTooManyRequests, "")
+			return
+		}
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	if !validUsername.MatchString(req.Username) {
+		sendJSONError(w, "Usernames may only contain letters, digits, dots, dashes, underscores and @", http.StatusBadRequest, "")
+		return
+	}
+	if err := checkPasswordPolicy(req.Password); err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest, "")
+		return
+	}
+
+	hashedPassword, err := crypto.HashPassword(req.Password)
+	if err != nil {
+		sendJSONError(w, "Failed to hash password", http.StatusInternalServerError, err.Error())
+		return
+	}
+	user := users.User{
+		Username:    req.Username,
+		Password:    hashedPassword,
+		DisplayName: strings.TrimSpace(req.DisplayName),
+		Email:       strings.TrimSpace(req.Email),
+	}
+
+	pending := req.Invite == ""
+	if pending {
+		user.Role = cfg.Security.Registration.DefaultRole
+		if !auth.RoleExists(user.Role) {
+			user.Role = config.RoleViewer
+		}
+		user.Pending = true
+		err = users.Create(user)
+	} else {
+		// The invitation is only used up when the account was created
+		err = auth.UseInvitation(req.Invite, func(invitation auth.Invitation) error {
+			user.Role = invitation.Role
+			return users.Create(user)
+		})
+	}
+
+	switch {
+	case errors.Is(err, auth.ErrInvalidInvitation):
+		if loginBan != nil {
+			loginBan.RegisterFailure(ip)
+		}
+		sendJSONError(w, "The invitation is invalid or has expired", http.StatusForbidden, "")
+		return
+	case errors.Is(err, users.ErrExists):
+		sendJSONError(w, "Username already exists", http.StatusConflict, "")
+		return
+	case err != nil:
+		sendJSONError(w, "Failed to create account", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Registered users are their own actor
+	details := "invited as " + user.Role
+	if pending {
+		details = "registered, waits for approval"
+	}
+	audit.Record(audit.Entry{Actor: user.Username, IP: ip, Action: audit.ActionUserCreate, Target: user.Username, Outcome: audit.OutcomeSuccess, Details: details})
+
+	message := "Account created, you can log in now"
+	if pending {
+		message = "Account created, it can be used once an administrator approves it"
+		log.Printf("User %s registered and waits for approval", user.Username)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"pending": pending,
+		"message": message,
+	})
+}
+
+// ApproveUserHandler lets user managers approve a self-registered user
+func ApproveUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+		return
+	}
+
+	username := r.URL.Query().Get("username")
+	if username == "" {
+		sendJSONError(w, "Username is required", http.StatusBadRequest, "")
+		return
+	}
+
+	err := users.Update(username, func(user *users.User) error {
+		user.Pending = false
+		return nil
+	})
+	if errors.Is(err, users.ErrNotFound) {
+		sendJSONError(w, "User not found", http.StatusNotFound, "")
+		return
+	}
+	recordAudit(r, audit.ActionUserApprove, username, err, "")
+	if err != nil {
+		sendJSONError(w, "Failed to save user", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "User approved",
+	})
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"wiki-go/internal/audit"
+	"wiki-go/internal/auth"
+	"wiki-go/internal/roles"
+	"wiki-go/internal/users"
+)
+
+// RolesHandler lets user managers list, define and remove custom roles
+func RolesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":     true,
+			"roles":       auth.ListRoles(),
+			"permissions": roles.Permissions,
+		})
+
+	case http.MethodPost:
+		var req auth.CustomRole
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendJSONError(w, "Invalid request payload", http.StatusBadRequest, err.Error())
+			return
+		}
+		defer r.Body.Close()
+
+		req.Name = strings.TrimSpace(req.Name)
+		req.Description = strings.TrimSpace(req.Description)
+
+		if !canGrant(auth.GetSession(r), req.Permissions) {
+			sendJSONError(w, errGrantBeyondOwn, http.StatusForbidden, "")
+			return
+		}
+
+		previous, existed := findCustomRole(req.Name)
+		if err := auth.SaveRole(req); err != nil {
+			recordAudit(r, audit.ActionRoleSave, req.Name, err, "")
+			sendRoleError(w, err)
+			return
+		}
+
+		// Taking user management away from the role of the last user manager would lock everyone out
+		if existed && userManagers() == 0 {
+			auth.SaveRole(previous)
+			sendJSONError(w, "Nobody would be left to manage users", http.StatusBadRequest, "")
+			return
+		}
+		recordAudit(r, audit.ActionRoleSave, req.Name, nil, "permissions "+strings.Join(req.Permissions, ", "))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Role saved successfully",
+		})
+
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			sendJSONError(w, "Role name is required", http.StatusBadRequest, "")
+			return
+		}
+
+		// Users and logins mapped to the role would be left without one
+		for _, user := range users.List() {
+			if user.Role == name {
+				sendJSONError(w, "The role is assigned to "+user.Username, http.StatusConflict, "")
+				return
+			}
+		}
+		security := cfg.Security
+		for _, defaultRole := range []string{security.OIDC.DefaultRole, security.LDAP.DefaultRole, security.ReverseProxy.DefaultRole} {
+			if defaultRole == name {
+				sendJSONError(w, "The role is the default role of a login method", http.StatusConflict, "")
+				return
+			}
+		}
+
+		err := auth.DeleteRole(name)
+		recordAudit(r, audit.ActionRoleDelete, name, err, "")
+		if err != nil {
+			sendRoleError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Role deleted successfully",
+		})
+
+	default:
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+	}
+}
+
+// GroupsHandler lets user managers list, define and remove groups
+func GroupsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"groups":  auth.ListGroups(),
+		})
+
+	case http.MethodPost:
+		var req auth.Group
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendJSONError(w, "Invalid request payload", http.StatusBadRequest, err.Error())
+			return
+		}
+		defer r.Body.Close()
+
+		req.Name = strings.TrimSpace(req.Name)
+		req.Description = strings.TrimSpace(req.Description)
+
+		members := []string{}
+		for _, member := range req.Members {
+			member = strings.TrimSpace(member)
+			if member == "" || slices.Contains(members, member) {
+				continue
+			}
+			if _, err := GetUserByUsername(member); err != nil {
+				sendJSONError(w, "Unknown user "+member, http.StatusBadRequest, "")
+				return
+			}
+			members = append(members, member)
+		}
+		req.Members = members
+
+		// Members get the permissions of all roles of the group
+		if !canGrant(auth.GetSession(r), rolePermissions(req.Roles...)) {
+			sendJSONError(w, errGrantBeyondOwn, http.StatusForbidden, "")
+			return
+		}
+
+		previous, existed := findGroup(req.Name)
+		if err := auth.SaveGroup(req); err != nil {
+			recordAudit(r, audit.ActionGroupSave, req.Name, err, "")
+			sendRoleError(w, err)
+			return
+		}
+		if existed && userManagers() == 0 {
+			auth.SaveGroup(previous)
+			sendJSONError(w, "Nobody would be left to manage users", http.StatusBadRequest, "")
+			return
+		}
+		recordAudit(r, audit.ActionGroupSave, req.Name, nil, "roles "+strings.Join(req.Roles, ", ")+"; members "+strings.Join(req.Members, ", "))
+
+		message := "Group updated successfully"
+		if !existed {
+			message = "Group created successfully"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": message,
+		})
+
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		previous, existed := findGroup(name)
+		if !existed {
+			sendJSONError(w, "Group not found", http.StatusNotFound, "")
+			return
+		}
+		if err := auth.DeleteGroup(name); err != nil {
+			recordAudit(r, audit.ActionGroupDelete, name, err, "")
+			sendRoleError(w, err)
+			return
+		}
+		if userManagers() == 0 {
+			auth.SaveGroup(previous)
+			sendJSONError(w, "Nobody would be left to manage users", http.StatusBadRequest, "")
+			return
+		}
+		recordAudit(r, audit.ActionGroupDelete, name, nil, "")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Group deleted successfully",
+		})
+
+	default:
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+	}
+}
+
+// sendRoleError answers a failed change to a role or group
+func sendRoleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrUnknownGroup):
+		sendJSONError(w, err.Error(), http.StatusNotFound, "")
+	case errors.Is(err, auth.ErrInvalidName), errors.Is(err, auth.ErrBuiltinRole),
+		errors.Is(err, auth.ErrUnknownRole), errors.Is(err, auth.ErrUnknownPermission):
+		sendJSONError(w, err.Error(), http.StatusBadRequest, "")
+	default:
+		sendJSONError(w, "Failed to save roles and groups", http.StatusInternalServerError, err.Error())
+	}
+}
+
+// findCustomRole returns the custom role with the given name
+func findCustomRole(name string) (auth.CustomRole, bool) {
+	for _, role := range auth.ListRoles() {
+		if !role.Builtin && role.Name == name {
+			return role.CustomRole, true
+		}
+	}
+	return auth.CustomRole{}, false
+}
+
+// findGroup returns the group with the given name
+func findGroup(name string) (auth.Group, bool) {
+	for _, group := range auth.ListGroups() {
+		if group.Name == name {
+			return group, true
+		}
+	}
+	return auth.Group{}, false
+}
+
+// errGrantBeyondOwn answers an attempt to hand out permissions the caller doesn't have
+const errGrantBeyondOwn = "You can't grant permissions you don't have yourself"
+
+// canGrant reports whether a session may hand out permissions. User managers may only grant
+// what they can do themselves, so that user.manage alone doesn't lead to everything else.
+func canGrant(session *auth.Session, permissions []string) bool {
+	held := auth.Permissions(session)
+	for _, permission := range permissions {
+		if !slices.Contains(held, permission) {
+			return false
+		}
+	}
+	return true
+}
+
+// rolePermissions returns the permissions of the given roles together
+func rolePermissions(names ...string) []string {
+	var permissions []string
+	for _, name := range names {
+		permissions = append(permissions, auth.RolePermissions(name)...)
+	}
+	return permissions
+}
+
+// userManagers counts the enabled users that may manage users, directly or through a group
+func userManagers() int {
+	count := 0
+	for _, user := range users.List() {
+		if !user.Disabled && userCanManage(user) {
+			count++
+		}
+	}
+	return count
+}
+
+// userCanManage reports whether a user may manage users
+func userCanManage(user users.User) bool {
+	return auth.Can(&auth.Session{Username: user.Username, Role: user.Role}, roles.PermUserManage)
+}
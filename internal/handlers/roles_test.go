@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"wiki-go/internal/acl"
+	"wiki-go/internal/auth"
+	"wiki-go/internal/config"
+	"wiki-go/internal/roles"
+	"wiki-go/internal/users"
+)
+
+// setupTestWiki points the handlers at an empty wiki in a temporary directory
+func setupTestWiki(t *testing.T) {
+	t.Helper()
+	cfg = &config.Config{}
+	cfg.Wiki.RootDir = t.TempDir()
+	cfg.Wiki.DocumentsDir = "documents"
+
+	acl.Init(cfg)
+	if err := users.Init(filepath.Join(cfg.Wiki.RootDir, "users.json")); err != nil {
+		t.Fatalf("Failed to open the user store: %v", err)
+	}
+	for name, init := range map[string]func(*config.Config) error{
+		"sessions":    auth.InitSessions,
+		"roles":       auth.InitPermissions,
+		"invitations": auth.InitInvitations,
+	} {
+		if err := init(cfg); err != nil {
+			t.Fatalf("Failed to load %s: %v", name, err)
+		}
+	}
+}
+
+// loginAs creates a user with the given role and returns a request factory carrying their session
+func loginAs(t *testing.T, username, role string) func(method, target, body string) *http.Request {
+	t.Helper()
+	if _, exists := users.Get(username); !exists {
+		if err := users.Create(users.User{Username: username, Role: role}); err != nil {
+			t.Fatalf("Failed to create %s: %v", username, err)
+		}
+	}
+	rec := httptest.NewRecorder()
+	if err := auth.CreateSession(rec, httptest.NewRequest(http.MethodGet, "/", nil), username, role, false, cfg); err != nil {
+		t.Fatalf("Failed to log in %s: %v", username, err)
+	}
+	cookies := rec.Result().Cookies()
+
+	return func(method, target, body string) *http.Request {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		return r
+	}
+}
+
+func TestGrantBeyondOwnPermissions(t *testing.T) {
+	setupTestWiki(t)
+	if err := auth.SaveRole(auth.CustomRole{Name: "user-admin", Permissions: []string{roles.PermUserManage}}); err != nil {
+		t.Fatalf("Failed to save role: %v", err)
+	}
+	if err := users.Create(users.User{Username: "jane", Role: roles.RoleViewer}); err != nil {
+		t.Fatalf("Failed to create jane: %v", err)
+	}
+	manager := loginAs(t, "manager", "user-admin")
+	admin := loginAs(t, "root", roles.RoleAdmin)
+
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		request  *http.Request
+		expected int
+	}{
+		{
+			name:     "Role with a permission the manager lacks",
+			handler:  RolesHandler,
+			request:  manager(http.MethodPost, "/api/roles", `{"name":"publisher","permissions":["page.edit"]}`),
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "Role within the manager's permissions",
+			handler:  RolesHandler,
+			request:  manager(http.MethodPost, "/api/roles", `{"name":"helpdesk","permissions":["user.manage"]}`),
+			expected: http.StatusOK,
+		},
+		{
+			name:     "Role created by an admin",
+			handler:  RolesHandler,
+			request:  admin(http.MethodPost, "/api/roles", `{"name":"publisher","permissions":["page.edit","settings.manage"]}`),
+			expected: http.StatusOK,
+		},
+		{
+			name:     "Group with the admin role",
+			handler:  GroupsHandler,
+			request:  manager(http.MethodPost, "/api/groups", `{"name":"owners","roles":["admin"],"members":["manager"]}`),
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "Group with the manager's own role",
+			handler:  GroupsHandler,
+			request:  manager(http.MethodPost, "/api/groups", `{"name":"helpers","roles":["user-admin"],"members":["jane"]}`),
+			expected: http.StatusOK,
+		},
+		{
+			name:     "Promoting a user to admin",
+			handler:  UpdateUserHandler,
+			request:  manager(http.MethodPut, "/api/users", `{"username":"jane","role":"admin"}`),
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "Changing a user's email without touching the role",
+			handler:  UpdateUserHandler,
+			request:  manager(http.MethodPut, "/api/users", `{"username":"jane","email":"jane@example.com"}`),
+			expected: http.StatusOK,
+		},
+		{
+			name:     "Promoting a user as admin",
+			handler:  UpdateUserHandler,
+			request:  admin(http.MethodPut, "/api/users", `{"username":"jane","role":"editor"}`),
+			expected: http.StatusOK,
+		},
+		{
+			name:     "Creating an editor",
+			handler:  CreateUserHandler,
+			request:  manager(http.MethodPost, "/api/users", `{"username":"joe","password":"a long enough password","role":"editor"}`),
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "Creating a viewer",
+			handler:  CreateUserHandler,
+			request:  manager(http.MethodPost, "/api/users", `{"username":"joe","password":"a long enough password","role":"viewer"}`),
+			expected: http.StatusCreated,
+		},
+		{
+			name:     "Inviting an admin",
+			handler:  InvitationsHandler,
+			request:  manager(http.MethodPost, "/api/invitations", `{"role":"admin"}`),
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "Inviting a viewer",
+			handler:  InvitationsHandler,
+			request:  manager(http.MethodPost, "/api/invitations", `{"role":"viewer"}`),
+			expected: http.StatusCreated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler(rec, tt.request)
+			if rec.Code != tt.expected {
+				t.Errorf("Expected status %d, got: %d (%s)", tt.expected, rec.Code, strings.TrimSpace(rec.Body.String()))
+			}
+		})
+	}
+
+	if user, _ := users.Get("jane"); user.Role != roles.RoleEditor {
+		t.Errorf("Expected jane to be an editor after the admin's change, got: %s", user.Role)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 	"strings"
 
+	"wiki-go/internal/acl"
+	"wiki-go/internal/auth"
 	"wiki-go/internal/config"
 )
 
@@ -32,7 +34,14 @@ func SearchHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
 		return
 	}
 
-	results := performSearch(req.Query, cfg.Wiki.RootDir, cfg.Wiki.DocumentsDir)
+	// Documents the user, or their token, may not read don't show up, not even as a title
+	session := auth.GetSession(r)
+	results := []SearchResult{}
+	for _, result := range performSearch(req.Query, cfg.Wiki.RootDir, cfg.Wiki.DocumentsDir) {
+		if acl.CanRead(session, result.Path) && session.AllowsPath(result.Path) {
+			results = append(results, result)
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(results)
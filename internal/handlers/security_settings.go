@@ -4,7 +4,11 @@ import (
     "encoding/json"
     "net/http"
     "os"
+    "strings"
     "sync"
+    "wiki-go/internal/audit"
+    "wiki-go/internal/auth"
+    "wiki-go/internal/ban"
     "wiki-go/internal/config"
 )
 
@@ -13,12 +17,25 @@ var securityMu sync.Mutex
 // SecuritySettings represents the JSON payload for security settings.
 type SecuritySettings struct {
     LoginBan struct {
-        Enabled           bool `json:"enabled"`
-        MaxFailures       int  `json:"max_failures"`
-        WindowSeconds     int  `json:"window_seconds"`
-        InitialBanSeconds int  `json:"initial_ban_seconds"`
-        MaxBanSeconds     int  `json:"max_ban_seconds"`
+        Enabled           bool   `json:"enabled"`
+        MaxFailures       int    `json:"max_failures"`
+        WindowSeconds     int    `json:"window_seconds"`
+        InitialBanSeconds int    `json:"initial_ban_seconds"`
+        MaxBanSeconds     int    `json:"max_ban_seconds"`
+        Allowlist         string `json:"allowlist"`
     } `json:"login_ban"`
+    TwoFactor struct {
+        RequireForAdmins  bool `json:"require_for_admins"`
+        RequireForEditors bool `json:"require_for_editors"`
+    } `json:"two_factor"`
+    PasswordPolicy struct {
+        MinLength     int  `json:"min_length"`
+        CheckBreached bool `json:"check_breached"`
+    } `json:"password_policy"`
+    Registration struct {
+        Enabled     bool   `json:"enabled"`
+        DefaultRole string `json:"default_role"`
+    } `json:"registration"`
 }
 
 // SecuritySettingsHandler handles GET (read) and POST (update) of security settings.
@@ -42,6 +59,13 @@ func handleGetSecurity(w http.ResponseWriter, r *http.Request) {
     resp.LoginBan.WindowSeconds = cfg.Security.LoginBan.WindowSeconds
     resp.LoginBan.InitialBanSeconds = cfg.Security.LoginBan.InitialBanSeconds
     resp.LoginBan.MaxBanSeconds = cfg.Security.LoginBan.MaxBanSeconds
+    resp.LoginBan.Allowlist = cfg.Security.LoginBan.Allowlist
+    resp.TwoFactor.RequireForAdmins = cfg.Security.TwoFactor.RequireForAdmins
+    resp.TwoFactor.RequireForEditors = cfg.Security.TwoFactor.RequireForEditors
+    resp.PasswordPolicy.MinLength = cfg.Security.PasswordPolicy.MinLength
+    resp.PasswordPolicy.CheckBreached = cfg.Security.PasswordPolicy.CheckBreached
+    resp.Registration.Enabled = cfg.Security.Registration.Enabled
+    resp.Registration.DefaultRole = cfg.Security.Registration.DefaultRole
 
     json.NewEncoder(w).Encode(resp)
 }
@@ -54,10 +78,22 @@ func handleUpdateSecurity(w http.ResponseWriter, r *http.Request) {
     }
 
     // Basic validation
-    if req.LoginBan.MaxFailures <= 0 || req.LoginBan.WindowSeconds <= 0 || req.LoginBan.InitialBanSeconds <= 0 || req.LoginBan.MaxBanSeconds < req.LoginBan.InitialBanSeconds {
+    if req.LoginBan.MaxFailures <= 0 || req.LoginBan.WindowSeconds <= 0 || req.LoginBan.InitialBanSeconds <= 0 || req.LoginBan.MaxBanSeconds < req.LoginBan.InitialBanSeconds || req.PasswordPolicy.MinLength < 1 || req.PasswordPolicy.MinLength > 128 {
         http.Error(w, "Invalid values", http.StatusBadRequest)
         return
     }
+    if _, err := ban.ParseAllowlist(req.LoginBan.Allowlist); err != nil {
+        http.Error(w, "Invalid login ban allowlist: "+err.Error(), http.StatusBadRequest)
+        return
+    }
+    req.LoginBan.Allowlist = strings.TrimSpace(req.LoginBan.Allowlist)
+    if req.Registration.DefaultRole == "" {
+        req.Registration.DefaultRole = config.RoleViewer
+    }
+    if !auth.RoleExists(req.Registration.DefaultRole) {
+        http.Error(w, "Unknown role for registrations", http.StatusBadRequest)
+        return
+    }
 
     securityMu.Lock()
     defer securityMu.Unlock()
@@ -68,14 +104,22 @@ func handleUpdateSecurity(w http.ResponseWriter, r *http.Request) {
     cfg.Security.LoginBan.WindowSeconds = req.LoginBan.WindowSeconds
     cfg.Security.LoginBan.InitialBanSeconds = req.LoginBan.InitialBanSeconds
     cfg.Security.LoginBan.MaxBanSeconds = req.LoginBan.MaxBanSeconds
+    cfg.Security.LoginBan.Allowlist = req.LoginBan.Allowlist
+    cfg.Security.TwoFactor.RequireForAdmins = req.TwoFactor.RequireForAdmins
+    cfg.Security.TwoFactor.RequireForEditors = req.TwoFactor.RequireForEditors
+    cfg.Security.PasswordPolicy.MinLength = req.PasswordPolicy.MinLength
+    cfg.Security.PasswordPolicy.CheckBreached = req.PasswordPolicy.CheckBreached
+    cfg.Security.Registration.Enabled = req.Registration.Enabled
+    cfg.Security.Registration.DefaultRole = req.Registration.DefaultRole
 
     // Persist to disk
     // Reuse SaveConfig with config.ConfigFilePath
     f, err := os.Create(config.ConfigFilePath)
     if err == nil {
-        _ = config.SaveConfig(cfg, f)
+        err = config.SaveConfig(cfg, f)
         f.Close()
     }
+    recordAudit(r, audit.ActionSettingsSecurity, "security", err, "")
 
     // Reinitialise ban list with new policy
     InitLoginBan(cfg)
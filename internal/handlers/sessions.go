@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"wiki-go/internal/audit"
+	"wiki-go/internal/auth"
+	"wiki-go/internal/roles"
+)
+
+// SessionResponse represents a session in the response
+type SessionResponse struct {
+	auth.SessionInfo
+	Current bool `json:"current"` // The session the request was made with
+}
+
+// SessionsHandler lets users list and revoke their own sessions
+func SessionsHandler(w http.ResponseWriter, r *http.Request) {
+	session := auth.GetSession(r)
+	if session == nil {
+		sendJSONError(w, "Unauthorized", http.StatusUnauthorized, "")
+		return
+	}
+
+	// Sessions are managed from a logged in session, not with tokens
+	if session.TokenID != "" {
+		sendJSONError(w, "Sessions can only be managed from a logged in session", http.StatusForbidden, "")
+		return
+	}
+	currentID := auth.SessionID(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		sessions := []SessionResponse{}
+		for _, info := range auth.ListSessions(session.Username) {
+			sessions = append(sessions, SessionResponse{SessionInfo: info, Current: info.ID == currentID})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":  true,
+			"sessions": sessions,
+		})
+
+	case http.MethodDelete:
+		// Either a single session, or all sessions except the current one
+		if r.URL.Query().Get("others") == "true" {
+			count := auth.RevokeUserSessions(session.Username, currentID)
+			recordAudit(r, audit.ActionSessionRevoke, session.Username, nil, fmt.Sprintf("other sessions, %d revoked", count))
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": true,
+				"message": "Other sessions revoked",
+				"count":   count,
+			})
+			return
+		}
+
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			sendJSONError(w, "Session ID is required", http.StatusBadRequest, "")
+			return
+		}
+		// The entry is made first, the request has no session to name the actor once its own is revoked
+		entry := auditEntry(r, audit.ActionSessionRevoke, session.Username, nil, "session "+id)
+		if !auth.RevokeSession(session.Username, id) {
+			sendJSONError(w, "Session not found", http.StatusNotFound, "")
+			return
+		}
+		audit.Record(entry)
+
+		// Revoking the current session logs the user out, so clear the cookies too
+		if id == currentID {
+			auth.ClearSession(w, r, cfg)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Session revoked",
+		})
+
+	default:
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+	}
+}
+
+// UserSessionsHandler lets admins list and revoke the sessions of any user
+func UserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	// Check if user is authenticated and may manage users
+	session := auth.GetSession(r)
+	if !auth.Can(session, roles.PermUserManage) {
+		sendJSONError(w, "Unauthorized", http.StatusUnauthorized, "")
+		return
+	}
+
+	username := r.URL.Query().Get("username")
+	if username == "" {
+		sendJSONError(w, "Username is required", http.StatusBadRequest, "")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":  true,
+			"sessions": auth.ListSessions(username),
+		})
+
+	case http.MethodDelete:
+		entry := auditEntry(r, audit.ActionSessionRevoke, username, nil, "")
+		count := auth.RevokeUserSessions(username, "")
+		entry.Details = fmt.Sprintf("all sessions, %d revoked", count)
+		audit.Record(entry)
+		if username == session.Username {
+			auth.ClearSession(w, r, cfg)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Sessions revoked",
+			"count":   count,
+		})
+
+	default:
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"wiki-go/internal/audit"
+	"wiki-go/internal/auth"
+	"wiki-go/internal/roles"
+)
+
+// auditEntries returns the entries of an action in the test wiki's audit log, newest first
+func auditEntries(t *testing.T, action string) []audit.Entry {
+	t.Helper()
+	entries, err := audit.Query(audit.Filter{Action: action})
+	if err != nil {
+		t.Fatalf("Failed to query the audit log: %v", err)
+	}
+	return entries
+}
+
+func TestSessionRevocationAudited(t *testing.T) {
+	setupTestWiki(t)
+	if err := audit.Init(cfg); err != nil {
+		t.Fatalf("Failed to open the audit log: %v", err)
+	}
+	jane := loginAs(t, "jane", roles.RoleEditor)
+	loginAs(t, "bob", roles.RoleViewer)
+	loginAs(t, "bob", roles.RoleViewer)
+	admin := loginAs(t, "root", roles.RoleAdmin)
+
+	// Jane revokes the session she is using, which leaves the request without one
+	r := jane(http.MethodDelete, "/api/sessions", "")
+	r.URL.RawQuery = "id=" + auth.SessionID(r)
+	rec := httptest.NewRecorder()
+	SessionsHandler(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got: %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	UserSessionsHandler(rec, admin(http.MethodDelete, "/api/users/sessions?username=bob", ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got: %d", rec.Code)
+	}
+
+	entries := auditEntries(t, audit.ActionSessionRevoke)
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 session.revoke entries, got: %d", len(entries))
+	}
+	if entries[0].Actor != "root" || entries[0].Target != "bob" || entries[0].Details != "all sessions, 2 revoked" {
+		t.Errorf("Unexpected entry for the admin revoking bob's sessions: %+v", entries[0])
+	}
+	if entries[1].Actor != "jane" || entries[1].Target != "jane" || !strings.HasPrefix(entries[1].Details, "session ") {
+		t.Errorf("Unexpected entry for jane revoking her session: %+v", entries[1])
+	}
+
+	// A session that doesn't exist isn't recorded
+	rec = httptest.NewRecorder()
+	SessionsHandler(rec, admin(http.MethodDelete, "/api/sessions?id=unknown", ""))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got: %d", rec.Code)
+	}
+	if entries := auditEntries(t, audit.ActionSessionRevoke); len(entries) != 2 {
+		t.Errorf("Expected no entry for an unknown session, got: %d entries", len(entries))
+	}
+}
+
+func TestTwoFactorResetAudited(t *testing.T) {
+	setupTestWiki(t)
+	if err := audit.Init(cfg); err != nil {
+		t.Fatalf("Failed to open the audit log: %v", err)
+	}
+	totp := `{"jane": {"secret": "JBSWY3DPEHPK3PXP", "enabled": true}}`
+	if err := os.WriteFile(filepath.Join(cfg.Wiki.RootDir, "totp.json"), []byte(totp), 0600); err != nil {
+		t.Fatalf("Failed to write totp.json: %v", err)
+	}
+	if err := auth.InitTOTP(cfg); err != nil {
+		t.Fatalf("Failed to load second factors: %v", err)
+	}
+	admin := loginAs(t, "root", roles.RoleAdmin)
+
+	tests := []struct {
+		name     string
+		username string
+		expected int
+	}{
+		{name: "User with two-factor authentication", username: "jane", expected: http.StatusOK},
+		{name: "User without it", username: "bob", expected: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			UserTwoFactorHandler(rec, admin(http.MethodDelete, "/api/users/2fa?username="+tt.username, ""))
+			if rec.Code != tt.expected {
+				t.Errorf("Expected status %d, got: %d", tt.expected, rec.Code)
+			}
+		})
+	}
+
+	entries := auditEntries(t, audit.ActionUser2FAReset)
+	if len(entries) != 1 || entries[0].Actor != "root" || entries[0].Target != "jane" {
+		t.Errorf("Expected a single user.2fa_reset entry by root for jane, got: %+v", entries)
+	}
+	if auth.TOTPEnabled("jane") {
+		t.Error("Expected jane's second factor to be reset")
+	}
+}
@@ -6,9 +6,11 @@ import (
 	"net/http"
 	"os"
 	"time"
+	"wiki-go/internal/audit"
 	"wiki-go/internal/auth"
 	"wiki-go/internal/config"
 	"wiki-go/internal/i18n"
+	"wiki-go/internal/roles"
 )
 
 // WikiSettingsRequest represents the request body for updating wiki settings
@@ -60,9 +62,9 @@ func WikiSettingsHandler(w http.ResponseWriter, r *http.Request) {
 
 // GetWikiSettingsHandler handles requests to get the current wiki settings
 func GetWikiSettingsHandler(w http.ResponseWriter, r *http.Request) {
-	// Check if user is authenticated and has admin or editor role
+	// Check if user is authenticated and may manage settings
 	session := auth.GetSession(r)
-	if session == nil || (session.Role != config.RoleAdmin && session.Role != config.RoleEditor) {
+	if !auth.Can(session, roles.PermSettingsManage) {
 		sendJSONError(w, "Unauthorized", http.StatusUnauthorized, "")
 		return
 	}
@@ -92,9 +94,9 @@ func GetWikiSettingsHandler(w http.ResponseWriter, r *http.Request) {
 
 // UpdateWikiSettingsHandler handles requests to update the wiki settings
 func UpdateWikiSettingsHandler(w http.ResponseWriter, r *http.Request) {
-	// Check if user is authenticated and has admin role
+	// Check if user is authenticated and may manage settings
 	session := auth.GetSession(r)
-	if session == nil || session.Role != config.RoleAdmin {
+	if !auth.Can(session, roles.PermSettingsManage) {
 		sendJSONError(w, "Unauthorized", http.StatusUnauthorized, "")
 		return
 	}
@@ -138,7 +140,9 @@ func UpdateWikiSettingsHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Save the updated config to file
 	configPath := config.ConfigFilePath
-	if err := saveConfig(configPath, &updatedConfig); err != nil {
+	err := saveConfig(configPath, &updatedConfig)
+	recordAudit(r, audit.ActionSettingsWiki, "wiki", err, "")
+	if err != nil {
 		sendJSONError(w, "Failed to save configuration", http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+	"wiki-go/internal/acl"
 	"wiki-go/internal/auth"
 	"wiki-go/internal/config"
 	"wiki-go/internal/resources"
@@ -66,14 +67,11 @@ func SitemapHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config)
 	baseURL := getBaseURL(r, cfg)
 
 	// Get current user role for conditional display in HTML sitemap
-	userRole := ""
 	session := auth.CheckAuth(r)
-	if session != nil {
-		userRole = session.Role
-	}
+	userRole, _ := pagePermissions(session, true)
 
 	// Gather all pages
-	urls, pageEntries, err := gatherPages(baseURL, cfg)
+	urls, pageEntries, err := gatherPages(baseURL, cfg, session)
 	if err != nil {
 		http.Error(w, "Error generating sitemap: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -168,8 +166,8 @@ func renderHTMLSitemap(w http.ResponseWriter, r *http.Request, pages []SitemapPa
 	}
 }
 
-// gatherPages collects all pages for the sitemap
-func gatherPages(baseURL string, cfg *config.Config) ([]SitemapURL, []SitemapPageEntry, error) {
+// gatherPages collects all pages for the sitemap that session may read
+func gatherPages(baseURL string, cfg *config.Config, session *auth.Session) ([]SitemapURL, []SitemapPageEntry, error) {
 	urls := []SitemapURL{}
 	pageEntries := []SitemapPageEntry{}
 
@@ -218,6 +216,11 @@ func gatherPages(baseURL string, cfg *config.Config) ([]SitemapURL, []SitemapPag
 				return nil
 			}
 
+			// Skip documents the user may not read
+			if !acl.CanRead(session, relDirPath) {
+				return nil
+			}
+
 			// Format last modified time for XML
 			lastModStr := info.ModTime().Format(time.RFC3339)
 
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"wiki-go/internal/audit"
+	"wiki-go/internal/auth"
+)
+
+// TokenCreateRequest represents the request body for creating a personal access token
+type TokenCreateRequest struct {
+	Name          string `json:"name"`
+	Scope         string `json:"scope"`         // "read" or "write"
+	Path          string `json:"path"`          // Optional document path the token is limited to
+	ExpiresInDays int    `json:"expiresInDays"` // 0 for a token that doesn't expire
+}
+
+// TokensHandler lets users list, create and revoke their personal access tokens
+func TokensHandler(w http.ResponseWriter, r *http.Request) {
+	session := auth.GetSession(r)
+	if session == nil {
+		sendJSONError(w, "Unauthorized", http.StatusUnauthorized, "")
+		return
+	}
+
+	// Tokens can't be used to mint or revoke tokens
+	if session.TokenID != "" {
+		sendJSONError(w, "Tokens can only be managed from a logged in session", http.StatusForbidden, "")
+		return
+	}
+
+	// Tokens act with the role of a wiki user, which users of the reverse proxy aren't
+	if session.ViaProxy {
+		sendJSONError(w, "Tokens are not available to users logged in through the reverse proxy", http.StatusForbidden, "")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"tokens":  auth.ListTokens(session.Username),
+		})
+
+	case http.MethodPost:
+		var req TokenCreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendJSONError(w, "Invalid request payload", http.StatusBadRequest, err.Error())
+			return
+		}
+		defer r.Body.Close()
+
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			sendJSONError(w, "Token name is required", http.StatusBadRequest, "")
+			return
+		}
+		if req.Scope != auth.ScopeRead && req.Scope != auth.ScopeWrite {
+			sendJSONError(w, "Scope must be read or write", http.StatusBadRequest, "")
+			return
+		}
+		if req.ExpiresInDays < 0 {
+			sendJSONError(w, "Expiry must not be negative", http.StatusBadRequest, "")
+			return
+		}
+
+		var expiresAt *time.Time
+		if req.ExpiresInDays > 0 {
+			expiry := time.Now().AddDate(0, 0, req.ExpiresInDays)
+			expiresAt = &expiry
+		}
+
+		token, info, err := auth.CreateToken(session.Username, req.Name, req.Scope, req.Path, expiresAt)
+		if err != nil {
+			recordAudit(r, audit.ActionTokenCreate, "", err, "")
+			sendJSONError(w, "Failed to create token", http.StatusInternalServerError, err.Error())
+			return
+		}
+		details := info.Name + ", scope " + info.Scope
+		if info.Path != "" {
+			details += ", path " + info.Path
+		}
+		recordAudit(r, audit.ActionTokenCreate, info.ID, nil, details)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Token created. Copy it now, it won't be shown again.",
+			"token":   token,
+			"info":    info,
+		})
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			sendJSONError(w, "Token ID is required", http.StatusBadRequest, "")
+			return
+		}
+		if !auth.RevokeToken(session.Username, id) {
+			sendJSONError(w, "Token not found", http.StatusNotFound, "")
+			return
+		}
+		recordAudit(r, audit.ActionTokenRevoke, id, nil, "")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Token revoked",
+		})
+
+	default:
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+	}
+}
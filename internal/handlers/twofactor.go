@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"wiki-go/internal/audit"
+	"wiki-go/internal/auth"
+	"wiki-go/internal/qrcode"
+	"wiki-go/internal/roles"
+)
+
+// TwoFactorCodeRequest carries a code from an authenticator app, or a recovery code
+type TwoFactorCodeRequest struct {
+	Challenge string `json:"challenge,omitempty"` // Pending login, for the second login step
+	Code      string `json:"code"`
+}
+
+// TwoFactorSetupResponse is what an authenticator app needs to be set up
+type TwoFactorSetupResponse struct {
+	Success bool   `json:"success"`
+	Secret  string `json:"secret"` // For typing into the app by hand
+	URI     string `json:"uri"`    // otpauth:// URI
+	QRCode  string `json:"qrCode"` // The URI as an SVG QR code
+}
+
+// twoFactorSetup starts enrolment for the user and writes what the app needs
+func twoFactorSetup(w http.ResponseWriter, username string) {
+	secret, uri, err := auth.BeginTOTPEnrollment(username, cfg.Wiki.Title)
+	if err != nil {
+		sendJSONError(w, err.Error(), http.StatusConflict, "")
+		return
+	}
+
+	resp := TwoFactorSetupResponse{Success: true, Secret: secret, URI: uri}
+	if code, err := qrcode.Encode(uri); err == nil {
+		resp.QRCode = code.SVG()
+	} else {
+		log.Printf("Failed to encode two-factor QR code: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// codeBanned reports whether the client is banned from trying codes, and writes the response if so
+func codeBanned(w http.ResponseWriter, ip string) bool {
+	if loginBan == nil {
+		return false
+	}
+	if remaining := loginBan.IsBanned(ip); remaining > 0 {
+		writeBanned(w, int(remaining.Seconds()))
+		return true
+	}
+	return false
+}
+
+// codeFailed counts a wrong code like a wrong password, and writes the response
+func codeFailed(w http.ResponseWriter, ip string) {
+	if loginBan != nil {
+		if dur, bannedNow := loginBan.RegisterFailure(ip); bannedNow {
+			writeBanned(w, int(dur.Seconds()))
+			return
+		}
+	}
+	sendJSONError(w, "Invalid code", http.StatusUnauthorized, "")
+}
+
+// writeBanned tells the client to wait before trying again
+func writeBanned(w http.ResponseWriter, seconds int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    false,
+		"retryAfter": seconds,
+		"message":    "Too many failed logins; try again later",
+	})
+}
+
+// LoginTwoFactorHandler completes a login with the code of the user's authenticator app or a
+// recovery code. For users who have to set up two-factor authentication first, the code confirms
+// the new setup and the response carries their recovery codes.
+func LoginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSONError(w, "Invalid request body", http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ip := auth.ClientIP(r)
+	if codeBanned(w, ip) {
+		return
+	}
+
+	challenge := auth.GetLoginChallenge(req.Challenge)
+	if challenge == nil {
+		sendJSONError(w, "Login expired, please log in again", http.StatusUnauthorized, "")
+		return
+	}
+
+	var recoveryCodes []string
+	if challenge.Setup {
+		codes, err := auth.ConfirmTOTPEnrollment(challenge.Username, req.Code)
+		if err != nil {
+			auth.FailLoginChallenge(req.Challenge)
+			recordLogin(r, challenge.Username, audit.OutcomeFailure, "invalid two-factor code")
+			codeFailed(w, ip)
+			return
+		}
+		recoveryCodes = codes
+	} else if !auth.VerifyTOTP(challenge.Username, req.Code) {
+		auth.FailLoginChallenge(req.Challenge)
+		recordLogin(r, challenge.Username, audit.OutcomeFailure, "invalid two-factor code")
+		codeFailed(w, ip)
+		return
+	}
+
+	auth.CompleteLoginChallenge(req.Challenge)
+	if loginBan != nil {
+		loginBan.Clear(ip)
+	}
+
+	if err := auth.CreateSession(w, r, challenge.Username, challenge.Role, challenge.KeepLoggedIn, cfg); err != nil {
+		sendJSONError(w, "Failed to create session", http.StatusInternalServerError, "")
+		return
+	}
+	recordLogin(r, challenge.Username, audit.OutcomeSuccess, "two-factor")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"message":       "Login successful",
+		"recoveryCodes": recoveryCodes,
+	})
+}
+
+// LoginTwoFactorSetupHandler lets a user who must use two-factor authentication set it up during
+// the login, before they have a session
+func LoginTwoFactorSetupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSONError(w, "Invalid request body", http.StatusBadRequest, err.Error())
+		return
+	}
+
+	challenge := auth.GetLoginChallenge(req.Challenge)
+	if challenge == nil || !challenge.Setup {
+		sendJSONError(w, "Login expired, please log in again", http.StatusUnauthorized, "")
+		return
+	}
+
+	twoFactorSetup(w, challenge.Username)
+}
+
+// twoFactorSession returns the session of a logged in user who may manage their second factor
+func twoFactorSession(w http.ResponseWriter, r *http.Request) *auth.Session {
+	session := auth.GetSession(r)
+	if session == nil {
+		sendJSONError(w, "Unauthorized", http.StatusUnauthorized, "")
+		return nil
+	}
+	if session.TokenID != "" {
+		sendJSONError(w, "Two-factor authentication can only be managed from a logged in session", http.StatusForbidden, "")
+		return nil
+	}
+	// The reverse proxy handles the login of its users, second factor included
+	if session.ViaProxy {
+		sendJSONError(w, "Two-factor authentication is managed by the reverse proxy", http.StatusForbidden, "")
+		return nil
+	}
+	return session
+}
+
+// TwoFactorHandler returns the two-factor status of the current user (GET), or turns it off
+// with a valid code (DELETE)
+func TwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	session := twoFactorSession(w, r)
+	if session == nil {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":           true,
+			"enabled":           auth.TOTPEnabled(session.Username),
+			"required":          auth.TOTPRequired(cfg, session.Username, session.Role),
+			"recoveryCodesLeft": auth.TOTPRecoveryCodesLeft(session.Username),
+		})
+
+	case http.MethodDelete:
+		if auth.TOTPRequired(cfg, session.Username, session.Role) {
+			sendJSONError(w, "Two-factor authentication is required for your role", http.StatusForbidden, "")
+			return
+		}
+
+		var req TwoFactorCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendJSONError(w, "Invalid request body", http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ip := auth.ClientIP(r)
+		if codeBanned(w, ip) {
+			return
+		}
+		if auth.TOTPEnabled(session.Username) && !auth.VerifyTOTP(session.Username, req.Code) {
+			codeFailed(w, ip)
+			return
+		}
+
+		auth.DisableTOTP(session.Username)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Two-factor authentication disabled",
+		})
+
+	default:
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+	}
+}
+
+// TwoFactorSetupHandler starts setting up an authenticator app for the current user
+func TwoFactorSetupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+		return
+	}
+	session := twoFactorSession(w, r)
+	if session == nil {
+		return
+	}
+
+	twoFactorSetup(w, session.Username)
+}
+
+// TwoFactorEnableHandler confirms the setup with a code from the app and returns the recovery codes
+func TwoFactorEnableHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+		return
+	}
+	session := twoFactorSession(w, r)
+	if session == nil {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSONError(w, "Invalid request body", http.StatusBadRequest, err.Error())
+		return
+	}
+
+	codes, err := auth.ConfirmTOTPEnrollment(session.Username, req.Code)
+	if errors.Is(err, auth.ErrInvalidTOTPCode) {
+		sendJSONError(w, "Invalid code", http.StatusUnauthorized, "")
+		return
+	}
+	if err != nil {
+		sendJSONError(w, err.Error(), http.StatusConflict, "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"message":       "Two-factor authentication enabled",
+		"recoveryCodes": codes,
+	})
+}
+
+// TwoFactorRecoveryCodesHandler replaces the recovery codes of the current user
+func TwoFactorRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+		return
+	}
+	session := twoFactorSession(w, r)
+	if session == nil {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSONError(w, "Invalid request body", http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ip := auth.ClientIP(r)
+	if codeBanned(w, ip) {
+		return
+	}
+	if !auth.VerifyTOTP(session.Username, req.Code) {
+		codeFailed(w, ip)
+		return
+	}
+
+	codes, err := auth.RegenerateRecoveryCodes(session.Username)
+	if err != nil {
+		sendJSONError(w, err.Error(), http.StatusConflict, "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"recoveryCodes": codes,
+	})
+}
+
+// UserTwoFactorHandler lets user managers reset the second factor of a user who lost their device
+func UserTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	session := auth.GetSession(r)
+	if !auth.Can(session, roles.PermUserManage) {
+		sendJSONError(w, "Unauthorized", http.StatusUnauthorized, "")
+		return
+	}
+	if r.Method != http.MethodDelete {
+		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed, "")
+		return
+	}
+
+	username := r.URL.Query().Get("username")
+	if username == "" {
+		sendJSONError(w, "Username is required", http.StatusBadRequest, "")
+		return
+	}
+	if !auth.DisableTOTP(username) {
+		sendJSONError(w, "Two-factor authentication is not set up for this user", http.StatusNotFound, "")
+		return
+	}
+	recordAudit(r, audit.ActionUser2FAReset, username, nil, "")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Two-factor authentication reset",
+	})
+}
@@ -3,37 +3,58 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
+	"wiki-go/internal/audit"
 	"wiki-go/internal/auth"
 	"wiki-go/internal/config"
 	"wiki-go/internal/crypto"
+	"wiki-go/internal/roles"
+	"wiki-go/internal/users"
 )
 
 // User represents a user in the response
 type UserResponse struct {
 	Username string `json:"username"`
-	Role     string `json:"role"` // "admin", "editor", or "viewer"
+	Role     string `json:"role"`             // A built-in or custom role
+	Source   string `json:"source,omitempty"` // Set for users of an external identity provider
+	TwoFactor bool  `json:"twoFactor"`        // Whether the user set up two-factor authentication
+	Groups   []string `json:"groups"`         // Groups the user is a member of
+	DisplayName string     `json:"display_name,omitempty"`
+	Email       string     `json:"email,omitempty"`
+	Disabled    bool       `json:"disabled"`
+	Pending     bool       `json:"pending"` // Self-registered and waiting for approval
+	Created     *time.Time `json:"created,omitempty"`    // Unknown for accounts older than the user store
+	LastLogin   *time.Time `json:"last_login,omitempty"` // Unset until the first login
 }
 
 // UserCreateRequest represents the request body for creating a user
 type UserCreateRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
-	Role     string `json:"role"` // "admin", "editor", or "viewer"
+	Role     string `json:"role"` // A built-in or custom role
+	DisplayName string `json:"display_name,omitempty"`
+	Email       string `json:"email,omitempty"`
+	Disabled    bool   `json:"disabled,omitempty"`
 }
 
 // UserUpdateRequest represents the request body for updating a user
 type UserUpdateRequest struct {
 	Username    string `json:"username"`
 	NewPassword string `json:"new_password,omitempty"`
-	Role        string `json:"role"` // "admin", "editor", or "viewer"
+	Role        string `json:"role"` // A built-in or custom role, left unchanged when empty
+	DisplayName *string `json:"display_name,omitempty"` // Left unchanged when omitted
+	Email       *string `json:"email,omitempty"`        // Left unchanged when omitted
+	Disabled    *bool   `json:"disabled,omitempty"`     // Left unchanged when omitted
 }
 
 // UsersHandler handles user management endpoints
 func UsersHandler(w http.ResponseWriter, r *http.Request) {
-	// Check if user is authenticated and has admin role
+	// Check if user is authenticated and may manage users
 	session := auth.GetSession(r)
-	if session == nil || session.Role != config.RoleAdmin {
+	if !auth.Can(session, roles.PermUserManage) {
 		sendJSONError(w, "Unauthorized", http.StatusUnauthorized, "")
 		return
 	}
@@ -54,24 +75,34 @@ func UsersHandler(w http.ResponseWriter, r *http.Request) {
 
 // GetUsersHandler returns a list of all users (without passwords)
 func GetUsersHandler(w http.ResponseWriter, r *http.Request) {
-	// Check if user is authenticated and has admin role
+	// Check if user is authenticated and may manage users
 	session := auth.GetSession(r)
-	if session == nil || session.Role != config.RoleAdmin {
+	if !auth.Can(session, roles.PermUserManage) {
 		sendJSONError(w, "Unauthorized", http.StatusUnauthorized, "")
 		return
 	}
 
 	// Convert users to response objects (without passwords)
-	users := make([]UserResponse, 0, len(cfg.Users))
-	for _, user := range cfg.Users {
+	list := users.List()
+	response := make([]UserResponse, 0, len(list))
+	for _, user := range list {
 		role := user.Role
 		if role == "" {
 			role = config.RoleViewer // Default to viewer if role not set
 		}
 		
-		users = append(users, UserResponse{
+		response = append(response, UserResponse{
 			Username: user.Username,
 			Role:     role,
+			Source:   user.Source,
+			TwoFactor: auth.TOTPEnabled(user.Username),
+			Groups:   auth.UserGroups(user.Username),
+			DisplayName: user.DisplayName,
+			Email:       user.Email,
+			Disabled:    user.Disabled,
+			Pending:     user.Pending,
+			Created:     timeOrNil(user.Created),
+			LastLogin:   timeOrNil(user.LastLogin),
 		})
 	}
 
@@ -79,15 +110,15 @@ func GetUsersHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
-		"users": users,
+		"users": response,
 	})
 }
 
 // CreateUserHandler creates a new user
 func CreateUserHandler(w http.ResponseWriter, r *http.Request) {
-	// Check if user is authenticated and has admin role
+	// Check if user is authenticated and may manage users
 	session := auth.GetSession(r)
-	if session == nil || session.Role != config.RoleAdmin {
+	if !auth.Can(session, roles.PermUserManage) {
 		sendJSONError(w, "Unauthorized", http.StatusUnauthorized, "")
 		return
 	}
@@ -107,11 +138,14 @@ func CreateUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if username already exists
-	for _, user := range cfg.Users {
-		if user.Username == req.Username {
-			sendJSONError(w, "Username already exists", http.StatusConflict, "")
-			return
-		}
+	if _, exists := users.Get(req.Username); exists {
+		sendJSONError(w, "Username already exists", http.StatusConflict, "")
+		return
+	}
+
+	if err := checkPasswordPolicy(req.Password); err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest, "")
+		return
 	}
 
 	// Hash the password
@@ -121,30 +155,33 @@ func CreateUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create a copy of the current config
-	updatedConfig := *cfg
-
 	// Validate role
-	if req.Role != config.RoleAdmin && req.Role != config.RoleEditor && req.Role != config.RoleViewer {
+	if !auth.RoleExists(req.Role) {
 		req.Role = config.RoleViewer // Default to viewer if invalid role
 	}
+	if !canGrant(session, auth.RolePermissions(req.Role)) {
+		sendJSONError(w, errGrantBeyondOwn, http.StatusForbidden, "")
+		return
+	}
 
 	// Add the new user
-	updatedConfig.Users = append(updatedConfig.Users, config.User{
-		Username: req.Username,
-		Password: hashedPassword,
-		Role: req.Role,
+	err = users.Create(users.User{
+		Username:    req.Username,
+		Password:    hashedPassword,
+		Role:        req.Role,
+		DisplayName: strings.TrimSpace(req.DisplayName),
+		Email:       strings.TrimSpace(req.Email),
+		Disabled:    req.Disabled,
 	})
-
-	// Save the updated config
-	configPath := config.ConfigFilePath
-	if err := saveConfig(configPath, &updatedConfig); err != nil {
-		sendJSONError(w, "Failed to save configuration", http.StatusInternalServerError, err.Error())
+	if errors.Is(err, users.ErrExists) {
+		sendJSONError(w, "Username already exists", http.StatusConflict, "")
+		return
+	}
+	recordAudit(r, audit.ActionUserCreate, req.Username, err, "role "+req.Role)
+	if err != nil {
+		sendJSONError(w, "Failed to save user", http.StatusInternalServerError, err.Error())
 		return
 	}
-
-	// Update the global config
-	*cfg = updatedConfig
 
 	// Send success response
 	w.Header().Set("Content-Type", "application/json")
@@ -157,9 +194,9 @@ func CreateUserHandler(w http.ResponseWriter, r *http.Request) {
 
 // UpdateUserHandler updates an existing user
 func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
-	// Check if user is authenticated and has admin role
+	// Check if user is authenticated and may manage users
 	session := auth.GetSession(r)
-	if session == nil || session.Role != config.RoleAdmin {
+	if !auth.Can(session, roles.PermUserManage) {
 		sendJSONError(w, "Unauthorized", http.StatusUnauthorized, "")
 		return
 	}
@@ -178,49 +215,109 @@ func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create a copy of the current config
-	updatedConfig := *cfg
+	// Validate role, keeping the current one when it is left out
+	if req.Role != "" && !auth.RoleExists(req.Role) {
+		sendJSONError(w, "Unknown role", http.StatusBadRequest, "")
+		return
+	}
 
-	// Validate role
-	if req.Role != config.RoleAdmin && req.Role != config.RoleEditor && req.Role != config.RoleViewer {
-		req.Role = config.RoleViewer // Default to viewer if invalid role
+	// Don't allow locking yourself out
+	if req.Disabled != nil && *req.Disabled && session.Username == req.Username {
+		sendJSONError(w, "Cannot disable your own account", http.StatusBadRequest, "")
+		return
 	}
 
-	// Find and update the user
-	userFound := false
-	for i, user := range updatedConfig.Users {
-		if user.Username == req.Username {
-			// Update the user's role
-			updatedConfig.Users[i].Role = req.Role
-			// Update password if provided
-			if req.NewPassword != "" {
-				hashedPassword, err := crypto.HashPassword(req.NewPassword)
-				if err != nil {
-					sendJSONError(w, "Failed to hash password", http.StatusInternalServerError, err.Error())
-					return
-				}
-				updatedConfig.Users[i].Password = hashedPassword
-			}
+	current, found := users.Get(req.Username)
+	if !found {
+		sendJSONError(w, "User not found", http.StatusNotFound, "")
+		return
+	}
+	if req.Role != "" && req.Role != current.Role && !canGrant(session, auth.RolePermissions(req.Role)) {
+		sendJSONError(w, errGrantBeyondOwn, http.StatusForbidden, "")
+		return
+	}
 
-			userFound = true
-			break
+	// Make sure someone is left to manage users
+	if !current.Disabled && userCanManage(current) && userManagers() <= 1 {
+		updated := current
+		if req.Role != "" {
+			updated.Role = req.Role
+		}
+		if req.Disabled != nil {
+			updated.Disabled = *req.Disabled
+		}
+		if updated.Disabled || !userCanManage(updated) {
+			sendJSONError(w, "Cannot disable or demote the last admin user", http.StatusBadRequest, "")
+			return
 		}
 	}
 
-	if !userFound {
+	// Hash the new password if provided
+	hashedPassword := ""
+	if req.NewPassword != "" {
+		if err := checkPasswordPolicy(req.NewPassword); err != nil {
+			sendJSONError(w, err.Error(), http.StatusBadRequest, "")
+			return
+		}
+		var err error
+		hashedPassword, err = crypto.HashPassword(req.NewPassword)
+		if err != nil {
+			sendJSONError(w, "Failed to hash password", http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	// Update the user
+	roleChanged := false
+	disabled := false
+	var changes []string // For the audit log
+	err := users.Update(req.Username, func(user *users.User) error {
+		if req.Role != "" && user.Role != req.Role {
+			roleChanged = true
+			changes = append(changes, "role "+user.Role+" to "+req.Role)
+			user.Role = req.Role
+		}
+		if hashedPassword != "" {
+			user.Password = hashedPassword
+			changes = append(changes, "password")
+		}
+		if req.DisplayName != nil {
+			user.DisplayName = strings.TrimSpace(*req.DisplayName)
+		}
+		if req.Email != nil {
+			user.Email = strings.TrimSpace(*req.Email)
+		}
+		if req.Disabled != nil {
+			disabled = *req.Disabled && !user.Disabled
+			if *req.Disabled != user.Disabled {
+				changes = append(changes, fmt.Sprintf("disabled %t", *req.Disabled))
+			}
+			user.Disabled = *req.Disabled
+		}
+		return nil
+	})
+	if errors.Is(err, users.ErrNotFound) {
 		sendJSONError(w, "User not found", http.StatusNotFound, "")
 		return
 	}
-
-	// Save the updated config
-	configPath := config.ConfigFilePath
-	if err := saveConfig(configPath, &updatedConfig); err != nil {
-		sendJSONError(w, "Failed to save configuration", http.StatusInternalServerError, err.Error())
+	recordAudit(r, audit.ActionUserUpdate, req.Username, err, strings.Join(changes, ", "))
+	if err != nil {
+		sendJSONError(w, "Failed to save user", http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	// Update the global config
-	*cfg = updatedConfig
+	// Existing sessions carry the old role or were opened with the old password, so end them.
+	// An admin changing their own password stays logged in on the current session. Tokens of
+	// disabled users stop working until they are enabled again.
+	if roleChanged || disabled {
+		auth.RevokeUserSessions(req.Username, "")
+	} else if req.NewPassword != "" {
+		except := ""
+		if session.Username == req.Username {
+			except = auth.SessionID(r)
+		}
+		auth.RevokeUserSessions(req.Username, except)
+	}
 
 	// Send success response
 	w.Header().Set("Content-Type", "application/json")
@@ -233,9 +330,9 @@ func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 
 // DeleteUserHandler deletes a user
 func DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
-	// Check if user is authenticated and has admin role
+	// Check if user is authenticated and may manage users
 	session := auth.GetSession(r)
-	if session == nil || session.Role != config.RoleAdmin {
+	if !auth.Can(session, roles.PermUserManage) {
 		sendJSONError(w, "Unauthorized", http.StatusUnauthorized, "")
 		return
 	}
@@ -253,47 +350,35 @@ func DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create a copy of the current config
-	updatedConfig := *cfg
-
-	// Find and remove the user
-	userFound := false
-	for i, user := range updatedConfig.Users {
-		if user.Username == username {
-			// Remove this user from the slice
-			updatedConfig.Users = append(updatedConfig.Users[:i], updatedConfig.Users[i+1:]...)
-			userFound = true
-			break
-		}
-	}
-
-	if !userFound {
+	user, found := users.Get(username)
+	if !found {
 		sendJSONError(w, "User not found", http.StatusNotFound, "")
 		return
 	}
 
-	// Make sure we don't delete the last admin
-	adminCount := 0
-	for _, user := range updatedConfig.Users {
-		if user.Role == config.RoleAdmin {
-			adminCount++
-		}
-	}
-
-	if adminCount == 0 {
+	// Make sure someone is left to manage users
+	if !user.Disabled && userCanManage(user) && userManagers() <= 1 {
 		sendJSONError(w, "Cannot delete the last admin user", http.StatusBadRequest, "")
 		return
 	}
 
-	// Save the updated config
-	configPath := config.ConfigFilePath
-	if err := saveConfig(configPath, &updatedConfig); err != nil {
-		sendJSONError(w, "Failed to save configuration", http.StatusInternalServerError, err.Error())
+	if err := users.Delete(username); err != nil {
+		if errors.Is(err, users.ErrNotFound) {
+			sendJSONError(w, "User not found", http.StatusNotFound, "")
+			return
+		}
+		recordAudit(r, audit.ActionUserDelete, username, err, "")
+		sendJSONError(w, "Failed to save user", http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	// Update the global config
-	*cfg = updatedConfig
+	// Log the deleted user out everywhere and delete their tokens
+	auth.RevokeUserSessions(username, "")
+	auth.RevokeUserTokens(username)
+	auth.RevokePasswordResets(username)
+	auth.DisableTOTP(username)
+	auth.RemoveGroupMember(username)
+	recordAudit(r, audit.ActionUserDelete, username, nil, "")
 
 	// Send success response
 	w.Header().Set("Content-Type", "application/json")
@@ -304,12 +389,72 @@ func DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// GetUserByUsername retrieves a user by username (for internal use)
-func GetUserByUsername(username string) (*config.User, error) {
-	for _, user := range cfg.Users {
-		if user.Username == username {
-			return &user, nil
+// provisionExternalUser creates a user that logged in with an external identity provider on
+// their first login, or updates their role when it changed at the provider. Local users can't be
+// taken over by an external account with the same name, and disabled users stay locked out.
+// When the provider identifies users with a subject, an account only ever belongs to the subject
+// it was created for, since usernames such as preferred_username can often be changed by users.
+// Accounts created before subjects were stored are bound to the subject of their next login.
+func provisionExternalUser(username, subject, role, source string) error {
+	if user, found := users.Get(username); found {
+		if user.Source != source {
+			return fmt.Errorf("a user named %s already exists", username)
+		}
+		if subject != "" && user.Subject != "" && user.Subject != subject {
+			return fmt.Errorf("user %s belongs to another account at the identity provider", username)
+		}
+		if user.Disabled {
+			return fmt.Errorf("user %s is disabled", username)
 		}
+		if user.Role == role && user.Subject == subject {
+			return nil
+		}
+		return users.Update(username, func(user *users.User) error {
+			user.Role = role
+			if subject != "" {
+				user.Subject = subject
+			}
+			return nil
+		})
+	}
+
+	// The password is never used: these users log in with the provider
+	secret, err := auth.GenerateSessionToken()
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := crypto.HashPassword(secret)
+	if err != nil {
+		return err
+	}
+	return users.Create(users.User{
+		Username: username,
+		Password: hashedPassword,
+		Role:     role,
+		Source:   source,
+		Subject:  subject,
+	})
+}
+
+// GetUserByUsername retrieves a user by username (for internal use)
+func GetUserByUsername(username string) (*users.User, error) {
+	user, found := users.Get(username)
+	if !found {
+		return nil, errors.New("user not found")
+	}
+	return &user, nil
+}
+
+// checkPasswordPolicy checks a new password against the configured password policy
+func checkPasswordPolicy(password string) error {
+	policy := cfg.Security.PasswordPolicy
+	return crypto.CheckPasswordPolicy(password, policy.MinLength, policy.CheckBreached)
+}
+
+// timeOrNil returns nil for the zero time, so that it is left out of JSON responses
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
 	}
-	return nil, errors.New("user not found")
+	return &t
 }
@@ -9,7 +9,11 @@ import (
 	"sort"
 	"strings"
 	"time"
+	"wiki-go/internal/acl"
+	"wiki-go/internal/audit"
+	"wiki-go/internal/auth"
 	"wiki-go/internal/config"
+	"wiki-go/internal/roles"
 	"wiki-go/internal/utils"
 )
 
@@ -68,6 +72,17 @@ func VersionsHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config)
 		return
 	}
 
+	// Old versions are as restricted as the document. Trailing timestamps don't change the
+	// rules that apply, so the whole path can be checked.
+	aclPath := strings.TrimPrefix(docPath, "documents/")
+	if docPath == "pages/home" || strings.HasPrefix(docPath, "pages/home/") {
+		aclPath = ""
+	}
+	if !acl.CanWrite(auth.GetSession(r), aclPath) {
+		sendJSONErrorVersion(w, "You don't have permission to access this document", http.StatusForbidden)
+		return
+	}
+
 	fmt.Printf("Processing version request for document path: %s\n", docPath)
 
 	// Check for restore action first
@@ -266,6 +281,11 @@ func handleVersionRestore(w http.ResponseWriter, r *http.Request, cfg *config.Co
 		versionRelativePath = "documents/" + docPath
 	}
 
+	target := "/" + strings.TrimPrefix(versionRelativePath, "documents/")
+	if versionRelativePath == "pages/home" {
+		target = "/"
+	}
+
 	fmt.Printf("Version file path: %s\n", versionFilePath)
 	fmt.Printf("Document path for restore: %s\n", documentPath)
 
@@ -291,6 +311,15 @@ func handleVersionRestore(w http.ResponseWriter, r *http.Request, cfg *config.Co
 		return
 	}
 
+	// An older version can carry other access rules, restoring it changes them like saving would
+	if !auth.Can(auth.GetSession(r), roles.PermAccessBypass) {
+		currentContent, _ := os.ReadFile(documentPath)
+		if accessChanged(string(currentContent), string(versionContent)) {
+			sendJSONErrorVersion(w, "Only admins can change the access rules of a document", http.StatusForbidden)
+			return
+		}
+	}
+
 	// Before overwriting current document, save it as a version
 	if _, err := os.Stat(documentPath); err == nil && cfg.Wiki.MaxVersions > 0 {
 		// Document exists, read its current content
@@ -318,6 +347,7 @@ func handleVersionRestore(w http.ResponseWriter, r *http.Request, cfg *config.Co
 
 	// Write the version content to the document file
 	if err := os.WriteFile(documentPath, versionContent, 0644); err != nil {
+		recordAudit(r, audit.ActionDocumentRestore, target, err, "version "+timestamp)
 		fmt.Printf("Error writing to document file: %v\n", err)
 		sendJSONErrorVersion(w, "Failed to restore document", http.StatusInternalServerError)
 		return
@@ -331,6 +361,7 @@ func handleVersionRestore(w http.ResponseWriter, r *http.Request, cfg *config.Co
 	}
 
 	fmt.Printf("Successfully restored version %s to document %s\n", timestamp, documentPath)
+	recordAudit(r, audit.ActionDocumentRestore, target, nil, "version "+timestamp)
 
 	// Return success response
 	response := map[string]interface{}{
@@ -0,0 +1,168 @@
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BER tag classes and the constructed bit, as used by the LDAP protocol
+const (
+	classUniversal   = 0x00
+	classApplication = 0x40
+	classContext     = 0x80
+	constructed      = 0x20
+)
+
+// Universal tags
+const (
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x10 | constructed
+	tagSet         = 0x11 | constructed
+)
+
+// maxPacketSize guards against servers that announce absurd lengths
+const maxPacketSize = 16 << 20
+
+// element is a decoded BER element. LDAP only uses single byte tags.
+type element struct {
+	tag  byte
+	data []byte
+}
+
+// encode returns the BER encoding of a tag and its contents
+func encode(tag byte, contents ...[]byte) []byte {
+	length := 0
+	for _, c := range contents {
+		length += len(c)
+	}
+
+	out := []byte{tag}
+	out = append(out, encodeLength(length)...)
+	for _, c := range contents {
+		out = append(out, c...)
+	}
+	return out
+}
+
+// encodeLength returns a BER length in the shortest form
+func encodeLength(length int) []byte {
+	if length < 0x80 {
+		return []byte{byte(length)}
+	}
+	var b []byte
+	for l := length; l > 0; l >>= 8 {
+		b = append([]byte{byte(l)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+// encodeInt returns an INTEGER (or ENUMERATED, with that tag) in two's complement
+func encodeInt(tag byte, v int64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(v)}, b...)
+		if (v < 0x80 && v >= -0x80) || len(b) == 8 {
+			break
+		}
+		v >>= 8
+	}
+	return encode(tag, b)
+}
+
+// encodeString returns an OCTET STRING, or a string with another tag
+func encodeString(tag byte, s string) []byte {
+	return encode(tag, []byte(s))
+}
+
+// encodeBool returns a BOOLEAN
+func encodeBool(v bool) []byte {
+	if v {
+		return encode(tagBoolean, []byte{0xff})
+	}
+	return encode(tagBoolean, []byte{0x00})
+}
+
+// readElement reads one complete BER element from the connection
+func readElement(r *bufio.Reader) (element, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return element{}, err
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return element{}, err
+	}
+
+	length := int(first)
+	if first&0x80 != 0 {
+		n := int(first & 0x7f)
+		if n == 0 || n > 4 {
+			return element{}, errors.New("ldap: unsupported BER length")
+		}
+		length = 0
+		for i := 0; i < n; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return element{}, err
+			}
+			length = length<<8 | int(b)
+		}
+	}
+	if length > maxPacketSize {
+		return element{}, fmt.Errorf("ldap: packet of %d bytes is too large", length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return element{}, err
+	}
+	return element{tag: tag, data: data}, nil
+}
+
+// children decodes the contents of a constructed element
+func (e element) children() ([]element, error) {
+	var list []element
+	data := e.data
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, errors.New("ldap: truncated BER element")
+		}
+		tag := data[0]
+		length := int(data[1])
+		offset := 2
+		if data[1]&0x80 != 0 {
+			n := int(data[1] & 0x7f)
+			if n == 0 || n > 4 || len(data) < 2+n {
+				return nil, errors.New("ldap: invalid BER length")
+			}
+			length = 0
+			for _, b := range data[2 : 2+n] {
+				length = length<<8 | int(b)
+			}
+			offset += n
+		}
+		if length < 0 || len(data) < offset+length {
+			return nil, errors.New("ldap: truncated BER element")
+		}
+		list = append(list, element{tag: tag, data: data[offset : offset+length]})
+		data = data[offset+length:]
+	}
+	return list, nil
+}
+
+// int decodes an INTEGER or ENUMERATED
+func (e element) int() int64 {
+	var v int64
+	for i, b := range e.data {
+		if i == 0 && b&0x80 != 0 {
+			v = -1
+		}
+		v = v<<8 | int64(b)
+	}
+	return v
+}
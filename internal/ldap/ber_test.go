@@ -0,0 +1,132 @@
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestIntRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		value int64
+	}{
+		{name: "Zero", value: 0},
+		{name: "Small", value: 3},
+		{name: "Largest single byte", value: 127},
+		{name: "Needs a sign byte", value: 128},
+		{name: "Two bytes", value: 0x1234},
+		{name: "Minus one", value: -1},
+		{name: "Smallest single byte", value: -128},
+		{name: "Negative two bytes", value: -129},
+		{name: "Message ID", value: 2147483647},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := readElement(bufio.NewReader(bytes.NewReader(encodeInt(tagInteger, tt.value))))
+			if err != nil {
+				t.Fatalf("Failed to decode: %v", err)
+			}
+			if e.tag != tagInteger {
+				t.Errorf("Expected tag %#x, got: %#x", tagInteger, e.tag)
+			}
+			if got := e.int(); got != tt.value {
+				t.Errorf("Expected: %d, got: %d", tt.value, got)
+			}
+		})
+	}
+}
+
+func TestLengthRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		length int
+		header int // Expected size of the tag and length
+	}{
+		{name: "Empty", length: 0, header: 2},
+		{name: "Short form", length: 127, header: 2},
+		{name: "One length byte", length: 128, header: 3},
+		{name: "Two length bytes", length: 256, header: 4},
+		{name: "Three length bytes", length: 70000, header: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value := strings.Repeat("x", tt.length)
+			encoded := encodeString(tagOctetString, value)
+			if len(encoded) != tt.header+tt.length {
+				t.Errorf("Expected %d bytes, got: %d", tt.header+tt.length, len(encoded))
+			}
+
+			e, err := readElement(bufio.NewReader(bytes.NewReader(encoded)))
+			if err != nil {
+				t.Fatalf("Failed to decode: %v", err)
+			}
+			if string(e.data) != value {
+				t.Errorf("Expected %d bytes of contents, got: %d", tt.length, len(e.data))
+			}
+		})
+	}
+}
+
+func TestChildrenRoundTrip(t *testing.T) {
+	long := strings.Repeat("y", 300)
+	sequence := encode(tagSequence,
+		encodeInt(tagInteger, 7),
+		encodeString(tagOctetString, "cn=admin"),
+		encodeBool(true),
+		encodeString(tagOctetString, long),
+		encode(tagSet),
+	)
+
+	e, err := readElement(bufio.NewReader(bytes.NewReader(sequence)))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	children, err := e.children()
+	if err != nil {
+		t.Fatalf("Failed to decode children: %v", err)
+	}
+
+	expected := []element{
+		{tag: tagInteger, data: []byte{7}},
+		{tag: tagOctetString, data: []byte("cn=admin")},
+		{tag: tagBoolean, data: []byte{0xff}},
+		{tag: tagOctetString, data: []byte(long)},
+		{tag: tagSet, data: []byte{}},
+	}
+	if len(children) != len(expected) {
+		t.Fatalf("Expected %d children, got: %d", len(expected), len(children))
+	}
+	for i, child := range children {
+		if child.tag != expected[i].tag || !bytes.Equal(child.data, expected[i].data) {
+			t.Errorf("Child %d: expected %#x %q, got: %#x %q", i, expected[i].tag, expected[i].data, child.tag, child.data)
+		}
+	}
+}
+
+func TestMalformedElements(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "Truncated contents", data: []byte{tagOctetString, 5, 'a', 'b'}},
+		{name: "Indefinite length", data: []byte{tagSequence, 0x80, 0, 0}},
+		{name: "Length of more than four bytes", data: []byte{tagOctetString, 0x85, 1, 0, 0, 0, 0}},
+		{name: "Too large", data: []byte{tagOctetString, 0x84, 0x7f, 0xff, 0xff, 0xff}},
+		{name: "Missing length", data: []byte{tagOctetString}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readElement(bufio.NewReader(bytes.NewReader(tt.data))); err == nil {
+				t.Errorf("Expected an error for %x", tt.data)
+			}
+			if _, err := (element{tag: tagSequence, data: tt.data}).children(); err == nil {
+				t.Errorf("Expected an error decoding %x as children", tt.data)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package ldap
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEscapeFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "Plain", input: "jane.doe", expected: "jane.doe"},
+		{name: "Wildcard", input: "*", expected: "\\2a"},
+		{name: "Injected filter", input: "jane)(uid=*", expected: "jane\\29\\28uid=\\2a"},
+		{name: "Backslash", input: "a\\b", expected: "a\\5cb"},
+		{name: "NUL", input: "a\x00b", expected: "a\\00b"},
+		{name: "Non-ASCII kept", input: "jürgen", expected: "jürgen"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := EscapeFilter(tt.input)
+			if result != tt.expected {
+				t.Errorf("Expected: %q, got: %q", tt.expected, result)
+			}
+
+			// The escaped value must match the input exactly, not as a pattern
+			decoded, err := unescapeFilterValue(result)
+			if err != nil {
+				t.Fatalf("Failed to unescape %q: %v", result, err)
+			}
+			if decoded != tt.input {
+				t.Errorf("Expected %q to unescape to %q, got: %q", result, tt.input, decoded)
+			}
+		})
+	}
+}
+
+func TestEscapedFilterIsEquality(t *testing.T) {
+	encoded, err := compileFilter("(uid=" + EscapeFilter("*)(objectClass=*") + ")")
+	if err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+	expected := encode(filterEquality, encodeString(tagOctetString, "uid"), encodeString(tagOctetString, "*)(objectClass=*"))
+	if !bytes.Equal(encoded, expected) {
+		t.Errorf("Expected an equality filter %x, got: %x", expected, encoded)
+	}
+}
+
+func TestEscapeDN(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "Plain", input: "jane", expected: "jane"},
+		{name: "Comma", input: "doe, jane", expected: "doe\\, jane"},
+		{name: "Injected RDN", input: "jane,ou=admins", expected: "jane\\,ou\\=admins"},
+		{name: "Special characters", input: `a+b"c\d<e>f;g`, expected: `a\+b\"c\\d\<e\>f\;g`},
+		{name: "Leading space", input: " jane", expected: "\\ jane"},
+		{name: "Trailing space", input: "jane ", expected: "jane\\ "},
+		{name: "Inner space kept", input: "jane doe", expected: "jane doe"},
+		{name: "Leading hash", input: "#jane", expected: "\\#jane"},
+		{name: "Inner hash kept", input: "ja#ne", expected: "ja#ne"},
+		{name: "NUL", input: "a\x00b", expected: "a\\00b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := EscapeDN(tt.input)
+			if result != tt.expected {
+				t.Errorf("Expected: %q, got: %q", tt.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+// Package ldap is a minimal LDAPv3 client: enough to bind, search and upgrade a connection with
+// StartTLS, which is all that authenticating users against a directory takes.
+package ldap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Protocol operations
+const (
+	opBindRequest       = classApplication | constructed | 0
+	opBindResponse      = classApplication | constructed | 1
+	opUnbindRequest     = classApplication | 2
+	opSearchRequest     = classApplication | constructed | 3
+	opSearchResultEntry = classApplication | constructed | 4
+	opSearchResultDone  = classApplication | constructed | 5
+	opSearchResultRef   = classApplication | constructed | 19
+	opExtendedRequest   = classApplication | constructed | 23
+	opExtendedResponse  = classApplication | constructed | 24
+	authSimple          = classContext | 0
+	extendedRequestName = classContext | 0
+)
+
+const (
+	startTLSOID        = "1.3.6.1.4.1.1466.20037"
+	resultSuccess      = 0
+	resultInvalidCreds = 49
+	defaultPort        = "389"
+	defaultTLSPort     = "636"
+	searchTimeLimit    = 10 // Seconds the server may spend on a search
+)
+
+// Search scopes
+const (
+	ScopeBaseObject   = 0
+	ScopeSingleLevel  = 1
+	ScopeWholeSubtree = 2
+)
+
+// ErrInvalidCredentials is returned by Bind when the server rejects the password
+var ErrInvalidCredentials = errors.New("ldap: invalid credentials")
+
+// Error is a result code other than success returned by the server
+type Error struct {
+	Code    int64
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("ldap: result code %d", e.Code)
+	}
+	return fmt.Sprintf("ldap: result code %d: %s", e.Code, e.Message)
+}
+
+// Entry is an object returned by a search
+type Entry struct {
+	DN         string
+	Attributes map[string][]string // Keyed by lower case attribute name
+}
+
+// Get returns the values of an attribute
+func (e *Entry) Get(name string) []string {
+	return e.Attributes[strings.ToLower(name)]
+}
+
+// Conn is a connection to a directory server. Operations run one at a time.
+type Conn struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	host      string
+	timeout   time.Duration
+	messageID int64
+}
+
+// Dial connects to an ldap:// or ldaps:// URL
+func Dial(rawURL string, tlsConfig *tls.Config, timeout time.Duration) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: invalid URL: %w", err)
+	}
+
+	host := u.Hostname()
+	port := u.Port()
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var conn net.Conn
+	switch strings.ToLower(u.Scheme) {
+	case "ldap":
+		if port == "" {
+			port = defaultPort
+		}
+		conn, err = dialer.Dial("tcp", net.JoinHostPort(host, port))
+	case "ldaps":
+		if port == "" {
+			port = defaultTLSPort
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(host, port), withServerName(tlsConfig, host))
+	default:
+		return nil, fmt.Errorf("ldap: unsupported URL scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{conn: conn, reader: bufio.NewReader(conn), host: host, timeout: timeout}, nil
+}
+
+// withServerName returns a TLS config that verifies the certificate against host
+func withServerName(tlsConfig *tls.Config, host string) *tls.Config {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	} else {
+		tlsConfig = tlsConfig.Clone()
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = host
+	}
+	return tlsConfig
+}
+
+// Close unbinds and closes the connection
+func (c *Conn) Close() error {
+	c.messageID++
+	c.conn.SetDeadline(time.Now().Add(time.Second))
+	c.conn.Write(encode(tagSequence, encodeInt(tagInteger, c.messageID), encode(opUnbindRequest)))
+	return c.conn.Close()
+}
+
+// StartTLS upgrades the connection to TLS
+func (c *Conn) StartTLS(tlsConfig *tls.Config) error {
+	op := encode(opExtendedRequest, encodeString(extendedRequestName, startTLSOID))
+	response, err := c.roundTrip(op, opExtendedResponse)
+	if err != nil {
+		return err
+	}
+	if err := resultError(response); err != nil {
+		return err
+	}
+
+	tlsConn := tls.Client(c.conn, withServerName(tlsConfig, c.host))
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("ldap: TLS handshake failed: %w", err)
+	}
+	c.conn = tlsConn
+	c.reader = bufio.NewReader(tlsConn)
+	return nil
+}
+
+// Bind authenticates with a simple bind. Empty passwords are refused: servers treat them as an
+// unauthenticated bind, which succeeds without checking anything.
+func (c *Conn) Bind(dn, password string) error {
+	if password == "" {
+		return ErrInvalidCredentials
+	}
+
+	op := encode(opBindRequest,
+		encodeInt(tagInteger, 3),
+		encodeString(tagOctetString, dn),
+		encodeString(authSimple, password),
+	)
+	response, err := c.roundTrip(op, opBindResponse)
+	if err != nil {
+		return err
+	}
+	err = resultError(response)
+	var ldapErr *Error
+	if errors.As(err, &ldapErr) && ldapErr.Code == resultInvalidCreds {
+		return ErrInvalidCredentials
+	}
+	return err
+}
+
+// Search returns the entries below baseDN that match filter, with the requested attributes
+func (c *Conn) Search(baseDN string, scope int, filter string, attributes []string, sizeLimit int) ([]Entry, error) {
+	encodedFilter, err := compileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var attrs [][]byte
+	for _, attr := range attributes {
+		attrs = append(attrs, encodeString(tagOctetString, attr))
+	}
+
+	c.messageID++
+	id := c.messageID
+	op := encode(opSearchRequest,
+		encodeString(tagOctetString, baseDN),
+		encodeInt(tagEnumerated, int64(scope)),
+		encodeInt(tagEnumerated, 0), // Never dereference aliases
+		encodeInt(tagInteger, int64(sizeLimit)),
+		encodeInt(tagInteger, searchTimeLimit),
+		encodeBool(false),
+		encodedFilter,
+		encode(tagSequence, attrs...),
+	)
+	if err := c.send(id, op); err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for {
+		response, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+
+		switch response.tag {
+		case opSearchResultEntry:
+			entry, err := parseEntry(response)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case opSearchResultRef:
+			// Referrals to other servers aren't followed
+		case opSearchResultDone:
+			if err := resultError(response); err != nil {
+				return nil, err
+			}
+			return entries, nil
+		default:
+			return nil, fmt.Errorf("ldap: unexpected response 0x%02x to search", response.tag)
+		}
+	}
+}
+
+// roundTrip sends an operation and reads its single response
+func (c *Conn) roundTrip(op []byte, expect byte) (element, error) {
+	c.messageID++
+	id := c.messageID
+	if err := c.send(id, op); err != nil {
+		return element{}, err
+	}
+	response, err := c.receive(id)
+	if err != nil {
+		return element{}, err
+	}
+	if response.tag != expect {
+		return element{}, fmt.Errorf("ldap: unexpected response 0x%02x", response.tag)
+	}
+	return response, nil
+}
+
+// send writes an LDAPMessage
+func (c *Conn) send(id int64, op []byte) error {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	_, err := c.conn.Write(encode(tagSequence, encodeInt(tagInteger, id), op))
+	return err
+}
+
+// receive reads the next LDAPMessage for the given message ID and returns its protocol operation
+func (c *Conn) receive(id int64) (element, error) {
+	for {
+		c.conn.SetDeadline(time.Now().Add(c.timeout))
+		message, err := readElement(c.reader)
+		if err != nil {
+			return element{}, err
+		}
+		if message.tag != tagSequence {
+			return element{}, errors.New("ldap: malformed message")
+		}
+		parts, err := message.children()
+		if err != nil {
+			return element{}, err
+		}
+		if len(parts) < 2 || parts[0].tag != tagInteger {
+			return element{}, errors.New("ldap: malformed message")
+		}
+
+		// Unsolicited notifications use message ID 0, and mean the server is closing the connection
+		switch parts[0].int() {
+		case id:
+			return parts[1], nil
+		case 0:
+			if err := resultError(parts[1]); err != nil {
+				return element{}, err
+			}
+			return element{}, errors.New("ldap: server closed the connection")
+		}
+	}
+}
+
+// resultError returns the error of an LDAPResult, or nil for success
+func resultError(response element) error {
+	parts, err := response.children()
+	if err != nil {
+		return err
+	}
+	if len(parts) < 3 || parts[0].tag != tagEnumerated {
+		return errors.New("ldap: malformed result")
+	}
+	if code := parts[0].int(); code != resultSuccess {
+		return &Error{Code: code, Message: string(parts[2].data)}
+	}
+	return nil
+}
+
+// parseEntry decodes a SearchResultEntry
+func parseEntry(response element) (Entry, error) {
+	parts, err := response.children()
+	if err != nil {
+		return Entry{}, err
+	}
+	if len(parts) < 2 {
+		return Entry{}, errors.New("ldap: malformed search entry")
+	}
+
+	entry := Entry{DN: string(parts[0].data), Attributes: make(map[string][]string)}
+	attributes, err := parts[1].children()
+	if err != nil {
+		return Entry{}, err
+	}
+	for _, attribute := range attributes {
+		pair, err := attribute.children()
+		if err != nil || len(pair) < 2 {
+			return Entry{}, errors.New("ldap: malformed search entry attribute")
+		}
+		values, err := pair[1].children()
+		if err != nil {
+			return Entry{}, err
+		}
+		name := strings.ToLower(string(pair[0].data))
+		for _, value := range values {
+			entry.Attributes[name] = append(entry.Attributes[name], string(value.data))
+		}
+	}
+	return entry, nil
+}
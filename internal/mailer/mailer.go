@@ -0,0 +1,135 @@
+// Package mailer sends the few plain text emails the wiki needs, such as password reset links,
+// through the SMTP server of the configuration.
+package mailer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+	"wiki-go/internal/config"
+)
+
+// dialTimeout limits how long connecting to the mail server may take
+const dialTimeout = 10 * time.Second
+
+// ErrNotConfigured is returned when no SMTP server is configured
+var ErrNotConfigured = errors.New("mailer: no SMTP server configured")
+
+// Configured reports whether the configuration has an SMTP server to send email with
+func Configured(cfg *config.Config) bool {
+	return cfg.SMTP.Host != "" && cfg.SMTP.From != ""
+}
+
+// Send sends a plain text email to a single recipient
+func Send(cfg *config.Config, to, subject, body string) error {
+	if !Configured(cfg) {
+		return ErrNotConfigured
+	}
+
+	from, err := mail.ParseAddress(cfg.SMTP.From)
+	if err != nil {
+		return fmt.Errorf("mailer: invalid sender address: %w", err)
+	}
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("mailer: invalid recipient address: %w", err)
+	}
+	if strings.ContainsAny(subject, "\r\n") {
+		return errors.New("mailer: subject must be a single line")
+	}
+
+	client, err := dial(cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if cfg.SMTP.Username != "" {
+		// PlainAuth refuses to send the password over a connection without TLS
+		auth := smtp.PlainAuth("", cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("mailer: authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("mailer: sender refused: %w", err)
+	}
+	if err := client.Rcpt(rcpt.Address); err != nil {
+		return fmt.Errorf("mailer: recipient refused: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+	if _, err := w.Write(message(from, rcpt, subject, body)); err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("mailer: message refused: %w", err)
+	}
+	return client.Quit()
+}
+
+// dial connects to the mail server, with implicit TLS on port 465 and STARTTLS elsewhere when
+// the server offers it
+func dial(cfg *config.Config) (*smtp.Client, error) {
+	port := cfg.SMTP.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(cfg.SMTP.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: cfg.SMTP.Host}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if port == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mailer: failed to connect to %s: %w", addr, err)
+	}
+
+	client, err := smtp.NewClient(conn, cfg.SMTP.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mailer: %w", err)
+	}
+	if port != 465 {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				client.Close()
+				return nil, fmt.Errorf("mailer: STARTTLS failed: %w", err)
+			}
+		}
+	}
+	return client, nil
+}
+
+// message returns the headers and body of a plain text email with CRLF line endings
+func message(from, to *mail.Address, subject, body string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("From: " + from.String() + "\r\n")
+	buf.WriteString("To: " + to.String() + "\r\n")
+	buf.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	buf.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+
+	// The data writer of the SMTP client escapes leading dots
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return buf.Bytes()
+}
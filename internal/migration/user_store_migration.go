@@ -0,0 +1,88 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+	"wiki-go/internal/users"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MigrateUsersToStore moves the user accounts that older versions kept in the users list of
+// config.yaml into the user store at usersPath, then removes the list from config.yaml. It
+// runs after MigrateUserRoles, so every user already has a role. A store that already exists is
+// never overwritten; the users left in config.yaml are then only kept in the backup.
+func MigrateUsersToStore(configPath, usersPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Nothing to migrate, a new config won't have users in it
+			return nil
+		}
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+
+	// Find the users key of the top level mapping
+	mapping := root.Content[0]
+	index := -1
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == "users" {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil
+	}
+
+	log.Println("Moving users from the config file to the user store...")
+
+	var list []users.User
+	if err := mapping.Content[index+1].Decode(&list); err != nil {
+		return fmt.Errorf("failed to parse users in config file: %w", err)
+	}
+
+	if _, err := os.Stat(usersPath); errors.Is(err, os.ErrNotExist) {
+		if list == nil {
+			list = []users.User{}
+		}
+		if err := users.Import(usersPath, list); err != nil {
+			return fmt.Errorf("failed to write user store: %w", err)
+		}
+		log.Printf("Moved %d users to %s", len(list), usersPath)
+	} else if err != nil {
+		return fmt.Errorf("failed to check user store: %w", err)
+	} else {
+		log.Printf("User store %s already exists, leaving the users of the config file out", usersPath)
+	}
+
+	// Create backup of config file before removing the users from it
+	backupPath := configPath + "." + time.Now().Format("20060102-150405") + ".bak"
+	if err := copyFile(configPath, backupPath); err != nil {
+		return fmt.Errorf("failed to create config backup: %w", err)
+	}
+	log.Printf("Created config backup at: %s", backupPath)
+
+	mapping.Content = append(mapping.Content[:index], mapping.Content[index+2:]...)
+	updatedData, err := yaml.Marshal(&root)
+	if err != nil {
+		return fmt.Errorf("failed to marshal updated config: %w", err)
+	}
+	if err := os.WriteFile(configPath, updatedData, 0644); err != nil {
+		return fmt.Errorf("failed to save migrated config: %w", err)
+	}
+
+	log.Println("User store migration completed successfully")
+	return nil
+}
@@ -0,0 +1,162 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"wiki-go/internal/users"
+)
+
+const configWithUsers = `server:
+    host: 0.0.0.0
+    port: 8080
+users:
+    - username: admin
+      password: $2a$10$hash
+      role: admin
+    - username: jane
+      password: $2a$10$other
+      role: editor
+wiki:
+    title: Team wiki
+`
+
+// writeTestConfig writes a config file into a temporary directory and returns its path
+func writeTestConfig(t *testing.T, content string) string {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return configPath
+}
+
+// backups returns the backups made of a config file
+func backups(t *testing.T, configPath string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(configPath + ".*.bak")
+	if err != nil {
+		t.Fatalf("Failed to look for backups: %v", err)
+	}
+	return matches
+}
+
+func TestMigrateUsersToStore(t *testing.T) {
+	configPath := writeTestConfig(t, configWithUsers)
+	usersPath := filepath.Join(filepath.Dir(configPath), "users.yaml")
+
+	if err := MigrateUsersToStore(configPath, usersPath); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	if err := users.Init(usersPath); err != nil {
+		t.Fatalf("Failed to open the migrated store: %v", err)
+	}
+	jane, found := users.Get("jane")
+	if !found || jane.Role != "editor" || jane.Password != "$2a$10$other" {
+		t.Errorf("Expected jane to be moved with her role and hash, got: %+v", jane)
+	}
+	if count := len(users.List()); count != 2 {
+		t.Errorf("Expected 2 users in the store, got: %d", count)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	config := string(data)
+	if strings.Contains(config, "users:") || strings.Contains(config, "$2a$") {
+		t.Errorf("Expected the users to be removed from the config, got:\n%s", config)
+	}
+	if !strings.Contains(config, "title: Team wiki") || !strings.Contains(config, "port: 8080") {
+		t.Errorf("Expected the other settings to be kept, got:\n%s", config)
+	}
+
+	list := backups(t, configPath)
+	if len(list) != 1 {
+		t.Fatalf("Expected a backup of the config, got: %v", list)
+	}
+	if backup, _ := os.ReadFile(list[0]); string(backup) != configWithUsers {
+		t.Error("Expected the backup to hold the original config")
+	}
+
+	// Running again finds nothing left to do
+	if err := MigrateUsersToStore(configPath, usersPath); err != nil {
+		t.Fatalf("Failed to run the migration again: %v", err)
+	}
+	if list := backups(t, configPath); len(list) != 1 {
+		t.Errorf("Expected no second backup, got: %v", list)
+	}
+}
+
+func TestMigrateUsersKeepsExistingStore(t *testing.T) {
+	configPath := writeTestConfig(t, configWithUsers)
+	usersPath := filepath.Join(filepath.Dir(configPath), "users.yaml")
+	if err := users.Import(usersPath, []users.User{{Username: "root", Role: "admin"}}); err != nil {
+		t.Fatalf("Failed to create the store: %v", err)
+	}
+
+	if err := MigrateUsersToStore(configPath, usersPath); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	if err := users.Init(usersPath); err != nil {
+		t.Fatalf("Failed to open the store: %v", err)
+	}
+	if _, found := users.Get("jane"); found {
+		t.Error("Expected the existing store not to be overwritten")
+	}
+	if _, found := users.Get("root"); !found {
+		t.Error("Expected the existing store to keep its users")
+	}
+	if data, _ := os.ReadFile(configPath); strings.Contains(string(data), "users:") {
+		t.Error("Expected the users to be removed from the config")
+	}
+	if list := backups(t, configPath); len(list) != 1 {
+		t.Errorf("Expected the users to be kept in a backup, got: %v", list)
+	}
+}
+
+func TestMigrateUsersNothingToDo(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string // Empty for a missing config file
+	}{
+		{name: "Missing config"},
+		{name: "Config without users", config: "wiki:\n    title: Team wiki\n"},
+		{name: "Empty config", config: "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if tt.config != "" {
+				configPath = writeTestConfig(t, tt.config)
+			}
+			usersPath := filepath.Join(filepath.Dir(configPath), "users.yaml")
+
+			if err := MigrateUsersToStore(configPath, usersPath); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if _, err := os.Stat(usersPath); !os.IsNotExist(err) {
+				t.Error("Expected no user store to be written")
+			}
+			if list := backups(t, configPath); len(list) != 0 {
+				t.Errorf("Expected no backup, got: %v", list)
+			}
+		})
+	}
+}
+
+func TestMigrateUsersInvalidList(t *testing.T) {
+	configPath := writeTestConfig(t, "users: not a list\n")
+	usersPath := filepath.Join(filepath.Dir(configPath), "users.yaml")
+
+	if err := MigrateUsersToStore(configPath, usersPath); err == nil {
+		t.Fatal("Expected an error for a users key that isn't a list")
+	}
+	if data, _ := os.ReadFile(configPath); string(data) != "users: not a list\n" {
+		t.Error("Expected the config to be left alone")
+	}
+}
@@ -0,0 +1,273 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		degree   int
+		expected []byte
+	}{
+		{
+			// ISO/IEC 18004 annex I: "01234567" as version 1-M
+			name:     "01234567",
+			data:     []byte{0x10, 0x20, 0x0c, 0x56, 0x61, 0x80, 0xec, 0x11, 0xec, 0x11, 0xec, 0x11, 0xec, 0x11, 0xec, 0x11},
+			degree:   10,
+			expected: []byte{0xa5, 0x24, 0xd4, 0xc1, 0xed, 0x36, 0xc7, 0x87, 0x2c, 0x55},
+		},
+		{
+			// "HELLO WORLD" as version 1-M
+			name:     "HELLO WORLD",
+			data:     []byte{0x20, 0x5b, 0x0b, 0x78, 0xd1, 0x72, 0xdc, 0x4d, 0x43, 0x40, 0xec, 0x11, 0xec, 0x11, 0xec, 0x11},
+			degree:   10,
+			expected: []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23},
+		},
+		{
+			name:     "All zero",
+			data:     make([]byte, 16),
+			degree:   10,
+			expected: make([]byte, 10),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := reedSolomon(tt.data, tt.degree); !bytes.Equal(result, tt.expected) {
+				t.Errorf("Expected: % x, got: % x", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestGaloisField(t *testing.T) {
+	if gfExp[8] != 0x1d || gfExp[254] != 0x8e || gfExp[255] != 1 {
+		t.Errorf("Unexpected powers of 2: %#x %#x %#x", gfExp[8], gfExp[254], gfExp[255])
+	}
+	for a := 1; a < 256; a++ {
+		if gfExp[gfLog[a]] != byte(a) {
+			t.Fatalf("Expected exp(log(%d)) to be %d, got: %d", a, a, gfExp[gfLog[a]])
+		}
+	}
+	if gfMul(0x53, 0xca) != gfMul(0xca, 0x53) || gfMul(0x02, 0x80) != 0x1d || gfMul(0, 0x53) != 0 {
+		t.Error("Unexpected products")
+	}
+}
+
+func TestEncodeData(t *testing.T) {
+	// Byte mode, a length of 3, "abc", the terminator and alternating pad codewords
+	expected := []byte{0x40, 0x36, 0x16, 0x26, 0x30, 0xec, 0x11, 0xec, 0x11, 0xec, 0x11, 0xec, 0x11, 0xec, 0x11, 0xec}
+	if result := encodeData([]byte("abc"), 1); !bytes.Equal(result, expected) {
+		t.Errorf("Expected: % x, got: % x", expected, result)
+	}
+
+	// From version 10 the length takes 16 bits
+	if result := encodeData([]byte("abc"), 10); !bytes.Equal(result[:4], []byte{0x40, 0x00, 0x36, 0x16}) {
+		t.Errorf("Expected a 16 bit length, got: % x", result[:4])
+	}
+}
+
+func TestAddErrorCorrectionInterleaves(t *testing.T) {
+	// Version 5-M has two blocks of 43 data codewords
+	data := make([]byte, versions[5].dataCodewords())
+	for i := range data {
+		data[i] = byte(i)
+	}
+	out := addErrorCorrection(data, versions[5])
+
+	if len(out) != 2*43+2*24 {
+		t.Fatalf("Expected 134 codewords, got: %d", len(out))
+	}
+	if !bytes.Equal(out[:4], []byte{0, 43, 1, 44}) {
+		t.Errorf("Expected the data blocks to be interleaved, got: % x", out[:4])
+	}
+	first, second := reedSolomon(data[:43], 24), reedSolomon(data[43:], 24)
+	if out[86] != first[0] || out[87] != second[0] || out[133] != second[23] {
+		t.Error("Expected the error correction blocks to be interleaved after the data")
+	}
+}
+
+func TestVersionSelection(t *testing.T) {
+	// Byte mode capacities at level M
+	capacities := []int{1: 14, 2: 26, 3: 42, 4: 62, 5: 84, 6: 106, 7: 122, 8: 152, 9: 180, 10: 213}
+
+	for version := 1; version < len(capacities); version++ {
+		t.Run(fmt.Sprint(version), func(t *testing.T) {
+			code, err := Encode(strings.Repeat("a", capacities[version]))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if code.Size != 17+4*version {
+				t.Errorf("Expected size %d at full capacity, got: %d", 17+4*version, code.Size)
+			}
+			if version > 1 {
+				code, _ = Encode(strings.Repeat("a", capacities[version-1]+1))
+				if code.Size != 17+4*version {
+					t.Errorf("Expected size %d just past version %d, got: %d", 17+4*version, version-1, code.Size)
+				}
+			}
+		})
+	}
+
+	if _, err := Encode(strings.Repeat("a", 214)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("Expected ErrTooLong, got: %v", err)
+	}
+}
+
+// formatBits reads both copies of the format information of a code
+func formatBits(c *Code) (int, int) {
+	var first, second int
+	position := func(i int) (int, int) {
+		switch {
+		case i <= 5:
+			return 8, i
+		case i == 6:
+			return 8, 7
+		case i == 7:
+			return 8, 8
+		case i == 8:
+			return 7, 8
+		}
+		return 14 - i, 8
+	}
+	for i := 0; i < 15; i++ {
+		if x, y := position(i); c.Dark(x, y) {
+			first |= 1 << i
+		}
+		x, y := c.Size-1-i, 8
+		if i >= 8 {
+			x, y = 8, c.Size-15+i
+		}
+		if c.Dark(x, y) {
+			second |= 1 << i
+		}
+	}
+	return first, second
+}
+
+func TestFormatBits(t *testing.T) {
+	// Format information of level M for masks 0 to 7
+	expected := []string{
+		"101010000010010", "101000100100101", "101111001111100", "101101101001011",
+		"100010111111001", "100000011001110", "100111110010111", "100101010100000",
+	}
+
+	for mask, bits := range expected {
+		t.Run(fmt.Sprint(mask), func(t *testing.T) {
+			c := &Code{Size: 21, modules: grid(21), reserve: grid(21)}
+			c.drawFormatBits(mask)
+			first, second := formatBits(c)
+			if got := fmt.Sprintf("%015b", first); got != bits {
+				t.Errorf("Expected: %s, got: %s", bits, got)
+			}
+			if first != second {
+				t.Errorf("Expected both copies to match, got: %015b and %015b", first, second)
+			}
+			if !c.Dark(8, c.Size-8) {
+				t.Error("Expected the dark module")
+			}
+		})
+	}
+}
+
+func TestVersionBits(t *testing.T) {
+	code, err := Encode(strings.Repeat("a", 110)) // Version 7
+	if err != nil || code.Size != 45 {
+		t.Fatalf("Expected a version 7 code, got: %v", err)
+	}
+
+	var bottomLeft, topRight int
+	for i := 0; i < 18; i++ {
+		a, b := code.Size-11+i%3, i/3
+		if code.Dark(a, b) {
+			topRight |= 1 << i
+		}
+		if code.Dark(b, a) {
+			bottomLeft |= 1 << i
+		}
+	}
+	if topRight != 0x07c94 || bottomLeft != 0x07c94 {
+		t.Errorf("Expected version information 0x07c94, got: %#05x and %#05x", topRight, bottomLeft)
+	}
+}
+
+func TestMaskPatterns(t *testing.T) {
+	// The modules each mask inverts in the top left 6 by 6 corner, rows top to bottom
+	expected := []string{
+		"#.#.#./.#.#.#/#.#.#./.#.#.#/#.#.#./.#.#.#",
+		"######/....../######/....../######/......",
+		"#..#../#..#../#..#../#..#../#..#../#..#..",
+		"#..#../..#..#/.#..#./#..#../..#..#/.#..#.",
+		"###.../###.../...###/...###/###.../###...",
+		"######/#...../#..#../#.#.#./#..#../#.....",
+		"######/###.../##.##./#.#.#./#.##.#/#...##",
+		"#.#.#./...###/#...##/.#.#.#/###.../.###..",
+	}
+
+	for mask, pattern := range expected {
+		t.Run(fmt.Sprint(mask), func(t *testing.T) {
+			c := &Code{Size: 6, modules: grid(6), reserve: grid(6)}
+			c.applyMask(mask)
+
+			var rows []string
+			for y := 0; y < 6; y++ {
+				var row strings.Builder
+				for x := 0; x < 6; x++ {
+					if c.Dark(x, y) {
+						row.WriteByte('#')
+					} else {
+						row.WriteByte('.')
+					}
+				}
+				rows = append(rows, row.String())
+			}
+			if got := strings.Join(rows, "/"); got != pattern {
+				t.Errorf("Expected: %s, got: %s", pattern, got)
+			}
+		})
+	}
+
+	// Function modules are never masked
+	c := &Code{Size: 6, modules: grid(6), reserve: grid(6)}
+	c.reserve[0][0] = true
+	c.applyMask(0)
+	if c.Dark(0, 0) {
+		t.Error("Expected a function module to be left alone")
+	}
+}
+
+func TestEncodeChoosesLowestPenalty(t *testing.T) {
+	code, err := Encode("otpauth://totp/Wiki:jane?secret=JBSWY3DPEHPK3PXP&issuer=Wiki")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	first, second := formatBits(code)
+	if first != second {
+		t.Fatalf("Expected both copies of the format information to match, got: %015b and %015b", first, second)
+	}
+	mask := (first ^ 0x5412) >> 10 & 7
+	if level := (first ^ 0x5412) >> 13; level != 0 {
+		t.Errorf("Expected level M, got: %d", level)
+	}
+
+	// Trying every other mask on the same data never scores better
+	penalty := code.penalty()
+	for other := 0; other < 8; other++ {
+		code.applyMask(mask)
+		code.applyMask(other)
+		code.drawFormatBits(other)
+		if p := code.penalty(); p < penalty {
+			t.Errorf("Expected mask %d to score at most %d, mask %d scores %d", mask, penalty, other, p)
+		}
+		code.applyMask(other)
+		code.applyMask(mask)
+		code.drawFormatBits(mask)
+	}
+}
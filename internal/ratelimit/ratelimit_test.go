@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllow(t *testing.T) {
+	tests := []struct {
+		name      string
+		perMinute int
+		burst     int
+		requests  int // Made at once
+		allowed   int // How many of them pass
+	}{
+		{name: "Within the burst", perMinute: 60, burst: 5, requests: 5, allowed: 5},
+		{name: "Over the burst", perMinute: 60, burst: 5, requests: 8, allowed: 5},
+		{name: "Burst below one", perMinute: 60, burst: 0, requests: 3, allowed: 1},
+		{name: "Disabled", perMinute: 0, burst: 1, requests: 100, allowed: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(tt.perMinute, tt.burst)
+			allowed := 0
+			for i := 0; i < tt.requests; i++ {
+				if ok, _ := l.Allow("key"); ok {
+					allowed++
+				}
+			}
+			if allowed != tt.allowed {
+				t.Errorf("Expected %d requests to pass, got: %d", tt.allowed, allowed)
+			}
+		})
+	}
+}
+
+func TestAllowRetryAfter(t *testing.T) {
+	l := New(60, 1)
+	if ok, _ := l.Allow("key"); !ok {
+		t.Fatal("Expected the first request to pass")
+	}
+	ok, wait := l.Allow("key")
+	if ok {
+		t.Fatal("Expected the second request to be refused")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("Expected to wait up to a second for the next token, got: %v", wait)
+	}
+}
+
+func TestAllowKeysAreSeparate(t *testing.T) {
+	l := New(60, 1)
+	if ok, _ := l.Allow("ip:192.0.2.1"); !ok {
+		t.Fatal("Expected the first key to pass")
+	}
+	if ok, _ := l.Allow("ip:192.0.2.2"); !ok {
+		t.Error("Expected another key to have a bucket of its own")
+	}
+}
+
+func TestAllowRefill(t *testing.T) {
+	l := New(60, 3)
+	for i := 0; i < 3; i++ {
+		l.Allow("key")
+	}
+
+	// Two seconds later two tokens are back, at one per second
+	l.buckets["key"].last = l.buckets["key"].last.Add(-2 * time.Second)
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("key"); !ok {
+			t.Fatalf("Expected refilled request %d to pass", i+1)
+		}
+	}
+	if ok, _ := l.Allow("key"); ok {
+		t.Error("Expected the bucket to be empty again")
+	}
+
+	// A long pause fills the bucket up to the burst, not beyond
+	l.buckets["key"].last = l.buckets["key"].last.Add(-time.Hour)
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if ok, _ := l.Allow("key"); ok {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Errorf("Expected a full bucket to allow 3 requests, got: %d", allowed)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	l := New(60, 2)
+	l.Allow("idle")
+	l.Allow("busy")
+	l.Allow("busy")
+
+	now := time.Now()
+	l.buckets["idle"].last = now.Add(-time.Minute)
+	l.sweep(now)
+
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("Expected the refilled bucket to be dropped")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("Expected the empty bucket to be kept")
+	}
+}
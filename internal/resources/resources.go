@@ -28,6 +28,15 @@ func GetFileSystem() http.FileSystem {
 	return http.FS(fsys)
 }
 
+// GetStaticFS returns an fs.FS for the embedded static files
+func GetStaticFS() fs.FS {
+	fsys, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		panic(err)
+	}
+	return fsys
+}
+
 // LoadTemplates loads and parses the embedded HTML templates
 func LoadTemplates(funcMap template.FuncMap) (*template.Template, error) {
 	// Parse base template with function map
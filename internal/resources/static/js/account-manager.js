@@ -0,0 +1,539 @@
+// Account Management Module
+// Handles the account dialog, where users manage their profile, password, sessions, API tokens and two-factor authentication
+
+document.addEventListener('DOMContentLoaded', function() {
+    'use strict';
+
+    const accountButton = document.querySelector('.account-button');
+    const accountDialog = document.querySelector('.account-dialog');
+    if (!accountDialog) return;
+
+    const closeAccountDialog = accountDialog.querySelector('.close-dialog');
+    const accountErrorMessage = accountDialog.querySelector('.error-message');
+    const tabButtons = accountDialog.querySelectorAll('.tab-button');
+    const tabPanes = accountDialog.querySelectorAll('.tab-pane');
+    const profileSummary = accountDialog.querySelector('.profile-summary');
+    const profileForm = document.getElementById('profileForm');
+    const profileDisplayName = document.getElementById('profileDisplayName');
+    const profileLanguage = document.getElementById('profileLanguage');
+    const profileTheme = document.getElementById('profileTheme');
+    const passwordChangeForm = document.getElementById('passwordChangeForm');
+    const sessionsList = accountDialog.querySelector('.sessions-list');
+    const revokeOthersButton = document.getElementById('revokeOtherSessionsBtn');
+    const tokensList = accountDialog.querySelector('.tokens-list');
+    const tokenForm = document.getElementById('tokenForm');
+    const tokenCreated = accountDialog.querySelector('.token-created');
+    const createdTokenInput = document.getElementById('createdToken');
+    const twoFactorStatus = accountDialog.querySelector('.two-factor-status');
+    const twoFactorSetup = accountDialog.querySelector('#account-two-factor-tab .two-factor-setup');
+    const twoFactorRecovery = accountDialog.querySelector('#account-two-factor-tab .two-factor-recovery');
+    const twoFactorForm = document.getElementById('twoFactorForm');
+    const twoFactorCodeInput = document.getElementById('twoFactorCode');
+    const twoFactorButtons = {
+        setup: document.getElementById('twoFactorSetupBtn'),
+        confirm: document.getElementById('twoFactorConfirmBtn'),
+        regenerate: document.getElementById('twoFactorRegenerateBtn'),
+        disable: document.getElementById('twoFactorDisableBtn')
+    };
+
+    // Translate a key, with a fallback for when i18n isn't loaded yet
+    function t(key, fallback) {
+        return window.i18n ? window.i18n.t(key) : fallback;
+    }
+
+    // Escape text for use in HTML
+    function escapeHtml(text) {
+        const div = document.createElement('div');
+        div.textContent = text || '';
+        return div.innerHTML;
+    }
+
+    // Tab switching
+    tabButtons.forEach(button => {
+        button.addEventListener('click', function() {
+            tabButtons.forEach(btn => btn.classList.remove('active'));
+            tabPanes.forEach(pane => pane.classList.remove('active'));
+
+            this.classList.add('active');
+            document.getElementById(this.getAttribute('data-tab')).classList.add('active');
+        });
+    });
+
+    // Show account dialog
+    if (accountButton) {
+        accountButton.addEventListener('click', function() {
+            accountErrorMessage.style.display = 'none';
+            accountDialog.classList.add('active');
+            tokenCreated.style.display = 'none';
+            createdTokenInput.value = '';
+            loadProfile();
+            loadSessions();
+            loadTokens();
+            twoFactorRecovery.style.display = 'none';
+            loadTwoFactor();
+        });
+    }
+
+    if (closeAccountDialog) {
+        closeAccountDialog.addEventListener('click', hideAccountDialog);
+    }
+
+    if (profileForm) {
+        profileForm.addEventListener('submit', saveProfile);
+    }
+
+    if (passwordChangeForm) {
+        passwordChangeForm.addEventListener('submit', changePassword);
+    }
+
+    if (revokeOthersButton) {
+        revokeOthersButton.addEventListener('click', revokeOtherSessions);
+    }
+
+    if (tokenForm) {
+        tokenForm.addEventListener('submit', createToken);
+    }
+
+    if (twoFactorForm) {
+        twoFactorForm.addEventListener('submit', enableTwoFactor);
+        twoFactorButtons.setup.addEventListener('click', setupTwoFactor);
+        twoFactorButtons.regenerate.addEventListener('click', regenerateRecoveryCodes);
+        twoFactorButtons.disable.addEventListener('click', disableTwoFactor);
+    }
+
+    // Function to hide account dialog
+    function hideAccountDialog() {
+        accountDialog.classList.remove('active');
+    }
+
+    // Function to show an error in the dialog
+    function showAccountError(message) {
+        accountErrorMessage.textContent = message;
+        accountErrorMessage.style.display = 'block';
+    }
+
+    // Function to load the user's profile and preferences
+    async function loadProfile() {
+        try {
+            const response = await fetch('/api/me');
+            const data = await response.json().catch(() => ({}));
+            if (!response.ok) {
+                // Users of an authenticating proxy have no profile in the wiki
+                profileForm.style.display = 'none';
+                passwordChangeForm.style.display = 'none';
+                profileSummary.textContent = data.message || t('profile.load_failed', 'Failed to load profile');
+                return;
+            }
+            const profile = data.profile;
+
+            const roleName = window.RolesManager ? window.RolesManager.roleName(profile.role) : profile.role;
+            profileSummary.textContent = t('profile.summary', 'Logged in as {0} ({1})')
+                .replace('{0}', profile.username)
+                .replace('{1}', roleName);
+
+            profileLanguage.innerHTML = `<option value="">${escapeHtml(t('profile.language_default', 'Wiki default'))}</option>` +
+                profile.languages.map(lang => `<option value="${escapeHtml(lang)}">${escapeHtml(lang)}</option>`).join('');
+
+            profileForm.style.display = '';
+            profileDisplayName.value = profile.display_name || '';
+            profileLanguage.value = profile.language || '';
+            profileTheme.value = profile.theme || '';
+
+            // Users of an identity provider change their password there
+            passwordChangeForm.style.display = profile.source ? 'none' : '';
+            passwordChangeForm.reset();
+        } catch (error) {
+            console.error('Error loading profile:', error);
+            showAccountError(t('profile.load_failed', 'Failed to load profile'));
+        }
+    }
+
+    // Function to save the display name, language and theme
+    async function saveProfile(e) {
+        e.preventDefault();
+        accountErrorMessage.style.display = 'none';
+
+        const preferences = {
+            display_name: profileDisplayName.value.trim(),
+            language: profileLanguage.value,
+            theme: profileTheme.value
+        };
+
+        try {
+            const response = await fetch('/api/me', {
+                method: 'PUT',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(preferences)
+            });
+            const data = await response.json().catch(() => ({}));
+            if (!response.ok) {
+                throw new Error(data.message || 'Failed to save profile');
+            }
+
+            // Going back to a default takes the saved choice away from this browser too
+            if (!preferences.theme) {
+                localStorage.removeItem('theme');
+            }
+            if (window.Auth && window.Auth.applyPreferences) {
+                await window.Auth.applyPreferences(preferences, true);
+            }
+            window.DialogSystem.showMessageDialog(t('account.profile', 'Profile'), t('profile.saved', 'Profile saved'));
+        } catch (error) {
+            console.error('Error saving profile:', error);
+            showAccountError(error.message);
+        }
+    }
+
+    // Function to change the user's own password
+    async function changePassword(e) {
+        e.preventDefault();
+        accountErrorMessage.style.display = 'none';
+
+        const newPassword = document.getElementById('newPassword').value;
+        if (newPassword !== document.getElementById('confirmNewPassword').value) {
+            showAccountError(t('profile.password_mismatch', "The new passwords don't match"));
+            return;
+        }
+
+        try {
+            const response = await fetch('/api/me/password', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({
+                    current_password: document.getElementById('currentPassword').value,
+                    new_password: newPassword
+                })
+            });
+            const data = await response.json().catch(() => ({}));
+            if (!response.ok) {
+                throw new Error(data.message || 'Failed to change password');
+            }
+
+            passwordChangeForm.reset();
+            loadSessions();
+            window.DialogSystem.showMessageDialog(
+                t('profile.change_password', 'Change Password'),
+                t('profile.password_changed', 'Password changed. Your other sessions were logged out.')
+            );
+            if (window.Auth && window.Auth.checkDefaultPassword) {
+                window.Auth.checkDefaultPassword();
+            }
+        } catch (error) {
+            console.error('Error changing password:', error);
+            showAccountError(error.message);
+        }
+    }
+
+    // Function to load the user's sessions
+    async function loadSessions() {
+        try {
+            const response = await fetch('/api/sessions');
+            if (!response.ok) {
+                throw new Error('Failed to load sessions');
+            }
+            const data = await response.json();
+            renderSessions(data.sessions);
+        } catch (error) {
+            console.error('Error loading sessions:', error);
+            showAccountError(t('sessions.load_failed', 'Failed to load sessions'));
+        }
+    }
+
+    // Function to render the sessions list
+    function renderSessions(sessions) {
+        if (!sessions || sessions.length === 0) {
+            sessionsList.innerHTML = `<div class="empty-message">${escapeHtml(t('sessions.none', 'No active sessions'))}</div>`;
+            return;
+        }
+
+        sessionsList.innerHTML = sessions.map(session => `
+            <div class="user-item session-item">
+                <div class="session-info">
+                    <div>
+                        <span class="session-agent">${escapeHtml(session.userAgent || t('sessions.unknown_browser', 'Unknown browser'))}</span>
+                        ${session.current ? `<span class="current-user-badge">${escapeHtml(t('sessions.current', 'This session'))}</span>` : ''}
+                    </div>
+                    <div class="session-details">
+                        ${escapeHtml(session.ip)} ·
+                        ${escapeHtml(t('sessions.created', 'Created'))} ${escapeHtml(new Date(session.createdAt).toLocaleString())} ·
+                        ${escapeHtml(t('sessions.last_seen', 'Last seen'))} ${escapeHtml(new Date(session.lastSeen).toLocaleString())}
+                    </div>
+                </div>
+                <div class="user-actions">
+                    <button class="revoke-session-btn" title="${escapeHtml(t('sessions.revoke', 'Revoke session'))}" data-id="${escapeHtml(session.id)}" data-current="${session.current}">
+                        <i class="fa fa-sign-out"></i>
+                    </button>
+                </div>
+            </div>
+        `).join('');
+
+        sessionsList.querySelectorAll('.revoke-session-btn').forEach(button => {
+            button.addEventListener('click', () => {
+                revokeSession(button.getAttribute('data-id'), button.getAttribute('data-current') === 'true');
+            });
+        });
+    }
+
+    // Function to revoke a single session
+    async function revokeSession(id, current) {
+        try {
+            const response = await fetch(`/api/sessions?id=${encodeURIComponent(id)}`, {
+                method: 'DELETE'
+            });
+            if (!response.ok) {
+                throw new Error('Failed to revoke session');
+            }
+
+            // Revoking the current session is a logout
+            if (current) {
+                window.location.reload();
+                return;
+            }
+            loadSessions();
+        } catch (error) {
+            console.error('Error revoking session:', error);
+            showAccountError(t('sessions.revoke_failed', 'Failed to revoke session'));
+        }
+    }
+
+    // Function to revoke all sessions except the current one
+    async function revokeOtherSessions() {
+        try {
+            const response = await fetch('/api/sessions?others=true', {
+                method: 'DELETE'
+            });
+            if (!response.ok) {
+                throw new Error('Failed to revoke sessions');
+            }
+            loadSessions();
+        } catch (error) {
+            console.error('Error revoking sessions:', error);
+            showAccountError(t('sessions.revoke_failed', 'Failed to revoke session'));
+        }
+    }
+
+    // Function to load the user's API tokens
+    async function loadTokens() {
+        try {
+            const response = await fetch('/api/tokens');
+            if (!response.ok) {
+                throw new Error('Failed to load tokens');
+            }
+            const data = await response.json();
+            renderTokens(data.tokens);
+        } catch (error) {
+            console.error('Error loading tokens:', error);
+            showAccountError(t('tokens.load_failed', 'Failed to load tokens'));
+        }
+    }
+
+    // Function to render the tokens list
+    function renderTokens(tokens) {
+        if (!tokens || tokens.length === 0) {
+            tokensList.innerHTML = `<div class="empty-message">${escapeHtml(t('tokens.none', 'No API tokens'))}</div>`;
+            return;
+        }
+
+        tokensList.innerHTML = tokens.map(token => {
+            const details = [
+                token.scope === 'write' ? t('tokens.scope_write', 'Read and write') : t('tokens.scope_read', 'Read only'),
+                token.path ? '/' + token.path : t('tokens.all_documents', 'All documents'),
+                token.expiresAt ?
+                    `${t('tokens.expires', 'Expires')} ${new Date(token.expiresAt).toLocaleDateString()}` :
+                    t('tokens.expiry_never', 'Never expires'),
+                token.lastUsed ?
+                    `${t('sessions.last_seen', 'Last seen')} ${new Date(token.lastUsed).toLocaleString()}` :
+                    t('tokens.never_used', 'Never used')
+            ];
+
+            return `
+                <div class="user-item session-item">
+                    <div class="session-info">
+                        <div><span class="session-agent">${escapeHtml(token.name)}</span></div>
+                        <div class="session-details">${details.map(escapeHtml).join(' · ')}</div>
+                    </div>
+                    <div class="user-actions">
+                        <button class="revoke-session-btn" title="${escapeHtml(t('tokens.revoke', 'Revoke token'))}" data-id="${escapeHtml(token.id)}">
+                            <i class="fa fa-trash"></i>
+                        </button>
+                    </div>
+                </div>
+            `;
+        }).join('');
+
+        tokensList.querySelectorAll('.revoke-session-btn').forEach(button => {
+            button.addEventListener('click', () => revokeToken(button.getAttribute('data-id')));
+        });
+    }
+
+    // Function to create a token and show it once
+    async function createToken(e) {
+        e.preventDefault();
+
+        const payload = {
+            name: document.getElementById('tokenName').value.trim(),
+            scope: document.getElementById('tokenScope').value,
+            path: document.getElementById('tokenPath').value.trim(),
+            expiresInDays: parseInt(document.getElementById('tokenExpiry').value, 10) || 0
+        };
+
+        try {
+            const response = await fetch('/api/tokens', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(payload)
+            });
+            const data = await response.json();
+            if (!response.ok) {
+                throw new Error(data.message || 'Failed to create token');
+            }
+
+            tokenForm.reset();
+            createdTokenInput.value = data.token;
+            tokenCreated.style.display = 'block';
+            createdTokenInput.select();
+            loadTokens();
+        } catch (error) {
+            console.error('Error creating token:', error);
+            showAccountError(error.message);
+        }
+    }
+
+    // Function to revoke a token
+    async function revokeToken(id) {
+        try {
+            const response = await fetch(`/api/tokens?id=${encodeURIComponent(id)}`, {
+                method: 'DELETE'
+            });
+            if (!response.ok) {
+                throw new Error('Failed to revoke token');
+            }
+            loadTokens();
+        } catch (error) {
+            console.error('Error revoking token:', error);
+            showAccountError(t('tokens.revoke_failed', 'Failed to revoke token'));
+        }
+    }
+
+    // Function to show only the two-factor controls that apply to the current state
+    function showTwoFactorControls(visible) {
+        Object.keys(twoFactorButtons).forEach(name => {
+            twoFactorButtons[name].style.display = visible.includes(name) ? '' : 'none';
+        });
+        accountDialog.querySelector('.two-factor-code-group').style.display =
+            visible.includes('confirm') || visible.includes('disable') || visible.includes('regenerate') ? '' : 'none';
+        twoFactorCodeInput.value = '';
+    }
+
+    // Function to load the two-factor status of the user
+    async function loadTwoFactor() {
+        twoFactorSetup.style.display = 'none';
+        try {
+            const response = await fetch('/api/2fa');
+            if (!response.ok) {
+                throw new Error('Failed to load two-factor status');
+            }
+            const data = await response.json();
+
+            if (data.enabled) {
+                twoFactorStatus.textContent = `${t('two_factor.status_enabled', 'Two-factor authentication is on.')} ` +
+                    `${t('two_factor.recovery_left', 'Recovery codes left:')} ${data.recoveryCodesLeft}`;
+                showTwoFactorControls(data.required ? ['regenerate'] : ['regenerate', 'disable']);
+            } else {
+                twoFactorStatus.textContent = data.required ?
+                    t('two_factor.required', 'Your role requires two-factor authentication.') :
+                    t('two_factor.status_disabled', 'Two-factor authentication is off.');
+                showTwoFactorControls(['setup']);
+            }
+        } catch (error) {
+            console.error('Error loading two-factor status:', error);
+            showAccountError(t('two_factor.load_failed', 'Failed to load two-factor status'));
+        }
+    }
+
+    // Function to send a two-factor request and return its data
+    async function twoFactorRequest(url, method, body) {
+        const response = await fetch(url, {
+            method,
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(body || {})
+        });
+        const data = await response.json().catch(() => ({}));
+        if (!response.ok) {
+            throw new Error(data.message || 'Request failed');
+        }
+        return data;
+    }
+
+    // Function to show recovery codes, which are only shown once
+    function showRecoveryCodes(codes) {
+        twoFactorRecovery.querySelector('.two-factor-recovery-codes').textContent = codes.join('\n');
+        twoFactorRecovery.style.display = 'block';
+    }
+
+    // Function to start setting up an authenticator app
+    async function setupTwoFactor() {
+        accountErrorMessage.style.display = 'none';
+        try {
+            const data = await twoFactorRequest('/api/2fa/setup', 'POST');
+            twoFactorSetup.querySelector('.two-factor-qr').innerHTML = data.qrCode || '';
+            twoFactorSetup.querySelector('.two-factor-secret').textContent = data.secret;
+            twoFactorSetup.style.display = 'block';
+            twoFactorRecovery.style.display = 'none';
+            showTwoFactorControls(['confirm']);
+            twoFactorCodeInput.focus();
+        } catch (error) {
+            console.error('Error setting up two-factor authentication:', error);
+            showAccountError(error.message);
+        }
+    }
+
+    // Function to confirm the setup with a code from the app
+    async function enableTwoFactor(e) {
+        e.preventDefault();
+        accountErrorMessage.style.display = 'none';
+        try {
+            const data = await twoFactorRequest('/api/2fa/enable', 'POST', { code: twoFactorCodeInput.value.trim() });
+            await loadTwoFactor();
+            showRecoveryCodes(data.recoveryCodes);
+        } catch (error) {
+            console.error('Error enabling two-factor authentication:', error);
+            showAccountError(error.message);
+        }
+    }
+
+    // Function to replace the recovery codes
+    async function regenerateRecoveryCodes() {
+        accountErrorMessage.style.display = 'none';
+        try {
+            const data = await twoFactorRequest('/api/2fa/recovery-codes', 'POST', { code: twoFactorCodeInput.value.trim() });
+            await loadTwoFactor();
+            showRecoveryCodes(data.recoveryCodes);
+        } catch (error) {
+            console.error('Error replacing recovery codes:', error);
+            showAccountError(error.message);
+        }
+    }
+
+    // Function to turn two-factor authentication off
+    async function disableTwoFactor() {
+        accountErrorMessage.style.display = 'none';
+        try {
+            await twoFactorRequest('/api/2fa', 'DELETE', { code: twoFactorCodeInput.value.trim() });
+            twoFactorRecovery.style.display = 'none';
+            loadTwoFactor();
+        } catch (error) {
+            console.error('Error disabling two-factor authentication:', error);
+            showAccountError(error.message);
+        }
+    }
+
+    // Make functions available globally
+    window.AccountManager = {
+        hideAccountDialog,
+        loadProfile,
+        loadSessions,
+        loadTokens,
+        loadTwoFactor
+    };
+});
@@ -48,6 +48,17 @@ document.addEventListener('DOMContentLoaded', function() {
         window.WikiEditor.initializeEditControls();
     }
 
+    // Toolbar and sidebar buttons; the Content Security Policy doesn't allow inline handlers
+    document.querySelector('.print-button')?.addEventListener('click', function() {
+        window.print();
+    });
+    document.querySelector('.export-epub')?.addEventListener('click', function() {
+        window.location.href = this.dataset.href;
+    });
+    document.querySelector('.sitemap-button')?.addEventListener('click', function() {
+        window.open('/sitemap/', '_blank');
+    });
+
     // Add scroll event listener to toggle shadows
     const breadcrumbs = document.querySelector('.breadcrumbs');
     const hamburger = document.querySelector('.hamburger');
@@ -37,6 +37,7 @@
                 loginDialog.classList.add('active');
 
                 // Reset form and clear error messages
+                resetTwoFactor();
                 loginForm.reset();
                 errorMessage.style.display = 'none';
 
@@ -52,6 +53,12 @@
             });
         }
 
+        // Single sign-on returns to the current page
+        const ssoButton = document.querySelector('.login-dialog .sso-login-button');
+        if (ssoButton) {
+            ssoButton.href = '/api/oidc/login?next=' + encodeURIComponent(window.location.pathname + window.location.search);
+        }
+
         // Add click handler for logout button
         const logoutButton = document.querySelector('.logout-button');
         if (logoutButton) {
@@ -79,6 +86,7 @@
         loginDialog.classList.add('active');
         editCallback = callback;
         errorMessage.style.display = 'none';
+        resetTwoFactor();
         loginForm.reset();
         // Focus on username field after dialog is shown
         setTimeout(() => {
@@ -93,6 +101,29 @@
         }
     }
 
+    // Function to go back from the two-factor step to the password form
+    function resetTwoFactor() {
+        if (window.TwoFactorLogin && loginDialog) {
+            window.TwoFactorLogin.reset(loginDialog);
+        }
+    }
+
+    // Function to finish a successful login
+    function completeLogin() {
+        hideLoginDialog();
+        if (window.loginCallback) {
+            // Store loginCallback info in localStorage
+            localStorage.setItem('pendingAction', 'loginCallback');
+            window.loginCallback = null; // Clear the callback after use
+        } else if (editCallback) {
+            // Store edit action in localStorage
+            localStorage.setItem('pendingAction', 'editPage');
+        }
+
+        // Reload the page to refresh the comments section
+        window.location.reload();
+    }
+
     // Function to handle login form submission
     async function handleLoginSubmit(e) {
         e.preventDefault();
@@ -114,22 +145,17 @@
             });
 
             if (response.ok) {
-                hideLoginDialog();
-                if (window.loginCallback) {
-                    // Store loginCallback info in localStorage
-                    localStorage.setItem('pendingAction', 'loginCallback');
-                    window.loginCallback = null; // Clear the callback after use
-                } else if (editCallback) {
-                    // Store edit action in localStorage
-                    localStorage.setItem('pendingAction', 'editPage');
+                // Users with two-factor authentication continue with a code
+                const data = await response.json().catch(() => ({}));
+                if (data.twoFactorRequired && window.TwoFactorLogin) {
+                    window.TwoFactorLogin.start(loginDialog, data, completeLogin);
+                    return;
                 }
-
-                // Reload the page to refresh the comments section
-                window.location.reload();
+                completeLogin();
             } else {
                 let msg = window.i18n ? window.i18n.t('login.error') : 'Invalid username or password';
 
-                if (response.status === 429) {
+                if (response.status === 429 || response.status === 403) {
                     try {
                         const data = await response.json();
                         if (data && data.message) {
@@ -174,46 +200,43 @@
         }
     }
 
-    // Function to check if current user is an admin
-    async function checkIfUserIsAdmin() {
+    // Function to get the permissions of the current user, or null when not logged in
+    async function getPermissions() {
         try {
             const response = await fetch('/api/check-auth');
             if (!response.ok) {
-                return false;
+                return null;
             }
 
             const data = await response.json();
-            return data.role === 'admin';
+            return data.permissions || [];
         } catch (error) {
-            console.error('Error checking admin status:', error);
-            return false;
+            console.error('Error checking permissions:', error);
+            return null;
         }
     }
 
-    // Function to check if current user has a specific role
-    async function checkUserRole(requiredRole) {
-        try {
-            const response = await fetch('/api/check-auth');
-            if (!response.ok) {
-                return false;
-            }
-
-            const data = await response.json();
+    // Function to check if current user has any of the given permissions
+    async function hasPermission(...permissions) {
+        const granted = await getPermissions();
+        return granted !== null && permissions.some(permission => granted.includes(permission));
+    }
 
-            // Handle role hierarchy
-            if (requiredRole === 'admin') {
-                return data.role === 'admin';
-            } else if (requiredRole === 'editor') {
-                return data.role === 'admin' || data.role === 'editor';
-            } else if (requiredRole === 'viewer') {
-                return data.role === 'admin' || data.role === 'editor' || data.role === 'viewer';
-            }
+    // Function to check if current user may open the settings
+    async function checkIfUserIsAdmin() {
+        return hasPermission('settings.manage', 'user.manage');
+    }
 
-            return false;
-        } catch (error) {
-            console.error('Error checking user role:', error);
-            return false;
+    // Function to check if current user has what a built-in role allows
+    async function checkUserRole(requiredRole) {
+        if (requiredRole === 'admin') {
+            return checkIfUserIsAdmin();
+        } else if (requiredRole === 'editor') {
+            return hasPermission('page.edit');
+        } else if (requiredRole === 'viewer') {
+            return (await getPermissions()) !== null;
         }
+        return false;
     }
 
     // Function to show permission error
@@ -249,58 +272,71 @@
                 return;
             }
 
-            // User is authenticated, check role
+            // User is authenticated, check permissions
             const authData = await authResponse.json();
-            const isAdmin = authData.role === 'admin';
-            const isEditor = authData.role === 'editor';
+            const permissions = authData.permissions || [];
+            const canManage = permissions.includes('settings.manage') || permissions.includes('user.manage');
+            const canEdit = permissions.includes('page.edit');
 
-            // Show/hide buttons based on role
-            if (isAdmin) {
-                // Admin user - show all admin buttons
-                document.querySelectorAll('.admin-only-button').forEach(btn => {
+            // Show/hide buttons based on permissions
+            document.querySelectorAll('.admin-only-button').forEach(btn => {
+                if (canManage) {
                     btn.style.cssText = 'display: inline-flex !important';
-                });
+                } else {
+                    btn.style.display = 'none';
+                }
+            });
 
-                // Show editor buttons
-                document.querySelectorAll('.editor-only-button').forEach(btn => {
+            document.querySelectorAll('.editor-only-button').forEach(btn => {
+                if (canEdit) {
                     btn.style.cssText = 'display: inline-flex !important';
-                });
-
-                // Special case for move/rename button (only show if not on homepage)
-                const renameBtn = document.querySelector('.move-document');
-                if (renameBtn && (window.location.pathname === '/' || window.location.pathname === '/homepage')) {
-                    renameBtn.style.cssText = 'display: none !important';
-                }
-            } else if (isEditor) {
-                // Editor user - hide admin buttons, show editor buttons
-                document.querySelectorAll('.admin-only-button').forEach(btn => {
+                } else {
                     btn.style.display = 'none';
-                });
+                }
+            });
 
-                document.querySelectorAll('.editor-only-button').forEach(btn => {
-                    btn.style.cssText = 'display: inline-flex !important';
-                });
+            if (canEdit) {
+                // Deleting documents is a permission of its own
+                const deleteBtn = document.querySelector('.delete-document');
+                if (deleteBtn && !permissions.includes('page.delete')) {
+                    deleteBtn.style.cssText = 'display: none !important';
+                }
 
                 // Special case for move/rename button (only show if not on homepage)
                 const renameBtn = document.querySelector('.move-document');
                 if (renameBtn && (window.location.pathname === '/' || window.location.pathname === '/homepage')) {
                     renameBtn.style.cssText = 'display: none !important';
                 }
-            } else {
-                // Viewer user - hide admin and editor buttons
-                document.querySelectorAll('.admin-only-button, .editor-only-button').forEach(btn => {
-                    btn.style.display = 'none';
-                });
             }
 
             // Show logout button, hide login button for all authenticated users
             document.querySelector('.toolbar-button.auth-button.primary').style.cssText = 'display: none !important';
             document.querySelector('.logout-button').style.cssText = 'display: inline-flex !important';
+
+            applyPreferences(authData.preferences);
         } catch (error) {
             console.error('Error checking authentication status:', error);
         }
     }
 
+    // Function to apply the theme and language the user chose in their profile. The profile's
+    // theme is the default of browsers the user hasn't toggled the theme in, unless override is set.
+    async function applyPreferences(preferences, override) {
+        if (!preferences) return;
+
+        const localTheme = localStorage.getItem('theme');
+        if (preferences.theme && (override || !localTheme) && window.ThemeManager && window.ThemeManager.getCurrentTheme() !== preferences.theme) {
+            localStorage.setItem('theme', preferences.theme);
+            window.ThemeManager.setTheme(preferences.theme);
+        }
+
+        // Pages are rendered in the wiki's language; texts that scripts show follow the user's choice
+        if (preferences.language && window.i18n && window.i18n.getCurrentLanguage() !== preferences.language) {
+            document.documentElement.lang = preferences.language;
+            await window.i18n.setCurrentLanguage(preferences.language);
+        }
+    }
+
     // Function to check if the default password is in use
     async function checkDefaultPassword() {
         try {
@@ -356,9 +392,12 @@
         hideLoginDialog: hideLoginDialog,
         checkIfUserIsAdmin: checkIfUserIsAdmin,
         checkUserRole: checkUserRole,
+        getPermissions: getPermissions,
+        hasPermission: hasPermission,
         showAdminOnlyError: showAdminOnlyError,
         showPermissionError: showPermissionError,
         updateToolbarButtons: updateToolbarButtons,
+        applyPreferences: applyPreferences,
         checkDefaultPassword: checkDefaultPassword
     };
 })();
@@ -408,7 +408,7 @@ function showTablePicker(button) {
 
 // ===== ANCHOR PICKER =====
 
-// Function to slugify heading text (mirror of Go makeSlug)
+// Function to slugify heading text (mirror of Go MakeSlug)
 function makeSlug(text) {
     return text.toLowerCase()
         .replace(/[&+_,.()\[\]{}'"!?;:~*]/g, ' ')
@@ -97,6 +97,10 @@ async function loadTranslations(lang) {
         if (!languageCache[lang]) {
             languageCache[lang] = await loadLanguageData(lang);
         }
+        // Keep English around for keys a language doesn't translate yet
+        if (!languageCache.en) {
+            languageCache.en = lang === 'en' ? languageCache[lang] : await loadLanguageData('en');
+        }
         translations = languageCache[lang];
     } catch (error) {
         console.error(`Error loading translations for ${lang}:`, error);
@@ -116,13 +120,22 @@ function t(key, lang) {
     if (lang && lang !== currentLanguage) {
         // If we have this language cached, use it
         if (languageCache[lang]) {
-            return languageCache[lang][key] || key;
+            return languageCache[lang][key] || fallback(key);
         }
         // Otherwise, we don't have this language loaded, just return the current translation or key
     }
 
     // Use current language translations
-    return translations[key] || key;
+    return translations[key] || fallback(key);
+}
+
+/**
+ * Get the English text for a key missing in a language
+ * @param {string} key - Translation key
+ * @returns {string} - English text or key if not found
+ */
+function fallback(key) {
+    return (languageCache.en && languageCache.en[key]) || key;
 }
 
 /**
@@ -9,6 +9,9 @@ document.addEventListener('DOMContentLoaded', function() {
     // Import form elements
     const importForm = document.getElementById('importForm');
     const importZipFile = document.getElementById('importZipFile');
+    const importFormat = document.getElementById('importFormat');
+    const importConflict = document.getElementById('importConflict');
+    const importDryRun = document.getElementById('importDryRun');
     const importButton = document.getElementById('importButton');
     const cancelImportButton = document.getElementById('cancelImportButton');
     const importProgressContainer = document.querySelector('.import-progress-container');
@@ -51,8 +54,13 @@ document.addEventListener('DOMContentLoaded', function() {
 
         const file = importZipFile.files[0];
 
-        // Validate file type
-        if (!file.name.toLowerCase().endsWith('.zip')) {
+        // Validate file type, MediaWiki exports are XML files
+        if (importFormat && importFormat.value === 'mediawiki') {
+            if (!file.name.toLowerCase().endsWith('.xml')) {
+                showImportError('Please select a valid XML file');
+                return;
+            }
+        } else if (!file.name.toLowerCase().endsWith('.zip')) {
             showImportError('Please select a valid ZIP file');
             return;
         }
@@ -60,6 +68,15 @@ document.addEventListener('DOMContentLoaded', function() {
         // Create form data
         const formData = new FormData();
         formData.append('zipFile', file);
+        if (importFormat) {
+            formData.append('format', importFormat.value);
+        }
+        if (importConflict) {
+            formData.append('conflict', importConflict.value);
+        }
+        if (importDryRun && importDryRun.checked) {
+            formData.append('dryRun', 'true');
+        }
 
         try {
             // Show progress UI
@@ -165,6 +182,14 @@ document.addEventListener('DOMContentLoaded', function() {
             importZipFile.disabled = true;
         }
 
+        if (importFormat) {
+            importFormat.disabled = true;
+        }
+
+        if (importConflict) {
+            importConflict.disabled = true;
+        }
+
         if (importProgressContainer) {
             importProgressContainer.style.display = 'block';
         }
@@ -188,6 +213,14 @@ document.addEventListener('DOMContentLoaded', function() {
             importZipFile.disabled = false;
         }
 
+        if (importFormat) {
+            importFormat.disabled = false;
+        }
+
+        if (importConflict) {
+            importConflict.disabled = false;
+        }
+
         if (importProgressContainer) {
             importProgressContainer.style.display = 'none';
         }
@@ -233,11 +266,33 @@ document.addEventListener('DOMContentLoaded', function() {
             resultsHtml += '</ul>';
 
             // Refresh the sidebar to show new content
-            if (window.SidebarNavigation && window.SidebarNavigation.refreshSidebar) {
+            if (!data.dryRun && window.SidebarNavigation && window.SidebarNavigation.refreshSidebar) {
                 window.SidebarNavigation.refreshSidebar();
             }
         }
 
+        if (data.importedAssets && data.importedAssets.length) {
+            resultsHtml += `<h5>${window.i18n ? window.i18n.t('import.attachments_title') : 'Attachments:'}</h5>`;
+            resultsHtml += '<ul class="imported-files-list">';
+
+            data.importedAssets.forEach(file => {
+                resultsHtml += `<li>${file.originalPath} → ${file.newPath}</li>`;
+            });
+
+            resultsHtml += '</ul>';
+        }
+
+        if (data.skipped && data.skipped.length) {
+            resultsHtml += `<h5>${window.i18n ? window.i18n.t('import.skipped_title') : 'Skipped:'}</h5>`;
+            resultsHtml += '<ul class="import-errors-list">';
+
+            data.skipped.forEach(message => {
+                resultsHtml += `<li>${message}</li>`;
+            });
+
+            resultsHtml += '</ul>';
+        }
+
         if (data.errors && data.errors.length) {
             resultsHtml += '<h5>Errors:</h5>';
             resultsHtml += '<ul class="import-errors-list">';
@@ -250,7 +305,11 @@ document.addEventListener('DOMContentLoaded', function() {
         }
 
         // Add summary
-        resultsHtml += `<p class="import-summary">Successfully imported ${data.successCount || 0} files with ${data.errorCount || 0} errors.</p>`;
+        if (data.dryRun) {
+            resultsHtml += `<p class="import-summary">${data.message}</p>`;
+        } else {
+            resultsHtml += `<p class="import-summary">Successfully imported ${data.successCount || 0} files with ${data.errorCount || 0} errors.</p>`;
+        }
 
         // Update results content
         importResultsContent.innerHTML = resultsHtml;
@@ -0,0 +1,130 @@
+// Invitation links management for the users tab of the settings dialog
+(function() {
+    'use strict';
+
+    const invitationsList = document.querySelector('.invitations-list');
+    const invitationForm = document.getElementById('invitationForm');
+    const invitationRoleSelect = document.getElementById('invitationRole');
+    const invitationNoteInput = document.getElementById('invitationNote');
+    const invitationExpiresInput = document.getElementById('invitationExpires');
+    const invitationLinkGroup = document.querySelector('.invitation-link-group');
+    const invitationLinkInput = document.getElementById('invitationLink');
+
+    function t(key, fallback) {
+        if (window.i18n && window.i18n.t) {
+            const text = window.i18n.t(key);
+            if (text && text !== key) {
+                return text;
+            }
+        }
+        return fallback;
+    }
+
+    function escapeHTML(text) {
+        const div = document.createElement('div');
+        div.textContent = text == null ? '' : String(text);
+        return div.innerHTML;
+    }
+
+    async function request(url, options, failure) {
+        const response = await fetch(url, options);
+        const data = await response.json().catch(() => null);
+        if (!response.ok || !data || !data.success) {
+            throw new Error(data?.message || failure);
+        }
+        return data;
+    }
+
+    // Function to load the open invitations
+    async function load() {
+        if (window.RolesManager) {
+            window.RolesManager.populateRoleSelect(invitationRoleSelect);
+        }
+        try {
+            const data = await request('/api/invitations', {}, 'Failed to load invitations');
+            render(data.invitations || []);
+        } catch (error) {
+            console.error('Error loading invitations:', error);
+        }
+    }
+
+    function render(invitations) {
+        if (!invitationsList) return;
+
+        if (invitations.length === 0) {
+            invitationsList.innerHTML = `<div class="empty-message">${escapeHTML(t('invitations.none', 'No open invitations'))}</div>`;
+            return;
+        }
+
+        const roleName = window.RolesManager ? window.RolesManager.roleName : (role => role);
+        invitationsList.innerHTML = invitations.map(invitation => `
+            <div class="user-item" data-id="${escapeHTML(invitation.id)}">
+                <div class="user-info">
+                    <span class="username">${escapeHTML(invitation.note || invitation.id)}</span>
+                    <span class="role-badge role-${['admin', 'editor', 'viewer'].includes(invitation.role) ? invitation.role : 'custom'}">${escapeHTML(roleName(invitation.role))}</span>
+                    <div class="form-help">${escapeHTML(t('invitations.expires', 'Expires'))}: ${escapeHTML(new Date(invitation.expiresAt).toLocaleString())} &middot; ${escapeHTML(invitation.createdBy)}</div>
+                </div>
+                <div class="user-actions">
+                    <button class="delete-user-btn revoke-invitation-btn" title="${escapeHTML(t('invitations.revoke', 'Revoke invitation'))}"><i class="fa fa-trash"></i></button>
+                </div>
+            </div>
+        `).join('');
+
+        invitationsList.querySelectorAll('.revoke-invitation-btn').forEach(button => {
+            button.addEventListener('click', () => {
+                revoke(button.closest('.user-item').getAttribute('data-id'));
+            });
+        });
+    }
+
+    async function create(e) {
+        e.preventDefault();
+        try {
+            const data = await request('/api/invitations', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({
+                    role: invitationRoleSelect.value,
+                    note: invitationNoteInput.value.trim(),
+                    expiresInDays: parseInt(invitationExpiresInput.value, 10) || 7
+                })
+            }, 'Failed to create invitation');
+
+            // The link can only be shown now, the server keeps a hash of it
+            invitationLinkInput.value = window.location.origin + data.link;
+            invitationLinkGroup.style.display = '';
+            invitationLinkInput.select();
+            invitationNoteInput.value = '';
+            await load();
+        } catch (error) {
+            window.DialogSystem.showMessageDialog(t('invitations.create_failed', 'Creating Invitation Failed'), error.message);
+        }
+    }
+
+    function revoke(id) {
+        const title = t('invitations.revoke', 'Revoke invitation');
+        window.DialogSystem.showConfirmDialog(title, t('invitations.revoke_confirm', 'Revoke this invitation? Its link stops working.'), async (confirmed) => {
+            if (!confirmed) {
+                return;
+            }
+            try {
+                await request(`/api/invitations?id=${encodeURIComponent(id)}`, { method: 'DELETE' }, 'Failed to revoke invitation');
+                await load();
+            } catch (error) {
+                window.DialogSystem.showMessageDialog(title, error.message);
+            }
+        });
+    }
+
+    if (invitationForm) {
+        invitationForm.addEventListener('submit', create);
+    }
+    if (invitationLinkInput) {
+        invitationLinkInput.addEventListener('focus', () => invitationLinkInput.select());
+    }
+
+    // Expose public API
+    window.InvitationsManager = {
+        load: load
+    };
+})();
@@ -562,6 +562,7 @@ function handleEscapeKey(e) {
     const isUserConfirmDialogOpen = document.querySelector('.user-confirmation-dialog')?.classList.contains('active');
     const isNewDocDialogOpen = document.querySelector('.new-document-dialog')?.classList.contains('active');
     const isSettingsDialogOpen = document.querySelector('.settings-dialog')?.classList.contains('active');
+    const isAccountDialogOpen = document.querySelector('.account-dialog')?.classList.contains('active');
     const isMoveDocDialogOpen = document.querySelector('.move-document-dialog')?.classList.contains('active');
     const isAddLinkDialogOpen = document.querySelector('.add-link-dialog')?.classList.contains('active');
     const isSearchResultsOpen = document.querySelector('.search-results')?.classList.contains('active');
@@ -606,6 +607,10 @@ function handleEscapeKey(e) {
         // Close settings dialog
         window.SettingsManager.hideSettingsDialog();
         e.preventDefault();
+    } else if (isAccountDialogOpen) {
+        // Close account dialog
+        window.AccountManager.hideAccountDialog();
+        e.preventDefault();
     } else if (isAddLinkDialogOpen) {
         // Close add link dialog
         if (window.LinksInteractivity && window.LinksInteractivity.hideAddLinkDialog) {
@@ -0,0 +1,93 @@
+// Login ban list for the security tab of the settings dialog
+(function() {
+    'use strict';
+
+    const loginBansList = document.querySelector('.login-bans-list');
+
+    function t(key, fallback) {
+        if (window.i18n && window.i18n.t) {
+            const text = window.i18n.t(key);
+            if (text && text !== key) {
+                return text;
+            }
+        }
+        return fallback;
+    }
+
+    function escapeHTML(text) {
+        const div = document.createElement('div');
+        div.textContent = text == null ? '' : String(text);
+        return div.innerHTML;
+    }
+
+    async function request(url, options, failure) {
+        const response = await fetch(url, options);
+        const data = await response.json().catch(() => null);
+        if (!response.ok || !data || !data.success) {
+            throw new Error(data?.message || failure);
+        }
+        return data;
+    }
+
+    // Function to load the addresses in the ban list
+    async function load() {
+        try {
+            const data = await request('/api/settings/security/bans', {}, 'Failed to load the ban list');
+            render(data.entries || []);
+        } catch (error) {
+            console.error('Error loading ban list:', error);
+        }
+    }
+
+    function render(entries) {
+        if (!loginBansList) return;
+
+        if (entries.length === 0) {
+            loginBansList.innerHTML = `<div class="empty-message">${escapeHTML(t('login_bans.none', 'No banned addresses'))}</div>`;
+            return;
+        }
+
+        loginBansList.innerHTML = entries.map(entry => {
+            const status = entry.banned
+                ? `${escapeHTML(t('login_bans.banned_until', 'Banned until'))}: ${escapeHTML(new Date(entry.bannedUntil).toLocaleString())}`
+                : `${escapeHTML(t('login_bans.fails', 'Failed logins'))}: ${escapeHTML(entry.fails)}`;
+            return `
+            <div class="user-item" data-ip="${escapeHTML(entry.ip)}">
+                <div class="user-info">
+                    <span class="username">${escapeHTML(entry.ip)}</span>
+                    <div class="form-help">${status} &middot; ${escapeHTML(t('login_bans.ban_length', 'Last ban (seconds)'))}: ${escapeHTML(entry.banSeconds)}</div>
+                </div>
+                <div class="user-actions">
+                    <button class="delete-user-btn unban-btn" title="${escapeHTML(t('login_bans.unban', 'Lift ban'))}"><i class="fa fa-unlock"></i></button>
+                </div>
+            </div>
+        `;
+        }).join('');
+
+        loginBansList.querySelectorAll('.unban-btn').forEach(button => {
+            button.addEventListener('click', () => {
+                unban(button.closest('.user-item').getAttribute('data-ip'));
+            });
+        });
+    }
+
+    function unban(ip) {
+        const title = t('login_bans.unban', 'Lift ban');
+        window.DialogSystem.showConfirmDialog(title, t('login_bans.unban_confirm', 'Lift the ban on this address and forget its failed logins?'), async (confirmed) => {
+            if (!confirmed) {
+                return;
+            }
+            try {
+                await request(`/api/settings/security/bans?ip=${encodeURIComponent(ip)}`, { method: 'DELETE' }, 'Failed to lift ban');
+                await load();
+            } catch (error) {
+                window.DialogSystem.showMessageDialog(title, error.message);
+            }
+        });
+    }
+
+    // Expose public API
+    window.LoginBansManager = {
+        load: load
+    };
+})();
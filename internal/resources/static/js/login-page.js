@@ -0,0 +1,75 @@
+// Standalone login page, shown when a private wiki asks visitors to log in
+document.addEventListener('DOMContentLoaded', function() {
+    const loginDialog = document.querySelector('.login-dialog');
+    const loginForm = document.getElementById('loginForm');
+    const errorMessage = document.getElementById('loginError');
+    const errorText = errorMessage.getAttribute('data-error-message');
+    const ssoButton = document.querySelector('.sso-login-button');
+
+    // Single sign-on returns to the page that asked for the login too
+    const redirectParam = new URLSearchParams(window.location.search).get('redirect');
+    if (ssoButton && redirectParam && redirectParam.startsWith('/')) {
+        ssoButton.href = '/api/oidc/login?next=' + encodeURIComponent(redirectParam);
+    }
+
+    // Redirect to original page if provided
+    function redirectAfterLogin() {
+        const dest = redirectParam;
+        if (dest && dest.startsWith('/')) {
+            window.location.href = dest;
+        } else {
+            window.location.href = '/';
+        }
+    }
+
+    loginForm.addEventListener('submit', async function(e) {
+        e.preventDefault();
+        const username = document.getElementById('username').value;
+        const password = document.getElementById('password').value;
+        const keepLoggedIn = document.getElementById('keepLoggedIn').checked;
+
+        try {
+            const response = await fetch('/api/login', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify({
+                    username,
+                    password,
+                    keepLoggedIn
+                })
+            });
+
+            if (response.ok) {
+                // Users with two-factor authentication continue with a code
+                const data = await response.json().catch(() => ({}));
+                if (data.twoFactorRequired) {
+                    window.TwoFactorLogin.start(loginDialog, data, redirectAfterLogin);
+                    return;
+                }
+                redirectAfterLogin();
+            } else {
+                let msg = errorText;
+                if (response.status === 429 || response.status === 403) {
+                    try {
+                        const data = await response.json();
+                        if (data && data.message) {
+                            msg = data.message;
+                            if (data.retryAfter) {
+                                const retryTxt = window.i18n ? window.i18n.t('login.retry_in') : 'retry in';
+                                msg += ` (${retryTxt} ${data.retryAfter}s)`;
+                            }
+                        }
+                    } catch (e) {}
+                }
+                errorMessage.textContent = msg;
+                errorMessage.style.display = 'block';
+            }
+        } catch (error) {
+            console.error('Login error:', error);
+            errorMessage.textContent = 'An error occurred. Please try again.';
+            errorMessage.style.display = 'block';
+        }
+    });
+});
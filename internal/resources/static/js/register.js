@@ -0,0 +1,56 @@
+// Registration page: creates an account from an invitation link or as a self-registration
+document.addEventListener('DOMContentLoaded', function() {
+    const registerForm = document.getElementById('registerForm');
+    if (!registerForm) {
+        return;
+    }
+
+    const errorMessage = document.getElementById('registerError');
+    const successMessage = document.getElementById('registerSuccess');
+
+    function showError(message) {
+        errorMessage.textContent = message;
+        errorMessage.style.display = 'block';
+    }
+
+    registerForm.addEventListener('submit', async function(e) {
+        e.preventDefault();
+        errorMessage.style.display = 'none';
+
+        const password = document.getElementById('password').value;
+        if (password !== document.getElementById('confirmPassword').value) {
+            showError(registerForm.getAttribute('data-mismatch-message'));
+            return;
+        }
+
+        try {
+            const response = await fetch('/api/register', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify({
+                    username: document.getElementById('username').value,
+                    password: password,
+                    display_name: document.getElementById('displayName').value,
+                    email: document.getElementById('email').value,
+                    invite: registerForm.getAttribute('data-invite') || ''
+                })
+            });
+
+            const data = await response.json().catch(() => ({}));
+            if (!response.ok) {
+                showError(data.message || registerForm.getAttribute('data-error-message'));
+                return;
+            }
+
+            // Invited users can log in right away, others wait for an admin
+            registerForm.style.display = 'none';
+            successMessage.textContent = data.message;
+            successMessage.style.display = 'block';
+        } catch (error) {
+            console.error('Registration error:', error);
+            showError(registerForm.getAttribute('data-error-message'));
+        }
+    });
+});
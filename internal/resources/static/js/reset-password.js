@@ -0,0 +1,66 @@
+// Password reset page: sets a new password from a reset link, or requests a link by email
+document.addEventListener('DOMContentLoaded', function() {
+    const resetForm = document.getElementById('resetPasswordForm');
+    const requestForm = document.getElementById('requestResetForm');
+    const errorMessage = document.getElementById('resetError');
+    const successMessage = document.getElementById('resetSuccess');
+
+    function showError(message) {
+        errorMessage.textContent = message;
+        errorMessage.style.display = 'block';
+    }
+
+    function showSuccess(form, message) {
+        form.style.display = 'none';
+        successMessage.textContent = message;
+        successMessage.style.display = 'block';
+    }
+
+    async function post(form, url, body) {
+        errorMessage.style.display = 'none';
+        try {
+            const response = await fetch(url, {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify(body)
+            });
+
+            const data = await response.json().catch(() => ({}));
+            if (!response.ok) {
+                showError(data.message || form.getAttribute('data-error-message'));
+                return;
+            }
+            showSuccess(form, data.message);
+        } catch (error) {
+            console.error('Password reset error:', error);
+            showError(form.getAttribute('data-error-message'));
+        }
+    }
+
+    if (resetForm) {
+        resetForm.addEventListener('submit', function(e) {
+            e.preventDefault();
+
+            const password = document.getElementById('password').value;
+            if (password !== document.getElementById('confirmPassword').value) {
+                showError(resetForm.getAttribute('data-mismatch-message'));
+                return;
+            }
+            post(resetForm, '/api/password-reset', {
+                token: resetForm.getAttribute('data-token'),
+                password: password
+            });
+        });
+    }
+
+    if (requestForm) {
+        requestForm.addEventListener('submit', function(e) {
+            e.preventDefault();
+            post(requestForm, '/api/password-reset/email', {
+                username: document.getElementById('username').value
+            });
+        });
+    }
+});
@@ -0,0 +1,301 @@
+// Roles and groups management for the settings dialog
+(function() {
+    'use strict';
+
+    const rolesList = document.querySelector('.roles-list');
+    const roleForm = document.getElementById('roleForm');
+    const roleFormTitle = document.getElementById('role-form-title');
+    const roleNameInput = document.getElementById('roleFormName');
+    const roleDescriptionInput = document.getElementById('roleFormDescription');
+    const rolePermissions = document.querySelector('.role-permissions');
+    const clearRoleBtn = document.getElementById('clearRoleBtn');
+
+    const groupsList = document.querySelector('.groups-list');
+    const groupForm = document.getElementById('groupForm');
+    const groupFormTitle = document.getElementById('group-form-title');
+    const groupNameInput = document.getElementById('groupFormName');
+    const groupDescriptionInput = document.getElementById('groupFormDescription');
+    const groupMembersInput = document.getElementById('groupFormMembers');
+    const groupRoles = document.querySelector('.group-roles');
+    const clearGroupBtn = document.getElementById('clearGroupBtn');
+
+    // Roles and permissions as last loaded from the server
+    let roles = [];
+    let permissions = [];
+
+    function t(key, fallback) {
+        if (window.i18n && window.i18n.t) {
+            const text = window.i18n.t(key);
+            if (text && text !== key) {
+                return text;
+            }
+        }
+        return fallback;
+    }
+
+    function escapeHTML(text) {
+        const div = document.createElement('div');
+        div.textContent = text == null ? '' : String(text);
+        return div.innerHTML;
+    }
+
+    // Function to get the display name of a role, translated for the built-in ones
+    function roleName(role) {
+        if (['admin', 'editor', 'viewer'].includes(role)) {
+            return t(`users.role_${role}`, role.charAt(0).toUpperCase() + role.slice(1));
+        }
+        return role;
+    }
+
+    // Function to get the display name of a permission
+    function permissionName(permission) {
+        return t(`permissions.${permission.replace('.', '_')}`, permission);
+    }
+
+    // Function to render a list of checkboxes into a container
+    function renderCheckboxes(container, name, values, labelFor) {
+        if (!container) return;
+        container.innerHTML = values.map(value => `
+            <div class="checkbox-group">
+                <input type="checkbox" id="${name}-${escapeHTML(value)}" name="${name}" value="${escapeHTML(value)}">
+                <label for="${name}-${escapeHTML(value)}">${escapeHTML(labelFor(value))}</label>
+            </div>
+        `).join('');
+    }
+
+    function checkedValues(container) {
+        return Array.from(container.querySelectorAll('input[type="checkbox"]:checked')).map(input => input.value);
+    }
+
+    function setChecked(container, values) {
+        container.querySelectorAll('input[type="checkbox"]').forEach(input => {
+            input.checked = values.includes(input.value);
+        });
+    }
+
+    async function request(url, options, failure) {
+        const response = await fetch(url, options);
+        const data = await response.json().catch(() => null);
+        if (!response.ok || !data || !data.success) {
+            throw new Error(data?.message || failure);
+        }
+        return data;
+    }
+
+    // Function to load roles and groups, for the roles tab and the user form
+    async function load() {
+        try {
+            const [rolesData, groupsData] = await Promise.all([
+                request('/api/roles', {}, 'Failed to load roles'),
+                request('/api/groups', {}, 'Failed to load groups')
+            ]);
+            roles = rolesData.roles || [];
+            permissions = rolesData.permissions || [];
+
+            renderCheckboxes(rolePermissions, 'rolePermission', permissions, permissionName);
+            renderCheckboxes(groupRoles, 'groupRole', roles.map(role => role.name), roleName);
+            renderRoles();
+            renderGroups(groupsData.groups || []);
+            resetRoleForm();
+            resetGroupForm();
+        } catch (error) {
+            console.error('Error loading roles:', error);
+        }
+        return roles;
+    }
+
+    // Function to fill a role select with the built-in and custom roles
+    function populateRoleSelect(select) {
+        if (!select || roles.length === 0) return;
+        const current = select.value;
+        select.innerHTML = roles.map(role =>
+            `<option value="${escapeHTML(role.name)}">${escapeHTML(roleName(role.name))}</option>`
+        ).join('');
+        if (roles.some(role => role.name === current)) {
+            select.value = current;
+        }
+    }
+
+    function renderRoles() {
+        if (!rolesList) return;
+
+        rolesList.innerHTML = roles.map(role => `
+            <div class="user-item" data-role="${escapeHTML(role.name)}">
+                <div class="user-info">
+                    <span class="username">${escapeHTML(roleName(role.name))}</span>
+                    ${role.builtin ? `<span class="source-badge">${escapeHTML(t('roles.builtin', 'Built-in'))}</span>` : ''}
+                    <div class="form-help">${escapeHTML(role.permissions.map(permissionName).join(', ') || t('roles.no_permissions', 'No permissions'))}</div>
+                </div>
+                ${role.builtin ? '' : `
+                <div class="user-actions">
+                    <button class="edit-user-btn edit-role-btn" title="${escapeHTML(t('roles.edit', 'Edit role'))}"><i class="fa fa-pencil"></i></button>
+                    <button class="delete-user-btn delete-role-btn" title="${escapeHTML(t('roles.delete', 'Delete role'))}"><i class="fa fa-trash"></i></button>
+                </div>
+                `}
+            </div>
+        `).join('');
+
+        rolesList.querySelectorAll('.edit-role-btn').forEach(button => {
+            button.addEventListener('click', () => {
+                const name = button.closest('.user-item').getAttribute('data-role');
+                editRole(roles.find(role => role.name === name));
+            });
+        });
+        rolesList.querySelectorAll('.delete-role-btn').forEach(button => {
+            button.addEventListener('click', () => {
+                deleteItem('roles', button.closest('.user-item').getAttribute('data-role'));
+            });
+        });
+    }
+
+    function renderGroups(groups) {
+        if (!groupsList) return;
+
+        if (groups.length === 0) {
+            groupsList.innerHTML = `<div class="empty-message">${escapeHTML(t('groups.none', 'No groups yet'))}</div>`;
+            return;
+        }
+
+        groupsList.innerHTML = groups.map(group => `
+            <div class="user-item" data-group="${escapeHTML(group.name)}">
+                <div class="user-info">
+                    <span class="username">${escapeHTML(group.name)}</span>
+                    ${(group.roles || []).map(role => `<span class="role-badge role-${['admin', 'editor', 'viewer'].includes(role) ? role : 'custom'}">${escapeHTML(roleName(role))}</span>`).join('')}
+                    <div class="form-help">${escapeHTML(group.members.join(', '))}</div>
+                </div>
+                <div class="user-actions">
+                    <button class="edit-user-btn edit-group-btn" title="${escapeHTML(t('groups.edit', 'Edit group'))}"><i class="fa fa-pencil"></i></button>
+                    <button class="delete-user-btn delete-group-btn" title="${escapeHTML(t('groups.delete', 'Delete group'))}"><i class="fa fa-trash"></i></button>
+                </div>
+            </div>
+        `).join('');
+
+        groupsList.querySelectorAll('.edit-group-btn').forEach(button => {
+            button.addEventListener('click', () => {
+                const name = button.closest('.user-item').getAttribute('data-group');
+                editGroup(groups.find(group => group.name === name));
+            });
+        });
+        groupsList.querySelectorAll('.delete-group-btn').forEach(button => {
+            button.addEventListener('click', () => {
+                deleteItem('groups', button.closest('.user-item').getAttribute('data-group'));
+            });
+        });
+    }
+
+    function resetRoleForm() {
+        if (!roleForm) return;
+        roleForm.reset();
+        roleNameInput.disabled = false;
+        roleFormTitle.textContent = t('roles.add_title', 'Add Role');
+    }
+
+    function editRole(role) {
+        if (!role) return;
+        roleNameInput.value = role.name;
+        roleNameInput.disabled = true;
+        roleDescriptionInput.value = role.description || '';
+        setChecked(rolePermissions, role.permissions);
+        roleFormTitle.textContent = `${t('roles.edit', 'Edit role')}: ${role.name}`;
+    }
+
+    function resetGroupForm() {
+        if (!groupForm) return;
+        groupForm.reset();
+        groupNameInput.disabled = false;
+        groupFormTitle.textContent = t('groups.add_title', 'Add Group');
+    }
+
+    function editGroup(group) {
+        if (!group) return;
+        groupNameInput.value = group.name;
+        groupNameInput.disabled = true;
+        groupDescriptionInput.value = group.description || '';
+        groupMembersInput.value = group.members.join(', ');
+        setChecked(groupRoles, group.roles || []);
+        groupFormTitle.textContent = `${t('groups.edit', 'Edit group')}: ${group.name}`;
+    }
+
+    async function saveRole(e) {
+        e.preventDefault();
+        try {
+            await request('/api/roles', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({
+                    name: roleNameInput.value.trim(),
+                    description: roleDescriptionInput.value.trim(),
+                    permissions: checkedValues(rolePermissions)
+                })
+            }, 'Failed to save role');
+            await reload();
+        } catch (error) {
+            window.DialogSystem.showMessageDialog(t('roles.save_failed', 'Saving Failed'), error.message);
+        }
+    }
+
+    async function saveGroup(e) {
+        e.preventDefault();
+        try {
+            await request('/api/groups', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({
+                    name: groupNameInput.value.trim(),
+                    description: groupDescriptionInput.value.trim(),
+                    members: groupMembersInput.value.split(',').map(member => member.trim()).filter(Boolean),
+                    roles: checkedValues(groupRoles)
+                })
+            }, 'Failed to save group');
+            await reload();
+        } catch (error) {
+            window.DialogSystem.showMessageDialog(t('roles.save_failed', 'Saving Failed'), error.message);
+        }
+    }
+
+    // Function to delete a role or group after confirmation
+    function deleteItem(kind, name) {
+        const title = kind === 'roles' ? t('roles.delete', 'Delete role') : t('groups.delete', 'Delete group');
+        const message = t('roles.delete_confirm', 'Are you sure you want to delete "{0}"?').replace('{0}', name);
+
+        window.DialogSystem.showConfirmDialog(title, message, async (confirmed) => {
+            if (!confirmed) {
+                return;
+            }
+            try {
+                await request(`/api/${kind}?name=${encodeURIComponent(name)}`, { method: 'DELETE' }, 'Failed to delete');
+                await reload();
+            } catch (error) {
+                window.DialogSystem.showMessageDialog(t('roles.delete_failed', 'Delete Failed'), error.message);
+            }
+        });
+    }
+
+    // Function to reload roles and groups along with the users that show them
+    async function reload() {
+        await load();
+        if (window.SettingsManager && window.SettingsManager.loadUsers) {
+            window.SettingsManager.loadUsers();
+        }
+    }
+
+    if (roleForm) {
+        roleForm.addEventListener('submit', saveRole);
+    }
+    if (clearRoleBtn) {
+        clearRoleBtn.addEventListener('click', resetRoleForm);
+    }
+    if (groupForm) {
+        groupForm.addEventListener('submit', saveGroup);
+    }
+    if (clearGroupBtn) {
+        clearGroupBtn.addEventListener('click', resetGroupForm);
+    }
+
+    // Expose public API
+    window.RolesManager = {
+        load: load,
+        populateRoleSelect: populateRoleSelect,
+        roleName: roleName
+    };
+})();
@@ -60,6 +60,12 @@ const WikiSearch = (function() {
      * @param {string} query - The search query
      */
     async function performSearch(query) {
+        // Static exports ship a prebuilt index instead of the search API
+        if (window.STATIC_SEARCH_INDEX) {
+            displaySearchResults(searchStaticIndex(query), query);
+            return;
+        }
+
         try {
             const response = await fetch('/api/search', {
                 method: 'POST',
@@ -89,6 +95,52 @@ const WikiSearch = (function() {
         }
     }
 
+    /**
+     * Search the prebuilt index of a static export, mirroring the server-side query syntax
+     * @param {string} query - The search query
+     * @returns {Array} Matching results with paths relative to the current page
+     */
+    function searchStaticIndex(query) {
+        const index = window.STATIC_SEARCH_INDEX;
+        const phrases = [];
+        const include = [];
+        const exclude = [];
+
+        // Extract exact phrases (text within quotes)
+        const remaining = query.replace(/"([^"]+)"/g, function(_, phrase) {
+            phrases.push(phrase.toLowerCase());
+            return ' ';
+        });
+
+        // Split remaining words into included and excluded terms
+        const words = remaining.split(/\s+/).filter(Boolean);
+        for (let i = 0; i < words.length; i++) {
+            const word = words[i].toLowerCase();
+            if (word === 'not' && i + 1 < words.length) {
+                exclude.push(words[++i].toLowerCase());
+            } else if (word !== 'and') {
+                include.push(word);
+            }
+        }
+
+        return index.pages.filter(function(page) {
+            return phrases.every(p => page.content.includes(p)) &&
+                include.every(w => page.content.includes(w)) &&
+                !exclude.some(w => page.content.includes(w));
+        }).map(function(page) {
+            const needle = phrases[0] || include[0] || '';
+            const pos = Math.max(0, page.content.indexOf(needle) - 100);
+            let excerpt = page.content.substring(pos, pos + 200);
+            if (pos > 0) excerpt = '...' + excerpt;
+            if (pos + 200 < page.content.length) excerpt += '...';
+            return {
+                title: page.title,
+                path: index.root + page.path,
+                excerpt: excerpt
+            };
+        });
+    }
+
     /**
      * Display search results in the UI
      * @param {Array} results - Search results from the API
@@ -18,8 +18,8 @@ document.addEventListener('DOMContentLoaded', function() {
     const contentSettingsForm = document.getElementById('contentSettingsForm');
     const securitySettingsForm = document.getElementById('securitySettingsForm');
     const settingsErrorMessage = settingsDialog.querySelector('.error-message');
-    const tabButtons = document.querySelectorAll('.tab-button');
-    const tabPanes = document.querySelectorAll('.tab-pane');
+    const tabButtons = settingsDialog.querySelectorAll('.tab-button');
+    const tabPanes = settingsDialog.querySelectorAll('.tab-pane');
 
     // Tab switching
     tabButtons.forEach(button => {
@@ -65,24 +65,7 @@ document.addEventListener('DOMContentLoaded', function() {
                     loadSettings();
 
                     // Explicitly reset and activate the first tab when opening settings
-                    setTimeout(() => {
-                        const firstTabButton = document.querySelector('.settings-tabs .tab-button[data-tab="general-tab"]');
-                        const firstTabPane = document.getElementById('general-tab');
-
-                        if (firstTabButton && firstTabPane) {
-                            // Reset all tabs first
-                            document.querySelectorAll('.settings-tabs .tab-button').forEach(btn => {
-                                btn.classList.remove('active');
-                            });
-                            document.querySelectorAll('.tab-pane').forEach(pane => {
-                                pane.classList.remove('active');
-                            });
-
-                            // Activate the first tab
-                            firstTabButton.classList.add('active');
-                            firstTabPane.classList.add('active');
-                        }
-                    }, 50); // Small delay to ensure dialog is rendered
+                    setTimeout(activateFirstTab, 50); // Small delay to ensure dialog is rendered
                 } else {
                     window.Auth.showAdminOnlyError();
                 }
@@ -166,7 +149,8 @@ document.addEventListener('DOMContentLoaded', function() {
             'loginBanMaxFailures',
             'loginBanWindow',
             'loginBanInitial',
-            'loginBanMax'
+            'loginBanMax',
+            'loginBanAllowlist'
         ];
 
         function updateLoginBanFields() {
@@ -250,8 +234,53 @@ document.addEventListener('DOMContentLoaded', function() {
     }
 
     // Function to load settings from the server
+    // Function to activate the first tab the user's permissions show
+    function activateFirstTab() {
+        const firstTabButton = Array.from(tabButtons).find(btn => btn.style.display !== 'none');
+        if (!firstTabButton) return;
+        const firstTabPane = document.getElementById(firstTabButton.getAttribute('data-tab'));
+
+        if (firstTabPane) {
+            // Reset all tabs first
+            tabButtons.forEach(btn => btn.classList.remove('active'));
+            tabPanes.forEach(pane => pane.classList.remove('active'));
+
+            // Activate the first tab
+            firstTabButton.classList.add('active');
+            firstTabPane.classList.add('active');
+        }
+    }
+
     async function loadSettings() {
         try {
+            // Only show the tabs the user's permissions reach
+            const permissions = await window.Auth.getPermissions() || [];
+            const canManageSettings = permissions.includes('settings.manage');
+            const canManageUsers = permissions.includes('user.manage');
+            const tabPermissions = {
+                'general-tab': canManageSettings,
+                'security-tab': canManageSettings,
+                'content-tab': canManageSettings,
+                'users-tab': canManageUsers,
+                'roles-tab': canManageUsers,
+                'import-tab': permissions.includes('content.import')
+            };
+            tabButtons.forEach(btn => {
+                btn.style.display = tabPermissions[btn.getAttribute('data-tab')] === false ? 'none' : '';
+            });
+
+            if (canManageUsers) {
+                // Load users and roles for the users and roles tabs
+                loadUsers();
+            }
+
+            if (!canManageSettings) {
+                settingsDialog.classList.add('active');
+                settingsErrorMessage.style.display = 'none';
+                activateFirstTab();
+                return;
+            }
+
             const response = await fetch('/api/settings/wiki');
             if (!response.ok) {
                 throw new Error('Failed to fetch settings');
@@ -290,30 +319,12 @@ document.addEventListener('DOMContentLoaded', function() {
                 console.log(`Disable file upload checking: ${disableFileUploadChecking}`);
             }
 
-            // Load users for the users tab
-            loadUsers();
-
             // Show dialog
             settingsDialog.classList.add('active');
             settingsErrorMessage.style.display = 'none';
 
             // Ensure the first tab is active by default
-            const firstTabButton = document.querySelector('.settings-tabs .tab-button[data-tab="general-tab"]');
-            const firstTabPane = document.getElementById('general-tab');
-
-            if (firstTabButton && firstTabPane) {
-                // Reset all tabs first
-                document.querySelectorAll('.settings-tabs .tab-button').forEach(btn => {
-                    btn.classList.remove('active');
-                });
-                document.querySelectorAll('.settings-dialog .tab-pane').forEach(pane => {
-                    pane.classList.remove('active');
-                });
-
-                // Activate the first tab
-                firstTabButton.classList.add('active');
-                firstTabPane.classList.add('active');
-            }
+            activateFirstTab();
 
             // Another request for security
             try {
@@ -325,6 +336,26 @@ document.addEventListener('DOMContentLoaded', function() {
                     document.getElementById('loginBanWindow').value = sec.login_ban.window_seconds;
                     document.getElementById('loginBanInitial').value = sec.login_ban.initial_ban_seconds;
                     document.getElementById('loginBanMax').value = sec.login_ban.max_ban_seconds;
+                    document.getElementById('loginBanAllowlist').value = sec.login_ban.allowlist || '';
+                    document.getElementById('twoFactorRequireAdmins').checked = sec.two_factor.require_for_admins;
+                    document.getElementById('twoFactorRequireEditors').checked = sec.two_factor.require_for_editors;
+                    document.getElementById('passwordMinLength').value = sec.password_policy.min_length;
+                    document.getElementById('passwordCheckBreached').checked = sec.password_policy.check_breached;
+                    document.getElementById('registrationEnabled').checked = sec.registration.enabled;
+
+                    // Custom roles may not be loaded yet
+                    const defaultRoleSelect = document.getElementById('registrationDefaultRole');
+                    if (window.RolesManager) {
+                        window.RolesManager.populateRoleSelect(defaultRoleSelect);
+                    }
+                    if (!Array.from(defaultRoleSelect.options).some(option => option.value === sec.registration.default_role)) {
+                        defaultRoleSelect.add(new Option(sec.registration.default_role, sec.registration.default_role));
+                    }
+                    defaultRoleSelect.value = sec.registration.default_role;
+
+                    if (window.LoginBansManager) {
+                        window.LoginBansManager.load();
+                    }
                 }
             } catch (e) {}
         } catch (error) {
@@ -347,6 +378,9 @@ document.addEventListener('DOMContentLoaded', function() {
     const passwordInput = document.getElementById('userFormPassword');
     const passwordHelp = document.getElementById('password-help');
     const userRoleSelect = document.getElementById('userRole');
+    const displayNameInput = document.getElementById('userFormDisplayName');
+    const emailInput = document.getElementById('userFormEmail');
+    const disabledInput = document.getElementById('userFormDisabled');
     const saveUserBtn = document.getElementById('saveUserBtn');
     const cancelUserBtn = document.getElementById('cancelUserBtn');
 
@@ -378,7 +412,16 @@ document.addEventListener('DOMContentLoaded', function() {
                 throw new Error('Failed to load users');
             }
             const data = await response.json();
+
+            // Custom roles are offered next to the built-in ones
+            if (window.RolesManager) {
+                await window.RolesManager.load();
+                window.RolesManager.populateRoleSelect(userRoleSelect);
+            }
             renderUsersList(data.users);
+            if (window.InvitationsManager) {
+                window.InvitationsManager.load();
+            }
 
             // Create "Add New User" button if it doesn't exist
             if (!usersListContainer.querySelector('.add-user-btn')) {
@@ -420,43 +463,87 @@ document.addEventListener('DOMContentLoaded', function() {
             const roleA = a.role || (a.is_admin ? 'admin' : 'viewer');
             const roleB = b.role || (b.is_admin ? 'admin' : 'viewer');
 
-            // Define role priority (admin > editor > viewer)
+            // Define role priority (admin > editor > viewer > custom roles)
             const rolePriority = { 'admin': 0, 'editor': 1, 'viewer': 2 };
+            const priorityA = rolePriority[roleA] ?? 3;
+            const priorityB = rolePriority[roleB] ?? 3;
 
             // Sort by role priority first
-            if (rolePriority[roleA] !== rolePriority[roleB]) {
-                return rolePriority[roleA] - rolePriority[roleB];
+            if (priorityA !== priorityB) {
+                return priorityA - priorityB;
             }
 
             // If same role, sort alphabetically
             return a.username.localeCompare(b.username);
         });
 
+        // Users by name, for the edit buttons
+        const usersByName = {};
+        users.forEach(user => {
+            usersByName[user.username] = user;
+        });
+
+        const escapeHTML = (text) => {
+            const div = document.createElement('div');
+            div.textContent = text == null ? '' : String(text);
+            return div.innerHTML;
+        };
+
         const html = users.map(user => {
             const isCurrentUser = user.username === currentUsername;
             // Get role with fallback for backward compatibility
             const role = user.role || (user.is_admin ? 'admin' : 'viewer');
 
             // Get role display name
+            const isBuiltinRole = ['admin', 'editor', 'viewer'].includes(role);
             let roleDisplay = role.charAt(0).toUpperCase() + role.slice(1);
-            if (window.i18n && window.i18n.t) {
+            if (window.RolesManager) {
+                roleDisplay = window.RolesManager.roleName(role);
+            } else if (isBuiltinRole && window.i18n && window.i18n.t) {
                 roleDisplay = window.i18n.t(`users.role_${role}`);
             }
 
             // Set role badge class based on role
-            const roleBadgeClass = `role-badge role-${role}`;
+            const roleBadgeClass = `role-badge role-${isBuiltinRole ? role : 'custom'}`;
+
+            // Show when the user last logged in on hover
+            const lastLogin = user.last_login ?
+                `${window.i18n ? window.i18n.t('users.last_login') : 'Last login'}: ${new Date(user.last_login).toLocaleString()}` :
+                (window.i18n ? window.i18n.t('users.never_logged_in') : 'Never logged in');
 
             return `
-                <div class="user-item" data-username="${user.username}">
-                    <div class="user-info">
+                <div class="user-item${user.disabled ? ' user-disabled' : ''}" data-username="${user.username}">
+                    <div class="user-info" title="${escapeHTML(lastLogin)}">
                         <span class="username">${user.username}</span>
+                        ${user.display_name ? `<span class="display-name">${escapeHTML(user.display_name)}</span>` : ''}
                         <span class="${roleBadgeClass}">${roleDisplay}</span>
+                        ${user.source ? `<span class="source-badge">${window.i18n ? window.i18n.t(`users.source_${user.source}`) : user.source.toUpperCase()}</span>` : ''}
+                        ${user.pending ? `<span class="pending-badge">${window.i18n ? window.i18n.t('users.pending') : 'Pending'}</span>` : ''}
+                        ${user.disabled ? `<span class="disabled-badge">${window.i18n ? window.i18n.t('users.disabled') : 'Disabled'}</span>` : ''}
                         ${isCurrentUser ? `<span class="current-user-badge">${window.i18n ? window.i18n.t('common.you') : 'You'}</span>` : ''}
                     </div>
                     <div class="user-actions">
-                        <button class="edit-user-btn" title="Edit user" data-username="${user.username}" data-user='${JSON.stringify({role: role, is_admin: user.is_admin})}'>
+                        ${user.pending ? `
+                        <button class="approve-user-btn" title="${window.i18n ? window.i18n.t('users.approve') : 'Approve'}" data-username="${user.username}">
+                            <i class="fa fa-check"></i>
+                        </button>
+                        ` : ''}
+                        <button class="edit-user-btn" title="Edit user" data-username="${user.username}">
                             <i class="fa fa-pencil"></i>
                         </button>
+                        <button class="revoke-sessions-btn" title="${window.i18n ? window.i18n.t('users.revoke_sessions') : 'Revoke Sessions'}" data-username="${user.username}">
+                            <i class="fa fa-sign-out"></i>
+                        </button>
+                        ${!user.source ? `
+                        <button class="reset-password-btn" title="${window.i18n ? window.i18n.t('users.reset_password') : 'Create Password Reset Link'}" data-username="${user.username}">
+                            <i class="fa fa-key"></i>
+                        </button>
+                        ` : ''}
+                        ${user.twoFactor ? `
+                        <button class="reset-two-factor-btn" title="${window.i18n ? window.i18n.t('users.reset_two_factor') : 'Reset Two-Factor Authentication'}" data-username="${user.username}">
+                            <i class="fa fa-mobile"></i>
+                        </button>
+                        ` : ''}
                         ${!isCurrentUser ? `
                         <button class="delete-user-btn" title="Delete user" data-username="${user.username}">
                             <i class="fa fa-trash"></i>
@@ -473,8 +560,7 @@ document.addEventListener('DOMContentLoaded', function() {
         usersList.querySelectorAll('.edit-user-btn').forEach(button => {
             button.addEventListener('click', () => {
                 const username = button.getAttribute('data-username');
-                const userData = JSON.parse(button.getAttribute('data-user'));
-                editUser(username, userData);
+                editUser(username, usersByName[username]);
             });
         });
 
@@ -484,6 +570,34 @@ document.addEventListener('DOMContentLoaded', function() {
                 deleteUser(username);
             });
         });
+
+        usersList.querySelectorAll('.revoke-sessions-btn').forEach(button => {
+            button.addEventListener('click', () => {
+                const username = button.getAttribute('data-username');
+                revokeUserSessions(username);
+            });
+        });
+
+        usersList.querySelectorAll('.reset-password-btn').forEach(button => {
+            button.addEventListener('click', () => {
+                const username = button.getAttribute('data-username');
+                createPasswordResetLink(username);
+            });
+        });
+
+        usersList.querySelectorAll('.approve-user-btn').forEach(button => {
+            button.addEventListener('click', () => {
+                const username = button.getAttribute('data-username');
+                approveUser(username);
+            });
+        });
+
+        usersList.querySelectorAll('.reset-two-factor-btn').forEach(button => {
+            button.addEventListener('click', () => {
+                const username = button.getAttribute('data-username');
+                resetUserTwoFactor(username);
+            });
+        });
     }
 
     // Function to reset the user form (for adding a new user)
@@ -497,6 +611,10 @@ document.addEventListener('DOMContentLoaded', function() {
         passwordHelp.style.display = 'none';
         passwordInput.required = true;
         userRoleSelect.value = 'viewer'; // Default to viewer
+        displayNameInput.value = '';
+        emailInput.value = '';
+        disabledInput.checked = false;
+        disabledInput.disabled = false;
         saveUserBtn.textContent = 'Add User';
         saveUserBtn.setAttribute('data-i18n', 'users.add_button');
 
@@ -536,6 +654,16 @@ document.addEventListener('DOMContentLoaded', function() {
             // For backward compatibility
             userRoleSelect.value = user.is_admin ? 'admin' : 'viewer';
         }
+        displayNameInput.value = user.display_name || '';
+        emailInput.value = user.email || '';
+        disabledInput.checked = !!user.disabled;
+
+        // You can't disable your own account
+        const currentUsername = document.cookie
+            .split('; ')
+            .find(row => row.startsWith('session_user='))
+            ?.split('=')[1];
+        disabledInput.disabled = username === currentUsername;
         saveUserBtn.textContent = 'Update User';
         saveUserBtn.setAttribute('data-i18n', 'users.update_button');
 
@@ -570,6 +698,9 @@ document.addEventListener('DOMContentLoaded', function() {
         const username = userFormUsernameInput.value.trim();
         const password = passwordInput.value;
         const role = userRoleSelect.value;
+        const displayName = displayNameInput.value.trim();
+        const email = emailInput.value.trim();
+        const disabled = disabledInput.checked;
 
         if (!username) {
             window.DialogSystem.showMessageDialog("Form Error", "Username is required");
@@ -594,7 +725,10 @@ document.addEventListener('DOMContentLoaded', function() {
                     body: JSON.stringify({
                         username,
                         password,
-                        role: role
+                        role: role,
+                        display_name: displayName,
+                        email: email,
+                        disabled: disabled
                     })
                 });
             } else {
@@ -607,7 +741,10 @@ document.addEventListener('DOMContentLoaded', function() {
                     body: JSON.stringify({
                         username,
                         new_password: password || undefined,
-                        role: role
+                        role: role,
+                        display_name: displayName,
+                        email: email,
+                        disabled: disabled
                     })
                 });
             }
@@ -671,6 +808,120 @@ document.addEventListener('DOMContentLoaded', function() {
         );
     }
 
+    // Function to log a user out of all their sessions
+    async function revokeUserSessions(username) {
+        const title = window.i18n ? window.i18n.t('users.revoke_sessions') : "Revoke Sessions";
+        const message = window.i18n ?
+            window.i18n.t('users.revoke_sessions_confirm').replace('{0}', username) :
+            `Log "${username}" out of all sessions?`;
+
+        window.DialogSystem.showConfirmDialog(
+            title,
+            message,
+            async (confirmed) => {
+                if (!confirmed) {
+                    return;
+                }
+
+                try {
+                    const response = await fetch(`/api/users/sessions?username=${encodeURIComponent(username)}`, {
+                        method: 'DELETE'
+                    });
+
+                    if (!response.ok) {
+                        const errorData = await response.json().catch(() => null);
+                        throw new Error(errorData?.message || 'Failed to revoke sessions');
+                    }
+
+                    const data = await response.json();
+                    const done = window.i18n ?
+                        window.i18n.t('users.sessions_revoked').replace('{0}', data.count) :
+                        `${data.count} session(s) revoked`;
+                    window.DialogSystem.showMessageDialog(title, done);
+                } catch (error) {
+                    console.error('Error revoking sessions:', error);
+                    window.DialogSystem.showMessageDialog(title, error.message || 'Failed to revoke sessions');
+                }
+            }
+        );
+    }
+
+    // Function to remove the second factor of a user who lost their device
+    async function resetUserTwoFactor(username) {
+        const title = window.i18n ? window.i18n.t('users.reset_two_factor') : "Reset Two-Factor Authentication";
+        const message = window.i18n ?
+            window.i18n.t('users.reset_two_factor_confirm').replace('{0}', username) :
+            `Remove two-factor authentication from "${username}"?`;
+
+        window.DialogSystem.showConfirmDialog(
+            title,
+            message,
+            async (confirmed) => {
+                if (!confirmed) {
+                    return;
+                }
+
+                try {
+                    const response = await fetch(`/api/users/2fa?username=${encodeURIComponent(username)}`, {
+                        method: 'DELETE'
+                    });
+
+                    if (!response.ok) {
+                        const errorData = await response.json().catch(() => null);
+                        throw new Error(errorData?.message || 'Failed to reset two-factor authentication');
+                    }
+
+                    loadUsers();
+                } catch (error) {
+                    console.error('Error resetting two-factor authentication:', error);
+                    window.DialogSystem.showMessageDialog(title, error.message || 'Failed to reset two-factor authentication');
+                }
+            }
+        );
+    }
+
+    // Function to create a password reset link for a user, to be shared out of band
+    async function createPasswordResetLink(username) {
+        const title = window.i18n ? window.i18n.t('users.reset_password') : 'Create Password Reset Link';
+        try {
+            const response = await fetch(`/api/users/password-reset?username=${encodeURIComponent(username)}`, {
+                method: 'POST'
+            });
+            const data = await response.json().catch(() => null);
+            if (!response.ok || !data) {
+                throw new Error(data?.message || 'Failed to create password reset link');
+            }
+
+            // The link is only shown once, the server keeps a hash of it
+            const message = window.i18n ?
+                window.i18n.t('users.reset_password_link').replace('{0}', username) :
+                `Send this link to ${username}. It works once and logs them out everywhere:`;
+            window.DialogSystem.showMessageDialog(title, `${message}\n\n${window.location.origin}${data.link}`);
+        } catch (error) {
+            console.error('Error creating password reset link:', error);
+            window.DialogSystem.showMessageDialog(title, error.message || 'Failed to create password reset link');
+        }
+    }
+
+    // Function to approve a self-registered user
+    async function approveUser(username) {
+        try {
+            const response = await fetch(`/api/users/approve?username=${encodeURIComponent(username)}`, {
+                method: 'POST'
+            });
+
+            if (!response.ok) {
+                const errorData = await response.json().catch(() => null);
+                throw new Error(errorData?.message || 'Failed to approve user');
+            }
+
+            loadUsers();
+        } catch (error) {
+            console.error('Error approving user:', error);
+            window.DialogSystem.showMessageDialog(window.i18n ? window.i18n.t('users.approve') : 'Approve', error.message || 'Failed to approve user');
+        }
+    }
+
     // Function to fetch max upload size from server
     async function fetchMaxUploadSize() {
         try {
@@ -705,7 +956,20 @@ document.addEventListener('DOMContentLoaded', function() {
                 max_failures: parseInt(document.getElementById('loginBanMaxFailures').value, 10) || 3,
                 window_seconds: parseInt(document.getElementById('loginBanWindow').value, 10) || 30,
                 initial_ban_seconds: parseInt(document.getElementById('loginBanInitial').value, 10) || 60,
-                max_ban_seconds: parseInt(document.getElementById('loginBanMax').value, 10) || 86400
+                max_ban_seconds: parseInt(document.getElementById('loginBanMax').value, 10) || 86400,
+                allowlist: document.getElementById('loginBanAllowlist').value.trim()
+            },
+            two_factor: {
+                require_for_admins: document.getElementById('twoFactorRequireAdmins').checked,
+                require_for_editors: document.getElementById('twoFactorRequireEditors').checked
+            },
+            password_policy: {
+                min_length: parseInt(document.getElementById('passwordMinLength').value, 10) || 8,
+                check_breached: document.getElementById('passwordCheckBreached').checked
+            },
+            registration: {
+                enabled: document.getElementById('registrationEnabled').checked,
+                default_role: document.getElementById('registrationDefaultRole').value
             }
         };
 
@@ -719,7 +983,7 @@ document.addEventListener('DOMContentLoaded', function() {
                 // reload to apply new policy without restart
                 window.location.reload();
             } else {
-                settingsErrorMessage.textContent = 'Failed to save security settings';
+                settingsErrorMessage.textContent = (await resp.text()).trim() || 'Failed to save security settings';
                 settingsErrorMessage.style.display = 'block';
             }
         } catch (e) {
@@ -734,6 +998,7 @@ document.addEventListener('DOMContentLoaded', function() {
         hideSettingsDialog,
         fetchMaxUploadSize,
         loadSettings,
+        loadUsers,
         maxFileUploadSizeMB: () => maxFileUploadSizeMB,
         maxFileUploadSizeBytes: () => maxFileUploadSizeBytes,
         isFileUploadCheckingDisabled: () => disableFileUploadChecking
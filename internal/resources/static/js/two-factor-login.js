@@ -0,0 +1,119 @@
+// Two-Factor Login Module
+// Handles the second login step, and the setup of an authenticator app when the role requires one
+(function() {
+    'use strict';
+
+    // Translate a key, with a fallback for when i18n isn't loaded
+    function t(key, fallback) {
+        return window.i18n ? window.i18n.t(key) : fallback;
+    }
+
+    // Show an error in the login container
+    function showError(container, message) {
+        const errorMessage = container.querySelector('.error-message');
+        errorMessage.textContent = message;
+        errorMessage.style.display = 'block';
+    }
+
+    // Go back to the username and password form
+    function reset(container) {
+        const form = container.querySelector('.two-factor-form');
+        if (!form) return;
+
+        container.querySelector('#loginForm').style.display = '';
+        form.style.display = 'none';
+        form.reset();
+        container.querySelector('.two-factor-setup').style.display = 'none';
+        container.querySelector('.two-factor-recovery').style.display = 'none';
+        delete container.dataset.challenge;
+    }
+
+    // Switch the login container to the code step. onSuccess runs once the user is logged in.
+    async function start(container, loginData, onSuccess) {
+        const form = container.querySelector('.two-factor-form');
+        const setup = container.querySelector('.two-factor-setup');
+        const codeInput = form.querySelector('input[name="code"]');
+
+        container.dataset.challenge = loginData.challenge;
+        container.querySelector('#loginForm').style.display = 'none';
+        container.querySelector('.error-message').style.display = 'none';
+        form.style.display = '';
+        setup.style.display = 'none';
+
+        // Users who have to set up two-factor authentication get the QR code first
+        if (loginData.setup) {
+            try {
+                const response = await fetch('/api/login/2fa/setup', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ challenge: loginData.challenge })
+                });
+                const data = await response.json();
+                if (!response.ok) {
+                    throw new Error(data.message || 'Failed to set up two-factor authentication');
+                }
+                container.querySelector('.two-factor-qr').innerHTML = data.qrCode || '';
+                container.querySelector('.two-factor-secret').textContent = data.secret;
+                setup.style.display = '';
+            } catch (error) {
+                console.error('Two-factor setup error:', error);
+                reset(container);
+                showError(container, error.message);
+                return;
+            }
+        }
+
+        form.onsubmit = (e) => {
+            e.preventDefault();
+            verify(container, codeInput.value.trim(), onSuccess);
+        };
+        setTimeout(() => codeInput.focus(), 100);
+    }
+
+    // Send the code, and finish the login
+    async function verify(container, code, onSuccess) {
+        try {
+            const response = await fetch('/api/login/2fa', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ challenge: container.dataset.challenge, code })
+            });
+            const data = await response.json().catch(() => ({}));
+
+            if (response.ok) {
+                // A new setup comes with recovery codes, which are only shown once
+                if (data.recoveryCodes && data.recoveryCodes.length) {
+                    container.querySelector('.two-factor-form').style.display = 'none';
+                    const recovery = container.querySelector('.two-factor-recovery');
+                    recovery.querySelector('.two-factor-recovery-codes').textContent = data.recoveryCodes.join('\n');
+                    recovery.style.display = '';
+                    recovery.querySelector('.two-factor-continue').onclick = onSuccess;
+                    return;
+                }
+                onSuccess();
+                return;
+            }
+
+            let msg = t('two_factor.invalid_code', 'Invalid code');
+            if (response.status === 429 && data.message) {
+                msg = data.message;
+                if (data.retryAfter) {
+                    msg += ` (${t('login.retry_in', 'retry in')} ${data.retryAfter}s)`;
+                }
+            } else if (data.message && data.message !== 'Invalid code') {
+                // The login expired, so start over with the password
+                msg = data.message;
+                reset(container);
+            }
+            showError(container, msg);
+        } catch (error) {
+            console.error('Two-factor login error:', error);
+            showError(container, 'An error occurred. Please try again.');
+        }
+    }
+
+    window.TwoFactorLogin = {
+        start,
+        reset
+    };
+})();
@@ -4,10 +4,59 @@ package roles
 const (
 	// RoleAdmin can do anything from document actions to changing settings and creating/deleting comments
 	RoleAdmin = "admin"
-	
+
 	// RoleEditor can only do document actions and post comments
 	RoleEditor = "editor"
-	
+
 	// RoleViewer can only view documents and post comments
 	RoleViewer = "viewer"
 )
+
+// Permission constants. A role is a set of these; handlers check them instead of role names.
+const (
+	PermPageEdit        = "page.edit"        // Create, edit, move and restore documents
+	PermPageDelete      = "page.delete"      // Delete documents
+	PermFileUpload      = "file.upload"      // Upload, rename and delete attachments
+	PermCommentModerate = "comment.moderate" // Delete other people's comments
+	PermContentImport   = "content.import"   // Import documents from archives
+	PermSettingsManage  = "settings.manage"  // Change the wiki and security settings
+	PermUserManage      = "user.manage"      // Manage users, their sessions, roles and groups
+	PermAccessBypass    = "access.bypass"    // Read and edit documents regardless of access rules
+	PermAuditView       = "audit.view"       // Read the audit log
+)
+
+// Permissions lists every permission, in the order the settings show them
+var Permissions = []string{
+	PermPageEdit,
+	PermPageDelete,
+	PermFileUpload,
+	PermCommentModerate,
+	PermContentImport,
+	PermSettingsManage,
+	PermUserManage,
+	PermAccessBypass,
+	PermAuditView,
+}
+
+// Presets are the permissions of the built-in roles, which can't be changed or removed
+var Presets = map[string][]string{
+	RoleAdmin:  Permissions,
+	RoleEditor: {PermPageEdit, PermPageDelete, PermFileUpload},
+	RoleViewer: {},
+}
+
+// IsBuiltin reports whether role is one of the built-in presets
+func IsBuiltin(role string) bool {
+	_, ok := Presets[role]
+	return ok
+}
+
+// IsPermission reports whether name is a known permission
+func IsPermission(name string) bool {
+	for _, permission := range Permissions {
+		if permission == name {
+			return true
+		}
+	}
+	return false
+}
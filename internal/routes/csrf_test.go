@@ -0,0 +1,63 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"wiki-go/internal/config"
+	"wiki-go/internal/csp"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Security.CSRF.TrustedOrigins = " https://app.example.com/ , https://tools.example.org"
+	handler := CSRFMiddleware(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		headers  map[string]string
+		expected int
+	}{
+		{name: "Cross-site read", method: http.MethodGet, headers: map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example.net"}, expected: http.StatusOK},
+		{name: "Not from a browser", method: http.MethodPost, expected: http.StatusOK},
+		{name: "Same origin", method: http.MethodPost, headers: map[string]string{"Sec-Fetch-Site": "same-origin", "Origin": "https://wiki.example.com"}, expected: http.StatusOK},
+		{name: "Typed by the user", method: http.MethodPost, headers: map[string]string{"Sec-Fetch-Site": "none"}, expected: http.StatusOK},
+		{name: "Cross-site", method: http.MethodPost, headers: map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example.net"}, expected: http.StatusForbidden},
+		{name: "Sibling subdomain", method: http.MethodDelete, headers: map[string]string{"Sec-Fetch-Site": "same-site", "Origin": "https://blog.example.com"}, expected: http.StatusForbidden},
+		{name: "Same origin without Sec-Fetch-Site", method: http.MethodPut, headers: map[string]string{"Origin": "https://wiki.example.com"}, expected: http.StatusOK},
+		{name: "Cross origin without Sec-Fetch-Site", method: http.MethodPut, headers: map[string]string{"Origin": "https://evil.example.net"}, expected: http.StatusForbidden},
+		{name: "Trusted origin", method: http.MethodPost, headers: map[string]string{"Sec-Fetch-Site": "same-site", "Origin": "https://app.example.com"}, expected: http.StatusOK},
+		{name: "Second trusted origin", method: http.MethodPost, headers: map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://tools.example.org"}, expected: http.StatusOK},
+		{name: "Trusted host on another scheme", method: http.MethodPost, headers: map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "http://app.example.com"}, expected: http.StatusForbidden},
+		{name: "Referer of the wiki", method: http.MethodPost, headers: map[string]string{"Referer": "https://wiki.example.com/docs/page"}, expected: http.StatusOK},
+		{name: "Referer of another site", method: http.MethodPost, headers: map[string]string{"Referer": "https://evil.example.net/form"}, expected: http.StatusForbidden},
+		{name: "Referer of a trusted origin", method: http.MethodPost, headers: map[string]string{"Referer": "https://app.example.com/page"}, expected: http.StatusOK},
+		{name: "Referer that doesn't parse", method: http.MethodPost, headers: map[string]string{"Referer": "https://[::1"}, expected: http.StatusForbidden},
+		{name: "Referer read", method: http.MethodGet, headers: map[string]string{"Referer": "https://evil.example.net/form"}, expected: http.StatusOK},
+		{name: "API token", method: http.MethodPost, headers: map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example.net", "Authorization": "Bearer wgo_id_secret"}, expected: http.StatusOK},
+		{name: "CSP report", method: http.MethodPost, path: csp.ReportPath, headers: map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example.net"}, expected: http.StatusOK},
+		{name: "Other path under the CSP report", method: http.MethodPost, path: csp.ReportPath + "/other", headers: map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example.net"}, expected: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.path
+			if path == "" {
+				path = "/api/save/docs/page"
+			}
+			r := httptest.NewRequest(tt.method, "https://wiki.example.com"+path, nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+			if rec.Code != tt.expected {
+				t.Errorf("Expected status %d, got: %d", tt.expected, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"wiki-go/internal/auth"
+	"wiki-go/internal/config"
+	"wiki-go/internal/ratelimit"
+)
+
+// RateLimitMiddleware throttles API requests with a token bucket per user, or per IP address for
+// requests without a login. Search, markdown rendering, comment posting and link metadata fetching
+// have budgets of their own, the remaining API requests share one. Pages and static files are not
+// limited, except for requests with an access token, which also count against their IP address.
+func RateLimitMiddleware(cfg *config.Config, next http.Handler) http.Handler {
+	limits := cfg.Security.RateLimit
+	if !limits.Enabled {
+		return next
+	}
+
+	limiters := map[string]*ratelimit.Limiter{
+		"api":      ratelimit.New(limits.APIPerMinute, limits.APIBurst),
+		"search":   ratelimit.New(limits.SearchPerMinute, limits.SearchBurst),
+		"render":   ratelimit.New(limits.RenderPerMinute, limits.RenderBurst),
+		"comments": ratelimit.New(limits.CommentsPerMinute, limits.CommentsBurst),
+		"metadata": ratelimit.New(limits.MetadataPerMinute, limits.MetadataBurst),
+	}
+
+	// limited takes a token from the bucket of key, or answers the request when it is empty
+	limited := func(w http.ResponseWriter, r *http.Request, class, key string) bool {
+		ok, wait := limiters[class].Allow(key)
+		if ok {
+			return false
+		}
+		log.Printf("Rate limited %s request to %s from %s", class, r.URL.Path, key)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "Too many requests, please try again later",
+		})
+		return true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class := rateLimitClass(r)
+		ipKey := "ip:" + auth.ClientIP(r)
+
+		// Checking an access token can cost a bcrypt comparison, so the address pays for the
+		// attempt before the token is looked at, whatever the path
+		bearer := auth.HasBearerToken(r)
+		if bearer {
+			if class == "" {
+				class = "api"
+			}
+			if limited(w, r, class, ipKey) {
+				return
+			}
+		}
+		if class == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if session := auth.GetSession(r); session != nil {
+			if limited(w, r, class, "user:"+session.Username) {
+				return
+			}
+		} else if !bearer && limited(w, r, class, ipKey) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitClass returns the budget a request counts against, or "" for requests that aren't limited
+func rateLimitClass(r *http.Request) string {
+	path := r.URL.Path
+	switch {
+	case path == "/api/search":
+		return "search"
+	case path == "/api/render-markdown":
+		return "render"
+	case path == "/api/links/fetch-metadata":
+		return "metadata"
+	case strings.HasPrefix(path, "/api/comments/add/"):
+		return "comments"
+	case strings.HasPrefix(path, "/api/"):
+		return "api"
+	}
+	return ""
+}
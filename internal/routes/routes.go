@@ -11,8 +11,10 @@ import (
 	"strings"
 	"wiki-go/internal/auth"
 	"wiki-go/internal/config"
+	"wiki-go/internal/csp"
 	"wiki-go/internal/handlers"
 	"wiki-go/internal/resources"
+	"wiki-go/internal/roles"
 )
 
 // addCacheControlHeaders adds appropriate Cache-Control headers based on file type
@@ -46,41 +48,16 @@ func addCacheControlHeaders(w http.ResponseWriter, filename string) {
 	}
 }
 
-// CSPMiddleware adds Content Security Policy headers to all responses
-func CSPMiddleware(next http.Handler) http.Handler {
+// CSPMiddleware adds the Content Security Policy and other security headers to all responses.
+// Each request gets a new nonce, which templates put on their inline scripts.
+func CSPMiddleware(cfg *config.Config, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set a less restrictive Content Security Policy that allows inline scripts and styles
-		csp := []string{
-			// Default to allowing same-origin resources and inline scripts/styles
-			"default-src 'self' 'unsafe-inline' 'unsafe-eval'",
-			// Allow inline styles and styles from same origin
-			"style-src 'self' 'unsafe-inline'",
-			// Allow scripts from same origin and inline scripts
-			"script-src 'self' 'unsafe-inline' 'unsafe-eval'",
-			// Images from same origin and data: URLs (for embedded images)
-			"img-src 'self' data: https://*.ytimg.com https://*.vimeocdn.com",
-			// Connect only to same origin
-			"connect-src 'self'",
-			// Fonts from same origin
-			"font-src 'self'",
-			// Allow object/embed only from same origin
-			"object-src 'self'",
-			// Media only from same origin
-			"media-src 'self' https://*.youtube.com https://*.vimeo.com",
-			// Allow frames from YouTube and Vimeo for video embeds
-			"frame-src 'self' https://*.youtube.com https://*.vimeo.com",
-			// Form submissions only to same origin
-			"form-action 'self'",
-			// Base URI restricted to same origin
-			"base-uri 'self'",
-		}
-
-		// Set the CSP header - using Content-Security-Policy-Report-Only first to avoid breaking things
-		// This will report violations but not enforce them
-		w.Header().Set("Content-Security-Policy-Report-Only", strings.Join(csp, "; "))
+		nonce := csp.NewNonce()
+		r = csp.WithNonce(r, nonce)
 
-		// Once you've fixed all the violations, you can switch to enforcing mode:
-		// w.Header().Set("Content-Security-Policy", strings.Join(csp, "; "))
+		// Report-only mode shows what the policy would block without breaking pages
+		w.Header().Set(csp.HeaderName(cfg.Security.CSP.Mode), csp.Policy(nonce))
+		w.Header().Set("Reporting-Endpoints", `csp="`+csp.ReportPath+`"`)
 
 		// Add other security headers
 		w.Header().Set("X-Content-Type-Options", "nosniff")
@@ -99,52 +76,6 @@ func CSPMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-/*
-// Example of how to implement nonce-based CSP (for future reference)
-func CSPMiddlewareWithNonce(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Generate a random nonce for this request
-		nonce := generateNonce()
-
-		// Store the nonce in the request context so templates can access it
-		ctx := context.WithValue(r.Context(), "csp-nonce", nonce)
-		r = r.WithContext(ctx)
-
-		// Set a strict Content Security Policy with nonce
-		csp := []string{
-			// Default to only allowing same-origin resources
-			"default-src 'self'",
-			// Allow styles from same origin and inline styles with nonce
-			fmt.Sprintf("style-src 'self' 'nonce-%s'", nonce),
-			// Allow scripts from same origin and inline scripts with nonce
-			fmt.Sprintf("script-src 'self' https://cdn.jsdelivr.net 'nonce-%s'", nonce),
-			// Images from same origin and data: URLs
-			"img-src 'self' data:",
-			// Other directives...
-		}
-
-		// Set the CSP header
-		w.Header().Set("Content-Security-Policy", strings.Join(csp, "; "))
-
-		// Add other security headers
-		w.Header().Set("X-Content-Type-Options", "nosniff")
-		w.Header().Set("X-Frame-Options", "SAMEORIGIN")
-		w.Header().Set("X-XSS-Protection", "1; mode=block")
-		w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
-
-		// Call the next handler
-		next.ServeHTTP(w, r)
-	})
-}
-
-// Generate a random nonce for CSP
-func generateNonce() string {
-	b := make([]byte, 16)
-	rand.Read(b)
-	return base64.StdEncoding.EncodeToString(b)
-}
-*/
-
 // Helper function to check if a file exists
 func fileExists(path string) bool {
 	_, err := os.Stat(path)
@@ -188,30 +119,15 @@ func SetupRoutes(cfg *config.Config) {
 	// Create a new ServeMux to apply middleware to all routes
 	mux := http.NewServeMux()
 
-	// Role-based middleware
-	adminMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
+	// Permission-based middleware
+	requirePermission := func(permission string, next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			if !auth.RequireRole(r, "admin") {
+			if !auth.RequirePermission(r, permission) {
 				w.Header().Set("Content-Type", "application/json")
 				w.WriteHeader(http.StatusForbidden)
 				json.NewEncoder(w).Encode(map[string]interface{}{
 					"success": false,
-					"message": "Admin access required",
-				})
-				return
-			}
-			next(w, r)
-		}
-	}
-
-	editorMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
-		return func(w http.ResponseWriter, r *http.Request) {
-			if !auth.RequireRole(r, "editor") {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusForbidden)
-				json.NewEncoder(w).Encode(map[string]interface{}{
-					"success": false,
-					"message": "Unauthorized. Admin or editor access required.",
+					"message": "Permission required: " + permission,
 				})
 				return
 			}
@@ -294,7 +210,18 @@ func SetupRoutes(cfg *config.Config) {
 	mux.HandleFunc("/api/login", handlers.LoginHandler)
 	mux.HandleFunc("/api/check-auth", handlers.CheckAuthHandler)
 	mux.HandleFunc("/api/logout", handlers.LogoutHandler)
+	mux.HandleFunc("/api/register", handlers.RegisterHandler)
+	mux.HandleFunc("/api/password-reset", handlers.PasswordResetHandler)
+	mux.HandleFunc("/api/password-reset/email", handlers.PasswordResetEmailHandler)
 	mux.HandleFunc("/api/check-default-password", handlers.CheckDefaultPasswordHandler)
+	mux.HandleFunc("/api/login/2fa", handlers.LoginTwoFactorHandler)
+	mux.HandleFunc("/api/login/2fa/setup", handlers.LoginTwoFactorSetupHandler)
+	mux.HandleFunc("/api/2fa", handlers.TwoFactorHandler)
+	mux.HandleFunc("/api/2fa/setup", handlers.TwoFactorSetupHandler)
+	mux.HandleFunc("/api/2fa/enable", handlers.TwoFactorEnableHandler)
+	mux.HandleFunc("/api/2fa/recovery-codes", handlers.TwoFactorRecoveryCodesHandler)
+	mux.HandleFunc("/api/oidc/login", handlers.OIDCLoginHandler)
+	mux.HandleFunc("/api/oidc/callback", handlers.OIDCCallbackHandler)
 	mux.HandleFunc("/api/document/create", handlers.CreateDocumentHandler)
 	mux.HandleFunc("/api/document/", handlers.DocumentHandler)
 	mux.HandleFunc("/api/source/", handlers.SourceHandler)
@@ -331,20 +258,41 @@ func SetupRoutes(cfg *config.Config) {
 		handlers.SearchHandler(w, r, cfg)
 	})
 
-	// Settings API - Admin only
-	mux.HandleFunc("/api/settings/wiki", adminMiddleware(handlers.WikiSettingsHandler))
-	mux.HandleFunc("/api/settings/security", adminMiddleware(handlers.SecuritySettingsHandler))
+	// Settings API - settings.manage permission
+	mux.HandleFunc("/api/settings/wiki", requirePermission(roles.PermSettingsManage, handlers.WikiSettingsHandler))
+	mux.HandleFunc("/api/settings/security", requirePermission(roles.PermSettingsManage, handlers.SecuritySettingsHandler))
+	mux.HandleFunc("/api/settings/security/bans", requirePermission(roles.PermSettingsManage, handlers.LoginBansHandler))
+
+	// User Management API - user.manage permission
+	mux.HandleFunc("/api/users", requirePermission(roles.PermUserManage, handlers.UsersHandler))
+	mux.HandleFunc("/api/users/sessions", requirePermission(roles.PermUserManage, handlers.UserSessionsHandler))
+	mux.HandleFunc("/api/users/2fa", requirePermission(roles.PermUserManage, handlers.UserTwoFactorHandler))
+	mux.HandleFunc("/api/roles", requirePermission(roles.PermUserManage, handlers.RolesHandler))
+	mux.HandleFunc("/api/groups", requirePermission(roles.PermUserManage, handlers.GroupsHandler))
+	mux.HandleFunc("/api/users/approve", requirePermission(roles.PermUserManage, handlers.ApproveUserHandler))
+	mux.HandleFunc("/api/users/password-reset", requirePermission(roles.PermUserManage, handlers.UserPasswordResetHandler))
+	mux.HandleFunc("/api/invitations", requirePermission(roles.PermUserManage, handlers.InvitationsHandler))
+
+	// Audit log
+	mux.HandleFunc("/api/audit", requirePermission(roles.PermAuditView, handlers.AuditHandler))
+
+	// Session management API - the current user's own sessions
+	mux.HandleFunc("/api/sessions", handlers.SessionsHandler)
 
-	// User Management API - Admin only
-	mux.HandleFunc("/api/users", adminMiddleware(handlers.UsersHandler))
+	// Profile, preferences and password of the logged in user
+	mux.HandleFunc("/api/me", handlers.MeHandler)
+	mux.HandleFunc("/api/me/password", handlers.MePasswordHandler)
 
-	// Version history API - Editor or Admin
-	mux.HandleFunc("/api/versions/", editorMiddleware(func(w http.ResponseWriter, r *http.Request) {
+	// Personal access token API - the current user's own tokens
+	mux.HandleFunc("/api/tokens", handlers.TokensHandler)
+
+	// Version history API - page.edit permission
+	mux.HandleFunc("/api/versions/", requirePermission(roles.PermPageEdit, func(w http.ResponseWriter, r *http.Request) {
 		handlers.VersionsHandler(w, r, cfg)
 	}))
 
-	// Document move/rename API - Editor or Admin
-	mux.HandleFunc("/api/document/move", editorMiddleware(func(w http.ResponseWriter, r *http.Request) {
+	// Document move/rename API - page.edit permission
+	mux.HandleFunc("/api/document/move", requirePermission(roles.PermPageEdit, func(w http.ResponseWriter, r *http.Request) {
 		handlers.MoveDocumentHandler(w, r, cfg)
 	}))
 
@@ -365,12 +313,17 @@ func SetupRoutes(cfg *config.Config) {
 		w.Write(data)
 	})
 
+	// EPUB export API - a document and its children as an e-book
+	mux.HandleFunc("/api/export/epub/", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ExportEPUBHandler(w, r, cfg)
+	})
+
 	// Documents list API - for document linking
 	mux.HandleFunc("/api/documents/list", func(w http.ResponseWriter, r *http.Request) {
 		handlers.ListDocumentsHandler(w, r, cfg)
 	})
 
-	// Import API - Admin only
+	// Import API - content.import permission
 	mux.HandleFunc("/api/import", func(w http.ResponseWriter, r *http.Request) {
 		handlers.ImportHandler(w, r, cfg)
 	})
@@ -388,14 +341,19 @@ func SetupRoutes(cfg *config.Config) {
 		handlers.SitemapHandler(w, r, cfg)
 	})
 
+	// Content Security Policy violation reports sent by browsers
+	mux.HandleFunc(csp.ReportPath, handlers.CSPReportHandler)
+
 	// Utility API endpoints
 	mux.HandleFunc("/api/utils/slugify", handlers.SlugifyHandler)
 
-	// Links Metadata API - Editor or Admin only
-	mux.HandleFunc("/api/links/fetch-metadata", editorMiddleware(handlers.FetchMetadataHandler))
+	// Links Metadata API - page.edit permission
+	mux.HandleFunc("/api/links/fetch-metadata", requirePermission(roles.PermPageEdit, handlers.FetchMetadataHandler))
 
-	// Login page
+	// Login, registration and password reset pages
 	mux.HandleFunc("/login", handlers.LoginPageHandler)
+	mux.HandleFunc("/register", handlers.RegisterPageHandler)
+	mux.HandleFunc("/reset-password", handlers.PasswordResetPageHandler)
 
 	// Home page and other pages
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -423,7 +381,7 @@ func SetupRoutes(cfg *config.Config) {
 	})
 
 	// Apply middleware to all routes
-	handler := CSPMiddleware(mux)
+	handler := CSPMiddleware(cfg, CSRFMiddleware(cfg, RateLimitMiddleware(cfg, mux)))
 
 	// Set the handler for the default ServeMux
 	http.Handle("/", handler)
@@ -0,0 +1,123 @@
+// Package ssrf makes HTTP clients for fetching URLs that users supply, without letting them reach
+// the server itself or its network: loopback, private, link-local and other special addresses are
+// refused unless they are allowlisted.
+package ssrf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrBlocked is returned for URLs whose host is, or resolves to, a refused address
+var ErrBlocked = errors.New("address is not allowed")
+
+// blockedNets are special ranges that the methods of net.IP don't cover
+var blockedNets = mustParseCIDRs(
+	"0.0.0.0/8",      // "This" network
+	"100.64.0.0/10",  // Carrier-grade NAT
+	"192.0.0.0/24",   // IETF protocol assignments
+	"198.18.0.0/15",  // Benchmarking
+	"240.0.0.0/4",    // Reserved, including broadcast
+	"64:ff9b::/96",   // NAT64, which maps to IPv4 addresses
+	"64:ff9b:1::/48", // Local-use NAT64
+	"2001:db8::/32",  // Documentation
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// Blocked reports whether ip may not be fetched from. Addresses within allow are always permitted.
+func Blocked(ip net.IP, allow []*net.IPNet) bool {
+	for _, n := range allow {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, n := range blockedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckHost resolves host and returns ErrBlocked when any of its addresses is refused. It gives an
+// early, clear error; the client still checks the address of every connection it opens, since DNS
+// answers can change between the two.
+func CheckHost(ctx context.Context, host string, allow []*net.IPNet) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if Blocked(ip, allow) {
+			return fmt.Errorf("%w: %s", ErrBlocked, host)
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if Blocked(addr.IP, allow) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrBlocked, host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// NewClient returns a client that only connects to permitted addresses and follows at most
+// maxRedirects redirects, each of which must be http or https and pass CheckHost again.
+// It ignores proxy environment variables, which would hide the address of the target.
+func NewClient(timeout time.Duration, maxRedirects int, allow []*net.IPNet) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		// Control runs with the resolved address, right before each connection is made
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || Blocked(ip, allow) {
+				return fmt.Errorf("%w: %s", ErrBlocked, host)
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			DisableKeepAlives:   true, // Clients are made per fetch, idle connections would pile up
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return CheckHost(req.Context(), req.URL.Hostname(), allow)
+		},
+	}
+}
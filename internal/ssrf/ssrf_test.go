@@ -0,0 +1,85 @@
+package ssrf
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBlocked(t *testing.T) {
+	_, lan, _ := net.ParseCIDR("192.168.10.0/24")
+	allow := []*net.IPNet{lan}
+
+	tests := []struct {
+		ip       string
+		expected bool
+	}{
+		{ip: "93.184.216.34", expected: false},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946", expected: false},
+		{ip: "127.0.0.1", expected: true},
+		{ip: "127.1.2.3", expected: true},
+		{ip: "::1", expected: true},
+		{ip: "0.0.0.0", expected: true},
+		{ip: "::", expected: true},
+		{ip: "10.0.0.1", expected: true},
+		{ip: "172.16.5.4", expected: true},
+		{ip: "192.168.1.1", expected: true},
+		{ip: "fd00::1", expected: true},
+		{ip: "169.254.169.254", expected: true}, // Cloud metadata
+		{ip: "fe80::1", expected: true},
+		{ip: "100.64.0.1", expected: true},
+		{ip: "198.18.0.1", expected: true},
+		{ip: "224.0.0.1", expected: true},
+		{ip: "255.255.255.255", expected: true},
+		{ip: "::ffff:127.0.0.1", expected: true}, // IPv4-mapped loopback
+		{ip: "::ffff:10.0.0.1", expected: true},
+		{ip: "64:ff9b::7f00:1", expected: true}, // NAT64 of 127.0.0.1
+		{ip: "192.168.10.20", expected: false},  // Allowlisted
+		{ip: "192.168.11.20", expected: true},   // Next to the allowlist
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			ip := net.ParseIP(tt.ip)
+			if ip == nil {
+				t.Fatalf("Invalid test address %q", tt.ip)
+			}
+			if result := Blocked(ip, allow); result != tt.expected {
+				t.Errorf("Expected: %t, got: %t", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestCheckHostLiteral(t *testing.T) {
+	if err := CheckHost(context.Background(), "127.0.0.1", nil); !errors.Is(err, ErrBlocked) {
+		t.Errorf("Expected ErrBlocked for a loopback address, got: %v", err)
+	}
+	if err := CheckHost(context.Background(), "93.184.216.34", nil); err != nil {
+		t.Errorf("Expected a public address to pass, got: %v", err)
+	}
+}
+
+func TestClientRefusesLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// The test server listens on loopback, which only the allowlist lets through
+	if _, err := NewClient(5*time.Second, 3, nil).Get(server.URL); !errors.Is(err, ErrBlocked) {
+		t.Errorf("Expected ErrBlocked, got: %v", err)
+	}
+
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	_, loopback6, _ := net.ParseCIDR("::1/128")
+	resp, err := NewClient(5*time.Second, 3, []*net.IPNet{loopback, loopback6}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected an allowlisted address to work, got: %v", err)
+	}
+	resp.Body.Close()
+}
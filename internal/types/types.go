@@ -41,7 +41,10 @@ type PageData struct {
 	Comments           []comments.Comment // Comments for the document
 	CommentsAllowed    bool               // Whether comments are allowed for this document
 	IsAuthenticated    bool               // Whether the user is authenticated
-	UserRole           string             // User role: "admin", "editor", or "viewer"
+	UserRole           string             // Built-in role whose controls to show: "admin", "editor", or "viewer"
+	Permissions        map[string]bool    // What the user may do on this page, by permission
 	DocPath            string             // Document path for API calls
 	DocumentLayout     string             // Document layout type from frontmatter (e.g., "kanban")
+	StaticExport       bool               // Whether the page is rendered for a static site export
+	CSPNonce           string             // Nonce that lets the inline scripts of this response run
 }
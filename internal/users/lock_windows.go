@@ -0,0 +1,39 @@
+//go:build windows
+
+package users
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+// lockfileExclusiveLock is LOCKFILE_EXCLUSIVE_LOCK from the Windows API
+const lockfileExclusiveLock = 0x2
+
+// lockFile takes an exclusive lock on the file at path, creating it if needed, and returns
+// the function that releases it
+func lockFile(path string) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	overlapped := new(syscall.Overlapped)
+	handle := file.Fd()
+	r, _, err := procLockFileEx.Call(handle, lockfileExclusiveLock, 0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+	if r == 0 {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		procUnlockFileEx.Call(handle, 0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+		file.Close()
+	}, nil
+}
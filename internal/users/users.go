@@ -0,0 +1,312 @@
+// Package users stores the wiki's accounts in a YAML file of their own. Every change rereads
+// the file and writes it back atomically while holding a lock on it, so that edits made by hand
+// or by another process in between are not lost.
+package users
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"wiki-go/internal/crypto"
+	"wiki-go/internal/roles"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FilePath defines the global path to the user store
+const FilePath = "data/users.yaml"
+
+// Sources of users that log in with an external identity provider
+const (
+	SourceOIDC = "oidc" // Single sign-on with OpenID Connect
+	SourceLDAP = "ldap" // LDAP or Active Directory bind
+)
+
+// User is an account of the wiki
+type User struct {
+	Username    string    `yaml:"username"`
+	Password    string    `yaml:"password"`               // bcrypt hash
+	Role        string    `yaml:"role"`                   // A built-in or custom role
+	Source      string    `yaml:"source,omitempty"`       // Where the account comes from: empty for local users, or one of the Source constants
+	Subject     string    `yaml:"subject,omitempty"`      // Unchangeable identifier at the identity provider, the sub claim for single sign-on
+	DisplayName string    `yaml:"display_name,omitempty"` // Name shown instead of the username
+	Email       string    `yaml:"email,omitempty"`        // Contact address
+	Created     time.Time `yaml:"created,omitempty"`      // Zero for accounts older than the store
+	LastLogin   time.Time `yaml:"last_login,omitempty"`   // Zero until the first login
+	Disabled    bool      `yaml:"disabled,omitempty"`     // Disabled users can't log in
+	Pending     bool      `yaml:"pending,omitempty"`      // Self-registered users can't log in until an admin approves them
+	Language    string    `yaml:"language,omitempty"`     // Preferred interface language, empty for the wiki's default
+	Theme       string    `yaml:"theme,omitempty"`        // Preferred theme, "light" or "dark", empty to follow the system
+}
+
+// Name returns the display name of the user, or the username when none is set
+func (u User) Name() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.Username
+}
+
+// storeFile is the layout of the users file
+type storeFile struct {
+	Users []User `yaml:"users"`
+}
+
+// Errors returned by the store
+var (
+	ErrNotFound = errors.New("user not found")
+	ErrExists   = errors.New("username already exists")
+)
+
+var (
+	mu      sync.RWMutex
+	path    string
+	users   []User
+	modTime time.Time
+	size    int64
+
+	// writeMu keeps changes from this process in order; the file lock keeps out other processes
+	writeMu sync.Mutex
+)
+
+// Init opens the user store at storePath. A store that doesn't exist yet is created with the
+// default admin account.
+func Init(storePath string) error {
+	mu.Lock()
+	path = storePath
+	users = nil
+	modTime = time.Time{}
+	mu.Unlock()
+
+	if _, err := os.Stat(storePath); errors.Is(err, os.ErrNotExist) {
+		hashedPassword, err := crypto.HashPassword("admin")
+		if err != nil {
+			return err
+		}
+		err = Import(storePath, []User{{
+			Username: "admin",
+			Password: hashedPassword,
+			Role:     roles.RoleAdmin,
+			Created:  time.Now().UTC(),
+		}})
+		if err != nil {
+			return err
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return reload()
+}
+
+// readFile parses the users file
+func readFile(file string) ([]User, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var parsed storeFile
+	if err := yaml.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	return parsed.Users, nil
+}
+
+// reload rereads the file if it changed since it was last read. The caller holds mu.
+func reload() error {
+	if path == "" {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if users != nil && info.ModTime().Equal(modTime) && info.Size() == size {
+		return nil
+	}
+
+	loaded, err := readFile(path)
+	if err != nil {
+		return err
+	}
+	if loaded == nil {
+		loaded = []User{}
+	}
+	users, modTime, size = loaded, info.ModTime(), info.Size()
+	return nil
+}
+
+// current returns the users, rereading the file if it changed
+func current() []User {
+	mu.RLock()
+	info, err := os.Stat(path)
+	fresh := users != nil && err == nil && info.ModTime().Equal(modTime) && info.Size() == size
+	list := users
+	mu.RUnlock()
+	if fresh || path == "" {
+		return list
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err := reload(); err != nil {
+		// Keep serving the last good copy rather than locking everyone out
+		log.Printf("Warning: failed to read users: %v", err)
+	}
+	return users
+}
+
+// writeFile writes users to file atomically
+func writeFile(file string, list []User) error {
+	data, err := yaml.Marshal(storeFile{Users: list})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0600)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	return err
+}
+
+// modify applies change to the users on disk under the file lock and writes them back
+func modify(change func([]User) ([]User, error)) error {
+	writeMu.Lock()
+	defer writeMu.Unlock()
+
+	mu.RLock()
+	file := path
+	mu.RUnlock()
+	if file == "" {
+		return errors.New("user store is not initialised")
+	}
+
+	unlock, err := lockFile(file + ".lock")
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", file, err)
+	}
+	defer unlock()
+
+	list, err := readFile(file)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	list, err = change(list)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(file, list); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	users = nil
+	return reload()
+}
+
+// Import writes a complete list of users to a store, replacing what it held. It is used to
+// create and migrate stores before Init.
+func Import(file string, list []User) error {
+	writeMu.Lock()
+	defer writeMu.Unlock()
+
+	unlock, err := lockFile(file + ".lock")
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", file, err)
+	}
+	defer unlock()
+	return writeFile(file, list)
+}
+
+// List returns all users sorted by username
+func List() []User {
+	list := append([]User(nil), current()...)
+	sort.Slice(list, func(i, j int) bool { return list[i].Username < list[j].Username })
+	return list
+}
+
+// Get returns the user with the given username
+func Get(username string) (User, bool) {
+	for _, user := range current() {
+		if user.Username == username {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+// Create adds a user. Created is set to now when left empty.
+func Create(user User) error {
+	if user.Created.IsZero() {
+		user.Created = time.Now().UTC()
+	}
+	return modify(func(list []User) ([]User, error) {
+		for _, existing := range list {
+			if existing.Username == user.Username {
+				return nil, ErrExists
+			}
+		}
+		return append(list, user), nil
+	})
+}
+
+// Update changes a user. The username can't be changed.
+func Update(username string, change func(*User) error) error {
+	return modify(func(list []User) ([]User, error) {
+		for i := range list {
+			if list[i].Username != username {
+				continue
+			}
+			if err := change(&list[i]); err != nil {
+				return nil, err
+			}
+			list[i].Username = username
+			return list, nil
+		}
+		return nil, ErrNotFound
+	})
+}
+
+// Delete removes a user
+func Delete(username string) error {
+	return modify(func(list []User) ([]User, error) {
+		for i, user := range list {
+			if user.Username == username {
+				return append(list[:i], list[i+1:]...), nil
+			}
+		}
+		return nil, ErrNotFound
+	})
+}
+
+// RecordLogin sets the last login time of a user to now
+func RecordLogin(username string) error {
+	return Update(username, func(user *User) error {
+		user.LastLogin = time.Now().UTC()
+		return nil
+	})
+}
@@ -0,0 +1,210 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	"wiki-go/internal/roles"
+)
+
+// setupStore opens a new store in a temporary directory and returns its path
+func setupStore(t *testing.T) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "users.yaml")
+	if err := Init(file); err != nil {
+		t.Fatalf("Failed to open the user store: %v", err)
+	}
+	return file
+}
+
+func TestInitCreatesAdmin(t *testing.T) {
+	file := setupStore(t)
+
+	admin, found := Get("admin")
+	if !found || admin.Role != roles.RoleAdmin {
+		t.Fatalf("Expected a default admin account, got: %+v", admin)
+	}
+	if admin.Password == "" || admin.Password == "admin" {
+		t.Error("Expected the default password to be stored hashed")
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatalf("Expected the store to exist: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("Expected mode 0600, got: %o", mode)
+	}
+}
+
+func TestCreateUpdateDelete(t *testing.T) {
+	setupStore(t)
+
+	if err := Create(User{Username: "jane", Role: roles.RoleEditor}); err != nil {
+		t.Fatalf("Failed to create jane: %v", err)
+	}
+	if err := Create(User{Username: "jane", Role: roles.RoleViewer}); !errors.Is(err, ErrExists) {
+		t.Errorf("Expected ErrExists for a second jane, got: %v", err)
+	}
+	jane, _ := Get("jane")
+	if jane.Created.IsZero() {
+		t.Error("Expected the creation time to be set")
+	}
+
+	err := Update("jane", func(user *User) error {
+		user.Role = roles.RoleViewer
+		user.Username = "joe" // Ignored, usernames can't change
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to update jane: %v", err)
+	}
+	if jane, found := Get("jane"); !found || jane.Role != roles.RoleViewer {
+		t.Errorf("Expected jane to be a viewer, got: %+v", jane)
+	}
+	if _, found := Get("joe"); found {
+		t.Error("Expected the username to stay the same")
+	}
+
+	failed := errors.New("refused")
+	if err := Update("jane", func(user *User) error {
+		user.Role = roles.RoleAdmin
+		return failed
+	}); !errors.Is(err, failed) {
+		t.Errorf("Expected the change's error, got: %v", err)
+	}
+	if jane, _ := Get("jane"); jane.Role != roles.RoleViewer {
+		t.Errorf("Expected a failed change not to be saved, got role: %s", jane.Role)
+	}
+	if err := Update("nobody", func(*User) error { return nil }); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got: %v", err)
+	}
+
+	if err := Delete("jane"); err != nil {
+		t.Fatalf("Failed to delete jane: %v", err)
+	}
+	if _, found := Get("jane"); found {
+		t.Error("Expected jane to be gone")
+	}
+	if err := Delete("jane"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got: %v", err)
+	}
+}
+
+func TestListSorted(t *testing.T) {
+	setupStore(t)
+	for _, name := range []string{"zoe", "bob", "mia"} {
+		if err := Create(User{Username: name, Role: roles.RoleViewer}); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	var names []string
+	for _, user := range List() {
+		names = append(names, user.Username)
+	}
+	if fmt.Sprint(names) != "[admin bob mia zoe]" {
+		t.Errorf("Expected users sorted by name, got: %v", names)
+	}
+}
+
+func TestReloadAfterOutsideChange(t *testing.T) {
+	file := setupStore(t)
+	if _, found := Get("admin"); !found {
+		t.Fatal("Expected the default admin")
+	}
+
+	// Another process or a hand edit replaces the file
+	edited := "users:\n  - username: root\n    role: admin\n  - username: jane\n    role: editor\n"
+	if err := os.WriteFile(file, []byte(edited), 0600); err != nil {
+		t.Fatalf("Failed to edit the store: %v", err)
+	}
+	if _, found := Get("jane"); !found {
+		t.Fatal("Expected the edited file to be read again")
+	}
+	if _, found := Get("admin"); found {
+		t.Error("Expected the removed admin to be gone")
+	}
+
+	// Changes start from the file on disk, so the edit is kept
+	if err := Create(User{Username: "bob", Role: roles.RoleViewer}); err != nil {
+		t.Fatalf("Failed to create bob: %v", err)
+	}
+	for _, name := range []string{"root", "jane", "bob"} {
+		if _, found := Get(name); !found {
+			t.Errorf("Expected %s in the store", name)
+		}
+	}
+}
+
+func TestConcurrentCreates(t *testing.T) {
+	setupStore(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := Create(User{Username: fmt.Sprintf("user%02d", i), Role: roles.RoleViewer}); err != nil {
+				t.Errorf("Failed to create user%02d: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if count := len(List()); count != 21 {
+		t.Errorf("Expected 21 users, got: %d", count)
+	}
+}
+
+func TestChangesWaitForFileLock(t *testing.T) {
+	file := setupStore(t)
+
+	// Hold the lock like another process in the middle of a change would
+	unlock, err := lockFile(file + ".lock")
+	if err != nil {
+		t.Fatalf("Failed to take the lock: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- Create(User{Username: "jane", Role: roles.RoleViewer}) }()
+
+	select {
+	case err := <-done:
+		unlock()
+		t.Fatalf("Expected the change to wait for the lock, it finished with: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Failed to create jane: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the change to go through once the lock was released")
+	}
+	if _, found := Get("jane"); !found {
+		t.Error("Expected jane in the store")
+	}
+}
+
+func TestChangesBeforeInit(t *testing.T) {
+	mu.Lock()
+	saved := path
+	path = ""
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		path = saved
+		mu.Unlock()
+	}()
+
+	if err := Create(User{Username: "jane"}); err == nil {
+		t.Error("Expected changes to fail before the store is opened")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/extension"
 	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
 	"github.com/yuin/goldmark/renderer/html"
 )
 
@@ -46,6 +47,17 @@ func RenderMarkdown(md string) []byte {
 
 // RenderMarkdownWithPath converts markdown text to HTML with the current document path
 func RenderMarkdownWithPath(md string, docPath string) []byte {
+	return renderMarkdown(md, docPath, false)
+}
+
+// RenderMarkdownXHTML converts markdown text to XHTML with the current document path.
+// It is used where well-formed markup is required, such as EPUB exports.
+func RenderMarkdownXHTML(md string, docPath string) []byte {
+	return renderMarkdown(md, docPath, true)
+}
+
+// renderMarkdown converts markdown text to HTML, or to XHTML when xhtml is true
+func renderMarkdown(md string, docPath string, xhtml bool) []byte {
 	// Check for frontmatter
 	metadata, contentWithoutFrontmatter, hasFrontmatter := frontmatter.Parse(md)
 
@@ -98,6 +110,15 @@ func RenderMarkdownWithPath(md string, docPath string) []byte {
 	// Apply any custom extensions via pre-processing
 	md = goldext.ProcessMarkdown(md, docPath)
 
+	// Renderer options
+	rendererOptions := []renderer.Option{
+		html.WithUnsafe(), // Allow raw HTML in the markdown
+		html.WithHardWraps(),
+	}
+	if xhtml {
+		rendererOptions = append(rendererOptions, html.WithXHTML())
+	}
+
 	// Configure Goldmark with all needed extensions
 	markdown := goldmark.New(
 		// Enable common extensions
@@ -116,11 +137,7 @@ func RenderMarkdownWithPath(md string, docPath string) []byte {
 			parser.WithAutoHeadingID(), // Enable auto heading IDs
 			parser.WithAttribute(),     // Enable attributes
 		),
-		// Renderer options
-		goldmark.WithRendererOptions(
-			html.WithUnsafe(), // Allow raw HTML in the markdown
-			html.WithHardWraps(),
-		),
+		goldmark.WithRendererOptions(rendererOptions...),
 	)
 
 	// Create a buffer to store the rendered HTML
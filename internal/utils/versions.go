@@ -6,8 +6,30 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 )
 
+// SaveVersion stores content as a version of the document at relativePath (for example
+// "documents/guide" or "pages/home") and removes old versions beyond maxVersions
+func SaveVersion(rootDir string, relativePath string, content []byte, timestamp time.Time, maxVersions int) error {
+	// Create versions directory path that mirrors the document path
+	versionDir := filepath.Join(rootDir, "versions", relativePath)
+	if err := os.MkdirAll(versionDir, 0755); err != nil {
+		return err
+	}
+
+	// Create version file path with timestamp (yyyymmddhhmmss)
+	versionPath := filepath.Join(versionDir, timestamp.Format("20060102150405")+".md")
+	if err := os.WriteFile(versionPath, content, 0644); err != nil {
+		return err
+	}
+	log.Printf("Created version: %s", versionPath)
+
+	// Clean up old versions if needed
+	CleanupOldVersions(versionDir, maxVersions)
+	return nil
+}
+
 // CleanupOldVersions removes old versions if the number of versions exceeds maxVersions
 func CleanupOldVersions(versionDir string, maxVersions int) {
 	// If maxVersions is 0 or negative, keep all versions
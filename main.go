@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,23 +11,37 @@ import (
 	"wiki-go/internal/migration"
 	"wiki-go/internal/routes"
 	"wiki-go/internal/static"
+	"wiki-go/internal/users"
 
 	// Import goldext package for its initialization side effects
 	_ "wiki-go/internal/goldext"
 )
 
 func main() {
+	exportStatic := flag.String("export-static", "", "Render the wiki into a static HTML site in the given directory and exit")
+	flag.Parse()
+
 	// Migrate user roles from old IsAdmin to new role-based system
 	if err := migration.MigrateUserRoles(config.ConfigFilePath); err != nil {
 		log.Fatal("Error migrating user roles:", err)
 	}
 
+	// Move users from the config file into their own store
+	if err := migration.MigrateUsersToStore(config.ConfigFilePath, users.FilePath); err != nil {
+		log.Fatal("Error migrating users:", err)
+	}
+
 	// Load configuration (after migration)
 	cfg, err := config.LoadConfig(config.ConfigFilePath)
 	if err != nil {
 		log.Fatal("Error loading config:", err)
 	}
 
+	// Open the user store, creating the default admin on first run
+	if err := users.Init(users.FilePath); err != nil {
+		log.Fatal("Error loading users:", err)
+	}
+
 	// Ensure the homepage exists
 	if err := handlers.EnsureHomepageExists(cfg); err != nil {
 		log.Fatal("Error creating homepage:", err)
@@ -40,6 +55,14 @@ func main() {
 	// Update handlers with config
 	handlers.InitHandlers(cfg)
 
+	// Export a static snapshot of the wiki instead of starting the server
+	if *exportStatic != "" {
+		if err := handlers.ExportStaticSite(cfg, *exportStatic); err != nil {
+			log.Fatal("Error exporting static site:", err)
+		}
+		return
+	}
+
 	// Setup all routes
 	routes.SetupRoutes(cfg)
 